@@ -1,8 +1,11 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"telegram-bot/internal/bot"
 	config "telegram-bot/internal/configuration"
@@ -11,6 +14,9 @@ import (
 )
 
 // flag: --config <path_of_config>
+// subcommand: migrate [-dry-run] up|down|status
+// subcommand: backup [-force] create|list|verify|restore
+// subcommand: rekey
 func main() {
 	/*---------------------------logger---------------------------*/
 	l := logger.GetInstance()
@@ -26,6 +32,30 @@ func main() {
 		l.Fatalf("failed to open config: %s", err)
 	}
 
+	/*--------------------------migrate---------------------------*/
+	if flag.Arg(0) == "migrate" {
+		if err := server.Migrate(cfg, flag.Args()[1:], os.Stdout); err != nil {
+			l.Fatalf("failed to migrate: %s", err)
+		}
+		return
+	}
+
+	/*---------------------------backup---------------------------*/
+	if flag.Arg(0) == "backup" {
+		if err := server.Backup(cfg, flag.Args()[1:], os.Stdout); err != nil {
+			l.Fatalf("failed to backup: %s", err)
+		}
+		return
+	}
+
+	/*---------------------------rekey----------------------------*/
+	if flag.Arg(0) == "rekey" {
+		if err := server.Rekey(cfg, flag.Args()[1:], os.Stdout); err != nil {
+			l.Fatalf("failed to rekey: %s", err)
+		}
+		return
+	}
+
 	botChan := make(chan *bot.Bot)
 
 	/*----------------------------bot-----------------------------*/
@@ -43,7 +73,10 @@ func main() {
 	s := server.New(cfg)
 
 	/*---------------------------start----------------------------*/
-	if err := s.Start(botChan); err != nil {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	if err := s.Start(ctx, botChan); err != nil {
 		l.Fatalf("failed to start server: %s", err)
 	}
 }
@@ -5,6 +5,8 @@ box.cfg {
                     'replicator:' .. os.getenv("TARANTOOL_PASSWORD") .. '@localhost:3302' }, -- replica URI
     read_only = false,
 }
+-- Initial schema only: later changes are versioned migrations in
+-- internal/migrations, applied by the bot on the master (`main migrate up`).
 box.once("schema", function()
     box.schema.user.create('replicator', { password = os.getenv("TARANTOOL_PASSWORD") })
     box.schema.user.grant('replicator', 'read,write,execute', 'universe', nil)
@@ -5,6 +5,8 @@ box.cfg {
                     'replicator:' .. os.getenv("TARANTOOL_PASSWORD") .. '@tarantool-replica:3301' }, -- replica URI
     read_only = false,
 }
+-- Initial schema only: later changes are versioned migrations in
+-- internal/migrations, applied by the bot on the master (`main migrate up`).
 box.once("schema", function()
     local secret = os.getenv("TARANTOOL_PASSWORD")
 
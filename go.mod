@@ -8,6 +8,9 @@ require (
 	github.com/labstack/gommon v0.4.0
 	github.com/sirupsen/logrus v1.9.0
 	github.com/tarantool/go-tarantool v1.10.0
+	go.etcd.io/bbolt v1.3.7
+	golang.org/x/crypto v0.6.0
+	gopkg.in/vmihailenco/msgpack.v2 v2.9.2
 	gopkg.in/yaml.v3 v3.0.1
 )
 
@@ -23,11 +26,9 @@ require (
 	github.com/valyala/fasttemplate v1.2.2 // indirect
 	github.com/vmihailenco/msgpack/v5 v5.3.5 // indirect
 	github.com/vmihailenco/tagparser/v2 v2.0.0 // indirect
-	golang.org/x/crypto v0.6.0 // indirect
 	golang.org/x/net v0.7.0 // indirect
 	golang.org/x/sys v0.5.0 // indirect
 	golang.org/x/text v0.7.0 // indirect
 	golang.org/x/time v0.3.0 // indirect
 	google.golang.org/appengine v1.6.7 // indirect
-	gopkg.in/vmihailenco/msgpack.v2 v2.9.2 // indirect
 )
@@ -0,0 +1,192 @@
+// Package backup makes encrypted snapshots of the whole storage, checks
+// them and restores them.
+//
+// A snapshot is a sealed stream (see pkg/sealed) of gzip compressed
+// msgpack records: a header, a record per user with its credentials, trash
+// and state, and a summary of what was written. Next to each snapshot a
+// ".sha256" file holds its SHA-256 in the format of sha256sum, so copies
+// can be checked without the passphrase.
+package backup
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"gopkg.in/vmihailenco/msgpack.v2"
+
+	passwdRepository "telegram-bot/internal/passwd/repository"
+	"telegram-bot/pkg/sealed"
+)
+
+const (
+	formatName    = "telegram-bot-passwd"
+	formatVersion = 1
+)
+
+var (
+	// ErrFormat is returned for files that aren't snapshots or whose
+	// records can't be read
+	ErrFormat = errors.New("not a snapshot")
+	// ErrPassphrase is returned when the snapshot can't be opened with the
+	// passphrase, either because it's wrong or the snapshot was changed
+	ErrPassphrase = sealed.ErrPassphrase
+	// ErrChecksum is returned when a snapshot doesn't match its checksum
+	// or its summary
+	ErrChecksum = errors.New("snapshot checksum mismatch")
+)
+
+type header struct {
+	Format  string `msgpack:"format"`
+	Version int    `msgpack:"version"`
+	// CreatedAt is a Unix time in milliseconds
+	CreatedAt int64 `msgpack:"created_at"`
+}
+
+// record is a user or, last, the summary.
+type record struct {
+	User    *passwdRepository.UserSnapshot `msgpack:"user,omitempty"`
+	Summary *Summary                       `msgpack:"summary,omitempty"`
+}
+
+// Summary counts what a snapshot holds.
+type Summary struct {
+	CreatedAt   time.Time `msgpack:"-"`
+	Users       int       `msgpack:"users"`
+	Credentials int       `msgpack:"credentials"`
+	Trash       int       `msgpack:"trash"`
+	States      int       `msgpack:"states"`
+}
+
+func (s *Summary) add(snapshot passwdRepository.UserSnapshot) {
+	s.Users++
+	s.Credentials += len(snapshot.Credentials)
+	s.Trash += len(snapshot.Trash)
+	if snapshot.State != nil {
+		s.States++
+	}
+}
+
+// counts leaves out the creation time, which isn't part of the summary
+// record.
+func (s Summary) counts() Summary {
+	s.CreatedAt = time.Time{}
+	return s
+}
+
+func (s Summary) String() string {
+	return fmt.Sprintf("%d users, %d credentials, %d in the trash, %d states", s.Users, s.Credentials, s.Trash, s.States)
+}
+
+// Write writes a snapshot of storage to w sealed with the passphrase at
+// the cost.
+func Write(ctx context.Context, w io.Writer, storage passwdRepository.Snapshotter, passphrase string, cost sealed.Cost) (Summary, error) {
+	summary := Summary{CreatedAt: time.Now().UTC().Truncate(time.Millisecond)}
+
+	sw, err := sealed.NewWriter(w, passphrase, cost)
+	if err != nil {
+		return Summary{}, err
+	}
+
+	gz := gzip.NewWriter(sw)
+	enc := msgpack.NewEncoder(gz)
+
+	err = enc.Encode(header{Format: formatName, Version: formatVersion, CreatedAt: summary.CreatedAt.UnixMilli()})
+	if err != nil {
+		return Summary{}, err
+	}
+
+	err = storage.Dump(ctx, func(snapshot passwdRepository.UserSnapshot) error {
+		summary.add(snapshot)
+		return enc.Encode(record{User: &snapshot})
+	})
+	if err != nil {
+		return Summary{}, err
+	}
+
+	counts := summary.counts()
+	if err = enc.Encode(record{Summary: &counts}); err != nil {
+		return Summary{}, err
+	}
+
+	if err = gz.Close(); err != nil {
+		return Summary{}, err
+	}
+
+	if err = sw.Close(); err != nil {
+		return Summary{}, err
+	}
+
+	return summary, nil
+}
+
+// Read reads a snapshot sealed with the passphrase from r and calls fn
+// with each user until fn returns an error. The users read are checked
+// against the summary at the end.
+func Read(r io.Reader, passphrase string, fn func(passwdRepository.UserSnapshot) error) (Summary, error) {
+	sr, err := sealed.NewReader(r, passphrase)
+	if err != nil {
+		return Summary{}, err
+	}
+
+	gz, err := gzip.NewReader(sr)
+	if err != nil {
+		return Summary{}, formatError(err)
+	}
+	defer gz.Close()
+
+	dec := msgpack.NewDecoder(gz)
+
+	var h header
+	if err = dec.Decode(&h); err != nil {
+		return Summary{}, formatError(err)
+	}
+
+	if h.Format != formatName || h.Version != formatVersion {
+		return Summary{}, fmt.Errorf("%w: format %q version %d", ErrFormat, h.Format, h.Version)
+	}
+
+	read := Summary{CreatedAt: time.UnixMilli(h.CreatedAt).UTC()}
+
+	for {
+		var rec record
+		if err = dec.Decode(&rec); err != nil {
+			return Summary{}, formatError(err)
+		}
+
+		switch {
+		case rec.User != nil:
+			read.add(*rec.User)
+
+			if err = fn(*rec.User); err != nil {
+				return Summary{}, err
+			}
+		case rec.Summary != nil:
+			if *rec.Summary != read.counts() {
+				return Summary{}, fmt.Errorf("%w: read %s, the summary has %s", ErrChecksum, read, rec.Summary)
+			}
+
+			// The sealed stream checks nothing follows the summary
+			if _, err = io.Copy(io.Discard, gz); err != nil {
+				return Summary{}, formatError(err)
+			}
+
+			return read, nil
+		default:
+			return Summary{}, fmt.Errorf("%w: unknown record", ErrFormat)
+		}
+	}
+}
+
+// formatError reports damaged data as ErrFormat, errors of the sealed
+// stream as they are.
+func formatError(err error) error {
+	if errors.Is(err, sealed.ErrPassphrase) || errors.Is(err, sealed.ErrFormat) {
+		return err
+	}
+
+	return fmt.Errorf("%w: %s", ErrFormat, err)
+}
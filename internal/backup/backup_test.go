@@ -0,0 +1,281 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"telegram-bot/internal/models"
+	passwdRepository "telegram-bot/internal/passwd/repository"
+	"telegram-bot/pkg/sealed"
+)
+
+const testPassphrase = "correct horse battery staple"
+
+// testCost keeps the tests fast
+var testCost = sealed.Cost{LogN: 10, R: 8, P: 1}
+
+func mustNoErr(t *testing.T, err error) {
+	t.Helper()
+
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+}
+
+func testOpts(t *testing.T) Opts {
+	return Opts{Dir: t.TempDir(), Passphrase: testPassphrase, Cost: testCost}
+}
+
+// newTestStorage returns a storage with users that have credentials,
+// items in the trash and states, and one that has only a token.
+func newTestStorage(t *testing.T) *passwdRepository.Memory {
+	t.Helper()
+
+	ctx := context.Background()
+	storage := passwdRepository.NewMemory()
+
+	for userID := int64(1); userID <= 3; userID++ {
+		mustNoErr(t, storage.SetToken(ctx, userID, fmt.Sprintf("\xfftoken-%d", userID)))
+		mustNoErr(t, storage.SetSetting(ctx, userID, models.SettingGenerator, "length=20"))
+
+		for i := 0; i < 3; i++ {
+			mustNoErr(t, storage.SaveCredentials(ctx, models.Credentials{
+				UserID:       uint64(userID),
+				ServiceName:  fmt.Sprintf("service-%d", i),
+				Username:     "user",
+				PasswordHash: "\x00secret\xfe",
+				CreatedAt:    1700000000,
+				Details:      models.Details{URL: "https://example.com", Tags: []string{"work"}},
+			}))
+		}
+
+		mustNoErr(t, storage.Trash(ctx, userID, "service-0", "user", time.Unix(1700000100, 0)))
+		mustNoErr(t, storage.SetDraft(ctx, userID, "service-1", "user"))
+	}
+
+	mustNoErr(t, storage.SetToken(ctx, 4, "token-4"))
+
+	return storage
+}
+
+func dump(t *testing.T, storage passwdRepository.Snapshotter) []passwdRepository.UserSnapshot {
+	t.Helper()
+
+	var snapshots []passwdRepository.UserSnapshot
+	mustNoErr(t, storage.Dump(context.Background(), func(snapshot passwdRepository.UserSnapshot) error {
+		snapshots = append(snapshots, snapshot)
+		return nil
+	}))
+
+	return snapshots
+}
+
+func TestCreateVerifyRestore(t *testing.T) {
+	ctx := context.Background()
+	storage := newTestStorage(t)
+	opts := testOpts(t)
+
+	path, written, err := Create(ctx, storage, opts)
+	mustNoErr(t, err)
+
+	want := Summary{CreatedAt: written.CreatedAt, Users: 4, Credentials: 6, Trash: 3, States: 3}
+	if written != want {
+		t.Fatalf("expected %+v written, got %+v", want, written)
+	}
+
+	verified, err := Verify(ctx, path, testPassphrase)
+	mustNoErr(t, err)
+
+	if !verified.CreatedAt.Equal(written.CreatedAt) || verified.counts() != written.counts() {
+		t.Fatalf("expected %+v verified, got %+v", written, verified)
+	}
+
+	restoredInto := passwdRepository.NewMemory()
+
+	restored, err := Restore(ctx, path, testPassphrase, restoredInto)
+	mustNoErr(t, err)
+
+	if restored.counts() != written.counts() {
+		t.Fatalf("expected %s restored, got %s", written, restored)
+	}
+
+	if got, want := dump(t, restoredInto), dump(t, storage); !reflect.DeepEqual(got, want) {
+		t.Fatalf("restored storage differs:\nexpected %+v\ngot      %+v", want, got)
+	}
+
+	if _, err = Verify(ctx, path, "wrong passphrase"); !errors.Is(err, ErrPassphrase) {
+		t.Fatalf("expected ErrPassphrase, got %v", err)
+	}
+}
+
+func TestChecksumModified(t *testing.T) {
+	ctx := context.Background()
+
+	path, _, err := Create(ctx, newTestStorage(t), testOpts(t))
+	mustNoErr(t, err)
+
+	mustNoErr(t, checkChecksum(path))
+
+	data, err := os.ReadFile(path)
+	mustNoErr(t, err)
+
+	data[len(data)/2] ^= 1
+	mustNoErr(t, os.WriteFile(path, data, 0o600))
+
+	if err = checkChecksum(path); !errors.Is(err, ErrChecksum) {
+		t.Fatalf("expected ErrChecksum, got %v", err)
+	}
+
+	// The checksum is checked before the passphrase is needed
+	if _, err = Verify(ctx, path, testPassphrase); !errors.Is(err, ErrChecksum) {
+		t.Fatalf("expected ErrChecksum from Verify, got %v", err)
+	}
+
+	if _, err = Restore(ctx, path, testPassphrase, passwdRepository.NewMemory()); !errors.Is(err, ErrChecksum) {
+		t.Fatalf("expected ErrChecksum from Restore, got %v", err)
+	}
+}
+
+// duplicateDumper dumps each user of a storage twice.
+type duplicateDumper struct {
+	passwdRepository.Snapshotter
+}
+
+func (d duplicateDumper) Dump(ctx context.Context, fn func(passwdRepository.UserSnapshot) error) error {
+	return d.Snapshotter.Dump(ctx, func(snapshot passwdRepository.UserSnapshot) error {
+		if err := fn(snapshot); err != nil {
+			return err
+		}
+
+		return fn(snapshot)
+	})
+}
+
+func TestVerifySummary(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "passwd-duplicates"+fileExt)
+
+	// The records match the summary but restoring a user twice replaces it
+	var buf bytes.Buffer
+	_, err := Write(ctx, &buf, duplicateDumper{newTestStorage(t)}, testPassphrase, testCost)
+	mustNoErr(t, err)
+
+	mustNoErr(t, os.WriteFile(path, buf.Bytes(), 0o600))
+
+	sum, err := fileSum(path)
+	mustNoErr(t, err)
+	mustNoErr(t, writeChecksum(path, sum))
+
+	_, err = Verify(ctx, path, testPassphrase)
+	if !errors.Is(err, ErrChecksum) || !strings.Contains(err.Error(), "restored 4 users") {
+		t.Fatalf("expected ErrChecksum for 4 users restored of 8, got %v", err)
+	}
+}
+
+func TestRotate(t *testing.T) {
+	dir := t.TempDir()
+	start := time.Date(2026, 10, 19, 3, 0, 0, 0, time.UTC)
+
+	var paths []string
+	for i := 0; i < 5; i++ {
+		path := filepath.Join(dir, filePrefix+start.Add(time.Duration(i)*time.Hour).Format(fileTimeLayout)+fileExt)
+		mustNoErr(t, os.WriteFile(path, []byte("snapshot"), 0o600))
+		mustNoErr(t, writeChecksum(path, []byte("sum")))
+		paths = append(paths, path)
+	}
+
+	other := filepath.Join(dir, "notes.txt")
+	mustNoErr(t, os.WriteFile(other, nil, 0o600))
+
+	mustNoErr(t, rotate(dir, 2))
+
+	kept, err := List(dir)
+	mustNoErr(t, err)
+
+	if want := []string{paths[4], paths[3]}; !reflect.DeepEqual(kept, want) {
+		t.Fatalf("expected %v kept, got %v", want, kept)
+	}
+
+	for _, path := range paths[:3] {
+		if _, err = os.Stat(path + checksumExt); !os.IsNotExist(err) {
+			t.Fatalf("expected the checksum of %s removed, got %v", path, err)
+		}
+	}
+
+	if _, err = os.Stat(other); err != nil {
+		t.Fatalf("expected other files kept: %v", err)
+	}
+
+	// 0 keeps all of them
+	mustNoErr(t, rotate(dir, 0))
+
+	if kept, err = List(dir); err != nil || len(kept) != 2 {
+		t.Fatalf("expected 2 snapshots, got %v, %v", kept, err)
+	}
+}
+
+func TestCreateKeep(t *testing.T) {
+	ctx := context.Background()
+	storage := newTestStorage(t)
+	opts := testOpts(t)
+	opts.Keep = 2
+
+	var created []string
+	for i := 0; i < 3; i++ {
+		path, _, err := Create(ctx, storage, opts)
+		mustNoErr(t, err)
+		created = append(created, path)
+
+		// Snapshot names have millisecond precision
+		time.Sleep(2 * time.Millisecond)
+	}
+
+	kept, err := List(opts.Dir)
+	mustNoErr(t, err)
+
+	if want := []string{created[2], created[1]}; !reflect.DeepEqual(kept, want) {
+		t.Fatalf("expected %v kept, got %v", want, kept)
+	}
+}
+
+func TestCommandRestoreForce(t *testing.T) {
+	ctx := context.Background()
+	opts := testOpts(t)
+
+	path, _, err := Create(ctx, newTestStorage(t), opts)
+	mustNoErr(t, err)
+
+	// A storage with a user of its own, which the snapshot doesn't have
+	storage := passwdRepository.NewMemory()
+	mustNoErr(t, storage.SetToken(ctx, 5, "token-5"))
+
+	var out bytes.Buffer
+	if err = Command(ctx, storage, opts, []string{"restore", path}, &out); !errors.Is(err, errNotEmpty) {
+		t.Fatalf("expected errNotEmpty, got %v", err)
+	}
+
+	if users := dump(t, storage); len(users) != 1 {
+		t.Fatalf("expected the storage left alone, got %d users", len(users))
+	}
+
+	mustNoErr(t, Command(ctx, storage, opts, []string{"-force", "restore", path}, &out))
+
+	if !strings.Contains(out.String(), "restored "+path+": 4 users") {
+		t.Fatalf("unexpected output %q", out.String())
+	}
+
+	if users := dump(t, storage); len(users) != 5 {
+		t.Fatalf("expected 4 users restored next to the other one, got %d users", len(users))
+	}
+
+	// An empty storage doesn't need -force
+	mustNoErr(t, Command(ctx, passwdRepository.NewMemory(), opts, []string{"restore", path}, &out))
+}
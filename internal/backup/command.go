@@ -0,0 +1,123 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+
+	passwdRepository "telegram-bot/internal/passwd/repository"
+)
+
+const usage = `usage: backup [-force] <command>
+
+commands:
+  create          write a snapshot of the storage to the backup directory
+  list            list snapshots in the backup directory, the newest first
+  verify <file>   check a snapshot and restore it into memory
+  restore <file>  restore a snapshot into the storage, users in the storage
+                  are replaced by those in the snapshot. Stop the bot first,
+                  its cache keeps the replaced users for a while.
+
+The passphrase of snapshots is read from BACKUP_PASSPHRASE.
+`
+
+// errNotEmpty keeps restore from replacing users by mistake
+var errNotEmpty = errors.New("the storage has users, restore with -force to replace them")
+
+// Command implements the "backup" subcommand of the bot binary.
+func Command(ctx context.Context, storage passwdRepository.Snapshotter, opts Opts, args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("backup", flag.ContinueOnError)
+	fs.SetOutput(out)
+	fs.Usage = func() { fmt.Fprint(out, usage) }
+	force := fs.Bool("force", false, "restore into a storage that has users")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	switch fs.Arg(0) {
+	case "create":
+		path, summary, err := Create(ctx, storage, opts)
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(out, "wrote %s: %s\n", path, summary)
+
+		return nil
+	case "list":
+		paths, err := List(opts.Dir)
+		if err != nil {
+			return err
+		}
+
+		for _, path := range paths {
+			status := "ok"
+			if err = checkChecksum(path); err != nil {
+				status = err.Error()
+			}
+			fmt.Fprintf(out, "%s  %s\n", path, status)
+		}
+
+		return nil
+	case "verify":
+		path, err := fileArg(fs)
+		if err != nil {
+			return err
+		}
+
+		summary, err := Verify(ctx, path, opts.Passphrase)
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(out, "verified %s created %s: %s\n", path, summary.CreatedAt.Format("2006-01-02 15:04:05 MST"), summary)
+
+		return nil
+	case "restore":
+		path, err := fileArg(fs)
+		if err != nil {
+			return err
+		}
+
+		if !*force {
+			if err = checkEmpty(ctx, storage); err != nil {
+				return err
+			}
+		}
+
+		// A damaged snapshot is found before anything is replaced
+		if _, err = Verify(ctx, path, opts.Passphrase); err != nil {
+			return err
+		}
+
+		summary, err := Restore(ctx, path, opts.Passphrase, storage)
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(out, "restored %s: %s\n", path, summary)
+
+		return nil
+	default:
+		fs.Usage()
+		return fmt.Errorf("unknown backup command %q", fs.Arg(0))
+	}
+}
+
+func fileArg(fs *flag.FlagSet) (string, error) {
+	if fs.Arg(1) == "" {
+		fs.Usage()
+		return "", fmt.Errorf("backup %s needs a snapshot file", fs.Arg(0))
+	}
+
+	return fs.Arg(1), nil
+}
+
+func checkEmpty(ctx context.Context, storage passwdRepository.Snapshotter) error {
+	return storage.Dump(ctx, func(passwdRepository.UserSnapshot) error {
+		return errNotEmpty
+	})
+}
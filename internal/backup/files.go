@@ -0,0 +1,252 @@
+package backup
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	passwdRepository "telegram-bot/internal/passwd/repository"
+	"telegram-bot/pkg/sealed"
+)
+
+const (
+	filePrefix     = "passwd-"
+	fileExt        = ".snapshot"
+	checksumExt    = ".sha256"
+	fileTimeLayout = "20060102T150405.000Z"
+)
+
+// Opts configure where snapshots are kept and how they are sealed.
+type Opts struct {
+	Dir        string
+	Passphrase string
+	// Keep is the number of snapshots kept, older ones are removed after
+	// a new one is verified. 0 keeps all of them.
+	Keep int
+	// Cost of deriving the key, sealed.DefaultCost when it's zero
+	Cost sealed.Cost
+}
+
+func (o Opts) cost() sealed.Cost {
+	if o.Cost == (sealed.Cost{}) {
+		return sealed.DefaultCost
+	}
+
+	return o.Cost
+}
+
+// Create writes a snapshot of storage to the directory, verifies it and
+// removes old snapshots. It returns the path of the snapshot. A snapshot
+// that fails verification is removed and old ones are kept.
+func Create(ctx context.Context, storage passwdRepository.Snapshotter, opts Opts) (string, Summary, error) {
+	if opts.Passphrase == "" {
+		return "", Summary{}, errors.New("empty backup passphrase")
+	}
+
+	if err := os.MkdirAll(opts.Dir, 0o700); err != nil {
+		return "", Summary{}, err
+	}
+
+	tmp, err := os.CreateTemp(opts.Dir, filePrefix+"*.tmp")
+	if err != nil {
+		return "", Summary{}, err
+	}
+	defer os.Remove(tmp.Name())
+
+	hash := sha256.New()
+
+	written, err := Write(ctx, io.MultiWriter(tmp, hash), storage, opts.Passphrase, opts.cost())
+	if err == nil {
+		err = tmp.Sync()
+	}
+
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		return "", Summary{}, err
+	}
+
+	// Linking fails rather than replacing a snapshot of the same time,
+	// which a failed verification would remove with this one
+	path := filepath.Join(opts.Dir, filePrefix+written.CreatedAt.Format(fileTimeLayout)+fileExt)
+	if err = os.Link(tmp.Name(), path); err != nil {
+		return "", Summary{}, err
+	}
+
+	if err = writeChecksum(path, hash.Sum(nil)); err != nil {
+		removeSnapshot(path)
+		return "", Summary{}, err
+	}
+
+	verified, err := Verify(ctx, path, opts.Passphrase)
+	if err == nil && verified.counts() != written.counts() {
+		err = fmt.Errorf("%w: wrote %s, verified %s", ErrChecksum, written, verified)
+	}
+
+	if err != nil {
+		removeSnapshot(path)
+		return "", Summary{}, fmt.Errorf("verify %s: %w", filepath.Base(path), err)
+	}
+
+	if err = rotate(opts.Dir, opts.Keep); err != nil {
+		return path, written, fmt.Errorf("remove old snapshots: %w", err)
+	}
+
+	return path, written, nil
+}
+
+// Verify checks the snapshot at path against its checksum file and
+// restores it into a Memory storage, which is dumped and compared with
+// the summary of the snapshot.
+func Verify(ctx context.Context, path, passphrase string) (Summary, error) {
+	memory := passwdRepository.NewMemory()
+
+	summary, err := read(ctx, path, passphrase, memory)
+	if err != nil {
+		return Summary{}, err
+	}
+
+	restored := Summary{CreatedAt: summary.CreatedAt}
+	err = memory.Dump(ctx, func(snapshot passwdRepository.UserSnapshot) error {
+		restored.add(snapshot)
+		return nil
+	})
+	if err != nil {
+		return Summary{}, err
+	}
+
+	if restored != summary {
+		return Summary{}, fmt.Errorf("%w: restored %s of %s", ErrChecksum, restored, summary)
+	}
+
+	return summary, nil
+}
+
+// Restore restores the snapshot at path into storage after checking it
+// against its checksum file. Users are restored one at a time, so a
+// failed restore leaves some of them restored.
+func Restore(ctx context.Context, path, passphrase string, storage passwdRepository.Snapshotter) (Summary, error) {
+	return read(ctx, path, passphrase, storage)
+}
+
+// read checks the checksum of the snapshot at path and restores its users
+// into storage.
+func read(ctx context.Context, path, passphrase string, storage passwdRepository.Snapshotter) (Summary, error) {
+	if err := checkChecksum(path); err != nil {
+		return Summary{}, err
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return Summary{}, err
+	}
+	defer file.Close()
+
+	return Read(file, passphrase, func(snapshot passwdRepository.UserSnapshot) error {
+		return storage.Restore(ctx, snapshot)
+	})
+}
+
+// writeChecksum writes the sum of the snapshot at path in the format of
+// sha256sum.
+func writeChecksum(path string, sum []byte) error {
+	line := hex.EncodeToString(sum) + "  " + filepath.Base(path) + "\n"
+	return os.WriteFile(path+checksumExt, []byte(line), 0o600)
+}
+
+func checkChecksum(path string) error {
+	data, err := os.ReadFile(path + checksumExt)
+	if err != nil {
+		return err
+	}
+
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 {
+		return fmt.Errorf("%w: empty checksum file", ErrChecksum)
+	}
+
+	sum, err := fileSum(path)
+	if err != nil {
+		return err
+	}
+
+	if !strings.EqualFold(fields[0], hex.EncodeToString(sum)) {
+		return fmt.Errorf("%w: %s", ErrChecksum, filepath.Base(path))
+	}
+
+	return nil
+}
+
+func fileSum(path string) ([]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err = io.Copy(hash, bufio.NewReader(file)); err != nil {
+		return nil, err
+	}
+
+	return hash.Sum(nil), nil
+}
+
+// List returns the paths of the snapshots in dir, the newest first.
+func List(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var paths []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.Type().IsRegular() && strings.HasPrefix(name, filePrefix) && strings.HasSuffix(name, fileExt) {
+			paths = append(paths, filepath.Join(dir, name))
+		}
+	}
+
+	// Names sort by the time they were created
+	sort.Sort(sort.Reverse(sort.StringSlice(paths)))
+
+	return paths, nil
+}
+
+// rotate removes all but the keep newest snapshots in dir.
+func rotate(dir string, keep int) error {
+	if keep <= 0 {
+		return nil
+	}
+
+	paths, err := List(dir)
+	if err != nil || len(paths) <= keep {
+		return err
+	}
+
+	for _, path := range paths[keep:] {
+		if err = removeSnapshot(path); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func removeSnapshot(path string) error {
+	if err := os.Remove(path + checksumExt); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return os.Remove(path)
+}
@@ -1,7 +1,13 @@
 package bot
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
 	"strconv"
 	"time"
 
@@ -20,9 +26,16 @@ type Bot struct {
 	token      string
 	EncryptKey string
 	AutoDelete int
-	logger     *logger.Logger
+	// StaleAge is the age after which /audit reports a password
+	StaleAge time.Duration
+	// TrashRetention is how long deleted items are kept, 0 if until purged
+	TrashRetention time.Duration
+	logger         *logger.Logger
 }
 
+// ErrFileTooLarge is returned for files sent to the bot larger than asked.
+var ErrFileTooLarge = errors.New("file is too large")
+
 func New(botToken, secretToken, encryptKey string, cfg *config.Config) (*Bot, error) {
 	// Get instance of logger
 	newLogger := logger.GetInstance()
@@ -61,11 +74,13 @@ func New(botToken, secretToken, encryptKey string, cfg *config.Config) (*Bot, er
 	go webhookSetup(bot, wh, params, cfg, newLogger)
 
 	return &Bot{
-		BotAPI:     bot,
-		logger:     logger.GetInstance(),
-		AutoDelete: cfg.Bot.AutoDelete,
-		EncryptKey: encryptKey,
-		token:      botToken,
+		BotAPI:         bot,
+		logger:         logger.GetInstance(),
+		AutoDelete:     cfg.Bot.AutoDelete,
+		StaleAge:       time.Duration(cfg.Bot.StaleAge) * 24 * time.Hour,
+		TrashRetention: time.Duration(cfg.Bot.TrashRetention) * 24 * time.Hour,
+		EncryptKey:     encryptKey,
+		token:          botToken,
 	}, nil
 }
 
@@ -115,16 +130,17 @@ func MenuKeyboard() tgbotapi.ReplyKeyboardMarkup {
 	)
 }
 
-func NiceTimerCredentials(chatID int64, messageID int, bot *Bot, serviceName, username, password string) {
+// NiceTimerCredentials counts down under the credentials text in markdown
+// and deletes the message once the auto delete timeout is over. The text
+// is made again every second, so one-time codes in it stay current.
+func NiceTimerCredentials(chatID int64, messageID int, bot *Bot, text func() string) {
 	timer := bot.AutoDelete
 
 	for i := 0; i < timer; i++ {
 		msg := tgbotapi.NewEditMessageText(
 			chatID,
 			messageID,
-			"Your new credentials for "+serviceName+":\n"+
-				"Username: `"+username+"`\n"+
-				"Password: `"+password+"`\n\n"+
+			text()+"\n"+
 				"This message will be deleted in "+strconv.Itoa(timer-i)+" seconds",
 		)
 		msg.ParseMode = "markdown"
@@ -137,3 +153,70 @@ func NiceTimerCredentials(chatID int64, messageID int, bot *Bot, serviceName, us
 	msg := tgbotapi.NewDeleteMessage(chatID, messageID)
 	bot.BotAPI.Send(msg)
 }
+
+// NiceTimerDocument counts down under the caption of a document and
+// deletes it once the auto delete timeout is over.
+func NiceTimerDocument(chatID int64, messageID int, bot *Bot, caption string) {
+	timer := bot.AutoDelete
+
+	for i := 0; i < timer; i++ {
+		msg := tgbotapi.NewEditMessageCaption(
+			chatID,
+			messageID,
+			caption+"\n"+
+				"This message will be deleted in "+strconv.Itoa(timer-i)+" seconds",
+		)
+
+		bot.BotAPI.Send(msg)
+
+		time.Sleep(time.Second)
+	}
+
+	msg := tgbotapi.NewDeleteMessage(chatID, messageID)
+	bot.BotAPI.Send(msg)
+}
+
+// DownloadFile returns the content of a file sent to the bot, files
+// larger than maxSize are refused.
+func (b *Bot) DownloadFile(ctx context.Context, fileID string, maxSize int64) ([]byte, error) {
+	file, err := b.BotAPI.GetFile(tgbotapi.FileConfig{FileID: fileID})
+	if err != nil {
+		return nil, err
+	}
+
+	if int64(file.FileSize) > maxSize {
+		return nil, ErrFileTooLarge
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, file.Link(b.token), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := b.BotAPI.Client.Do(req)
+	if err != nil {
+		// The URL has the bot token in it
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			return nil, fmt.Errorf("download file: %w", urlErr.Err)
+		}
+
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("download file: %s", resp.Status)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxSize+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if int64(len(data)) > maxSize {
+		return nil, ErrFileTooLarge
+	}
+
+	return data, nil
+}
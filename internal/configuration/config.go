@@ -10,12 +10,18 @@ import (
 const (
 	loggerDebug = true
 
-	botURL     = "https://example.com:8443"
-	botMaxConn = 40
-	botAutoDel = 20
+	botURL      = "https://example.com:8443"
+	botMaxConn  = 40
+	botAutoDel  = 20
+	botDraftTTL = 30
+	botStaleAge = 180
+	botHistory  = 5
+	botTrash    = 30
 
-	serverHost = "localhost"
-	serverPort = "8443"
+	serverHost            = "localhost"
+	serverPort            = "8443"
+	serverRequestTimeout  = 10
+	serverShutdownTimeout = 15
 
 	webhookRetryCount = 5
 	webhookRetrySleep = 2
@@ -27,6 +33,32 @@ const (
 	tarantoolTimeout       = 2
 	tarantoolReconnect     = 2
 	tarantoolMaxReconnects = 3
+	tarantoolMigrate       = true
+	tarantoolCheckInterval = 1
+	tarantoolMaxLag        = 1
+
+	storageDriver      = "tarantool"
+	boltPath           = "./data/passwd.db"
+	boltTimeout        = 1
+	boltBackupPath     = ""
+	boltBackupInterval = 0
+
+	resilienceRetries   = 2
+	resilienceBackoff   = 100
+	resilienceThreshold = 5
+	resilienceCooldown  = 10
+
+	cacheEnabled = false
+	cacheSize    = 10000
+	cacheTTL     = 30
+
+	breachPath      = ""
+	breachHash      = "sha1"
+	breachMaxMemory = 64
+
+	backupSchedule = ""
+	backupDir      = "./data/snapshots"
+	backupKeep     = 7
 )
 
 type Config struct {
@@ -34,8 +66,12 @@ type Config struct {
 		Debug bool `yaml:"debug"`
 	} `yaml:"logger"`
 	Bot struct {
-		AutoDelete int `yaml:"auto_delete"`
-		WebHook    struct {
+		AutoDelete     int `yaml:"auto_delete"`
+		DraftTTL       int `yaml:"draft_ttl"`
+		StaleAge       int `yaml:"stale_age"`
+		HistoryDepth   int `yaml:"history_depth"`
+		TrashRetention int `yaml:"trash_retention"`
+		WebHook        struct {
 			URL                string `yaml:"url"`
 			MaxConnections     int    `yaml:"max_connections"`
 			RetryCount         int    `yaml:"retry_count"`
@@ -44,17 +80,53 @@ type Config struct {
 		} `yaml:"webhook"`
 	} `yaml:"bot"`
 	Server struct {
-		Host string `yaml:"host"`
-		Port string `yaml:"port"`
+		Host            string `yaml:"host"`
+		Port            string `yaml:"port"`
+		RequestTimeout  int    `yaml:"request_timeout"`
+		ShutdownTimeout int    `yaml:"shutdown_timeout"`
 	} `yaml:"server"`
 	Tarantool struct {
-		Host          string `yaml:"host"`
-		Port          string `yaml:"port"`
-		User          string `yaml:"user"`
-		Timeout       int    `yaml:"timeout"`
-		Reconnect     int    `yaml:"reconnect"`
-		MaxReconnects uint   `yaml:"max_reconnects"`
+		Addrs         []string `yaml:"addrs"`
+		Host          string   `yaml:"host"`
+		Port          string   `yaml:"port"`
+		User          string   `yaml:"user"`
+		Timeout       int      `yaml:"timeout"`
+		Reconnect     int      `yaml:"reconnect"`
+		MaxReconnects uint     `yaml:"max_reconnects"`
+		Migrate       bool     `yaml:"migrate"`
+		CheckInterval int      `yaml:"check_interval"`
+		MaxReplicaLag int      `yaml:"max_replica_lag"`
 	} `yaml:"tarantool"`
+	Storage struct {
+		Driver string `yaml:"driver"`
+		Bolt   struct {
+			Path           string `yaml:"path"`
+			Timeout        int    `yaml:"timeout"`
+			BackupPath     string `yaml:"backup_path"`
+			BackupInterval int    `yaml:"backup_interval"`
+		} `yaml:"bolt"`
+		Resilience struct {
+			Retries   int `yaml:"retries"`
+			Backoff   int `yaml:"backoff"`
+			Threshold int `yaml:"threshold"`
+			Cooldown  int `yaml:"cooldown"`
+		} `yaml:"resilience"`
+		Cache struct {
+			Enabled bool `yaml:"enabled"`
+			Size    int  `yaml:"size"`
+			TTL     int  `yaml:"ttl"`
+		} `yaml:"cache"`
+	} `yaml:"storage"`
+	Breach struct {
+		Path      string `yaml:"path"`
+		Hash      string `yaml:"hash"`
+		MaxMemory int    `yaml:"max_memory"`
+	} `yaml:"breach"`
+	Backup struct {
+		Schedule string `yaml:"schedule"`
+		Dir      string `yaml:"dir"`
+		Keep     int    `yaml:"keep"`
+	} `yaml:"backup"`
 }
 
 func New() *Config {
@@ -65,8 +137,12 @@ func New() *Config {
 			Debug: loggerDebug,
 		},
 		Bot: struct {
-			AutoDelete int `yaml:"auto_delete"`
-			WebHook    struct {
+			AutoDelete     int `yaml:"auto_delete"`
+			DraftTTL       int `yaml:"draft_ttl"`
+			StaleAge       int `yaml:"stale_age"`
+			HistoryDepth   int `yaml:"history_depth"`
+			TrashRetention int `yaml:"trash_retention"`
+			WebHook        struct {
 				URL                string `yaml:"url"`
 				MaxConnections     int    `yaml:"max_connections"`
 				RetryCount         int    `yaml:"retry_count"`
@@ -74,7 +150,11 @@ func New() *Config {
 				DropPendingUpdates bool   `yaml:"drop_pending_updates"`
 			} `yaml:"webhook"`
 		}{
-			AutoDelete: botAutoDel,
+			AutoDelete:     botAutoDel,
+			DraftTTL:       botDraftTTL,
+			StaleAge:       botStaleAge,
+			HistoryDepth:   botHistory,
+			TrashRetention: botTrash,
 			WebHook: struct {
 				URL                string `yaml:"url"`
 				MaxConnections     int    `yaml:"max_connections"`
@@ -90,19 +170,27 @@ func New() *Config {
 			},
 		},
 		Server: struct {
-			Host string `yaml:"host"`
-			Port string `yaml:"port"`
+			Host            string `yaml:"host"`
+			Port            string `yaml:"port"`
+			RequestTimeout  int    `yaml:"request_timeout"`
+			ShutdownTimeout int    `yaml:"shutdown_timeout"`
 		}{
-			Host: serverHost,
-			Port: serverPort,
+			Host:            serverHost,
+			Port:            serverPort,
+			RequestTimeout:  serverRequestTimeout,
+			ShutdownTimeout: serverShutdownTimeout,
 		},
 		Tarantool: struct {
-			Host          string `yaml:"host"`
-			Port          string `yaml:"port"`
-			User          string `yaml:"user"`
-			Timeout       int    `yaml:"timeout"`
-			Reconnect     int    `yaml:"reconnect"`
-			MaxReconnects uint   `yaml:"max_reconnects"`
+			Addrs         []string `yaml:"addrs"`
+			Host          string   `yaml:"host"`
+			Port          string   `yaml:"port"`
+			User          string   `yaml:"user"`
+			Timeout       int      `yaml:"timeout"`
+			Reconnect     int      `yaml:"reconnect"`
+			MaxReconnects uint     `yaml:"max_reconnects"`
+			Migrate       bool     `yaml:"migrate"`
+			CheckInterval int      `yaml:"check_interval"`
+			MaxReplicaLag int      `yaml:"max_replica_lag"`
 		}{
 			Host:          tarantoolHost,
 			Port:          tarantoolPort,
@@ -110,6 +198,80 @@ func New() *Config {
 			Timeout:       tarantoolTimeout,
 			Reconnect:     tarantoolReconnect,
 			MaxReconnects: tarantoolMaxReconnects,
+			Migrate:       tarantoolMigrate,
+			CheckInterval: tarantoolCheckInterval,
+			MaxReplicaLag: tarantoolMaxLag,
+		},
+		Storage: struct {
+			Driver string `yaml:"driver"`
+			Bolt   struct {
+				Path           string `yaml:"path"`
+				Timeout        int    `yaml:"timeout"`
+				BackupPath     string `yaml:"backup_path"`
+				BackupInterval int    `yaml:"backup_interval"`
+			} `yaml:"bolt"`
+			Resilience struct {
+				Retries   int `yaml:"retries"`
+				Backoff   int `yaml:"backoff"`
+				Threshold int `yaml:"threshold"`
+				Cooldown  int `yaml:"cooldown"`
+			} `yaml:"resilience"`
+			Cache struct {
+				Enabled bool `yaml:"enabled"`
+				Size    int  `yaml:"size"`
+				TTL     int  `yaml:"ttl"`
+			} `yaml:"cache"`
+		}{
+			Driver: storageDriver,
+			Bolt: struct {
+				Path           string `yaml:"path"`
+				Timeout        int    `yaml:"timeout"`
+				BackupPath     string `yaml:"backup_path"`
+				BackupInterval int    `yaml:"backup_interval"`
+			}{
+				Path:           boltPath,
+				Timeout:        boltTimeout,
+				BackupPath:     boltBackupPath,
+				BackupInterval: boltBackupInterval,
+			},
+			Resilience: struct {
+				Retries   int `yaml:"retries"`
+				Backoff   int `yaml:"backoff"`
+				Threshold int `yaml:"threshold"`
+				Cooldown  int `yaml:"cooldown"`
+			}{
+				Retries:   resilienceRetries,
+				Backoff:   resilienceBackoff,
+				Threshold: resilienceThreshold,
+				Cooldown:  resilienceCooldown,
+			},
+			Cache: struct {
+				Enabled bool `yaml:"enabled"`
+				Size    int  `yaml:"size"`
+				TTL     int  `yaml:"ttl"`
+			}{
+				Enabled: cacheEnabled,
+				Size:    cacheSize,
+				TTL:     cacheTTL,
+			},
+		},
+		Breach: struct {
+			Path      string `yaml:"path"`
+			Hash      string `yaml:"hash"`
+			MaxMemory int    `yaml:"max_memory"`
+		}{
+			Path:      breachPath,
+			Hash:      breachHash,
+			MaxMemory: breachMaxMemory,
+		},
+		Backup: struct {
+			Schedule string `yaml:"schedule"`
+			Dir      string `yaml:"dir"`
+			Keep     int    `yaml:"keep"`
+		}{
+			Schedule: backupSchedule,
+			Dir:      backupDir,
+			Keep:     backupKeep,
 		},
 	}
 }
@@ -0,0 +1,104 @@
+package migrations
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/tarantool/go-tarantool"
+)
+
+const usage = `usage: migrate [-dry-run] <command>
+
+commands:
+  up [version]  apply pending migrations up to version (all by default)
+  down [steps]  roll back the last steps migrations (1 by default)
+  status        list migrations and whether they are applied
+`
+
+// Command implements the "migrate" subcommand of the bot binary.
+func Command(conn tarantool.Connector, args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	fs.SetOutput(out)
+	fs.Usage = func() { fmt.Fprint(out, usage) }
+	dryRun := fs.Bool("dry-run", false, "only print migrations that would run")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	m := New(conn, All)
+	m.DryRun = *dryRun
+
+	verb := "applied"
+	if m.DryRun {
+		verb = "would apply"
+	}
+
+	switch fs.Arg(0) {
+	case "up":
+		target, err := optionalUint(fs.Arg(1), 0)
+		if err != nil {
+			return err
+		}
+
+		plan, err := m.Up(target)
+		printPlan(out, verb, plan)
+
+		return err
+	case "down":
+		steps, err := optionalUint(fs.Arg(1), 1)
+		if err != nil {
+			return err
+		}
+
+		if m.DryRun {
+			verb = "would roll back"
+		} else {
+			verb = "rolled back"
+		}
+
+		plan, err := m.Down(int(steps))
+		printPlan(out, verb, plan)
+
+		return err
+	case "status":
+		applied, err := m.Applied()
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range m.migrations {
+			status := "pending"
+			if applied[migration.Version] {
+				status = "applied"
+			}
+			fmt.Fprintf(out, "%-8s %s\n", status, migration)
+		}
+
+		return nil
+	default:
+		fs.Usage()
+		return fmt.Errorf("unknown migrate command %q", fs.Arg(0))
+	}
+}
+
+func printPlan(out io.Writer, verb string, plan []Migration) {
+	if len(plan) == 0 {
+		fmt.Fprintln(out, "nothing to do")
+		return
+	}
+
+	for _, migration := range plan {
+		fmt.Fprintf(out, "%s %s\n", verb, migration)
+	}
+}
+
+func optionalUint(arg string, def uint64) (uint64, error) {
+	if arg == "" {
+		return def, nil
+	}
+
+	return strconv.ParseUint(arg, 10, 64)
+}
@@ -0,0 +1,595 @@
+package migrations
+
+// Bodies of persistent functions are versioned like the migrations
+// creating them: a migration changing a function adds a new constant.
+
+const saveCredentialsV2 = `
+function(user_id, service_name, username, password)
+    box.atomic(function()
+        box.space.credentials:replace({ user_id, service_name, username, password })
+
+        local state = box.space.state:get(user_id)
+        if state ~= nil and state[3] == service_name then
+            box.space.state:replace({ state[1], state[2] })
+        end
+    end)
+end
+`
+
+const deleteCredentialsByUserV2 = `
+function(user_id)
+    box.atomic(function()
+        local keys = {}
+        for _, t in box.space.credentials.index.primary:pairs({ user_id }, { iterator = 'EQ' }) do
+            table.insert(keys, { t[1], t[2] })
+        end
+
+        for _, key in ipairs(keys) do
+            box.space.credentials:delete(key)
+        end
+    end)
+end
+`
+
+const reencryptV2 = `
+function(user_id, token, passwords)
+    box.atomic(function()
+        box.space.users:update(user_id, { { '=', 2, token } })
+
+        for service_name, password in pairs(passwords) do
+            box.space.credentials:update({ user_id, service_name }, { { '=', 4, password } })
+        end
+    end)
+end
+`
+
+const setDraftV2 = `
+function(user_id, service_name, username, now)
+    local state = box.space.state:get(user_id)
+    local current = state ~= nil and state[2] or 'default'
+
+    box.space.state:replace({ user_id, current, service_name, username, now })
+end
+`
+
+const discardDraftV2 = `
+function(user_id)
+    local state = box.space.state:get(user_id)
+    if state ~= nil then
+        box.space.state:replace({ state[1], state[2] })
+    end
+end
+`
+
+const purgeDraftsV2 = `
+function(older_than)
+    local drafts = {}
+    for _, t in box.space.state:pairs() do
+        if t[5] ~= nil and t[5] < older_than then
+            table.insert(drafts, t)
+        end
+    end
+
+    for _, t in ipairs(drafts) do
+        local state = t[2]
+        if state == 'setService' or state == 'setUsername' or state == 'setPassword' then
+            state = 'default'
+        end
+        box.space.state:replace({ t[1], state })
+    end
+
+    return #drafts
+end
+`
+
+const deleteCredentialsByUserV3 = `
+function(user_id)
+    box.atomic(function()
+        local keys = {}
+        for _, t in box.space.credentials.index.primary:pairs({ user_id }, { iterator = 'EQ' }) do
+            table.insert(keys, { t[1], t[2], t[3] })
+        end
+
+        for _, key in ipairs(keys) do
+            box.space.credentials:delete(key)
+        end
+    end)
+end
+`
+
+const reencryptV3 = `
+function(user_id, token, passwords)
+    box.atomic(function()
+        box.space.users:update(user_id, { { '=', 2, token } })
+
+        for _, p in ipairs(passwords) do
+            box.space.credentials:update({ user_id, p[1], p[2] }, { { '=', 4, p[3] } })
+        end
+    end)
+end
+`
+
+const purgeDraftsV3 = `
+function(older_than)
+    local pickers = {
+        setService = true, setUsername = true, setPassword = true,
+        getAccount = true, deleteAccount = true,
+    }
+
+    local drafts = {}
+    for _, t in box.space.state:pairs() do
+        if t[5] ~= nil and t[5] < older_than then
+            table.insert(drafts, t)
+        end
+    end
+
+    for _, t in ipairs(drafts) do
+        local state = t[2]
+        if pickers[state] then
+            state = 'default'
+        end
+        box.space.state:replace({ t[1], state })
+    end
+
+    return #drafts
+end
+`
+
+const saveCredentialsV4 = `
+function(user_id, service_name, username, password, details)
+    box.atomic(function()
+        box.space.credentials:replace({ user_id, service_name, username, password, details })
+
+        local state = box.space.state:get(user_id)
+        if state ~= nil and state[3] == service_name then
+            box.space.state:replace({ state[1], state[2] })
+        end
+    end)
+end
+`
+
+const reencryptV4 = `
+function(user_id, token, passwords)
+    box.atomic(function()
+        box.space.users:update(user_id, { { '=', 2, token } })
+
+        for _, p in ipairs(passwords) do
+            box.space.credentials:update({ user_id, p[1], p[2] }, { { '=', 4, p[3] }, { '=', 5, p[4] } })
+        end
+    end)
+end
+`
+
+const purgeDraftsV4 = `
+function(older_than)
+    local flows = {
+        setService = true, setUsername = true, setPassword = true,
+        setURL = true, setNotes = true, setTags = true, setField = true,
+        getAccount = true, deleteAccount = true,
+    }
+
+    local drafts = {}
+    for _, t in box.space.state:pairs() do
+        if t[5] ~= nil and t[5] < older_than then
+            table.insert(drafts, t)
+        end
+    end
+
+    for _, t in ipairs(drafts) do
+        local state = t[2]
+        if flows[state] then
+            state = 'default'
+        end
+        box.space.state:replace({ t[1], state })
+    end
+
+    return #drafts
+end
+`
+
+const purgeDraftsV5 = `
+function(older_than)
+    local flows = {
+        setType = true, setService = true, setUsername = true, setPassword = true,
+        setURL = true, setNotes = true, setTags = true, setField = true,
+        getAccount = true, deleteAccount = true,
+    }
+
+    local drafts = {}
+    for _, t in box.space.state:pairs() do
+        if t[5] ~= nil and t[5] < older_than then
+            table.insert(drafts, t)
+        end
+    end
+
+    for _, t in ipairs(drafts) do
+        local state = t[2]
+        if flows[state] or state:sub(1, 8) == 'setItem:' then
+            state = 'default'
+        end
+        box.space.state:replace({ t[1], state })
+    end
+
+    return #drafts
+end
+`
+
+const purgeDraftsV6 = `
+function(older_than)
+    local flows = {
+        setType = true, setService = true, setUsername = true, setPassword = true,
+        setURL = true, setNotes = true, setTags = true, setOTP = true, setField = true,
+        getAccount = true, deleteAccount = true,
+    }
+
+    local drafts = {}
+    for _, t in box.space.state:pairs() do
+        if t[5] ~= nil and t[5] < older_than then
+            table.insert(drafts, t)
+        end
+    end
+
+    for _, t in ipairs(drafts) do
+        local state = t[2]
+        if flows[state] or state:sub(1, 8) == 'setItem:' then
+            state = 'default'
+        end
+        box.space.state:replace({ t[1], state })
+    end
+
+    return #drafts
+end
+`
+
+const setSettingV7 = `
+function(user_id, key, value)
+    return box.atomic(function()
+        local user = box.space.users:get(user_id)
+        if user == nil then
+            return false
+        end
+
+        -- Removing the last setting stores box.NULL, which is truthy
+        -- in Lua but equals nil
+        local settings = {}
+        if user[3] ~= nil then
+            for k, v in pairs(user[3]) do
+                settings[k] = v
+            end
+        end
+        settings[key] = value ~= '' and value or nil
+
+        -- An empty table would be stored as an array
+        if next(settings) == nil then
+            settings = box.NULL
+        end
+
+        box.space.users:replace({ user[1], user[2], settings })
+        return true
+    end)
+end
+`
+
+const purgeDraftsV8 = `
+function(older_than)
+    local flows = {
+        setType = true, setService = true, setUsername = true, setPassword = true, weakPassword = true,
+        setURL = true, setNotes = true, setTags = true, setOTP = true, setField = true,
+        getAccount = true, deleteAccount = true,
+    }
+
+    local drafts = {}
+    for _, t in box.space.state:pairs() do
+        if t[5] ~= nil and t[5] < older_than then
+            table.insert(drafts, t)
+        end
+    end
+
+    for _, t in ipairs(drafts) do
+        local state = t[2]
+        if flows[state] or state:sub(1, 8) == 'setItem:' then
+            state = 'default'
+        end
+        box.space.state:replace({ t[1], state })
+    end
+
+    return #drafts
+end
+`
+
+const purgeDraftsV9 = `
+function(older_than)
+    local flows = {
+        setType = true, setService = true, setUsername = true, setPassword = true, weakPassword = true,
+        setURL = true, setNotes = true, setTags = true, setOTP = true, setField = true,
+        getAccount = true, deleteAccount = true, rotatePassword = true,
+    }
+
+    local drafts = {}
+    for _, t in box.space.state:pairs() do
+        if t[5] ~= nil and t[5] < older_than then
+            table.insert(drafts, t)
+        end
+    end
+
+    for _, t in ipairs(drafts) do
+        local state = t[2]
+        if flows[state] or state:sub(1, 8) == 'setItem:' then
+            state = 'default'
+        end
+        box.space.state:replace({ t[1], state })
+    end
+
+    return #drafts
+end
+`
+
+const touchCredentialsV10 = `
+function(user_id, service_name, username, now)
+    return box.atomic(function()
+        local t = box.space.credentials:get({ user_id, service_name, username })
+        if t == nil then
+            return false
+        end
+
+        local details = {}
+        if t[5] ~= nil then
+            for k, v in pairs(t[5]) do
+                details[k] = v
+            end
+        end
+        details.accessed_at = now
+
+        box.space.credentials:replace({ t[1], t[2], t[3], t[4], details })
+        return true
+    end)
+end
+`
+
+const purgeDraftsV10 = `
+function(older_than)
+    local flows = {
+        setType = true, setService = true, setUsername = true, setPassword = true, weakPassword = true,
+        setURL = true, setNotes = true, setTags = true, setOTP = true, setField = true,
+        getAccount = true, deleteAccount = true, rotatePassword = true,
+        historyAccount = true, historyRestore = true,
+    }
+
+    local drafts = {}
+    for _, t in box.space.state:pairs() do
+        if t[5] ~= nil and t[5] < older_than then
+            table.insert(drafts, t)
+        end
+    end
+
+    for _, t in ipairs(drafts) do
+        local state = t[2]
+        if flows[state] or state:sub(1, 8) == 'setItem:' then
+            state = 'default'
+        end
+        box.space.state:replace({ t[1], state })
+    end
+
+    return #drafts
+end
+`
+
+const deleteCredentialsByUserV11 = `
+function(user_id)
+    box.atomic(function()
+        for _, space in ipairs({ box.space.credentials, box.space.trash }) do
+            local keys = {}
+            for _, t in space.index.primary:pairs({ user_id }, { iterator = 'EQ' }) do
+                table.insert(keys, { t[1], t[2], t[3] })
+            end
+
+            for _, key in ipairs(keys) do
+                space:delete(key)
+            end
+        end
+    end)
+end
+`
+
+const reencryptV11 = `
+function(user_id, token, passwords)
+    box.atomic(function()
+        box.space.users:update(user_id, { { '=', 2, token } })
+
+        for _, p in ipairs(passwords) do
+            local space = p[5] and box.space.trash or box.space.credentials
+            space:update({ user_id, p[1], p[2] }, { { '=', 4, p[3] }, { '=', 5, p[4] } })
+        end
+    end)
+end
+`
+
+const trashV11 = `
+function(user_id, service_name, username, now)
+    return box.atomic(function()
+        local t = box.space.credentials:get({ user_id, service_name, username })
+        if t == nil then
+            return false
+        end
+
+        box.space.trash:replace({ t[1], t[2], t[3], t[4], t[5], now })
+        box.space.credentials:delete({ user_id, service_name, username })
+        return true
+    end)
+end
+`
+
+const restoreTrashV11 = `
+function(user_id, service_name, username)
+    return box.atomic(function()
+        local t = box.space.trash:get({ user_id, service_name, username })
+        if t == nil then
+            return 'not_found'
+        end
+
+        if box.space.credentials:get({ user_id, service_name, username }) ~= nil then
+            return 'conflict'
+        end
+
+        box.space.credentials:insert({ t[1], t[2], t[3], t[4], t[5] })
+        box.space.trash:delete({ user_id, service_name, username })
+        return 'restored'
+    end)
+end
+`
+
+const expireTrashV11 = `
+function(older_than)
+    local keys = {}
+    for _, t in box.space.trash.index.deleted_at:pairs({ older_than }, { iterator = 'LT' }) do
+        table.insert(keys, { t[1], t[2], t[3] })
+    end
+
+    box.atomic(function()
+        for _, key in ipairs(keys) do
+            box.space.trash:delete(key)
+        end
+    end)
+
+    return #keys
+end
+`
+
+const purgeDraftsV11 = `
+function(older_than)
+    local flows = {
+        setType = true, setService = true, setUsername = true, setPassword = true, weakPassword = true,
+        setURL = true, setNotes = true, setTags = true, setOTP = true, setField = true,
+        getAccount = true, deleteAccount = true, rotatePassword = true,
+        historyAccount = true, historyRestore = true, trashUndo = true, trashItem = true,
+    }
+
+    local drafts = {}
+    for _, t in box.space.state:pairs() do
+        if t[5] ~= nil and t[5] < older_than then
+            table.insert(drafts, t)
+        end
+    end
+
+    for _, t in ipairs(drafts) do
+        local state = t[2]
+        if flows[state] or state:sub(1, 8) == 'setItem:' then
+            state = 'default'
+        end
+        box.space.state:replace({ t[1], state })
+    end
+
+    return #drafts
+end
+`
+
+const renameCredentialsV12 = `
+function(user_id, service_name, username, new_service_name, new_username)
+    return box.atomic(function()
+        local t = box.space.credentials:get({ user_id, service_name, username })
+        if t == nil then
+            return 'not_found'
+        end
+
+        if new_service_name == service_name and new_username == username then
+            return 'renamed'
+        end
+
+        if box.space.credentials:get({ user_id, new_service_name, new_username }) ~= nil then
+            return 'conflict'
+        end
+
+        box.space.credentials:insert({ t[1], new_service_name, new_username, t[4], t[5] })
+        box.space.credentials:delete({ user_id, service_name, username })
+        return 'renamed'
+    end)
+end
+`
+
+const purgeDraftsV12 = `
+function(older_than)
+    local flows = {
+        setType = true, setService = true, setUsername = true, setPassword = true, weakPassword = true,
+        setURL = true, setNotes = true, setTags = true, setOTP = true, setField = true,
+        getAccount = true, deleteAccount = true, rotatePassword = true,
+        historyAccount = true, historyRestore = true, trashUndo = true, trashItem = true,
+        editAccount = true, editField = true,
+    }
+
+    local drafts = {}
+    for _, t in box.space.state:pairs() do
+        if t[5] ~= nil and t[5] < older_than then
+            table.insert(drafts, t)
+        end
+    end
+
+    for _, t in ipairs(drafts) do
+        local state = t[2]
+        if flows[state] or state:sub(1, 8) == 'setItem:' or state:sub(1, 10) == 'editValue:' then
+            state = 'default'
+        end
+        box.space.state:replace({ t[1], state })
+    end
+
+    return #drafts
+end
+`
+
+const dumpUsersV13 = `
+function(after_user_id, limit)
+    local users = {}
+    local key, iterator = { after_user_id }, 'GT'
+    if after_user_id == nil then
+        key, iterator = {}, 'ALL'
+    end
+
+    for _, user in box.space.users.index.primary:pairs(key, { iterator = iterator }) do
+        if #users >= limit then
+            break
+        end
+
+        local user_id = user[1]
+        table.insert(users, {
+            user,
+            box.space.credentials.index.primary:select({ user_id }, { iterator = 'EQ' }),
+            box.space.trash.index.primary:select({ user_id }, { iterator = 'EQ' }),
+            box.space.state:get(user_id),
+        })
+    end
+
+    return users
+end
+`
+
+const restoreUserV13 = `
+function(user, credentials, trash, state)
+    local user_id = user[1]
+
+    box.atomic(function()
+        for _, space in ipairs({ box.space.credentials, box.space.trash }) do
+            local keys = {}
+            for _, t in space.index.primary:pairs({ user_id }, { iterator = 'EQ' }) do
+                table.insert(keys, { t[1], t[2], t[3] })
+            end
+
+            for _, key in ipairs(keys) do
+                space:delete(key)
+            end
+        end
+
+        box.space.users:replace(user)
+        for _, t in ipairs(credentials) do
+            box.space.credentials:insert(t)
+        end
+        for _, t in ipairs(trash) do
+            box.space.trash:insert(t)
+        end
+
+        if state ~= nil then
+            box.space.state:replace(state)
+        else
+            box.space.state:delete(user_id)
+        end
+    end)
+end
+`
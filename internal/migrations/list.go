@@ -0,0 +1,308 @@
+package migrations
+
+// All contains every schema change made after the initial box.once("schema")
+// in configs/tarantool. Versions must never be reused or reordered.
+var All = []Migration{
+	{
+		// Local instances were created with a (user_id, token) key, so
+		// UpdateToken, which looks users up by id only, failed there.
+		Version: 1,
+		Name:    "users_primary_user_id",
+		Up: Lua(`
+local primary = box.space.users.index.primary
+if #primary.parts ~= 1 then
+    primary:alter({ parts = { 1, 'unsigned' } })
+end
+`),
+	},
+	{
+		// The set flow keeps service and username in the state as a draft and
+		// commits the full record with a single call.
+		Version: 2,
+		Name:    "credential_drafts",
+		Up: Steps(
+			Lua(`
+box.space.state:format({
+    { name = 'user_id', type = 'unsigned' },
+    { name = 'state', type = 'string' },
+    { name = 'last_service', type = 'string', is_nullable = true },
+    { name = 'draft_username', type = 'string', is_nullable = true },
+    { name = 'draft_updated_at', type = 'unsigned', is_nullable = true },
+})
+
+-- Half-filled tuples left by set flows abandoned before the password step
+local orphans = {}
+for _, t in box.space.credentials:pairs() do
+    if t[4] == nil then
+        table.insert(orphans, { t[1], t[2] })
+    end
+end
+for _, key in ipairs(orphans) do
+    box.space.credentials:delete(key)
+end
+`),
+			Function("passwd_save_credentials", saveCredentialsV2),
+			Function("passwd_delete_credentials_by_user", deleteCredentialsByUserV2),
+			Function("passwd_reencrypt", reencryptV2),
+			Function("passwd_set_draft", setDraftV2),
+			Function("passwd_discard_draft", discardDraftV2),
+			Function("passwd_purge_drafts", purgeDraftsV2),
+		),
+		Down: Steps(
+			DropFunctions(
+				"passwd_save_credentials",
+				"passwd_delete_credentials_by_user",
+				"passwd_reencrypt",
+				"passwd_set_draft",
+				"passwd_discard_draft",
+				"passwd_purge_drafts",
+			),
+			Lua(`
+box.space.state:format({
+    { name = 'user_id', type = 'unsigned' },
+    { name = 'state', type = 'string' },
+    { name = 'last_service', type = 'string', is_nullable = true },
+})
+`),
+		),
+	},
+	{
+		// Credentials are identified by service and username, so one person
+		// can keep several accounts of a service. Credentials saved without
+		// a username get an empty one: key parts can't be null. Drafts also
+		// remember the service while an account is picked.
+		Version: 3,
+		Name:    "multiple_accounts",
+		Up: Steps(
+			Lua(`
+box.atomic(function()
+    local keys = {}
+    for _, t in box.space.credentials:pairs() do
+        if t[3] == nil then
+            table.insert(keys, { t[1], t[2] })
+        end
+    end
+    for _, key in ipairs(keys) do
+        box.space.credentials:update(key, { { '=', 3, '' } })
+    end
+end)
+
+box.space.credentials:format({
+    { name = 'user_id', type = 'unsigned' },
+    { name = 'service_name', type = 'string' },
+    { name = 'login', type = 'string' },
+    { name = 'password', type = 'string', is_nullable = true },
+})
+box.space.credentials.index.primary:alter({ parts = { { 1, 'unsigned' }, { 2, 'string' }, { 3, 'string' } } })
+`),
+			Function("passwd_delete_credentials_by_user", deleteCredentialsByUserV3),
+			Function("passwd_reencrypt", reencryptV3),
+			Function("passwd_purge_drafts", purgeDraftsV3),
+		),
+		// Rolling back is only possible while no service has several accounts
+		Down: Steps(
+			Lua(`
+local previous
+for _, t in box.space.credentials:pairs() do
+    if previous ~= nil and previous[1] == t[1] and previous[2] == t[2] then
+        error(string.format('user %d has several accounts of %s', t[1], t[2]))
+    end
+    previous = t
+end
+
+box.space.credentials.index.primary:alter({ parts = { { 1, 'unsigned' }, { 2, 'string' } } })
+box.space.credentials:format({
+    { name = 'user_id', type = 'unsigned' },
+    { name = 'service_name', type = 'string' },
+    { name = 'login', type = 'string', is_nullable = true },
+    { name = 'password', type = 'string', is_nullable = true },
+})
+`),
+			Function("passwd_delete_credentials_by_user", deleteCredentialsByUserV2),
+			Function("passwd_reencrypt", reencryptV2),
+			Function("passwd_purge_drafts", purgeDraftsV2),
+		),
+	},
+	{
+		// Optional URL, notes, tags and custom fields are kept in a map, so
+		// new details don't need another change of the tuple layout. They are
+		// added after the password is saved, in steps that keep a draft.
+		Version: 4,
+		Name:    "credentials_details",
+		Up: Steps(
+			Lua(`
+box.space.credentials:format({
+    { name = 'user_id', type = 'unsigned' },
+    { name = 'service_name', type = 'string' },
+    { name = 'login', type = 'string' },
+    { name = 'password', type = 'string', is_nullable = true },
+    { name = 'details', type = 'map', is_nullable = true },
+})
+`),
+			Function("passwd_save_credentials", saveCredentialsV4),
+			Function("passwd_reencrypt", reencryptV4),
+			Function("passwd_purge_drafts", purgeDraftsV4),
+		),
+		// Details stay in the tuples and are skipped by older readers
+		Down: Steps(
+			Lua(`
+box.space.credentials:format({
+    { name = 'user_id', type = 'unsigned' },
+    { name = 'service_name', type = 'string' },
+    { name = 'login', type = 'string' },
+    { name = 'password', type = 'string', is_nullable = true },
+})
+`),
+			Function("passwd_save_credentials", saveCredentialsV2),
+			Function("passwd_reencrypt", reencryptV3),
+			Function("passwd_purge_drafts", purgeDraftsV3),
+		),
+	},
+	{
+		// Item types are kept with the details. Abandoned item flows,
+		// whose states carry the type and field, are purged as well.
+		Version: 5,
+		Name:    "typed_items",
+		Up:      Function("passwd_purge_drafts", purgeDraftsV5),
+		Down:    Function("passwd_purge_drafts", purgeDraftsV4),
+	},
+	{
+		// TOTP secrets are kept with the details, abandoned
+		// secret steps of the set flow are purged.
+		Version: 6,
+		Name:    "totp_secrets",
+		Up:      Function("passwd_purge_drafts", purgeDraftsV6),
+		Down:    Function("passwd_purge_drafts", purgeDraftsV5),
+	},
+	{
+		// Preferences such as the password generator options are kept
+		// in a map with the user.
+		Version: 7,
+		Name:    "user_settings",
+		Up: Steps(
+			Lua(`
+box.space.users:format({
+    { name = 'user_id', type = 'unsigned' },
+    { name = 'token', type = 'string' },
+    { name = 'settings', type = 'map', is_nullable = true },
+})
+`),
+			Function("passwd_set_setting", setSettingV7),
+		),
+		// Settings stay in the tuples and are skipped by older readers
+		Down: Steps(
+			DropFunctions("passwd_set_setting"),
+			Lua(`
+box.space.users:format({
+    { name = 'user_id', type = 'unsigned' },
+    { name = 'token', type = 'string' },
+})
+`),
+		),
+	},
+	{
+		// Weak passwords are saved and then offered to be replaced,
+		// abandoned offers are purged with the draft they keep.
+		Version: 8,
+		Name:    "password_strength",
+		Up:      Function("passwd_purge_drafts", purgeDraftsV8),
+		Down:    Function("passwd_purge_drafts", purgeDraftsV6),
+	},
+	{
+		// Passwords reported by /audit are changed in place, the account
+		// being changed is kept as a draft.
+		Version: 9,
+		Name:    "password_audit",
+		Up:      Function("passwd_purge_drafts", purgeDraftsV9),
+		Down:    Function("passwd_purge_drafts", purgeDraftsV8),
+	},
+	{
+		// Credentials keep when they were created and last viewed and their
+		// previous passwords in the details map. Viewing updates the map
+		// without discarding the draft, and restoring a previous password
+		// keeps the account as a draft.
+		Version: 10,
+		Name:    "credential_history",
+		Up: Steps(
+			Function("passwd_touch_credentials", touchCredentialsV10),
+			Function("passwd_purge_drafts", purgeDraftsV10),
+		),
+		Down: Steps(
+			DropFunctions("passwd_touch_credentials"),
+			Function("passwd_purge_drafts", purgeDraftsV9),
+		),
+	},
+	{
+		// Deleted credentials are moved to a trash space keeping the tuple
+		// and the time they were deleted, expired ones are purged by the bot.
+		// Undoing a deletion and acting on a deleted item keep a draft.
+		Version: 11,
+		Name:    "trash",
+		Up: Steps(
+			Lua(`
+box.schema.space.create('trash', { if_not_exists = true })
+box.space.trash:format({
+    { name = 'user_id', type = 'unsigned' },
+    { name = 'service_name', type = 'string' },
+    { name = 'login', type = 'string' },
+    { name = 'password', type = 'string', is_nullable = true },
+    { name = 'details', type = 'map', is_nullable = true },
+    { name = 'deleted_at', type = 'unsigned' },
+})
+box.space.trash:create_index('primary', {
+    if_not_exists = true,
+    parts = { { 1, 'unsigned' }, { 2, 'string' }, { 3, 'string' } },
+})
+box.space.trash:create_index('deleted_at', {
+    if_not_exists = true,
+    unique = false,
+    parts = { { 6, 'unsigned' } },
+})
+`),
+			Function("passwd_delete_credentials_by_user", deleteCredentialsByUserV11),
+			Function("passwd_reencrypt", reencryptV11),
+			Function("passwd_trash", trashV11),
+			Function("passwd_restore_trash", restoreTrashV11),
+			Function("passwd_expire_trash", expireTrashV11),
+			Function("passwd_purge_drafts", purgeDraftsV11),
+		),
+		// Deleting the trash space drops the credentials in it
+		Down: Steps(
+			DropFunctions("passwd_trash", "passwd_restore_trash", "passwd_expire_trash"),
+			Function("passwd_purge_drafts", purgeDraftsV10),
+			Function("passwd_delete_credentials_by_user", deleteCredentialsByUserV3),
+			Function("passwd_reencrypt", reencryptV4),
+			Lua(`
+if box.space.trash ~= nil then
+    box.space.trash:drop()
+end
+`),
+		),
+	},
+	{
+		// Editing a credential can rename it, which moves the tuple to a
+		// new primary key. Choosing the field and entering its value keep
+		// the account as a draft.
+		Version: 12,
+		Name:    "edit_credentials",
+		Up: Steps(
+			Function("passwd_rename_credentials", renameCredentialsV12),
+			Function("passwd_purge_drafts", purgeDraftsV12),
+		),
+		Down: Steps(
+			DropFunctions("passwd_rename_credentials"),
+			Function("passwd_purge_drafts", purgeDraftsV11),
+		),
+	},
+	{
+		// Backups dump each user with its credentials, trash and state in
+		// one call and restore them in one transaction.
+		Version: 13,
+		Name:    "snapshots",
+		Up: Steps(
+			Function("passwd_dump_users", dumpUsersV13),
+			Function("passwd_restore_user", restoreUserV13),
+		),
+		Down: DropFunctions("passwd_dump_users", "passwd_restore_user"),
+	},
+}
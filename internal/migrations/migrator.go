@@ -0,0 +1,443 @@
+package migrations
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/tarantool/go-tarantool"
+)
+
+const (
+	lockTTL = 5 * time.Minute
+	// renewEvery keeps the lock while a migration takes several minutes
+	renewEvery = lockTTL / 3
+)
+
+var (
+	ErrLocked       = errors.New("migrations are locked by another instance")
+	ErrReadOnly     = errors.New("migrations can't run on a read-only instance")
+	ErrIrreversible = errors.New("migration is irreversible")
+)
+
+// Step changes the schema of the connected instance.
+type Step func(conn tarantool.Connector) error
+
+// Lua returns a Step that evaluates chunk on the instance.
+func Lua(chunk string) Step {
+	return func(conn tarantool.Connector) error {
+		_, err := conn.Eval(chunk, []interface{}{})
+		return err
+	}
+}
+
+// Steps returns a Step running steps in order.
+func Steps(steps ...Step) Step {
+	return func(conn tarantool.Connector) error {
+		for _, step := range steps {
+			if err := step(conn); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+}
+
+// Function returns a Step that (re)creates a persistent Lua function
+// callable with conn.Call17.
+func Function(name, body string) Step {
+	return func(conn tarantool.Connector) error {
+		_, err := conn.Eval(`
+local name, body = ...
+box.schema.func.drop(name, { if_exists = true })
+box.schema.func.create(name, { language = 'LUA', body = body })
+`, []interface{}{name, body})
+		return err
+	}
+}
+
+// DropFunctions returns a Step that drops persistent functions created by Function.
+func DropFunctions(names ...string) Step {
+	return func(conn tarantool.Connector) error {
+		_, err := conn.Eval(`
+for _, name in ipairs({ ... }) do
+    box.schema.func.drop(name, { if_exists = true })
+end
+`, names)
+		return err
+	}
+}
+
+type Migration struct {
+	Version uint64
+	Name    string
+	Up      Step
+	// Down is nil for migrations that can't be rolled back
+	Down Step
+}
+
+func (m Migration) String() string {
+	return fmt.Sprintf("%04d_%s", m.Version, m.Name)
+}
+
+type Migrator struct {
+	conn       tarantool.Connector
+	migrations []Migration
+	owner      string
+	renewEvery time.Duration
+
+	mu sync.Mutex
+	// lockedAt is when the lock was last taken or renewed
+	lockedAt time.Time
+	// lockErr is set when renewing the lock failed
+	lockErr error
+
+	// DryRun makes Up and Down only report what would be done
+	DryRun bool
+}
+
+func New(conn tarantool.Connector, migrations []Migration) *Migrator {
+	sorted := make([]Migration, len(migrations))
+	copy(sorted, migrations)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Version < sorted[j].Version
+	})
+
+	host, _ := os.Hostname()
+
+	return &Migrator{
+		conn:       conn,
+		migrations: sorted,
+		owner:      fmt.Sprintf("%s:%d", host, os.Getpid()),
+		renewEvery: renewEvery,
+	}
+}
+
+const bootstrapLua = `
+if box.info.ro then
+    return false
+end
+box.schema.space.create('_migrations', { if_not_exists = true, format = {
+    { name = 'version', type = 'unsigned' },
+    { name = 'name', type = 'string' },
+    { name = 'applied_at', type = 'unsigned' },
+} })
+box.space._migrations:create_index('primary', { if_not_exists = true, parts = { 1, 'unsigned' } })
+box.schema.space.create('_migrations_lock', { if_not_exists = true, format = {
+    { name = 'id', type = 'unsigned' },
+    { name = 'owner', type = 'string' },
+    { name = 'expires_at', type = 'number' },
+} })
+box.space._migrations_lock:create_index('primary', { if_not_exists = true, parts = { 1, 'unsigned' } })
+return true
+`
+
+const appliedLua = `
+if box.space._migrations == nil then
+    return {}
+end
+local versions = {}
+for _, t in box.space._migrations:pairs() do
+    table.insert(versions, t[1])
+end
+return versions
+`
+
+const lockLua = `
+local owner, ttl = ...
+if box.info.ro then
+    return 'read-only'
+end
+return box.atomic(function()
+    local now = require('clock').time()
+    local lock = box.space._migrations_lock:get(1)
+    if lock ~= nil and lock[2] ~= owner and lock[3] > now then
+        return lock[2]
+    end
+    box.space._migrations_lock:replace({ 1, owner, now + ttl })
+    return ''
+end)
+`
+
+const unlockLua = `
+local owner = ...
+local lock = box.space._migrations_lock:get(1)
+if lock ~= nil and lock[2] == owner then
+    box.space._migrations_lock:delete(1)
+end
+`
+
+const recordLua = `
+local version, name = ...
+box.space._migrations:insert({ version, name, os.time() })
+`
+
+const forgetLua = `
+local version = ...
+box.space._migrations:delete(version)
+`
+
+// Applied returns versions of migrations recorded in the _migrations space.
+func (m *Migrator) Applied() (map[uint64]bool, error) {
+	resp, err := m.conn.Eval(appliedLua, []interface{}{})
+	if err != nil {
+		return nil, err
+	}
+
+	applied := make(map[uint64]bool)
+	if len(resp.Data) == 0 {
+		return applied, nil
+	}
+
+	versions, ok := resp.Data[0].([]interface{})
+	if !ok {
+		return applied, nil
+	}
+
+	for _, v := range versions {
+		version, err := toUint64(v)
+		if err != nil {
+			return nil, err
+		}
+		applied[version] = true
+	}
+
+	return applied, nil
+}
+
+// Pending returns migrations not applied yet in version order.
+func (m *Migrator) Pending() ([]Migration, error) {
+	applied, err := m.Applied()
+	if err != nil {
+		return nil, err
+	}
+
+	var pending []Migration
+	for _, migration := range m.migrations {
+		if !applied[migration.Version] {
+			pending = append(pending, migration)
+		}
+	}
+
+	return pending, nil
+}
+
+// Up applies pending migrations up to and including target, all of them
+// if target is 0. It returns the migrations applied (or planned in dry-run).
+func (m *Migrator) Up(target uint64) ([]Migration, error) {
+	var plan []Migration
+
+	err := m.withLock(func() error {
+		pending, err := m.Pending()
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range pending {
+			if target != 0 && migration.Version > target {
+				break
+			}
+
+			plan = append(plan, migration)
+			if m.DryRun {
+				continue
+			}
+
+			if err = m.held(); err != nil {
+				return err
+			}
+
+			if err = migration.Up(m.conn); err != nil {
+				return fmt.Errorf("migration %s failed: %w", migration, err)
+			}
+
+			if _, err = m.conn.Eval(recordLua, []interface{}{migration.Version, migration.Name}); err != nil {
+				return fmt.Errorf("failed to record migration %s: %w", migration, err)
+			}
+		}
+
+		return nil
+	})
+
+	return plan, err
+}
+
+// Down rolls back the last steps applied migrations.
+func (m *Migrator) Down(steps int) ([]Migration, error) {
+	var plan []Migration
+
+	err := m.withLock(func() error {
+		applied, err := m.Applied()
+		if err != nil {
+			return err
+		}
+
+		for i := len(m.migrations) - 1; i >= 0 && len(plan) < steps; i-- {
+			migration := m.migrations[i]
+			if !applied[migration.Version] {
+				continue
+			}
+
+			if migration.Down == nil {
+				return fmt.Errorf("%w: %s", ErrIrreversible, migration)
+			}
+
+			plan = append(plan, migration)
+			if m.DryRun {
+				continue
+			}
+
+			if err = m.held(); err != nil {
+				return err
+			}
+
+			if err = migration.Down(m.conn); err != nil {
+				return fmt.Errorf("rollback of %s failed: %w", migration, err)
+			}
+
+			if _, err = m.conn.Eval(forgetLua, []interface{}{migration.Version}); err != nil {
+				return fmt.Errorf("failed to forget migration %s: %w", migration, err)
+			}
+		}
+
+		return nil
+	})
+
+	return plan, err
+}
+
+// withLock runs fn holding the migration lock so that several bot instances
+// (or an instance and the CLI) don't migrate the same cluster concurrently.
+// The lock is renewed while fn runs, fn checks it's still held with held
+// before each migration. Dry runs don't modify the instance and skip the lock.
+func (m *Migrator) withLock(fn func() error) error {
+	if m.DryRun {
+		return fn()
+	}
+
+	resp, err := m.conn.Eval(bootstrapLua, []interface{}{})
+	if err != nil {
+		return err
+	}
+
+	if len(resp.Data) > 0 && resp.Data[0] == false {
+		return ErrReadOnly
+	}
+
+	m.mu.Lock()
+	m.lockErr = nil
+	m.mu.Unlock()
+
+	if err = m.lock(); err != nil {
+		return err
+	}
+
+	defer m.conn.Eval(unlockLua, []interface{}{m.owner})
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go m.renew(stop, done)
+
+	defer func() {
+		close(stop)
+		<-done
+	}()
+
+	return fn()
+}
+
+// lock takes the migration lock or extends the one held by m.
+func (m *Migrator) lock() error {
+	now := time.Now()
+
+	resp, err := m.conn.Eval(lockLua, []interface{}{m.owner, lockTTL.Seconds()})
+	if err != nil {
+		return err
+	}
+
+	if len(resp.Data) > 0 {
+		holder, _ := resp.Data[0].(string)
+
+		switch holder {
+		case "":
+		case "read-only":
+			return ErrReadOnly
+		default:
+			return fmt.Errorf("%w: %s", ErrLocked, holder)
+		}
+	}
+
+	m.mu.Lock()
+	m.lockedAt = now
+	m.mu.Unlock()
+
+	return nil
+}
+
+// renew extends the lock every m.renewEvery until stop is closed or
+// renewing fails.
+func (m *Migrator) renew(stop <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+
+	ticker := time.NewTicker(m.renewEvery)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if err := m.lock(); err != nil {
+				m.mu.Lock()
+				m.lockErr = fmt.Errorf("failed to renew the migration lock: %w", err)
+				m.mu.Unlock()
+
+				return
+			}
+		}
+	}
+}
+
+// held returns an error when the lock couldn't be renewed or its TTL has
+// passed since it was last renewed, another instance may hold it then.
+func (m *Migrator) held() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.lockErr != nil {
+		return m.lockErr
+	}
+
+	if time.Since(m.lockedAt) >= lockTTL {
+		return fmt.Errorf("%w: the lock expired at %s", ErrLocked, m.lockedAt.Add(lockTTL).Format(time.RFC3339))
+	}
+
+	return nil
+}
+
+func toUint64(v interface{}) (uint64, error) {
+	switch n := v.(type) {
+	case uint64:
+		return n, nil
+	case int64:
+		return uint64(n), nil
+	case uint32:
+		return uint64(n), nil
+	case int32:
+		return uint64(n), nil
+	case uint16:
+		return uint64(n), nil
+	case int16:
+		return uint64(n), nil
+	case uint8:
+		return uint64(n), nil
+	case int8:
+		return uint64(n), nil
+	default:
+		return 0, fmt.Errorf("unexpected version type %T", v)
+	}
+}
@@ -0,0 +1,371 @@
+package migrations
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tarantool/go-tarantool"
+)
+
+// fakeConn answers the chunks evaluated by Migrator like an instance would.
+// Other requests panic on the nil Connector.
+type fakeConn struct {
+	tarantool.Connector
+
+	mu          sync.Mutex
+	readOnly    bool
+	applied     map[uint64]string
+	lockOwner   string
+	lockExpires time.Time
+	locks       int
+}
+
+func newFakeConn() *fakeConn {
+	return &fakeConn{applied: make(map[uint64]string)}
+}
+
+func (c *fakeConn) Eval(expr string, args interface{}) (*tarantool.Response, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	a, _ := args.([]interface{})
+
+	var data interface{}
+	switch expr {
+	case bootstrapLua:
+		data = !c.readOnly
+	case appliedLua:
+		versions := []interface{}{}
+		for version := range c.applied {
+			versions = append(versions, version)
+		}
+		data = versions
+	case lockLua:
+		owner, ttl := a[0].(string), a[1].(float64)
+		c.locks++
+
+		if c.lockOwner != "" && c.lockOwner != owner && c.lockExpires.After(time.Now()) {
+			data = c.lockOwner
+			break
+		}
+
+		c.lockOwner = owner
+		c.lockExpires = time.Now().Add(time.Duration(ttl * float64(time.Second)))
+		data = ""
+	case unlockLua:
+		if c.lockOwner == a[0] {
+			c.lockOwner = ""
+		}
+	case recordLua:
+		version := a[0].(uint64)
+		if _, ok := c.applied[version]; ok {
+			return nil, fmt.Errorf("duplicate key %d", version)
+		}
+		c.applied[version] = a[1].(string)
+	case forgetLua:
+		delete(c.applied, a[0].(uint64))
+	default:
+		return nil, fmt.Errorf("unexpected eval %q", expr)
+	}
+
+	return &tarantool.Response{Data: []interface{}{data}}, nil
+}
+
+// testMigrations returns migrations out of order that log their steps,
+// version 2 can't be rolled back.
+func testMigrations(log *[]string) []Migration {
+	step := func(s string) Step {
+		return func(tarantool.Connector) error {
+			*log = append(*log, s)
+			return nil
+		}
+	}
+
+	return []Migration{
+		{Version: 3, Name: "third", Up: step("up 3"), Down: step("down 3")},
+		{Version: 1, Name: "first", Up: step("up 1"), Down: step("down 1")},
+		{Version: 2, Name: "second", Up: step("up 2")},
+		{Version: 4, Name: "fourth", Up: step("up 4"), Down: step("down 4")},
+	}
+}
+
+func versions(plan []Migration) []uint64 {
+	var versions []uint64
+	for _, migration := range plan {
+		versions = append(versions, migration.Version)
+	}
+
+	return versions
+}
+
+func mustNoErr(t *testing.T, err error) {
+	t.Helper()
+
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+}
+
+func TestAllOrdered(t *testing.T) {
+	for i, migration := range All {
+		if migration.Version != uint64(i+1) {
+			t.Fatalf("expected version %d, got %s", i+1, migration)
+		}
+
+		if migration.Up == nil {
+			t.Fatalf("%s has no Up", migration)
+		}
+	}
+}
+
+func TestUp(t *testing.T) {
+	var log []string
+	conn := newFakeConn()
+	m := New(conn, testMigrations(&log))
+
+	plan, err := m.Up(2)
+	mustNoErr(t, err)
+
+	if got := versions(plan); !reflect.DeepEqual(got, []uint64{1, 2}) {
+		t.Fatalf("expected 1 and 2 applied, got %v", got)
+	}
+
+	plan, err = m.Up(0)
+	mustNoErr(t, err)
+
+	if got := versions(plan); !reflect.DeepEqual(got, []uint64{3, 4}) {
+		t.Fatalf("expected 3 and 4 applied, got %v", got)
+	}
+
+	if want := []string{"up 1", "up 2", "up 3", "up 4"}; !reflect.DeepEqual(log, want) {
+		t.Fatalf("expected steps %v, got %v", want, log)
+	}
+
+	if want := map[uint64]string{1: "first", 2: "second", 3: "third", 4: "fourth"}; !reflect.DeepEqual(conn.applied, want) {
+		t.Fatalf("expected %v recorded, got %v", want, conn.applied)
+	}
+
+	if conn.lockOwner != "" {
+		t.Fatalf("expected the lock released, held by %s", conn.lockOwner)
+	}
+
+	if plan, err = m.Up(0); err != nil || len(plan) != 0 {
+		t.Fatalf("expected nothing to do, got %v, %v", plan, err)
+	}
+}
+
+func TestUpFailed(t *testing.T) {
+	var log []string
+	conn := newFakeConn()
+	migrations := testMigrations(&log)
+	migrations[0].Up = func(tarantool.Connector) error { return errors.New("boom") }
+
+	_, err := New(conn, migrations).Up(0)
+	if err == nil || !strings.Contains(err.Error(), "migration 0003_third failed: boom") {
+		t.Fatalf("expected the third migration failed, got %v", err)
+	}
+
+	if want := map[uint64]string{1: "first", 2: "second"}; !reflect.DeepEqual(conn.applied, want) {
+		t.Fatalf("expected %v recorded, got %v", want, conn.applied)
+	}
+}
+
+func TestDown(t *testing.T) {
+	var log []string
+	conn := newFakeConn()
+	m := New(conn, testMigrations(&log))
+
+	// 3 wasn't applied, so it's skipped
+	conn.applied = map[uint64]string{1: "first", 2: "second", 4: "fourth"}
+
+	plan, err := m.Down(1)
+	mustNoErr(t, err)
+
+	if got := versions(plan); !reflect.DeepEqual(got, []uint64{4}) {
+		t.Fatalf("expected 4 rolled back, got %v", got)
+	}
+
+	plan, err = m.Down(5)
+	if !errors.Is(err, ErrIrreversible) {
+		t.Fatalf("expected ErrIrreversible, got %v", err)
+	}
+
+	if len(plan) != 0 {
+		t.Fatalf("expected nothing rolled back, got %v", plan)
+	}
+
+	if want := []string{"down 4"}; !reflect.DeepEqual(log, want) {
+		t.Fatalf("expected steps %v, got %v", want, log)
+	}
+
+	if want := map[uint64]string{1: "first", 2: "second"}; !reflect.DeepEqual(conn.applied, want) {
+		t.Fatalf("expected %v left, got %v", want, conn.applied)
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	var log []string
+	conn := newFakeConn()
+	m := New(conn, testMigrations(&log))
+	m.DryRun = true
+
+	conn.applied = map[uint64]string{1: "first"}
+
+	plan, err := m.Up(0)
+	mustNoErr(t, err)
+
+	if got := versions(plan); !reflect.DeepEqual(got, []uint64{2, 3, 4}) {
+		t.Fatalf("expected 2, 3 and 4 planned, got %v", got)
+	}
+
+	plan, err = m.Down(1)
+	mustNoErr(t, err)
+
+	if got := versions(plan); !reflect.DeepEqual(got, []uint64{1}) {
+		t.Fatalf("expected 1 planned, got %v", got)
+	}
+
+	if len(log) != 0 || len(conn.applied) != 1 || conn.locks != 0 {
+		t.Fatalf("expected nothing done, ran %v and took the lock %d times", log, conn.locks)
+	}
+}
+
+func TestLocked(t *testing.T) {
+	var log []string
+	conn := newFakeConn()
+	conn.lockOwner = "other:1"
+	conn.lockExpires = time.Now().Add(time.Minute)
+
+	_, err := New(conn, testMigrations(&log)).Up(0)
+	if !errors.Is(err, ErrLocked) || !strings.Contains(err.Error(), "other:1") {
+		t.Fatalf("expected ErrLocked by other:1, got %v", err)
+	}
+
+	if len(log) != 0 || conn.lockOwner != "other:1" {
+		t.Fatalf("expected nothing done, ran %v and the lock held by %s", log, conn.lockOwner)
+	}
+
+	// An expired lock is taken over
+	conn.lockExpires = time.Now()
+
+	_, err = New(conn, testMigrations(&log)).Up(0)
+	mustNoErr(t, err)
+
+	conn.readOnly = true
+
+	if _, err = New(conn, testMigrations(&log)).Down(1); !errors.Is(err, ErrReadOnly) {
+		t.Fatalf("expected ErrReadOnly, got %v", err)
+	}
+}
+
+func TestLockRenewed(t *testing.T) {
+	conn := newFakeConn()
+
+	m := New(conn, []Migration{
+		{Version: 1, Name: "slow", Up: func(tarantool.Connector) error {
+			// Wait for the lock to be renewed while the migration runs
+			deadline := time.Now().Add(5 * time.Second)
+			for time.Now().Before(deadline) {
+				conn.mu.Lock()
+				locks := conn.locks
+				conn.mu.Unlock()
+
+				if locks > 1 {
+					return nil
+				}
+
+				time.Sleep(time.Millisecond)
+			}
+
+			return errors.New("the lock wasn't renewed")
+		}},
+		{Version: 2, Name: "after", Up: func(tarantool.Connector) error { return nil }},
+	})
+	m.renewEvery = time.Millisecond
+
+	_, err := m.Up(0)
+	mustNoErr(t, err)
+}
+
+func TestLockLost(t *testing.T) {
+	var log []string
+	conn := newFakeConn()
+	migrations := testMigrations(&log)
+
+	var m *Migrator
+	migrations[1].Up = func(tarantool.Connector) error {
+		// The migration outlived the lock, another instance took it
+		m.mu.Lock()
+		m.lockedAt = m.lockedAt.Add(-lockTTL)
+		m.mu.Unlock()
+
+		conn.mu.Lock()
+		conn.lockOwner = "other:1"
+		conn.lockExpires = time.Now().Add(time.Minute)
+		conn.mu.Unlock()
+
+		return nil
+	}
+
+	m = New(conn, migrations)
+
+	if _, err := m.Up(0); !errors.Is(err, ErrLocked) {
+		t.Fatalf("expected ErrLocked, got %v", err)
+	}
+
+	if len(log) != 0 || len(conn.applied) != 1 || conn.lockOwner != "other:1" {
+		t.Fatalf("expected only the first migration applied, ran %v, recorded %v, the lock held by %s", log, conn.applied, conn.lockOwner)
+	}
+}
+
+func TestCommandStatus(t *testing.T) {
+	conn := newFakeConn()
+	conn.applied = map[uint64]string{1: All[0].Name, 2: All[1].Name}
+
+	var out bytes.Buffer
+	mustNoErr(t, Command(conn, []string{"status"}, &out))
+
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	if len(lines) != len(All) {
+		t.Fatalf("expected %d migrations, got %q", len(All), out.String())
+	}
+
+	for i, line := range lines {
+		status := "pending"
+		if i < 2 {
+			status = "applied"
+		}
+
+		if want := fmt.Sprintf("%-8s %s", status, All[i]); line != want {
+			t.Fatalf("expected %q, got %q", want, line)
+		}
+	}
+}
+
+func TestCommandDryRun(t *testing.T) {
+	conn := newFakeConn()
+	for _, migration := range All {
+		conn.applied[migration.Version] = migration.Name
+	}
+
+	var out bytes.Buffer
+	mustNoErr(t, Command(conn, []string{"-dry-run", "up"}, &out))
+
+	if out.String() != "nothing to do\n" {
+		t.Fatalf("unexpected output %q", out.String())
+	}
+
+	out.Reset()
+	mustNoErr(t, Command(conn, []string{"-dry-run", "down", "1"}, &out))
+
+	last := All[len(All)-1]
+	if want := fmt.Sprintf("would roll back %s\n", last); out.String() != want {
+		t.Fatalf("expected %q, got %q", want, out.String())
+	}
+}
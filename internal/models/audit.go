@@ -0,0 +1,54 @@
+package models
+
+// Audit is a security report of a vault. Credentials in it have no secrets.
+type Audit struct {
+	// Checked is the number of logins with a password
+	Checked int
+	// Unchecked is the number of items other than logins, their secrets
+	// aren't audited
+	Unchecked int
+	Weak      []Credentials
+	// Breached passwords are found in the breached password corpus
+	Breached []Credentials
+	// Reused are groups of accounts sharing a password
+	Reused [][]Credentials
+	// Stale passwords weren't changed for longer than asked
+	Stale      []Credentials
+	NoUsername []Credentials
+}
+
+// IsClean reports whether the audit found nothing.
+func (a Audit) IsClean() bool {
+	return len(a.Weak) == 0 && len(a.Breached) == 0 && len(a.Reused) == 0 && len(a.Stale) == 0 && len(a.NoUsername) == 0
+}
+
+// Rotate returns the accounts whose passwords should be changed, each once.
+func (a Audit) Rotate() []Credentials {
+	var result []Credentials
+	seen := make(map[[2]string]bool)
+
+	add := func(c Credentials) {
+		key := [2]string{c.ServiceName, c.Username}
+		if !seen[key] {
+			seen[key] = true
+			result = append(result, c)
+		}
+	}
+
+	for _, c := range a.Breached {
+		add(c)
+	}
+	for _, c := range a.Weak {
+		add(c)
+	}
+	for _, group := range a.Reused {
+		for _, c := range group {
+			add(c)
+		}
+	}
+	for _, c := range a.Stale {
+		add(c)
+	}
+
+	return result
+}
@@ -1,10 +1,26 @@
 package models
 
 const (
-	HelpCMD        = "help"
-	SetCMD         = "1"
-	GetCMD         = "2"
-	DelCMD         = "3"
-	UpdateTokenCMD = "4"
-	BackToMenuCMD  = "Back to menu <<"
+	HelpCMD            = "help"
+	SetCMD             = "1"
+	GetCMD             = "2"
+	DelCMD             = "3"
+	UpdateTokenCMD     = "4"
+	BackToMenuCMD      = "Back to menu <<"
+	SkipCMD            = "Skip >>"
+	DoneCMD            = "Done"
+	GenerateCMD        = "Generate password"
+	KeepCMD            = "Keep it"
+	UndoCMD            = "Undo"
+	RestoreCMD         = "Restore"
+	PurgeCMD           = "Delete forever"
+	NextPageCMD        = "Next page >>"
+	ClearCMD           = "Clear"
+	ImportCMD          = "Import"
+	SkipDuplicatesCMD  = "Skip"
+	OverwriteCMD       = "Overwrite"
+	KeepBothCMD        = "Keep both"
+	SealedExportCMD    = "Encrypted file"
+	KeePassExportCMD   = "KeePass database"
+	BitwardenExportCMD = "Bitwarden JSON"
 )
@@ -1,9 +1,74 @@
 package models
 
+import "strings"
+
 type Credentials struct {
 	UserID       uint64 `json:"user_id"`
 	Token        string `json:"token"`
 	ServiceName  string `json:"service_name"`
 	Username     string `json:"username"`
 	PasswordHash string `json:"password_hash"`
+	// Type is one of the item types, empty for logins
+	Type string `json:"type,omitempty"`
+	// Strength is the strength.Score of the password when it was saved,
+	// 0 if it wasn't estimated
+	Strength int `json:"strength,omitempty"`
+	// UpdatedAt is the Unix time the password or item was last saved,
+	// 0 for credentials saved before it was kept
+	UpdatedAt int64 `json:"updated_at,omitempty"`
+	// CreatedAt and AccessedAt are the Unix times the credentials were
+	// first saved and last shown, 0 if that was before they were kept
+	CreatedAt  int64 `json:"created_at,omitempty"`
+	AccessedAt int64 `json:"accessed_at,omitempty"`
+	// History are the previous passwords, the most recent first
+	History []PasswordVersion `json:"history,omitempty"`
+	// DeletedAt is the Unix time credentials in the trash were deleted
+	DeletedAt int64 `json:"deleted_at,omitempty"`
+	Details
+}
+
+// PasswordVersion is a replaced password, encrypted like the current one.
+type PasswordVersion struct {
+	Password string `json:"password"`
+	Strength int    `json:"strength,omitempty"`
+	// UpdatedAt is the Unix time the password was saved, 0 if unknown
+	UpdatedAt int64 `json:"updated_at,omitempty"`
+	// ReplacedAt is the Unix time it was replaced by the next one
+	ReplacedAt int64 `json:"replaced_at"`
+}
+
+// Details are optional parts of credentials. Notes, field values and the
+// TOTP secret are encrypted with the same key as the password, URL and
+// tags are not.
+type Details struct {
+	URL   string   `json:"url,omitempty"`
+	Notes string   `json:"notes,omitempty"`
+	Tags  []string `json:"tags,omitempty"`
+	// Fields are custom named secrets such as security questions or PINs
+	Fields map[string]string `json:"fields,omitempty"`
+	// OTP is the otpauth URI of a TOTP secret
+	OTP string `json:"otp,omitempty"`
+}
+
+// IsZero reports whether none of the details are set.
+func (d Details) IsZero() bool {
+	return d.URL == "" && d.Notes == "" && len(d.Tags) == 0 && len(d.Fields) == 0 && d.OTP == ""
+}
+
+// ParseTags splits comma separated tags dropping empty and repeated ones.
+func ParseTags(text string) []string {
+	var tags []string
+	seen := make(map[string]bool)
+
+	for _, tag := range strings.Split(text, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "#")
+		if tag == "" || seen[tag] {
+			continue
+		}
+
+		seen[tag] = true
+		tags = append(tags, tag)
+	}
+
+	return tags
 }
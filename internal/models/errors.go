@@ -0,0 +1,35 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrNotFound is returned when the requested user or credentials don't exist.
+	ErrNotFound = errors.New("not found")
+	// ErrConflict is returned when a record that must be unique already exists.
+	ErrConflict = errors.New("already exists")
+	// ErrCorruptTuple is matched by every CorruptTupleError.
+	ErrCorruptTuple = errors.New("corrupt tuple")
+	// ErrUnavailable is returned without calling the storage while it keeps failing.
+	ErrUnavailable = errors.New("storage temporarily unavailable")
+)
+
+// CorruptTupleError describes a stored record that can't be decoded.
+type CorruptTupleError struct {
+	Space string
+	Err   error
+}
+
+func (e *CorruptTupleError) Error() string {
+	return fmt.Sprintf("corrupt tuple in %s: %s", e.Space, e.Err)
+}
+
+func (e *CorruptTupleError) Unwrap() error {
+	return e.Err
+}
+
+func (e *CorruptTupleError) Is(target error) bool {
+	return target == ErrCorruptTuple
+}
@@ -0,0 +1,68 @@
+package models
+
+// ExportVersion is raised when the export format changes in a way older
+// readers can't handle.
+const ExportVersion = 1
+
+// Export is an exported vault with every secret decrypted, it's only
+// written sealed with a passphrase.
+type Export struct {
+	Version int `json:"version"`
+	// ExportedAt is the Unix time of the export
+	ExportedAt int64        `json:"exported_at"`
+	Items      []ExportItem `json:"items"`
+}
+
+// ExportItem is an item of an export. Times are Unix times, 0 if unknown.
+type ExportItem struct {
+	// Type is one of the item types, logins included
+	Type       string            `json:"type"`
+	Name       string            `json:"name"`
+	Username   string            `json:"username,omitempty"`
+	Password   string            `json:"password,omitempty"`
+	URL        string            `json:"url,omitempty"`
+	Notes      string            `json:"notes,omitempty"`
+	Tags       []string          `json:"tags,omitempty"`
+	Fields     map[string]string `json:"fields,omitempty"`
+	OTP        string            `json:"otp,omitempty"`
+	CreatedAt  int64             `json:"created_at,omitempty"`
+	UpdatedAt  int64             `json:"updated_at,omitempty"`
+	AccessedAt int64             `json:"accessed_at,omitempty"`
+	// History are the previous passwords, the most recent first
+	History []ExportPassword `json:"history,omitempty"`
+}
+
+// ExportPassword is a previous password of an exported item.
+type ExportPassword struct {
+	Password   string `json:"password"`
+	UpdatedAt  int64  `json:"updated_at,omitempty"`
+	ReplacedAt int64  `json:"replaced_at"`
+}
+
+// ExportItemOf returns the export item of decrypted credentials.
+func ExportItemOf(c Credentials) ExportItem {
+	item := ExportItem{
+		Type:       c.ItemType().Name,
+		Name:       c.ServiceName,
+		Username:   c.Username,
+		Password:   c.PasswordHash,
+		URL:        c.URL,
+		Notes:      c.Notes,
+		Tags:       c.Tags,
+		Fields:     c.Fields,
+		OTP:        c.OTP,
+		CreatedAt:  c.CreatedAt,
+		UpdatedAt:  c.UpdatedAt,
+		AccessedAt: c.AccessedAt,
+	}
+
+	for _, v := range c.History {
+		item.History = append(item.History, ExportPassword{
+			Password:   v.Password,
+			UpdatedAt:  v.UpdatedAt,
+			ReplacedAt: v.ReplacedAt,
+		})
+	}
+
+	return item
+}
@@ -0,0 +1,21 @@
+package models
+
+// Ways to import an item with the service and username of a saved one.
+const (
+	DuplicatesSkip      = "skip"
+	DuplicatesOverwrite = "overwrite"
+	// DuplicatesKeepBoth saves the imported item under a numbered name
+	DuplicatesKeepBoth = "keep both"
+)
+
+// ImportResult counts what an import did. A dry run only counts new
+// items and duplicates.
+type ImportResult struct {
+	Added int
+	// Duplicates have the service and username of a saved item or of an
+	// earlier item of the same file
+	Duplicates  int
+	Skipped     int
+	Overwritten int
+	Renamed     int
+}
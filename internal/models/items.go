@@ -0,0 +1,349 @@
+package models
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+// Item types. Credentials saved before types existed have no type and are logins.
+const (
+	ItemLogin = "login"
+	ItemNote  = "note"
+	ItemCard  = "card"
+	ItemWiFi  = "wifi"
+	ItemToken = "token"
+)
+
+// FieldNotes is the key of a field kept in the notes of an item,
+// values of other fields are kept in its custom fields.
+const FieldNotes = "notes"
+
+// Keys of the parts of an item that can be edited besides the fields its
+// type declares, any other key is a custom field.
+const (
+	FieldService  = "service"
+	FieldUsername = "username"
+	FieldPassword = "password"
+	FieldURL      = "url"
+	FieldTags     = "tags"
+	FieldOTP      = "otp"
+)
+
+// ItemField is a value an item type asks for. All values are encrypted.
+type ItemField struct {
+	Key      string
+	Title    string
+	Prompt   string
+	Optional bool
+	// Summary fields are shown in listings, masked if Mask is set
+	Summary bool
+	// Choices are offered as buttons
+	Choices []string
+	// Validate checks an entered value and returns it normalized
+	Validate func(string) (string, error)
+	// Format shows a stored value in full
+	Format func(string) string
+	// Mask hides most of a value
+	Mask func(string) string
+}
+
+// Display returns the value as shown in the item view.
+func (f ItemField) Display(value string) string {
+	if f.Format != nil {
+		return f.Format(value)
+	}
+
+	return value
+}
+
+// Masked returns the value as shown in listings.
+func (f ItemField) Masked(value string) string {
+	if f.Mask != nil {
+		return f.Mask(value)
+	}
+
+	return f.Display(value)
+}
+
+// ItemType declares the fields of a kind of vault item. Logins have
+// their own flow with username, password and details, so they don't
+// declare fields.
+type ItemType struct {
+	Name   string
+	Title  string
+	Fields []ItemField
+}
+
+// ItemTypes are offered in this order when an item is created.
+var ItemTypes = []ItemType{
+	{
+		Name:  ItemLogin,
+		Title: "Login",
+	},
+	{
+		Name:  ItemNote,
+		Title: "Secure note",
+		Fields: []ItemField{
+			{Key: FieldNotes, Title: "Note", Prompt: "Enter note text:"},
+		},
+	},
+	{
+		Name:  ItemCard,
+		Title: "Payment card",
+		Fields: []ItemField{
+			{
+				Key:      "number",
+				Title:    "Number",
+				Prompt:   "Enter card number:",
+				Summary:  true,
+				Validate: validateCardNumber,
+				Format:   formatCardNumber,
+				Mask:     maskCardNumber,
+			},
+			{Key: "holder", Title: "Holder", Prompt: "Enter cardholder name:", Optional: true},
+			{
+				Key:      "expiry",
+				Title:    "Expiry",
+				Prompt:   "Enter expiry date as MM/YY:",
+				Optional: true,
+				Validate: validateCardExpiry,
+			},
+			{
+				Key:      "cvv",
+				Title:    "CVV",
+				Prompt:   "Enter CVV:",
+				Optional: true,
+				Validate: validateCVV,
+				Mask:     maskAll,
+			},
+		},
+	},
+	{
+		Name:  ItemWiFi,
+		Title: "Wi-Fi",
+		Fields: []ItemField{
+			{Key: "ssid", Title: "SSID", Prompt: "Enter network name (SSID):", Summary: true},
+			{
+				Key:      "security",
+				Title:    "Security",
+				Prompt:   "Choose security:",
+				Choices:  wifiSecurity,
+				Validate: validateWiFiSecurity,
+			},
+			{Key: "password", Title: "Password", Prompt: "Enter password:", Optional: true},
+		},
+	},
+	{
+		Name:  ItemToken,
+		Title: "API token",
+		Fields: []ItemField{
+			{Key: "token", Title: "Token", Prompt: "Enter token:"},
+			{
+				Key:      "expires",
+				Title:    "Expires",
+				Prompt:   "Enter expiry date as YYYY-MM-DD:",
+				Optional: true,
+				Summary:  true,
+				Validate: validateDate,
+				Format:   formatExpiry,
+			},
+		},
+	},
+}
+
+// ItemTypeOf returns the declared type by name, logins for an empty name.
+func ItemTypeOf(name string) (ItemType, bool) {
+	if name == "" {
+		name = ItemLogin
+	}
+
+	for _, t := range ItemTypes {
+		if t.Name == name {
+			return t, true
+		}
+	}
+
+	return ItemType{}, false
+}
+
+// ItemTypeByTitle returns the declared type with the title.
+func ItemTypeByTitle(title string) (ItemType, bool) {
+	for _, t := range ItemTypes {
+		if t.Title == title {
+			return t, true
+		}
+	}
+
+	return ItemType{}, false
+}
+
+// Field returns the declared field by key.
+func (t ItemType) Field(key string) (ItemField, bool) {
+	for _, f := range t.Fields {
+		if f.Key == key {
+			return f, true
+		}
+	}
+
+	return ItemField{}, false
+}
+
+// NextField returns the field asked for after the one with key.
+func (t ItemType) NextField(key string) (ItemField, bool) {
+	for i, f := range t.Fields {
+		if f.Key == key && i+1 < len(t.Fields) {
+			return t.Fields[i+1], true
+		}
+	}
+
+	return ItemField{}, false
+}
+
+// ItemType returns the type of the credentials. Types unknown to this
+// version are shown as logins.
+func (c Credentials) ItemType() ItemType {
+	t, ok := ItemTypeOf(c.Type)
+	if !ok {
+		t, _ = ItemTypeOf(ItemLogin)
+	}
+
+	return t
+}
+
+// Value returns the value of a declared field.
+func (c Credentials) Value(key string) string {
+	if key == FieldNotes {
+		return c.Notes
+	}
+
+	return c.Fields[key]
+}
+
+// DetailsOf returns details that set a declared field to value.
+func DetailsOf(key, value string) Details {
+	if key == FieldNotes {
+		return Details{Notes: value}
+	}
+
+	return Details{Fields: map[string]string{key: value}}
+}
+
+var wifiSecurity = []string{"WPA3", "WPA2", "WPA", "WEP", "None"}
+
+func validateWiFiSecurity(value string) (string, error) {
+	for _, s := range wifiSecurity {
+		if strings.EqualFold(s, strings.TrimSpace(value)) {
+			return s, nil
+		}
+	}
+
+	return "", errors.New("security must be one of " + strings.Join(wifiSecurity, ", "))
+}
+
+func validateCardNumber(value string) (string, error) {
+	number := strings.NewReplacer(" ", "", "-", "").Replace(value)
+
+	if len(number) < 12 || len(number) > 19 || !isDigits(number) {
+		return "", errors.New("card number must have 12 to 19 digits")
+	}
+
+	if !luhnValid(number) {
+		return "", errors.New("card number has a typo, its checksum doesn't match")
+	}
+
+	return number, nil
+}
+
+// luhnValid checks the check digit of a card number.
+func luhnValid(number string) bool {
+	sum := 0
+	double := false
+
+	for i := len(number) - 1; i >= 0; i-- {
+		digit := int(number[i] - '0')
+
+		if double {
+			digit *= 2
+			if digit > 9 {
+				digit -= 9
+			}
+		}
+
+		sum += digit
+		double = !double
+	}
+
+	return sum%10 == 0
+}
+
+func formatCardNumber(number string) string {
+	var groups []string
+	for len(number) > 4 {
+		groups = append(groups, number[:4])
+		number = number[4:]
+	}
+
+	return strings.Join(append(groups, number), " ")
+}
+
+func maskCardNumber(number string) string {
+	if len(number) < 4 {
+		return maskAll(number)
+	}
+
+	return "\xE2\x80\xA2\xE2\x80\xA2\xE2\x80\xA2\xE2\x80\xA2 " + number[len(number)-4:]
+}
+
+func maskAll(string) string {
+	return "\xE2\x80\xA2\xE2\x80\xA2\xE2\x80\xA2"
+}
+
+func validateCardExpiry(value string) (string, error) {
+	expiry, err := time.Parse("01/06", strings.TrimSpace(value))
+	if err != nil {
+		if expiry, err = time.Parse("01/2006", strings.TrimSpace(value)); err != nil {
+			return "", errors.New("expiry date must look like 07/27")
+		}
+	}
+
+	return expiry.Format("01/06"), nil
+}
+
+func validateCVV(value string) (string, error) {
+	value = strings.TrimSpace(value)
+
+	if len(value) < 3 || len(value) > 4 || !isDigits(value) {
+		return "", errors.New("CVV must have 3 or 4 digits")
+	}
+
+	return value, nil
+}
+
+func validateDate(value string) (string, error) {
+	date, err := time.Parse("2006-01-02", strings.TrimSpace(value))
+	if err != nil {
+		return "", errors.New("date must look like 2030-12-31")
+	}
+
+	return date.Format("2006-01-02"), nil
+}
+
+func formatExpiry(value string) string {
+	date, err := time.Parse("2006-01-02", value)
+	if err == nil && date.Before(time.Now()) {
+		return value + " (expired)"
+	}
+
+	return value
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+
+	return true
+}
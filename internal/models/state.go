@@ -1,9 +1,14 @@
 package models
 
+import "strings"
+
 type State struct {
 	UserID      uint64 `json:"user_id"`
 	State       string `json:"state"`
 	LastService string `json:"last_service"`
+	// Draft of the credentials being set, committed at once in setPassword
+	DraftUsername  string `json:"draft_username"`
+	DraftUpdatedAt int64  `json:"draft_updated_at"`
 }
 
 const (
@@ -13,9 +18,80 @@ const (
 	StateUpdateTokenConfirm = "updateTokenConfirm"
 	StateUpdateTokenInput   = "updateTokenInput"
 	StateUpdateToken        = "updateToken"
+	StateWeakToken          = "weakToken"
+	StateSetType            = "setType"
 	StateSetService         = "setService"
 	StateSetUsername        = "setUsername"
 	StateSetPassword        = "setPassword"
+	StateWeakPassword       = "weakPassword"
+	StateSetURL             = "setURL"
+	StateSetNotes           = "setNotes"
+	StateSetTags            = "setTags"
+	StateSetOTP             = "setOTP"
+	StateSetField           = "setField"
 	StateGetService         = "getService"
+	StateGetAccount         = "getAccount"
 	StateDeleteService      = "deleteService"
+	StateDeleteAccount      = "deleteAccount"
+	StateAuditToken         = "auditToken"
+	StateAuditRotate        = "auditRotate"
+	StateRotatePassword     = "rotatePassword"
+	StateOTPToken           = "otpToken"
+	StateHistoryToken       = "historyToken"
+	StateHistoryService     = "historyService"
+	StateHistoryAccount     = "historyAccount"
+	StateHistoryRestore     = "historyRestore"
+	StateTrashUndo          = "trashUndo"
+	StateTrash              = "trash"
+	StateTrashItem          = "trashItem"
+	StateEditService        = "editService"
+	StateEditAccount        = "editAccount"
+	StateEditField          = "editField"
+	StateExportToken        = "exportToken"
+	StateExportFormat       = "exportFormat"
+	StateExportPassphrase   = "exportPassphrase"
+	StateExportKeePass      = "exportKeePass"
+	StateExportBitwarden    = "exportBitwarden"
+	StateImportFile         = "importFile"
+	StateImportPassword     = "importPassword"
+	StateImportConfirm      = "importConfirm"
+
+	// StateSetItem is the prefix of states of the item creation flow,
+	// see ItemState
+	StateSetItem = "setItem"
+	// StateEditValue is the prefix of states asking for the new value of
+	// a field, see EditValueState
+	StateEditValue = "editValue"
 )
+
+// ItemState is the state asking for a field of an item type,
+// the name of the item when field is empty.
+func ItemState(itemType, field string) string {
+	if field == "" {
+		return StateSetItem + ":" + itemType
+	}
+
+	return StateSetItem + ":" + itemType + ":" + field
+}
+
+// ParseItemState returns the item type and field of a state made by ItemState.
+func ParseItemState(state string) (itemType, field string, ok bool) {
+	rest, ok := strings.CutPrefix(state, StateSetItem+":")
+	if !ok {
+		return "", "", false
+	}
+
+	itemType, field, _ = strings.Cut(rest, ":")
+
+	return itemType, field, true
+}
+
+// EditValueState is the state asking for the new value of the field.
+func EditValueState(field string) string {
+	return StateEditValue + ":" + field
+}
+
+// ParseEditValueState returns the field of a state made by EditValueState.
+func ParseEditValueState(state string) (field string, ok bool) {
+	return strings.CutPrefix(state, StateEditValue+":")
+}
@@ -3,4 +3,12 @@ package models
 type User struct {
 	ID    uint64 `json:"user_id"`
 	Token string `json:"token"`
+	// Settings are preferences of the user by key
+	Settings map[string]string `json:"settings,omitempty"`
 }
+
+// Keys of user settings.
+const (
+	// SettingGenerator keeps the default password generator options
+	SettingGenerator = "generator"
+)
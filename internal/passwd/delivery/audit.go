@@ -0,0 +1,237 @@
+package passwdHandler
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"telegram-bot/internal/bot"
+	"telegram-bot/internal/models"
+	"telegram-bot/pkg/strength"
+)
+
+// audit asks for the security password before the vault is decrypted.
+func (h Handler) audit(ctx context.Context, m *tgbotapi.Message) error {
+	msg := tgbotapi.NewMessage(m.Chat.ID, "Enter security password to audit your vault:")
+	msg.ReplyMarkup = h.BackToMenuKeyboard()
+
+	if _, err := h.bot.BotAPI.Send(msg); err != nil {
+		return err
+	}
+
+	return h.usecase.SetState(ctx, m.From.ID, models.StateAuditToken)
+}
+
+func (h Handler) auditToken(ctx context.Context, m *tgbotapi.Message, realToken string) error {
+	if m.Text != realToken {
+		msg := tgbotapi.NewMessage(m.Chat.ID, "Wrong security password.\nTry again:")
+		msg.ReplyMarkup = h.BackToMenuKeyboard()
+		_, err := h.bot.BotAPI.Send(msg)
+
+		return err
+	}
+
+	audit, err := h.usecase.Audit(ctx, m.From.ID, h.bot.StaleAge, h.bot.EncryptKey)
+	if err != nil {
+		return err
+	}
+
+	msg := tgbotapi.NewMessage(m.Chat.ID, auditText(audit, h.bot.StaleAge, time.Now()))
+
+	rotate := audit.Rotate()
+	if len(rotate) == 0 {
+		msg.ReplyMarkup = bot.MenuKeyboard()
+
+		if _, err = h.bot.BotAPI.Send(msg); err != nil {
+			return err
+		}
+
+		return h.usecase.SetState(ctx, m.From.ID, models.StateDefault)
+	}
+
+	labels := make([]string, len(rotate))
+	for i, c := range rotate {
+		labels[i] = rotateLabel(c.ServiceName, c.Username)
+	}
+
+	msg.Text += "\nChoose an account to change its password:"
+	msg.ReplyMarkup = h.optionsKeyboard(labels)
+
+	if _, err = h.bot.BotAPI.Send(msg); err != nil {
+		return err
+	}
+
+	return h.usecase.SetState(ctx, m.From.ID, models.StateAuditRotate)
+}
+
+// auditRotate asks for a new password of the account chosen in the report.
+func (h Handler) auditRotate(ctx context.Context, m *tgbotapi.Message) error {
+	service, username, err := h.findAccount(ctx, m.From.ID, m.Text)
+	if errors.Is(err, models.ErrNotFound) {
+		return h.serviceNotFound(ctx, m)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if err = h.usecase.SetDraft(ctx, m.From.ID, service, username); err != nil {
+		return err
+	}
+
+	msg := tgbotapi.NewMessage(m.Chat.ID, "Enter new password for "+m.Text+" or let me generate one:")
+	msg.ReplyMarkup = h.GenerateKeyboard()
+
+	if _, err = h.bot.BotAPI.Send(msg); err != nil {
+		return err
+	}
+
+	return h.usecase.SetState(ctx, m.From.ID, models.StateRotatePassword)
+}
+
+// rotatePassword replaces the password of the drafted account, its details are kept.
+func (h Handler) rotatePassword(ctx context.Context, m *tgbotapi.Message, state models.State) error {
+	service, username := state.LastService, state.DraftUsername
+
+	password := m.Text
+	if m.Text == models.GenerateCMD {
+		var err error
+		if password, err = h.generatePassword(ctx, m.From.ID); err != nil {
+			return err
+		}
+	}
+
+	if err := h.usecase.SetPassword(ctx, m.From.ID, service, username, password, h.bot.EncryptKey); err != nil {
+		return err
+	}
+
+	text := credentialsText("Your new credentials", models.Credentials{
+		ServiceName:  service,
+		Username:     username,
+		PasswordHash: password,
+	})
+
+	// Warnings quote parts of the password, which may break markdown
+	if result := strength.Estimate(password, username, service); result.Weak() {
+		text += "\xE2\x9A\xA0 This password is " + result.Score.String() + ".\n"
+	}
+	if h.usecase.Breached(password) {
+		text += "\xE2\x9A\xA0 " + breachedWarning + "\n"
+	}
+
+	msg := tgbotapi.NewMessage(m.Chat.ID, "Password changed! \xE2\x9C\x85\n"+text)
+	msg.ParseMode = "markdown"
+	msg.ReplyMarkup = bot.MenuKeyboard()
+
+	response, err := h.bot.BotAPI.Send(msg)
+	if err != nil {
+		return err
+	}
+
+	go bot.NiceTimerCredentials(response.Chat.ID, response.MessageID, h.bot, func() string {
+		return text
+	})
+
+	if err = h.usecase.DiscardDraft(ctx, m.From.ID); err != nil {
+		return err
+	}
+
+	return h.usecase.SetState(ctx, m.From.ID, models.StateDefault)
+}
+
+// rotateLabel names an account in the rotation picker.
+func rotateLabel(service, username string) string {
+	return service + " / " + accountLabel(username)
+}
+
+// findAccount returns the service and username of an account labeled by rotateLabel.
+func (h Handler) findAccount(ctx context.Context, userID int64, label string) (string, string, error) {
+	services, err := h.usecase.GetAllServices(ctx, userID)
+	if err != nil {
+		return "", "", err
+	}
+
+	for _, service := range services {
+		if !strings.HasPrefix(label, service+" / ") {
+			continue
+		}
+
+		usernames, err := h.usecase.GetAccounts(ctx, userID, service)
+		if err != nil {
+			return "", "", err
+		}
+
+		for _, username := range usernames {
+			if rotateLabel(service, username) == label {
+				return service, username, nil
+			}
+		}
+	}
+
+	return "", "", models.ErrNotFound
+}
+
+func auditText(audit models.Audit, staleAge time.Duration, now time.Time) string {
+	// Wi-Fi passwords, cards, notes and tokens aren't audited
+	unchecked := ""
+	if audit.Unchecked > 0 {
+		unchecked = "\nOnly passwords of logins are checked, " + strconv.Itoa(audit.Unchecked) + " other items aren't.\n"
+	}
+
+	if audit.Checked == 0 {
+		return "There are no saved passwords of logins to audit.\n" + unchecked
+	}
+
+	text := "Audit of " + strconv.Itoa(audit.Checked) + " passwords:\n"
+
+	if audit.IsClean() {
+		return text + "No problems found \xE2\x9C\x85\n" + unchecked
+	}
+
+	if len(audit.Weak) > 0 {
+		text += "\n\xE2\x9A\xA0 Weak (" + strconv.Itoa(len(audit.Weak)) + "):\n"
+		for _, c := range audit.Weak {
+			text += "- " + rotateLabel(c.ServiceName, c.Username) + ": " + strength.Score(c.Strength).String() + "\n"
+		}
+	}
+
+	if len(audit.Breached) > 0 {
+		text += "\n\xF0\x9F\x9A\xA8 Found in data breaches (" + strconv.Itoa(len(audit.Breached)) + "):\n"
+		for _, c := range audit.Breached {
+			text += "- " + rotateLabel(c.ServiceName, c.Username) + "\n"
+		}
+	}
+
+	if len(audit.Reused) > 0 {
+		text += "\n\xF0\x9F\x94\x81 Reused (" + strconv.Itoa(len(audit.Reused)) + "):\n"
+		for _, group := range audit.Reused {
+			labels := make([]string, len(group))
+			for i, c := range group {
+				labels[i] = rotateLabel(c.ServiceName, c.Username)
+			}
+			text += "- " + strings.Join(labels, ", ") + "\n"
+		}
+	}
+
+	if len(audit.Stale) > 0 {
+		days := strconv.Itoa(int(staleAge.Hours() / 24))
+		text += "\n\xE2\x8F\xB3 Unchanged for over " + days + " days (" + strconv.Itoa(len(audit.Stale)) + "):\n"
+		for _, c := range audit.Stale {
+			age := int(now.Sub(time.Unix(c.UpdatedAt, 0)).Hours() / 24)
+			text += "- " + rotateLabel(c.ServiceName, c.Username) + ": " + strconv.Itoa(age) + " days\n"
+		}
+	}
+
+	if len(audit.NoUsername) > 0 {
+		text += "\n\xF0\x9F\x91\xA4 Missing username (" + strconv.Itoa(len(audit.NoUsername)) + "):\n"
+		for _, c := range audit.NoUsername {
+			text += "- " + c.ServiceName + "\n"
+		}
+	}
+
+	return text + unchecked
+}
@@ -0,0 +1,32 @@
+package passwdHandler
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"telegram-bot/internal/models"
+)
+
+func TestAuditTextUnchecked(t *testing.T) {
+	note := "Only passwords of logins are checked, 2 other items aren't.\n"
+
+	tests := []struct {
+		audit models.Audit
+		want  string
+	}{
+		{models.Audit{Unchecked: 2}, "There are no saved passwords of logins to audit.\n\n" + note},
+		{models.Audit{Checked: 3, Unchecked: 2}, "No problems found \xE2\x9C\x85\n\n" + note},
+		{
+			models.Audit{Checked: 3, Unchecked: 2, NoUsername: []models.Credentials{{ServiceName: "github"}}},
+			"- github\n\n" + note,
+		},
+		{models.Audit{Checked: 3}, "No problems found \xE2\x9C\x85\n"},
+	}
+
+	for _, tt := range tests {
+		if text := auditText(tt.audit, 24*time.Hour, time.Now()); !strings.HasSuffix(text, tt.want) {
+			t.Errorf("expected text ending with %q, got:\n%s", tt.want, text)
+		}
+	}
+}
@@ -0,0 +1,249 @@
+package passwdHandler
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"telegram-bot/internal/bot"
+	"telegram-bot/internal/models"
+	"telegram-bot/pkg/totp"
+)
+
+// Optional details are asked for after the password is saved, so
+// the credentials are kept even if the user leaves halfway. The draft
+// keeps the service and username until the last step.
+
+func (h Handler) askURL(ctx context.Context, m *tgbotapi.Message) error {
+	return h.askDetail(ctx, m, "Enter website URL:", h.SkipKeyboard(), models.StateSetURL)
+}
+
+func (h Handler) setURL(ctx context.Context, m *tgbotapi.Message, state models.State) error {
+	if m.Text != models.SkipCMD {
+		if err := h.saveDetails(ctx, m, state, models.Details{URL: m.Text}); err != nil {
+			return err
+		}
+	}
+
+	return h.askDetail(ctx, m, "Enter notes:", h.SkipKeyboard(), models.StateSetNotes)
+}
+
+func (h Handler) setNotes(ctx context.Context, m *tgbotapi.Message, state models.State) error {
+	if m.Text != models.SkipCMD {
+		if err := h.saveDetails(ctx, m, state, models.Details{Notes: m.Text}); err != nil {
+			return err
+		}
+	}
+
+	return h.askDetail(ctx, m, "Enter tags separated by commas:", h.SkipKeyboard(), models.StateSetTags)
+}
+
+func (h Handler) setTags(ctx context.Context, m *tgbotapi.Message, state models.State) error {
+	if m.Text != models.SkipCMD {
+		if tags := models.ParseTags(m.Text); len(tags) > 0 {
+			if err := h.saveDetails(ctx, m, state, models.Details{Tags: tags}); err != nil {
+				return err
+			}
+		}
+	}
+
+	return h.askDetail(ctx, m, "Enter 2FA secret as base32 or an `otpauth://` URI:", h.SkipKeyboard(), models.StateSetOTP)
+}
+
+func (h Handler) setOTP(ctx context.Context, m *tgbotapi.Message, state models.State) error {
+	if m.Text != models.SkipCMD {
+		key, err := totp.Parse(m.Text)
+		if err != nil {
+			return h.askDetail(ctx, m, "That's not a 2FA secret, send it as base32 or an `otpauth://` URI:", h.SkipKeyboard(), models.StateSetOTP)
+		}
+
+		if key.Account == "" {
+			key.Issuer, key.Account = state.LastService, state.DraftUsername
+		}
+
+		if err = h.saveDetails(ctx, m, state, models.Details{OTP: key.URI()}); err != nil {
+			return err
+		}
+	}
+
+	return h.askDetail(
+		ctx, m,
+		"Send custom fields one per message as `name: value`, e.g. `PIN: 1234`.\n"+
+			"Press Done when finished:",
+		h.DoneKeyboard(),
+		models.StateSetField,
+	)
+}
+
+func (h Handler) setField(ctx context.Context, m *tgbotapi.Message, state models.State) error {
+	if m.Text == models.DoneCMD || m.Text == models.SkipCMD {
+		return h.finishDetails(ctx, m)
+	}
+
+	name, value, ok := parseField(m.Text)
+	if !ok {
+		msg := tgbotapi.NewMessage(m.Chat.ID, "Send the field as `name: value` or press Done:")
+		msg.ParseMode = "markdown"
+		msg.ReplyMarkup = h.DoneKeyboard()
+
+		_, err := h.bot.BotAPI.Send(msg)
+
+		return err
+	}
+
+	if err := h.saveDetails(ctx, m, state, models.Details{Fields: map[string]string{name: value}}); err != nil {
+		return err
+	}
+
+	msg := tgbotapi.NewMessage(m.Chat.ID, name+" saved \xE2\x9C\x85\nSend another field or press Done:")
+	msg.ReplyMarkup = h.DoneKeyboard()
+
+	_, err := h.bot.BotAPI.Send(msg)
+
+	return err
+}
+
+func (h Handler) finishDetails(ctx context.Context, m *tgbotapi.Message) error {
+	if err := h.usecase.DiscardDraft(ctx, m.From.ID); err != nil {
+		return err
+	}
+
+	msg := tgbotapi.NewMessage(m.Chat.ID, "Credentials saved \xE2\x9C\x85")
+	msg.ReplyMarkup = bot.MenuKeyboard()
+
+	if _, err := h.bot.BotAPI.Send(msg); err != nil {
+		return err
+	}
+
+	return h.usecase.SetState(ctx, m.From.ID, models.StateDefault)
+}
+
+func (h Handler) askDetail(ctx context.Context, m *tgbotapi.Message, text string, keyboard tgbotapi.ReplyKeyboardMarkup, state string) error {
+	msg := tgbotapi.NewMessage(m.Chat.ID, text)
+	msg.ParseMode = "markdown"
+	msg.ReplyMarkup = keyboard
+
+	if _, err := h.bot.BotAPI.Send(msg); err != nil {
+		return err
+	}
+
+	return h.usecase.SetState(ctx, m.From.ID, state)
+}
+
+// saveDetails adds details to the credentials of the draft. Saving
+// discards the draft, so it's set again for the next step.
+func (h Handler) saveDetails(ctx context.Context, m *tgbotapi.Message, state models.State, details models.Details) error {
+	err := h.usecase.SetDetails(ctx, m.From.ID, state.LastService, state.DraftUsername, details, h.bot.EncryptKey)
+	if err != nil {
+		return err
+	}
+
+	return h.usecase.SetDraft(ctx, m.From.ID, state.LastService, state.DraftUsername)
+}
+
+// parseField splits a "name: value" custom field.
+func parseField(text string) (string, string, bool) {
+	name, value, ok := strings.Cut(text, ":")
+	name, value = strings.TrimSpace(name), strings.TrimSpace(value)
+
+	if !ok || name == "" || value == "" {
+		return "", "", false
+	}
+
+	return name, value, true
+}
+
+// credentialsText shows credentials in markdown, logins under the title
+// and other items under the title of their type.
+func credentialsText(title string, c models.Credentials) string {
+	t := c.ItemType()
+
+	var text string
+	if len(t.Fields) == 0 {
+		text = title + " for " + escape(c.ServiceName) + ":\n" +
+			"Username: " + code(c.Username) + "\n" +
+			"Password: " + code(c.PasswordHash) + "\n"
+	} else {
+		text = t.Title + " " + escape(c.ServiceName) + ":\n"
+
+		for _, f := range t.Fields {
+			if value := c.Value(f.Key); value != "" {
+				text += f.Title + ": " + code(f.Display(value)) + "\n"
+			}
+		}
+	}
+
+	if c.URL != "" {
+		text += "URL: " + escape(c.URL) + "\n"
+	}
+
+	if len(c.Tags) > 0 {
+		text += "Tags: " + escape(strings.Join(c.Tags, ", ")) + "\n"
+	}
+
+	if c.OTP != "" {
+		text += "2FA code: " + otpCode(c.OTP, time.Now()) + "\n"
+	}
+
+	if _, declared := t.Field(models.FieldNotes); c.Notes != "" && !declared {
+		text += "Notes: " + code(c.Notes) + "\n"
+	}
+
+	names := make([]string, 0, len(c.Fields))
+	for name := range c.Fields {
+		if _, declared := t.Field(name); !declared {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		text += escape(name) + ": " + code(c.Fields[name]) + "\n"
+	}
+
+	if c.CreatedAt != 0 {
+		text += "Created: " + formatDate(c.CreatedAt) + "\n"
+	}
+
+	if c.UpdatedAt != 0 {
+		text += "Updated: " + formatDate(c.UpdatedAt) + "\n"
+	}
+
+	if c.AccessedAt != 0 {
+		text += "Last viewed: " + formatDate(c.AccessedAt) + "\n"
+	}
+
+	return text
+}
+
+// otpCode returns the code of a TOTP secret with its validity in markdown.
+func otpCode(uri string, now time.Time) string {
+	key, err := totp.Parse(uri)
+	if err != nil {
+		return "unavailable, the secret is damaged"
+	}
+
+	return "`" + key.Code(now) + "` (valid " + strconv.Itoa(int(key.Remaining(now)/time.Second)) + "s)"
+}
+
+// code formats a value as markdown code, a block if it has several lines
+// or a backquote, which would end inline code.
+func code(value string) string {
+	if strings.ContainsAny(value, "\n`") {
+		return "\n```\n" + value + "\n```"
+	}
+
+	return "`" + value + "`"
+}
+
+// markdownEscaper escapes the characters that start entities in markdown.
+var markdownEscaper = strings.NewReplacer("_", "\\_", "*", "\\*", "`", "\\`", "[", "\\[")
+
+// escape makes a value safe to show as markdown text.
+func escape(value string) string {
+	return markdownEscaper.Replace(value)
+}
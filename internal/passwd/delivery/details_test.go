@@ -0,0 +1,34 @@
+package passwdHandler
+
+import (
+	"strings"
+	"testing"
+
+	"telegram-bot/internal/models"
+)
+
+func TestCredentialsTextEscapesMarkdown(t *testing.T) {
+	text := credentialsText("Your credentials", models.Credentials{
+		ServiceName:  "my_service*",
+		Username:     "user_name",
+		PasswordHash: "pass`word",
+		Details: models.Details{
+			URL:    "https://example.com/a_b",
+			Tags:   []string{"work_stuff", "[x]"},
+			Fields: map[string]string{"pin_code": "1_2"},
+		},
+	})
+
+	for _, want := range []string{
+		"Your credentials for my\\_service\\*:\n",
+		"Username: `user_name`\n",
+		"Password: \n```\npass`word\n```\n",
+		"URL: https://example.com/a\\_b\n",
+		"Tags: work\\_stuff, \\[x]\n",
+		"pin\\_code: `1_2`\n",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("expected %q in:\n%s", want, text)
+		}
+	}
+}
@@ -0,0 +1,267 @@
+package passwdHandler
+
+import (
+	"context"
+	"errors"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"telegram-bot/internal/bot"
+	"telegram-bot/internal/models"
+	"telegram-bot/pkg/totp"
+)
+
+// Editing changes one part of a saved item and leaves the rest alone.
+// The draft keeps the item while the part and its new value are chosen.
+
+// customField is the edit key of custom fields, their name is entered
+// with the value
+const customField = "custom"
+
+func (h Handler) edit(ctx context.Context, m *tgbotapi.Message) error {
+	var err error
+
+	msg := tgbotapi.NewMessage(m.Chat.ID, "Enter service:")
+	if msg.ReplyMarkup, err = h.allServicesKeyboard(ctx, m.From.ID); err != nil {
+		return err
+	}
+
+	if _, err = h.bot.BotAPI.Send(msg); err != nil {
+		return err
+	}
+
+	return h.usecase.SetState(ctx, m.From.ID, models.StateEditService)
+}
+
+func (h Handler) editService(ctx context.Context, m *tgbotapi.Message) error {
+	usernames, err := h.usecase.GetAccounts(ctx, m.From.ID, m.Text)
+	if err != nil {
+		return err
+	}
+
+	switch len(usernames) {
+	case 0:
+		return h.serviceNotFound(ctx, m)
+	case 1:
+		return h.editItem(ctx, m, m.Text, usernames[0])
+	default:
+		return h.askAccount(ctx, m, usernames, models.StateEditAccount)
+	}
+}
+
+func (h Handler) editAccount(ctx context.Context, m *tgbotapi.Message, lastService string) error {
+	return h.editItem(ctx, m, lastService, accountUsername(m.Text))
+}
+
+// editItem offers the parts of the item that can be changed.
+func (h Handler) editItem(ctx context.Context, m *tgbotapi.Message, service, username string) error {
+	credentials, err := h.usecase.Get(ctx, m.From.ID, service, username, h.bot.EncryptKey)
+	if errors.Is(err, models.ErrNotFound) {
+		return h.serviceNotFound(ctx, m)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if err = h.usecase.SetDraft(ctx, m.From.ID, service, username); err != nil {
+		return err
+	}
+
+	fields := editFields(credentials)
+	titles := make([]string, len(fields))
+	for i, f := range fields {
+		titles[i] = f.Title
+	}
+
+	msg := tgbotapi.NewMessage(m.Chat.ID, "What do you want to change in "+rotateLabel(service, username)+"?")
+	msg.ReplyMarkup = h.optionsKeyboard(titles)
+
+	if _, err = h.bot.BotAPI.Send(msg); err != nil {
+		return err
+	}
+
+	return h.usecase.SetState(ctx, m.From.ID, models.StateEditField)
+}
+
+// editField asks for the new value of the part chosen. Passwords are
+// replaced like rotated ones, keeping the replaced one in the history.
+func (h Handler) editField(ctx context.Context, m *tgbotapi.Message, state models.State) error {
+	t, f, ok, err := h.findEditField(ctx, m.From.ID, state, func(f models.ItemField) bool {
+		return f.Title == m.Text
+	})
+	if err != nil {
+		return err
+	}
+
+	if !ok {
+		msg := tgbotapi.NewMessage(m.Chat.ID, "Choose what to change with the buttons below.")
+		_, err = h.bot.BotAPI.Send(msg)
+
+		return err
+	}
+
+	// Passwords of other items, such as Wi-Fi, are plain fields
+	if f.Key == models.FieldPassword && t.Name == models.ItemLogin {
+		msg := tgbotapi.NewMessage(m.Chat.ID, "Enter new password or let me generate one:")
+		msg.ReplyMarkup = h.GenerateKeyboard()
+
+		if _, err = h.bot.BotAPI.Send(msg); err != nil {
+			return err
+		}
+
+		return h.usecase.SetState(ctx, m.From.ID, models.StateRotatePassword)
+	}
+
+	return h.askEditValue(ctx, m, f, f.Prompt)
+}
+
+// editValue saves the value entered for the field of the drafted item.
+func (h Handler) editValue(ctx context.Context, m *tgbotapi.Message, state models.State, field string) error {
+	_, f, ok, err := h.findEditField(ctx, m.From.ID, state, func(f models.ItemField) bool {
+		return f.Key == field
+	})
+	if err != nil {
+		return err
+	}
+
+	if !ok {
+		return models.ErrNotFound
+	}
+
+	key, value := f.Key, m.Text
+
+	switch {
+	case m.Text == models.ClearCMD && f.Optional:
+		value = ""
+	case f.Key == customField:
+		if key, value, ok = parseField(m.Text); !ok {
+			return h.askEditValue(ctx, m, f, "Send the field as `name: value`:")
+		}
+	case f.Key == models.FieldOTP:
+		otp, err := totp.Parse(m.Text)
+		if err != nil {
+			return h.askEditValue(ctx, m, f, "That's not a 2FA secret, send it as base32 or an `otpauth://` URI:")
+		}
+
+		if otp.Account == "" {
+			otp.Issuer, otp.Account = state.LastService, state.DraftUsername
+		}
+		value = otp.URI()
+	case f.Validate != nil:
+		if value, err = f.Validate(value); err != nil {
+			return h.askEditValue(ctx, m, f, capitalize(err.Error())+". Try again:")
+		}
+	}
+
+	err = h.usecase.EditField(ctx, m.From.ID, state.LastService, state.DraftUsername, key, value, h.bot.EncryptKey)
+	if errors.Is(err, models.ErrConflict) {
+		return h.askEditValue(ctx, m, f, "There is already an item with this name, enter another one:")
+	}
+
+	if err != nil {
+		return err
+	}
+
+	text := f.Title + " saved \xE2\x9C\x85"
+	switch {
+	case value == "":
+		text = f.Title + " cleared \xE2\x9C\x85"
+	case f.Key == customField:
+		text = key + " saved \xE2\x9C\x85"
+	}
+
+	msg := tgbotapi.NewMessage(m.Chat.ID, text)
+	msg.ReplyMarkup = bot.MenuKeyboard()
+
+	if _, err = h.bot.BotAPI.Send(msg); err != nil {
+		return err
+	}
+
+	if err = h.usecase.DiscardDraft(ctx, m.From.ID); err != nil {
+		return err
+	}
+
+	return h.usecase.SetState(ctx, m.From.ID, models.StateDefault)
+}
+
+// findEditField returns the type of the drafted item and its first part matching.
+func (h Handler) findEditField(
+	ctx context.Context, userID int64, state models.State, match func(models.ItemField) bool,
+) (models.ItemType, models.ItemField, bool, error) {
+	credentials, err := h.usecase.Get(ctx, userID, state.LastService, state.DraftUsername, h.bot.EncryptKey)
+	if err != nil {
+		return models.ItemType{}, models.ItemField{}, false, err
+	}
+
+	for _, f := range editFields(credentials) {
+		if match(f) {
+			return credentials.ItemType(), f, true, nil
+		}
+	}
+
+	return credentials.ItemType(), models.ItemField{}, false, nil
+}
+
+// askEditValue asks for the value of the field, optional ones can be cleared.
+func (h Handler) askEditValue(ctx context.Context, m *tgbotapi.Message, f models.ItemField, text string) error {
+	var rows [][]tgbotapi.KeyboardButton
+
+	if len(f.Choices) > 0 {
+		var row []tgbotapi.KeyboardButton
+		for _, choice := range f.Choices {
+			row = append(row, tgbotapi.NewKeyboardButton(choice))
+		}
+		rows = append(rows, row)
+	}
+
+	if f.Optional {
+		rows = append(rows, tgbotapi.NewKeyboardButtonRow(tgbotapi.NewKeyboardButton(models.ClearCMD)))
+	}
+
+	rows = append(rows, tgbotapi.NewKeyboardButtonRow(tgbotapi.NewKeyboardButton("Back to menu <<")))
+
+	msg := tgbotapi.NewMessage(m.Chat.ID, text)
+	msg.ParseMode = "markdown"
+	msg.ReplyMarkup = tgbotapi.NewReplyKeyboard(rows...)
+
+	if _, err := h.bot.BotAPI.Send(msg); err != nil {
+		return err
+	}
+
+	return h.usecase.SetState(ctx, m.From.ID, models.EditValueState(f.Key))
+}
+
+// editFields lists the parts of c that can be changed: its name, the
+// username and password of logins or the fields declared by its type,
+// then the details every item has.
+func editFields(c models.Credentials) []models.ItemField {
+	t := c.ItemType()
+
+	fields := []models.ItemField{{Key: models.FieldService, Title: "Name", Prompt: "Enter new name:"}}
+
+	if len(t.Fields) == 0 {
+		fields = append(fields,
+			models.ItemField{Key: models.FieldUsername, Title: "Username", Prompt: "Enter new username:"},
+			models.ItemField{Key: models.FieldPassword, Title: "Password"},
+		)
+	}
+
+	fields = append(fields, t.Fields...)
+	fields = append(fields, models.ItemField{Key: models.FieldURL, Title: "URL", Prompt: "Enter website URL:", Optional: true})
+
+	if _, declared := t.Field(models.FieldNotes); !declared {
+		fields = append(fields, models.ItemField{Key: models.FieldNotes, Title: "Notes", Prompt: "Enter notes:", Optional: true})
+	}
+
+	return append(fields,
+		models.ItemField{Key: models.FieldTags, Title: "Tags", Prompt: "Enter tags separated by commas:", Optional: true},
+		models.ItemField{
+			Key:      models.FieldOTP,
+			Title:    "2FA secret",
+			Prompt:   "Enter 2FA secret as base32 or an `otpauth://` URI:",
+			Optional: true,
+		},
+		models.ItemField{Key: customField, Title: "Custom field", Prompt: "Send the field as `name: value`, e.g. `PIN: 1234`:"},
+	)
+}
@@ -0,0 +1,202 @@
+package passwdHandler
+
+import (
+	"context"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"telegram-bot/internal/bot"
+	"telegram-bot/internal/models"
+)
+
+const (
+	// exportCaption goes with the exported file
+	exportCaption = "Your vault, encrypted with your passphrase \xF0\x9F\x94\x92\nSave the file somewhere safe."
+	// keePassCaption goes with the exported KeePass database
+	keePassCaption = "Your vault as a KeePass database \xF0\x9F\x94\x92\n" +
+		"Open it in KeePass or KeePassXC with the password you chose."
+	// bitwardenCaption goes with the exported Bitwarden file
+	bitwardenCaption = "Your vault as a Bitwarden export \xF0\x9F\x94\x92\n" +
+		"Import it in Bitwarden as \"Bitwarden (json)\" with the password you chose."
+	// plainBitwardenCaption goes with the exported Bitwarden file without
+	// a password
+	plainBitwardenCaption = "Your vault as an unencrypted Bitwarden export \xE2\x9A\xA0\n" +
+		"Anyone with the file can read every password, import it in Bitwarden as \"Bitwarden (json)\" and delete it."
+)
+
+// export asks for the security password before the vault is exported.
+func (h Handler) export(ctx context.Context, m *tgbotapi.Message) error {
+	msg := tgbotapi.NewMessage(m.Chat.ID, "Enter security password to export your vault:")
+	msg.ReplyMarkup = h.BackToMenuKeyboard()
+
+	if _, err := h.bot.BotAPI.Send(msg); err != nil {
+		return err
+	}
+
+	return h.usecase.SetState(ctx, m.From.ID, models.StateExportToken)
+}
+
+func (h Handler) exportToken(ctx context.Context, m *tgbotapi.Message, realToken string) error {
+	if m.Text != realToken {
+		msg := tgbotapi.NewMessage(m.Chat.ID, "Wrong security password.\nTry again:")
+		msg.ReplyMarkup = h.BackToMenuKeyboard()
+		_, err := h.bot.BotAPI.Send(msg)
+
+		return err
+	}
+
+	msg := tgbotapi.NewMessage(m.Chat.ID, "Correct \xE2\x9C\x85\n"+
+		"Export an encrypted file this bot can import, a KeePass database or a Bitwarden export?")
+	msg.ReplyMarkup = h.ExportKeyboard()
+
+	if _, err := h.bot.BotAPI.Send(msg); err != nil {
+		return err
+	}
+
+	return h.usecase.SetState(ctx, m.From.ID, models.StateExportFormat)
+}
+
+// exportFormat asks for the passphrase or password of the chosen format.
+func (h Handler) exportFormat(ctx context.Context, m *tgbotapi.Message) error {
+	var text, state string
+
+	switch m.Text {
+	case models.SealedExportCMD:
+		text = "Enter a passphrase to encrypt the export with. It isn't stored, without it the file can't be opened:"
+		state = models.StateExportPassphrase
+	case models.KeePassExportCMD:
+		text = "Enter a password for the KeePass database. It isn't stored, without it the database can't be opened:"
+		state = models.StateExportKeePass
+	case models.BitwardenExportCMD:
+		return h.askBitwardenPassword(ctx, m)
+	default:
+		msg := tgbotapi.NewMessage(m.Chat.ID, "Choose with the buttons below.")
+		_, err := h.bot.BotAPI.Send(msg)
+
+		return err
+	}
+
+	msg := tgbotapi.NewMessage(m.Chat.ID, text)
+	msg.ReplyMarkup = h.BackToMenuKeyboard()
+
+	if _, err := h.bot.BotAPI.Send(msg); err != nil {
+		return err
+	}
+
+	return h.usecase.SetState(ctx, m.From.ID, state)
+}
+
+// exportPassphrase sends the vault sealed with the passphrase.
+func (h Handler) exportPassphrase(ctx context.Context, m *tgbotapi.Message) error {
+	if warning := h.exportSecret(ctx, m); warning != "" {
+		return h.retryExport(m, warning+"\nEnter a stronger passphrase:")
+	}
+
+	data, err := h.usecase.Export(ctx, m.From.ID, m.Text, h.bot.EncryptKey)
+	if err != nil {
+		return err
+	}
+
+	return h.sendExport(ctx, m, "passwords-"+time.Now().UTC().Format("2006-01-02")+".sealed", data, exportCaption)
+}
+
+// exportKeePass sends the vault as a KeePass database with the password.
+func (h Handler) exportKeePass(ctx context.Context, m *tgbotapi.Message) error {
+	if warning := h.exportSecret(ctx, m); warning != "" {
+		return h.retryExport(m, warning+"\nEnter a stronger password:")
+	}
+
+	data, err := h.usecase.ExportKeePass(ctx, m.From.ID, m.Text, h.bot.EncryptKey)
+	if err != nil {
+		return err
+	}
+
+	return h.sendExport(ctx, m, "passwords-"+time.Now().UTC().Format("2006-01-02")+".kdbx", data, keePassCaption)
+}
+
+// askBitwardenPassword asks for the password of a Bitwarden export, which
+// can be skipped for an unencrypted one.
+func (h Handler) askBitwardenPassword(ctx context.Context, m *tgbotapi.Message) error {
+	msg := tgbotapi.NewMessage(m.Chat.ID, "Enter a password for the Bitwarden export. It isn't stored, "+
+		"without it the file can't be opened.\nSkip to export it unencrypted, anyone with the file could read it:")
+	msg.ReplyMarkup = h.SkipKeyboard()
+
+	if _, err := h.bot.BotAPI.Send(msg); err != nil {
+		return err
+	}
+
+	return h.usecase.SetState(ctx, m.From.ID, models.StateExportBitwarden)
+}
+
+// exportBitwarden sends the vault as a Bitwarden export protected by the
+// password, or unencrypted if it was skipped.
+func (h Handler) exportBitwarden(ctx context.Context, m *tgbotapi.Message) error {
+	password, caption := m.Text, bitwardenCaption
+
+	if m.Text == models.SkipCMD {
+		password, caption = "", plainBitwardenCaption
+	} else if warning := h.exportSecret(ctx, m); warning != "" {
+		msg := tgbotapi.NewMessage(m.Chat.ID, warning+"\nEnter a stronger password:")
+		msg.ReplyMarkup = h.SkipKeyboard()
+		_, err := h.bot.BotAPI.Send(msg)
+
+		return err
+	}
+
+	data, err := h.usecase.ExportBitwarden(ctx, m.From.ID, password, h.bot.EncryptKey)
+	if err != nil {
+		return err
+	}
+
+	return h.sendExport(ctx, m, "passwords-"+time.Now().UTC().Format("2006-01-02")+".json", data, caption)
+}
+
+// exportSecret deletes the message with the passphrase or password of
+// an export right away and warns if it's weak.
+func (h Handler) exportSecret(ctx context.Context, m *tgbotapi.Message) string {
+	if _, err := h.bot.BotAPI.Request(tgbotapi.NewDeleteMessage(m.Chat.ID, m.MessageID)); err != nil {
+		h.logger.WithContext(ctx).Warnf("delete passphrase message of user %d: %s", m.From.ID, err)
+	}
+
+	return h.passwordWarning(m.Text)
+}
+
+func (h Handler) retryExport(m *tgbotapi.Message, text string) error {
+	msg := tgbotapi.NewMessage(m.Chat.ID, text)
+	msg.ReplyMarkup = h.BackToMenuKeyboard()
+	_, err := h.bot.BotAPI.Send(msg)
+
+	return err
+}
+
+// sendExport sends the exported vault as a document, which is deleted
+// like credentials are.
+func (h Handler) sendExport(ctx context.Context, m *tgbotapi.Message, name string, data []byte, caption string) error {
+	doc := tgbotapi.NewDocument(m.Chat.ID, tgbotapi.FileBytes{Name: name, Bytes: data})
+	doc.Caption = caption
+	doc.ReplyMarkup = bot.MenuKeyboard()
+
+	response, err := h.bot.BotAPI.Send(doc)
+	if err != nil {
+		return err
+	}
+
+	go bot.NiceTimerDocument(response.Chat.ID, response.MessageID, h.bot, caption)
+
+	return h.usecase.SetState(ctx, m.From.ID, models.StateDefault)
+}
+
+// ExportKeyboard offers the formats of an export.
+func (h Handler) ExportKeyboard() tgbotapi.ReplyKeyboardMarkup {
+	return tgbotapi.NewReplyKeyboard(
+		tgbotapi.NewKeyboardButtonRow(
+			tgbotapi.NewKeyboardButton(models.SealedExportCMD),
+			tgbotapi.NewKeyboardButton(models.KeePassExportCMD),
+			tgbotapi.NewKeyboardButton(models.BitwardenExportCMD),
+		),
+		tgbotapi.NewKeyboardButtonRow(
+			tgbotapi.NewKeyboardButton("Back to menu <<"),
+		),
+	)
+}
@@ -0,0 +1,105 @@
+package passwdHandler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"telegram-bot/internal/bot"
+	"telegram-bot/internal/models"
+	"telegram-bot/pkg/passgen"
+)
+
+const genUsage = "Options: a length, random, pronounceable or phrase with a number of words, " +
+	"nolower, noupper, nodigits, nosymbols, noambiguous, sep=-\n" +
+	"e.g. /gen 24 nosymbols, /gen phrase 6, /gen pronounceable 14\n" +
+	"/gen default followed by options makes them your default."
+
+// gen answers /gen [default] [options] with a generated password. Options
+// change the user's default policy for this password only, or for good
+// after "default". The password is deleted like shown credentials.
+func (h Handler) gen(ctx context.Context, m *tgbotapi.Message) error {
+	options := strings.TrimSpace(m.CommandArguments())
+
+	options, save := strings.CutPrefix(options, "default")
+
+	policy, err := h.usecase.GeneratorPolicy(ctx, m.From.ID)
+	if err != nil {
+		return err
+	}
+
+	if policy, err = passgen.Parse(options, policy); err != nil {
+		return h.invalidPolicy(m, err)
+	}
+
+	if save {
+		if err = h.usecase.SetGeneratorPolicy(ctx, m.From.ID, policy); err != nil {
+			return err
+		}
+	}
+
+	password, err := passgen.Generate(policy)
+	if err != nil {
+		return err
+	}
+
+	text := "Generated password:\n" + code(password) + "\n\n" + policyText(policy) + "\n" + genUsage + "\n"
+	if save {
+		text = "Default options saved \xE2\x9C\x85\n" + text
+	}
+
+	msg := tgbotapi.NewMessage(m.Chat.ID, text)
+	msg.ParseMode = "markdown"
+	msg.ReplyMarkup = bot.MenuKeyboard()
+
+	response, err := h.bot.BotAPI.Send(msg)
+	if err != nil {
+		return err
+	}
+
+	go bot.NiceTimerCredentials(response.Chat.ID, response.MessageID, h.bot, func() string {
+		return text
+	})
+
+	return nil
+}
+
+func (h Handler) invalidPolicy(m *tgbotapi.Message, err error) error {
+	if !errors.Is(err, passgen.ErrInvalidPolicy) {
+		return err
+	}
+
+	msg := tgbotapi.NewMessage(m.Chat.ID, "Can't generate: "+err.Error()+"\n\n"+genUsage)
+	_, err = h.bot.BotAPI.Send(msg)
+
+	return err
+}
+
+// generatePassword makes a password with the user's default policy.
+func (h Handler) generatePassword(ctx context.Context, userID int64) (string, error) {
+	policy, err := h.usecase.GeneratorPolicy(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+
+	return passgen.Generate(policy)
+}
+
+func policyText(policy passgen.Policy) string {
+	return fmt.Sprintf("Options: `%s`, about %.0f bits of entropy.", policy, policy.Entropy())
+}
+
+// GenerateKeyboard offers to generate the password instead of typing it.
+func (h Handler) GenerateKeyboard() tgbotapi.ReplyKeyboardMarkup {
+	return tgbotapi.NewReplyKeyboard(
+		tgbotapi.NewKeyboardButtonRow(
+			tgbotapi.NewKeyboardButton(models.GenerateCMD),
+		),
+		tgbotapi.NewKeyboardButtonRow(
+			tgbotapi.NewKeyboardButton("Back to menu <<"),
+		),
+	)
+}
@@ -0,0 +1,201 @@
+package passwdHandler
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"telegram-bot/internal/bot"
+	"telegram-bot/internal/models"
+)
+
+// restorePrefix starts the buttons restoring a previous password, followed
+// by its number in the history
+const restorePrefix = "Restore "
+
+// history asks for the security password before previous passwords are shown.
+func (h Handler) history(ctx context.Context, m *tgbotapi.Message) error {
+	msg := tgbotapi.NewMessage(m.Chat.ID, "Enter security password to see previous passwords:")
+	msg.ReplyMarkup = h.BackToMenuKeyboard()
+
+	if _, err := h.bot.BotAPI.Send(msg); err != nil {
+		return err
+	}
+
+	return h.usecase.SetState(ctx, m.From.ID, models.StateHistoryToken)
+}
+
+func (h Handler) historyToken(ctx context.Context, m *tgbotapi.Message, realToken string) error {
+	if m.Text != realToken {
+		msg := tgbotapi.NewMessage(m.Chat.ID, "Wrong security password.\nTry again:")
+		msg.ReplyMarkup = h.BackToMenuKeyboard()
+		_, err := h.bot.BotAPI.Send(msg)
+
+		return err
+	}
+
+	var err error
+
+	msg := tgbotapi.NewMessage(m.Chat.ID, "Correct \xE2\x9C\x85\nEnter service:")
+	if msg.ReplyMarkup, err = h.allServicesKeyboard(ctx, m.From.ID); err != nil {
+		return err
+	}
+
+	if _, err = h.bot.BotAPI.Send(msg); err != nil {
+		return err
+	}
+
+	return h.usecase.SetState(ctx, m.From.ID, models.StateHistoryService)
+}
+
+func (h Handler) historyService(ctx context.Context, m *tgbotapi.Message) error {
+	usernames, err := h.usecase.GetAccounts(ctx, m.From.ID, m.Text)
+	if err != nil {
+		return err
+	}
+
+	switch len(usernames) {
+	case 0:
+		return h.serviceNotFound(ctx, m)
+	case 1:
+		return h.sendHistory(ctx, m, m.Text, usernames[0])
+	default:
+		return h.askAccount(ctx, m, usernames, models.StateHistoryAccount)
+	}
+}
+
+func (h Handler) historyAccount(ctx context.Context, m *tgbotapi.Message, lastService string) error {
+	return h.sendHistory(ctx, m, lastService, accountUsername(m.Text))
+}
+
+// sendHistory shows the previous passwords of the account and offers to
+// restore one of them. The account is kept as a draft until it's chosen.
+func (h Handler) sendHistory(ctx context.Context, m *tgbotapi.Message, service, username string) error {
+	credentials, err := h.usecase.Get(ctx, m.From.ID, service, username, h.bot.EncryptKey)
+	if errors.Is(err, models.ErrNotFound) {
+		return h.serviceNotFound(ctx, m)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if len(credentials.History) == 0 {
+		msg := tgbotapi.NewMessage(m.Chat.ID, "There are no previous passwords of "+rotateLabel(service, username)+".")
+		msg.ReplyMarkup = bot.MenuKeyboard()
+
+		if _, err = h.bot.BotAPI.Send(msg); err != nil {
+			return err
+		}
+
+		if err = h.usecase.DiscardDraft(ctx, m.From.ID); err != nil {
+			return err
+		}
+
+		return h.usecase.SetState(ctx, m.From.ID, models.StateDefault)
+	}
+
+	if err = h.usecase.SetDraft(ctx, m.From.ID, service, username); err != nil {
+		return err
+	}
+
+	text := func() string {
+		return historyText(credentials)
+	}
+
+	labels := make([]string, len(credentials.History))
+	for i := range credentials.History {
+		labels[i] = restorePrefix + strconv.Itoa(i+1)
+	}
+
+	msg := tgbotapi.NewMessage(m.Chat.ID, text())
+	msg.ParseMode = "markdown"
+	msg.ReplyMarkup = h.optionsKeyboard(labels)
+
+	response, err := h.bot.BotAPI.Send(msg)
+	if err != nil {
+		return err
+	}
+
+	go bot.NiceTimerCredentials(response.Chat.ID, response.MessageID, h.bot, text)
+
+	return h.usecase.SetState(ctx, m.From.ID, models.StateHistoryRestore)
+}
+
+// historyRestore makes the chosen previous password of the drafted account current.
+func (h Handler) historyRestore(ctx context.Context, m *tgbotapi.Message, state models.State) error {
+	number, err := strconv.Atoi(strings.TrimPrefix(m.Text, restorePrefix))
+	if err != nil || !strings.HasPrefix(m.Text, restorePrefix) {
+		msg := tgbotapi.NewMessage(m.Chat.ID, "Choose a password to restore with the buttons below.")
+		_, err = h.bot.BotAPI.Send(msg)
+
+		return err
+	}
+
+	service, username := state.LastService, state.DraftUsername
+
+	if err = h.usecase.RestorePassword(ctx, m.From.ID, service, username, number-1, h.bot.EncryptKey); err != nil {
+		return err
+	}
+
+	credentials, err := h.usecase.Get(ctx, m.From.ID, service, username, h.bot.EncryptKey)
+	if err != nil {
+		return err
+	}
+
+	text := credentialsText("Your restored credentials", models.Credentials{
+		ServiceName:  service,
+		Username:     username,
+		PasswordHash: credentials.PasswordHash,
+	})
+
+	msg := tgbotapi.NewMessage(m.Chat.ID, "Password restored! \xE2\x9C\x85\n"+text)
+	msg.ParseMode = "markdown"
+	msg.ReplyMarkup = bot.MenuKeyboard()
+
+	response, err := h.bot.BotAPI.Send(msg)
+	if err != nil {
+		return err
+	}
+
+	go bot.NiceTimerCredentials(response.Chat.ID, response.MessageID, h.bot, func() string {
+		return text
+	})
+
+	if err = h.usecase.DiscardDraft(ctx, m.From.ID); err != nil {
+		return err
+	}
+
+	return h.usecase.SetState(ctx, m.From.ID, models.StateDefault)
+}
+
+// historyText lists the current and previous passwords of c in markdown.
+func historyText(c models.Credentials) string {
+	text := "Passwords of " + escape(rotateLabel(c.ServiceName, c.Username)) + ":\n" +
+		"Current"
+	if c.UpdatedAt != 0 {
+		text += " since " + formatDate(c.UpdatedAt)
+	}
+	text += ": " + code(c.PasswordHash) + "\n"
+
+	for i, v := range c.History {
+		text += strconv.Itoa(i+1) + ". "
+		if v.UpdatedAt != 0 {
+			text += formatDate(v.UpdatedAt) + " to "
+		} else {
+			text += "until "
+		}
+		text += formatDate(v.ReplacedAt) + ": " + code(v.Password) + "\n"
+	}
+
+	return text
+}
+
+// formatDate formats a Unix time as a UTC date.
+func formatDate(unix int64) string {
+	return time.Unix(unix, 0).UTC().Format("2006-01-02")
+}
@@ -0,0 +1,310 @@
+package passwdHandler
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"telegram-bot/internal/bot"
+	"telegram-bot/internal/models"
+	"telegram-bot/pkg/importer"
+)
+
+// Imports read an export of another password manager or of the bot sent
+// as a file. The file is deleted from the chat once it's read, encrypted
+// files wait for their password, a dry run tells what the file holds and
+// the import runs once the user chooses how to handle duplicates.
+
+const (
+	// maxImportSize is far above exports of thousands of items
+	maxImportSize = 5 << 20
+	// importTTL is how long a read file waits for the user's choice
+	importTTL = 10 * time.Minute
+)
+
+// pendingImports keeps read files between the dry run and the user's
+// choice. They hold plaintext secrets, so they are only kept in memory
+// and for a short while, a restart drops them.
+type pendingImports struct {
+	mu    sync.Mutex
+	files map[int64]pendingImport
+}
+
+type pendingImport struct {
+	entries []importer.Entry
+	// locked is an encrypted file waiting for its password
+	locked  []byte
+	expires time.Time
+}
+
+func newPendingImports() *pendingImports {
+	return &pendingImports{files: make(map[int64]pendingImport)}
+}
+
+func (p *pendingImports) put(userID int64, f pendingImport) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	for id, f := range p.files {
+		if now.After(f.expires) {
+			delete(p.files, id)
+		}
+	}
+
+	f.expires = now.Add(importTTL)
+	p.files[userID] = f
+}
+
+// take returns the file of the user and forgets it.
+func (p *pendingImports) take(userID int64) (pendingImport, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	f, ok := p.files[userID]
+	delete(p.files, userID)
+
+	if !ok || time.Now().After(f.expires) {
+		return pendingImport{}, false
+	}
+
+	return f, true
+}
+
+func (h Handler) startImport(ctx context.Context, m *tgbotapi.Message) error {
+	msg := tgbotapi.NewMessage(m.Chat.ID, "Send a CSV export of Chrome, Edge, Firefox, Bitwarden, 1Password or KeePassXC, "+
+		"a KeePass database, a Bitwarden JSON export or an encrypted export of this bot, as a file.\nIt's deleted from the chat once read.")
+	msg.ReplyMarkup = h.BackToMenuKeyboard()
+
+	if _, err := h.bot.BotAPI.Send(msg); err != nil {
+		return err
+	}
+
+	return h.usecase.SetState(ctx, m.From.ID, models.StateImportFile)
+}
+
+// importFile reads the file sent and tells what importing it would do,
+// or asks for its password if it's encrypted.
+func (h Handler) importFile(ctx context.Context, m *tgbotapi.Message) error {
+	if m.Document == nil {
+		msg := tgbotapi.NewMessage(m.Chat.ID, "Send the export as a file:")
+		msg.ReplyMarkup = h.BackToMenuKeyboard()
+		_, err := h.bot.BotAPI.Send(msg)
+
+		return err
+	}
+
+	data, err := h.bot.DownloadFile(ctx, m.Document.FileID, maxImportSize)
+
+	// The file has every password in plaintext
+	if _, deleteErr := h.bot.BotAPI.Request(tgbotapi.NewDeleteMessage(m.Chat.ID, m.MessageID)); deleteErr != nil {
+		h.logger.WithContext(ctx).Warnf("delete import file of user %d: %s", m.From.ID, deleteErr)
+	}
+
+	if errors.Is(err, bot.ErrFileTooLarge) {
+		return h.retryImport(m, "The file is larger than "+strconv.Itoa(maxImportSize>>20)+" MB, send a smaller one:")
+	}
+
+	if err != nil {
+		return err
+	}
+
+	file, err := importer.Parse(data)
+	if errors.Is(err, importer.ErrPasswordRequired) {
+		h.imports.put(m.From.ID, pendingImport{locked: data})
+
+		text := "This " + string(file.Format) + " file is encrypted, enter its password:"
+		if file.Format == importer.Sealed {
+			text = "This export of the bot is encrypted, enter the passphrase it was exported with:"
+		}
+
+		msg := tgbotapi.NewMessage(m.Chat.ID, text)
+		msg.ReplyMarkup = h.BackToMenuKeyboard()
+
+		if _, err = h.bot.BotAPI.Send(msg); err != nil {
+			return err
+		}
+
+		return h.usecase.SetState(ctx, m.From.ID, models.StateImportPassword)
+	}
+
+	if errors.Is(err, importer.ErrUnknownFormat) && file.Format == importer.Bitwarden {
+		h.logger.WithContext(ctx).Infof("read import file of user %d: %s", m.From.ID, err)
+
+		return h.retryImport(m, "I can't read this Bitwarden export. Exports encrypted with your account key "+
+			"can only be read by Bitwarden, export the vault as \"Password protected\" and send it:")
+	}
+
+	if errors.Is(err, importer.ErrUnknownFormat) {
+		return h.retryImport(m, "I can't read this file, send a CSV export of one of the password managers above:")
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return h.importDryRun(ctx, m, file)
+}
+
+// importPassword reads the encrypted file sent with the password, whose
+// message is deleted right away.
+func (h Handler) importPassword(ctx context.Context, m *tgbotapi.Message) error {
+	if _, err := h.bot.BotAPI.Request(tgbotapi.NewDeleteMessage(m.Chat.ID, m.MessageID)); err != nil {
+		h.logger.WithContext(ctx).Warnf("delete import password message of user %d: %s", m.From.ID, err)
+	}
+
+	f, ok := h.imports.take(m.From.ID)
+	if !ok || f.locked == nil {
+		return h.finishImport(ctx, m, "The file was sent too long ago, send it again with /import.")
+	}
+
+	file, err := importer.ParseWithPassword(f.locked, m.Text)
+	if errors.Is(err, importer.ErrPassword) {
+		h.imports.put(m.From.ID, f)
+		return h.retryImport(m, "Wrong password, try again:")
+	}
+
+	if errors.Is(err, importer.ErrUnknownFormat) {
+		h.logger.WithContext(ctx).Infof("read import file of user %d: %s", m.From.ID, err)
+
+		text := "I can't read this file. KeePass databases are supported in the KDBX 4 format " +
+			"protected by a password alone, without a key file."
+		switch file.Format {
+		case importer.Bitwarden:
+			text = "I can't read this Bitwarden export, it may be damaged."
+		case importer.Sealed:
+			text = "I can't read this export of the bot, it may be damaged or made by a newer version."
+		}
+
+		return h.finishImport(ctx, m, text)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return h.importDryRun(ctx, m, file)
+}
+
+// importDryRun tells what importing the file read would do and keeps it
+// until the user chooses.
+func (h Handler) importDryRun(ctx context.Context, m *tgbotapi.Message, file importer.File) error {
+	if len(file.Entries) == 0 {
+		return h.finishImport(ctx, m, "There is nothing to import in this "+string(file.Format)+" export.")
+	}
+
+	result, err := h.usecase.Import(ctx, m.From.ID, file.Entries, models.DuplicatesSkip, true, h.bot.EncryptKey)
+	if err != nil {
+		return err
+	}
+
+	h.imports.put(m.From.ID, pendingImport{entries: file.Entries})
+
+	text := "Found " + strconv.Itoa(len(file.Entries)) + " items in a " + string(file.Format) + " export:\n" +
+		"- new: " + strconv.Itoa(result.Added) + "\n" +
+		"- already saved: " + strconv.Itoa(result.Duplicates) + "\n"
+	if file.Skipped > 0 {
+		text += "- rows without a name or anything to keep, not imported: " + strconv.Itoa(file.Skipped) + "\n"
+	}
+
+	if result.Duplicates > 0 {
+		text += "\nSkip the items already saved, overwrite them or keep both?"
+	} else {
+		text += "\nImport them?"
+	}
+
+	msg := tgbotapi.NewMessage(m.Chat.ID, text)
+	msg.ReplyMarkup = h.ImportKeyboard(result.Duplicates > 0)
+
+	if _, err = h.bot.BotAPI.Send(msg); err != nil {
+		return err
+	}
+
+	return h.usecase.SetState(ctx, m.From.ID, models.StateImportConfirm)
+}
+
+// importConfirm imports the file read handling duplicates as chosen.
+func (h Handler) importConfirm(ctx context.Context, m *tgbotapi.Message) error {
+	var duplicates string
+
+	switch m.Text {
+	case models.ImportCMD, models.SkipDuplicatesCMD:
+		duplicates = models.DuplicatesSkip
+	case models.OverwriteCMD:
+		duplicates = models.DuplicatesOverwrite
+	case models.KeepBothCMD:
+		duplicates = models.DuplicatesKeepBoth
+	default:
+		msg := tgbotapi.NewMessage(m.Chat.ID, "Choose with the buttons below.")
+		_, err := h.bot.BotAPI.Send(msg)
+
+		return err
+	}
+
+	f, ok := h.imports.take(m.From.ID)
+	if !ok || f.entries == nil {
+		return h.finishImport(ctx, m, "The file was read too long ago, send it again with /import.")
+	}
+
+	result, err := h.usecase.Import(ctx, m.From.ID, f.entries, duplicates, false, h.bot.EncryptKey)
+	if err != nil {
+		return err
+	}
+
+	text := "Imported \xE2\x9C\x85\n- added: " + strconv.Itoa(result.Added) + "\n"
+	if result.Overwritten > 0 {
+		text += "- overwritten: " + strconv.Itoa(result.Overwritten) + "\n"
+	}
+	if result.Renamed > 0 {
+		text += "- kept both under a numbered name: " + strconv.Itoa(result.Renamed) + "\n"
+	}
+	if result.Skipped > 0 {
+		text += "- skipped as already saved: " + strconv.Itoa(result.Skipped) + "\n"
+	}
+
+	return h.finishImport(ctx, m, text)
+}
+
+// retryImport asks for another file.
+func (h Handler) retryImport(m *tgbotapi.Message, text string) error {
+	msg := tgbotapi.NewMessage(m.Chat.ID, text)
+	msg.ReplyMarkup = h.BackToMenuKeyboard()
+	_, err := h.bot.BotAPI.Send(msg)
+
+	return err
+}
+
+func (h Handler) finishImport(ctx context.Context, m *tgbotapi.Message, text string) error {
+	msg := tgbotapi.NewMessage(m.Chat.ID, text)
+	msg.ReplyMarkup = bot.MenuKeyboard()
+
+	if _, err := h.bot.BotAPI.Send(msg); err != nil {
+		return err
+	}
+
+	return h.usecase.SetState(ctx, m.From.ID, models.StateDefault)
+}
+
+// ImportKeyboard offers to import a file, choosing how to handle
+// duplicates if it has any.
+func (h Handler) ImportKeyboard(duplicates bool) tgbotapi.ReplyKeyboardMarkup {
+	row := tgbotapi.NewKeyboardButtonRow(tgbotapi.NewKeyboardButton(models.ImportCMD))
+	if duplicates {
+		row = tgbotapi.NewKeyboardButtonRow(
+			tgbotapi.NewKeyboardButton(models.SkipDuplicatesCMD),
+			tgbotapi.NewKeyboardButton(models.OverwriteCMD),
+			tgbotapi.NewKeyboardButton(models.KeepBothCMD),
+		)
+	}
+
+	return tgbotapi.NewReplyKeyboard(
+		row,
+		tgbotapi.NewKeyboardButtonRow(
+			tgbotapi.NewKeyboardButton("Back to menu <<"),
+		),
+	)
+}
@@ -0,0 +1,230 @@
+package passwdHandler
+
+import (
+	"context"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"telegram-bot/internal/bot"
+	"telegram-bot/internal/models"
+)
+
+// Items other than logins are saved once their first field is entered,
+// the remaining fields are added one by one like the details of a login.
+
+func (h Handler) itemTypesKeyboard() tgbotapi.ReplyKeyboardMarkup {
+	titles := make([]string, len(models.ItemTypes))
+	for i, t := range models.ItemTypes {
+		titles[i] = t.Title
+	}
+
+	return h.optionsKeyboard(titles)
+}
+
+func (h Handler) setType(ctx context.Context, m *tgbotapi.Message) error {
+	t, ok := models.ItemTypeByTitle(m.Text)
+	if !ok {
+		msg := tgbotapi.NewMessage(m.Chat.ID, "Choose one of the item types:")
+		msg.ReplyMarkup = h.itemTypesKeyboard()
+
+		_, err := h.bot.BotAPI.Send(msg)
+
+		return err
+	}
+
+	if t.Name == models.ItemLogin {
+		return h.askService(ctx, m)
+	}
+
+	return h.askDetail(ctx, m, "Enter name:", h.BackToMenuKeyboard(), models.ItemState(t.Name, ""))
+}
+
+// setItem handles the name of an item when field is empty and the value
+// of the field otherwise.
+func (h Handler) setItem(ctx context.Context, m *tgbotapi.Message, state models.State, itemType, field string) error {
+	t, ok := models.ItemTypeOf(itemType)
+	if !ok || len(t.Fields) == 0 {
+		if err := h.usecase.SetState(ctx, m.From.ID, models.StateDefault); err != nil {
+			return err
+		}
+
+		return h.help(m)
+	}
+
+	if field == "" {
+		return h.setItemName(ctx, m, t)
+	}
+
+	f, ok := t.Field(field)
+	if !ok {
+		return h.finishDetails(ctx, m)
+	}
+
+	if m.Text == models.SkipCMD {
+		if !f.Optional {
+			return h.askItemField(ctx, m, t, f, f.Title+" is required. "+f.Prompt)
+		}
+
+		return h.nextItemField(ctx, m, t, f)
+	}
+
+	value := m.Text
+	if f.Validate != nil {
+		var err error
+		if value, err = f.Validate(value); err != nil {
+			return h.askItemField(ctx, m, t, f, capitalize(err.Error())+". Try again:")
+		}
+	}
+
+	if field != t.Fields[0].Key {
+		if err := h.saveDetails(ctx, m, state, models.DetailsOf(field, value)); err != nil {
+			return err
+		}
+
+		return h.nextItemField(ctx, m, t, f)
+	}
+
+	err := h.usecase.SaveItem(ctx, m.From.ID, models.Credentials{
+		ServiceName: state.LastService,
+		Type:        t.Name,
+		Details:     models.DetailsOf(field, value),
+	}, h.bot.EncryptKey)
+	if err != nil {
+		return err
+	}
+
+	if err = h.usecase.SetDraft(ctx, m.From.ID, state.LastService, ""); err != nil {
+		return err
+	}
+
+	return h.nextItemField(ctx, m, t, f)
+}
+
+func (h Handler) setItemName(ctx context.Context, m *tgbotapi.Message, t models.ItemType) error {
+	// Items have no username, so an item with the name would be replaced
+	usernames, err := h.usecase.GetAccounts(ctx, m.From.ID, m.Text)
+	if err != nil {
+		return err
+	}
+
+	for _, username := range usernames {
+		if username == "" {
+			msg := tgbotapi.NewMessage(m.Chat.ID, "There is already an item named "+m.Text+", enter another name:")
+			msg.ReplyMarkup = h.BackToMenuKeyboard()
+
+			_, err = h.bot.BotAPI.Send(msg)
+
+			return err
+		}
+	}
+
+	if err = h.usecase.SetDraft(ctx, m.From.ID, m.Text, ""); err != nil {
+		return err
+	}
+
+	return h.askItemField(ctx, m, t, t.Fields[0], t.Fields[0].Prompt)
+}
+
+func (h Handler) nextItemField(ctx context.Context, m *tgbotapi.Message, t models.ItemType, f models.ItemField) error {
+	next, ok := t.NextField(f.Key)
+	if !ok {
+		return h.finishDetails(ctx, m)
+	}
+
+	return h.askItemField(ctx, m, t, next, next.Prompt)
+}
+
+func (h Handler) askItemField(ctx context.Context, m *tgbotapi.Message, t models.ItemType, f models.ItemField, text string) error {
+	var rows [][]tgbotapi.KeyboardButton
+
+	if len(f.Choices) > 0 {
+		var row []tgbotapi.KeyboardButton
+		for _, choice := range f.Choices {
+			row = append(row, tgbotapi.NewKeyboardButton(choice))
+		}
+		rows = append(rows, row)
+	}
+
+	if f.Optional {
+		rows = append(rows, tgbotapi.NewKeyboardButtonRow(tgbotapi.NewKeyboardButton(models.SkipCMD)))
+	}
+
+	rows = append(rows, tgbotapi.NewKeyboardButtonRow(tgbotapi.NewKeyboardButton("Back to menu <<")))
+
+	msg := tgbotapi.NewMessage(m.Chat.ID, text)
+	msg.ReplyMarkup = tgbotapi.NewReplyKeyboard(rows...)
+
+	if _, err := h.bot.BotAPI.Send(msg); err != nil {
+		return err
+	}
+
+	return h.usecase.SetState(ctx, m.From.ID, models.ItemState(t.Name, f.Key))
+}
+
+func (h Handler) search(ctx context.Context, m *tgbotapi.Message) error {
+	query := strings.TrimSpace(m.CommandArguments())
+	if query == "" {
+		msg := tgbotapi.NewMessage(m.Chat.ID, "Send /search with what to look for, e.g. /search github")
+		_, err := h.bot.BotAPI.Send(msg)
+
+		return err
+	}
+
+	items, err := h.usecase.Search(ctx, m.From.ID, query, h.bot.EncryptKey)
+	if err != nil {
+		return err
+	}
+
+	text := "Nothing found for " + query
+	if len(items) > 0 {
+		lines := make([]string, len(items))
+		for i, item := range items {
+			lines[i] = itemSummary(item)
+		}
+
+		text = "Found for " + query + ":\n" + strings.Join(lines, "\n")
+	}
+
+	msg := tgbotapi.NewMessage(m.Chat.ID, text)
+	msg.ReplyMarkup = bot.MenuKeyboard()
+
+	_, err = h.bot.BotAPI.Send(msg)
+
+	return err
+}
+
+// itemSummary describes an item in a line without revealing its secrets.
+func itemSummary(c models.Credentials) string {
+	t := c.ItemType()
+
+	var parts []string
+	if c.Username != "" {
+		parts = append(parts, c.Username)
+	}
+
+	for _, f := range t.Fields {
+		if value := c.Value(f.Key); f.Summary && value != "" {
+			parts = append(parts, f.Masked(value))
+		}
+	}
+
+	if c.URL != "" {
+		parts = append(parts, c.URL)
+	}
+
+	summary := "\xE2\x80\xA2 " + t.Title + ": " + c.ServiceName
+	if len(parts) > 0 {
+		summary += " (" + strings.Join(parts, ", ") + ")"
+	}
+
+	return summary
+}
+
+func capitalize(s string) string {
+	if s == "" {
+		return s
+	}
+
+	return strings.ToUpper(s[:1]) + s[1:]
+}
@@ -0,0 +1,101 @@
+package passwdHandler
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"telegram-bot/internal/bot"
+	"telegram-bot/internal/models"
+)
+
+// otp asks for the security password before the codes of the service are
+// shown. The service is kept as a draft until the password is checked.
+func (h Handler) otp(ctx context.Context, m *tgbotapi.Message) error {
+	service := strings.TrimSpace(m.CommandArguments())
+	if service == "" {
+		msg := tgbotapi.NewMessage(m.Chat.ID, "Send /otp with the service name, e.g. /otp github")
+		_, err := h.bot.BotAPI.Send(msg)
+
+		return err
+	}
+
+	if err := h.usecase.SetDraft(ctx, m.From.ID, service, ""); err != nil {
+		return err
+	}
+
+	msg := tgbotapi.NewMessage(m.Chat.ID, "Enter security password to see 2FA codes:")
+	msg.ReplyMarkup = h.BackToMenuKeyboard()
+
+	if _, err := h.bot.BotAPI.Send(msg); err != nil {
+		return err
+	}
+
+	return h.usecase.SetState(ctx, m.From.ID, models.StateOTPToken)
+}
+
+// otpToken answers with the current codes of the accounts of the service
+// once the security password is correct. The codes are refreshed and
+// deleted like shown credentials.
+func (h Handler) otpToken(ctx context.Context, m *tgbotapi.Message, realToken, service string) error {
+	if m.Text != realToken {
+		msg := tgbotapi.NewMessage(m.Chat.ID, "Wrong security password.\nTry again:")
+		msg.ReplyMarkup = h.BackToMenuKeyboard()
+		_, err := h.bot.BotAPI.Send(msg)
+
+		return err
+	}
+
+	if err := h.usecase.DiscardDraft(ctx, m.From.ID); err != nil {
+		return err
+	}
+
+	if err := h.usecase.SetState(ctx, m.From.ID, models.StateDefault); err != nil {
+		return err
+	}
+
+	accounts, err := h.usecase.OTP(ctx, m.From.ID, service, h.bot.EncryptKey)
+	if err != nil {
+		return err
+	}
+
+	if len(accounts) == 0 {
+		msg := tgbotapi.NewMessage(m.Chat.ID, "There is no 2FA secret saved for "+service)
+		msg.ReplyMarkup = bot.MenuKeyboard()
+		_, err = h.bot.BotAPI.Send(msg)
+
+		return err
+	}
+
+	text := func() string {
+		return otpText(service, accounts, time.Now())
+	}
+
+	msg := tgbotapi.NewMessage(m.Chat.ID, text())
+	msg.ParseMode = "markdown"
+	msg.ReplyMarkup = bot.MenuKeyboard()
+
+	response, err := h.bot.BotAPI.Send(msg)
+	if err != nil {
+		return err
+	}
+
+	go bot.NiceTimerCredentials(response.Chat.ID, response.MessageID, h.bot, text)
+
+	return nil
+}
+
+func otpText(service string, accounts []models.Credentials, now time.Time) string {
+	if len(accounts) == 1 {
+		return "2FA code for " + escape(service) + ": " + otpCode(accounts[0].OTP, now) + "\n"
+	}
+
+	text := "2FA codes for " + escape(service) + ":\n"
+	for _, c := range accounts {
+		text += escape(accountLabel(c.Username)) + ": " + otpCode(c.OTP, now) + "\n"
+	}
+
+	return text
+}
@@ -1,7 +1,9 @@
 package passwdHandler
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"strconv"
 
 	"telegram-bot/internal/models"
@@ -19,6 +21,7 @@ type Handler struct {
 	usecase passwdUsecase.PasswdUsecase
 	bot     *bot.Bot
 	logger  *logger.Logger
+	imports *pendingImports
 }
 
 func NewHandler(usecase passwdUsecase.PasswdUsecase, bot *bot.Bot) *Handler {
@@ -26,6 +29,7 @@ func NewHandler(usecase passwdUsecase.PasswdUsecase, bot *bot.Bot) *Handler {
 		usecase: usecase,
 		bot:     bot,
 		logger:  logger.GetInstance(),
+		imports: newPendingImports(),
 	}
 }
 
@@ -37,114 +41,299 @@ func (h Handler) GetMessage(c echo.Context) error {
 		return err
 	}
 
+	ctx := c.Request().Context()
+
 	toLog, _ := json.MarshalIndent(u, "", "  ")
-	h.logger.Debugf("update: \n%s", toLog)
+	h.logger.WithContext(ctx).Debugf("update %d: \n%s", u.UpdateID, toLog)
 
 	c.Set("chatID", u.Message.Chat.ID)
 	c.Set("bot", h.bot.BotAPI)
 
-	user, err := h.usecase.GetUser(u.Message.From.ID, h.bot.EncryptKey)
-	if err != nil {
+	return h.replyError(ctx, u.Message, h.handleMessage(ctx, u.Message))
+}
+
+func (h Handler) handleMessage(ctx context.Context, m *tgbotapi.Message) error {
+	user, err := h.usecase.GetUser(ctx, m.From.ID, h.bot.EncryptKey)
+	if err != nil && !errors.Is(err, models.ErrNotFound) {
 		return err
 	}
+	registered := err == nil
 
-	state, err := h.usecase.GetState(u.Message.From.ID)
+	state, err := h.usecase.GetState(ctx, m.From.ID)
 	if err != nil {
 		return err
 	}
 
-	if user == (models.User{}) && state.State != models.StateSetToken {
-		return h.start(u.Message)
+	if !registered && state.State != models.StateSetToken {
+		return h.start(ctx, m)
+	}
+
+	// Commands need the token, unregistered users are asked for it first
+	if !registered && m.IsCommand() {
+		if m.Command() == "start" {
+			return h.start(ctx, m)
+		}
+
+		return h.tokenIsCommand(m)
 	}
 
 	if state.State == models.StateSetToken {
-		switch u.Message.Text {
+		switch m.Text {
 		case models.BackToMenuCMD, models.SetCMD, models.GetCMD, models.DelCMD, models.UpdateTokenCMD, models.HelpCMD:
-			msg := tgbotapi.NewMessage(u.Message.Chat.ID, "Security password can't be a command, write it again")
-			_, err = h.bot.BotAPI.Send(msg)
-			return err
+			return h.tokenIsCommand(m)
 		}
 	}
 
-	if u.Message.Command() == "start" {
-		if err = h.usecase.SetState(u.Message.From.ID, models.StateDefault); err != nil {
+	if m.Command() == "search" {
+		return h.search(ctx, m)
+	}
+
+	if m.Command() == "otp" {
+		return h.otp(ctx, m)
+	}
+
+	if m.Command() == "gen" {
+		return h.gen(ctx, m)
+	}
+
+	if m.Command() == "audit" {
+		return h.audit(ctx, m)
+	}
+
+	if m.Command() == "history" {
+		return h.history(ctx, m)
+	}
+
+	if m.Command() == "trash" {
+		return h.trash(ctx, m)
+	}
+
+	if m.Command() == "edit" {
+		return h.edit(ctx, m)
+	}
+
+	if m.Command() == "export" {
+		return h.export(ctx, m)
+	}
+
+	if m.Command() == "import" {
+		return h.startImport(ctx, m)
+	}
+
+	if m.Command() == "start" {
+		if err = h.usecase.SetState(ctx, m.From.ID, models.StateDefault); err != nil {
 			return err
 		}
-		return h.startExisting(u.Message)
+		return h.startExisting(m)
 	}
 
-	switch u.Message.Text {
+	switch m.Text {
 	case models.HelpCMD:
-		return h.help(u.Message)
+		return h.help(m)
 	case models.SetCMD:
-		return h.set(u.Message)
+		return h.set(ctx, m)
 	case models.GetCMD:
-		return h.askToken(u.Message)
+		return h.askToken(ctx, m)
 	case models.DelCMD:
-		return h.delete(u.Message)
+		return h.delete(ctx, m)
 	case models.UpdateTokenCMD:
-		return h.updateTokenQ(u.Message)
+		return h.updateTokenQ(ctx, m)
 	case models.BackToMenuCMD:
-		if err = h.usecase.SetState(u.Message.From.ID, models.StateDefault); err != nil {
+		if err = h.usecase.SetState(ctx, m.From.ID, models.StateDefault); err != nil {
 			return err
 		}
 
-		switch state.State {
-		case models.StateSetUsername:
-		case models.StateSetPassword:
-			return h.usecase.Delete(u.Message.From.ID, state.LastService)
+		if err = h.usecase.DiscardDraft(ctx, m.From.ID); err != nil {
+			return err
 		}
 
-		return h.help(u.Message)
+		return h.help(m)
 	default:
+		if itemType, field, ok := models.ParseItemState(state.State); ok {
+			return h.setItem(ctx, m, state, itemType, field)
+		}
+
+		if field, ok := models.ParseEditValueState(state.State); ok {
+			return h.editValue(ctx, m, state, field)
+		}
+
 		switch state.State {
 		case models.StateCheckToken:
-			return h.checkToken(u.Message, user.Token)
+			return h.checkToken(ctx, m, user.Token)
+		case models.StateAuditToken:
+			return h.auditToken(ctx, m, user.Token)
+		case models.StateAuditRotate:
+			return h.auditRotate(ctx, m)
+		case models.StateRotatePassword:
+			return h.rotatePassword(ctx, m, state)
+		case models.StateOTPToken:
+			return h.otpToken(ctx, m, user.Token, state.LastService)
+		case models.StateHistoryToken:
+			return h.historyToken(ctx, m, user.Token)
+		case models.StateHistoryService:
+			return h.historyService(ctx, m)
+		case models.StateHistoryAccount:
+			return h.historyAccount(ctx, m, state.LastService)
+		case models.StateHistoryRestore:
+			return h.historyRestore(ctx, m, state)
+		case models.StateTrashUndo:
+			return h.trashUndo(ctx, m, state)
+		case models.StateTrash:
+			return h.trashChoose(ctx, m, state)
+		case models.StateTrashItem:
+			return h.trashItem(ctx, m, state)
+		case models.StateExportToken:
+			return h.exportToken(ctx, m, user.Token)
+		case models.StateExportFormat:
+			return h.exportFormat(ctx, m)
+		case models.StateExportPassphrase:
+			return h.exportPassphrase(ctx, m)
+		case models.StateExportKeePass:
+			return h.exportKeePass(ctx, m)
+		case models.StateExportBitwarden:
+			return h.exportBitwarden(ctx, m)
+		case models.StateImportFile:
+			return h.importFile(ctx, m)
+		case models.StateImportPassword:
+			return h.importPassword(ctx, m)
+		case models.StateImportConfirm:
+			return h.importConfirm(ctx, m)
+		case models.StateEditService:
+			return h.editService(ctx, m)
+		case models.StateEditAccount:
+			return h.editAccount(ctx, m, state.LastService)
+		case models.StateEditField:
+			return h.editField(ctx, m, state)
 		case models.StateSetToken:
-			return h.setToken(u.Message)
+			return h.setToken(ctx, m)
+		case models.StateWeakToken:
+			return h.weakToken(ctx, m)
 
 		case models.StateUpdateTokenConfirm:
-			return h.updateTokenQ(u.Message)
+			return h.updateTokenQ(ctx, m)
 		case models.StateUpdateTokenInput:
-			return h.updateTokenInput(u.Message)
+			return h.updateTokenInput(ctx, m)
 		case models.StateUpdateToken:
-			return h.updateToken(u.Message)
+			return h.updateToken(ctx, m)
 
+		case models.StateSetType:
+			return h.setType(ctx, m)
 		case models.StateSetService:
-			return h.setService(u.Message)
+			return h.setService(ctx, m)
 		case models.StateSetUsername:
-			return h.setUsername(u.Message, state.LastService)
+			return h.setUsername(ctx, m, state.LastService)
 		case models.StateSetPassword:
-			return h.setPassword(u.Message, state.LastService)
+			return h.setPassword(ctx, m, state)
+		case models.StateWeakPassword:
+			return h.weakPassword(ctx, m, state)
+		case models.StateSetURL:
+			return h.setURL(ctx, m, state)
+		case models.StateSetNotes:
+			return h.setNotes(ctx, m, state)
+		case models.StateSetTags:
+			return h.setTags(ctx, m, state)
+		case models.StateSetOTP:
+			return h.setOTP(ctx, m, state)
+		case models.StateSetField:
+			return h.setField(ctx, m, state)
 
 		case models.StateGetService:
-			return h.getService(u.Message)
+			return h.getService(ctx, m)
+		case models.StateGetAccount:
+			return h.getAccount(ctx, m, state.LastService)
 
 		case models.StateDeleteService:
-			return h.deleteService(u.Message)
+			return h.deleteService(ctx, m)
+		case models.StateDeleteAccount:
+			return h.deleteAccount(ctx, m, state.LastService)
 		default:
-			if err = h.usecase.SetState(u.Message.From.ID, models.StateDefault); err != nil {
+			if err = h.usecase.SetState(ctx, m.From.ID, models.StateDefault); err != nil {
 				return err
 			}
 
-			return h.help(u.Message)
+			return h.help(m)
 		}
 	}
 }
 
-func (h Handler) allServicesKeyboard(userID int64) (tgbotapi.ReplyKeyboardMarkup, error) {
-	var keyboard [][]tgbotapi.KeyboardButton
-	var row []tgbotapi.KeyboardButton
+// replyError answers errors with a known cause with a specific message,
+// the rest get the generic apology from the logger middleware.
+func (h Handler) replyError(ctx context.Context, m *tgbotapi.Message, err error) error {
+	var text string
 
-	services, err := h.usecase.GetAllServices(userID)
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, models.ErrNotFound):
+		text = "Not found, it may have been deleted \xE2\x9D\x8C"
+	case errors.Is(err, models.ErrConflict):
+		text = "It already exists \xE2\x9D\x8C"
+	case errors.Is(err, models.ErrCorruptTuple):
+		text = "Your stored data is damaged and can't be read \xE2\x9B\x94"
+	case errors.Is(err, models.ErrUnavailable):
+		text = "Storage is temporarily unavailable, try again in a minute \xE2\x8F\xB3"
+	default:
+		return err
+	}
+
+	h.logger.WithContext(ctx).Warnf("request of user %d failed: %s", m.From.ID, err)
+
+	msg := tgbotapi.NewMessage(m.Chat.ID, text)
+	msg.ReplyMarkup = bot.MenuKeyboard()
+
+	if _, sendErr := h.bot.BotAPI.Send(msg); sendErr != nil {
+		return sendErr
+	}
+
+	// The state can't be reset while the storage is unavailable,
+	// the user continues from where they were once it's back
+	if errors.Is(err, models.ErrUnavailable) {
+		return nil
+	}
+
+	return h.usecase.SetState(ctx, m.From.ID, models.StateDefault)
+}
+
+// serviceNotFound answers a service name that isn't stored.
+func (h Handler) serviceNotFound(ctx context.Context, m *tgbotapi.Message) error {
+	msg := tgbotapi.NewMessage(m.Chat.ID, "Service not found!")
+	msg.ReplyMarkup = bot.MenuKeyboard()
+
+	if _, err := h.bot.BotAPI.Send(msg); err != nil {
+		return err
+	}
+
+	return h.usecase.SetState(ctx, m.From.ID, models.StateDefault)
+}
+
+func (h Handler) allServicesKeyboard(ctx context.Context, userID int64) (tgbotapi.ReplyKeyboardMarkup, error) {
+	services, err := h.usecase.GetAllServices(ctx, userID)
 	if err != nil {
 		return tgbotapi.ReplyKeyboardMarkup{}, err
 	}
 
-	for _, service := range services {
-		row = append(row, tgbotapi.KeyboardButton{Text: service})
+	return h.optionsKeyboard(services), nil
+}
+
+// accountsKeyboard lists usernames of the service accounts.
+func (h Handler) accountsKeyboard(usernames []string) tgbotapi.ReplyKeyboardMarkup {
+	labels := make([]string, len(usernames))
+	for i, username := range usernames {
+		labels[i] = accountLabel(username)
+	}
+
+	return h.optionsKeyboard(labels)
+}
+
+// optionsKeyboard lists options in rows of five followed by the menu button.
+func (h Handler) optionsKeyboard(options []string) tgbotapi.ReplyKeyboardMarkup {
+	var keyboard [][]tgbotapi.KeyboardButton
+	var row []tgbotapi.KeyboardButton
+
+	for _, option := range options {
+		row = append(row, tgbotapi.KeyboardButton{Text: option})
 
-		if len(row)+1%5 == 0 {
+		if len(row) == 5 {
 			keyboard = append(keyboard, row)
 			row = nil
 		}
@@ -156,7 +345,26 @@ func (h Handler) allServicesKeyboard(userID int64) (tgbotapi.ReplyKeyboardMarkup
 
 	keyboard = append(keyboard, []tgbotapi.KeyboardButton{{Text: "Back to menu <<"}})
 
-	return tgbotapi.NewReplyKeyboard(keyboard...), nil
+	return tgbotapi.NewReplyKeyboard(keyboard...)
+}
+
+// noUsername labels accounts saved without a username in the account picker
+const noUsername = "(no username)"
+
+func accountLabel(username string) string {
+	if username == "" {
+		return noUsername
+	}
+
+	return username
+}
+
+func accountUsername(label string) string {
+	if label == noUsername {
+		return ""
+	}
+
+	return label
 }
 
 func (h Handler) BackToMenuKeyboard() tgbotapi.ReplyKeyboardMarkup {
@@ -167,6 +375,30 @@ func (h Handler) BackToMenuKeyboard() tgbotapi.ReplyKeyboardMarkup {
 	)
 }
 
+// SkipKeyboard offers to skip an optional step.
+func (h Handler) SkipKeyboard() tgbotapi.ReplyKeyboardMarkup {
+	return tgbotapi.NewReplyKeyboard(
+		tgbotapi.NewKeyboardButtonRow(
+			tgbotapi.NewKeyboardButton(models.SkipCMD),
+		),
+		tgbotapi.NewKeyboardButtonRow(
+			tgbotapi.NewKeyboardButton("Back to menu <<"),
+		),
+	)
+}
+
+// DoneKeyboard finishes a step that accepts several messages.
+func (h Handler) DoneKeyboard() tgbotapi.ReplyKeyboardMarkup {
+	return tgbotapi.NewReplyKeyboard(
+		tgbotapi.NewKeyboardButtonRow(
+			tgbotapi.NewKeyboardButton(models.DoneCMD),
+		),
+		tgbotapi.NewKeyboardButtonRow(
+			tgbotapi.NewKeyboardButton("Back to menu <<"),
+		),
+	)
+}
+
 func (h Handler) YesOrNoKeyboard() tgbotapi.ReplyKeyboardMarkup {
 	return tgbotapi.NewReplyKeyboard(
 		tgbotapi.NewKeyboardButtonRow(
@@ -179,7 +411,16 @@ func (h Handler) YesOrNoKeyboard() tgbotapi.ReplyKeyboardMarkup {
 func (h Handler) help(m *tgbotapi.Message) error {
 	msg := tgbotapi.NewMessage(
 		m.Chat.ID,
-		"1. Set credentials for service. \xF0\x9F\x94\x92\n2. Get login and password of service. \xF0\x9F\x94\x91\n3. Delete service. \xE2\x9D\x8C\n4. Change security password. \xF0\x9F\x94\x83\n\nEnter the number of the desired action:",
+		"1. Save a login, secure note, payment card, Wi-Fi or API token. \xF0\x9F\x94\x92\n2. Get saved item. \xF0\x9F\x94\x91\n3. Delete item. \xE2\x9D\x8C\n4. Change security password. \xF0\x9F\x94\x83\n\n"+
+			"/search text \xE2\x80\x94 find items by name, username, URL, tag or type.\n"+
+			"/otp service \xE2\x80\x94 get the current 2FA code.\n"+
+			"/gen \xE2\x80\x94 generate a password, /gen default with options sets your defaults.\n"+
+			"/audit \xE2\x80\x94 find weak, reused and old passwords.\n"+
+			"/history \xE2\x80\x94 see and restore previous passwords.\n"+
+			"/edit \xE2\x80\x94 change the name, username, password or another field of an item.\n"+
+			"/trash \xE2\x80\x94 restore or purge deleted items.\n"+
+			"/export \xE2\x80\x94 download your vault encrypted with a passphrase, as a KeePass database or a Bitwarden export.\n"+
+			"/import \xE2\x80\x94 import a CSV export of another password manager, a KeePass database, a Bitwarden JSON export or an export of this bot.\n\nEnter the number of the desired action:",
 	)
 	msg.ReplyMarkup = bot.MenuKeyboard()
 
@@ -204,7 +445,7 @@ func (h Handler) startExisting(m *tgbotapi.Message) error {
 	return nil
 }
 
-func (h Handler) start(m *tgbotapi.Message) error {
+func (h Handler) start(ctx context.Context, m *tgbotapi.Message) error {
 	msg := tgbotapi.NewMessage(
 		m.Chat.ID,
 		"Hello, ["+m.From.UserName+"](tg://user?id="+strconv.FormatInt(m.From.ID, 10)+")\\!\n"+
@@ -219,10 +460,17 @@ func (h Handler) start(m *tgbotapi.Message) error {
 		return err
 	}
 
-	return h.usecase.SetState(m.From.ID, models.StateSetToken)
+	return h.usecase.SetState(ctx, m.From.ID, models.StateSetToken)
+}
+
+func (h Handler) tokenIsCommand(m *tgbotapi.Message) error {
+	msg := tgbotapi.NewMessage(m.Chat.ID, "Security password can't be a command, write it again")
+	_, err := h.bot.BotAPI.Send(msg)
+
+	return err
 }
 
-func (h Handler) askToken(m *tgbotapi.Message) error {
+func (h Handler) askToken(ctx context.Context, m *tgbotapi.Message) error {
 	msg := tgbotapi.NewMessage(m.Chat.ID, "Enter security password:")
 	msg.ReplyMarkup = h.BackToMenuKeyboard()
 
@@ -230,10 +478,10 @@ func (h Handler) askToken(m *tgbotapi.Message) error {
 		return err
 	}
 
-	return h.usecase.SetState(m.From.ID, "checkToken")
+	return h.usecase.SetState(ctx, m.From.ID, "checkToken")
 }
 
-func (h Handler) checkToken(m *tgbotapi.Message, realToken string) error {
+func (h Handler) checkToken(ctx context.Context, m *tgbotapi.Message, realToken string) error {
 	if m.Text != realToken {
 		msg := tgbotapi.NewMessage(m.Chat.ID, "Wrong security password.\nTry again:")
 		msg.ReplyMarkup = h.BackToMenuKeyboard()
@@ -245,10 +493,10 @@ func (h Handler) checkToken(m *tgbotapi.Message, realToken string) error {
 		return nil
 	}
 
-	return h.get(m)
+	return h.get(ctx, m)
 }
 
-func (h Handler) updateTokenQ(m *tgbotapi.Message) error {
+func (h Handler) updateTokenQ(ctx context.Context, m *tgbotapi.Message) error {
 	msg := tgbotapi.NewMessage(m.Chat.ID, "This will delete all your passwords.\nAre you sure?")
 	msg.ReplyMarkup = h.YesOrNoKeyboard()
 
@@ -256,10 +504,10 @@ func (h Handler) updateTokenQ(m *tgbotapi.Message) error {
 		return err
 	}
 
-	return h.usecase.SetState(m.From.ID, models.StateUpdateTokenInput)
+	return h.usecase.SetState(ctx, m.From.ID, models.StateUpdateTokenInput)
 }
 
-func (h Handler) updateTokenInput(m *tgbotapi.Message) error {
+func (h Handler) updateTokenInput(ctx context.Context, m *tgbotapi.Message) error {
 	if m.Text == "Yes" {
 		msg := tgbotapi.NewMessage(m.Chat.ID, "Enter new security password:")
 		msg.ReplyMarkup = h.BackToMenuKeyboard()
@@ -268,10 +516,10 @@ func (h Handler) updateTokenInput(m *tgbotapi.Message) error {
 			return err
 		}
 
-		return h.usecase.SetState(m.From.ID, models.StateUpdateToken)
+		return h.usecase.SetState(ctx, m.From.ID, models.StateUpdateToken)
 	}
 
-	err := h.usecase.SetState(m.From.ID, models.StateDefault)
+	err := h.usecase.SetState(ctx, m.From.ID, models.StateDefault)
 	if err != nil {
 		return err
 	}
@@ -279,12 +527,16 @@ func (h Handler) updateTokenInput(m *tgbotapi.Message) error {
 	return h.help(m)
 }
 
-func (h Handler) setToken(m *tgbotapi.Message) error {
-	err := h.usecase.SetToken(m.From.ID, m.Text, h.bot.EncryptKey)
+func (h Handler) setToken(ctx context.Context, m *tgbotapi.Message) error {
+	err := h.usecase.SetToken(ctx, m.From.ID, m.Text, h.bot.EncryptKey)
 	if err != nil {
 		return err
 	}
 
+	if warning := h.passwordWarning(m.Text); warning != "" {
+		return h.warnWeakToken(ctx, m, warning)
+	}
+
 	msg := tgbotapi.NewMessage(m.Chat.ID, "Security password saved successfully! \xE2\x9C\x85")
 	msg.ReplyMarkup = bot.MenuKeyboard()
 
@@ -292,19 +544,23 @@ func (h Handler) setToken(m *tgbotapi.Message) error {
 		return err
 	}
 
-	return h.usecase.SetState(m.From.ID, models.StateDefault)
+	return h.usecase.SetState(ctx, m.From.ID, models.StateDefault)
 }
 
-func (h Handler) updateToken(m *tgbotapi.Message) error {
-	err := h.usecase.UpdateToken(m.From.ID, m.Text, h.bot.EncryptKey)
+func (h Handler) updateToken(ctx context.Context, m *tgbotapi.Message) error {
+	err := h.usecase.UpdateToken(ctx, m.From.ID, m.Text, h.bot.EncryptKey)
 	if err != nil {
 		return err
 	}
 
-	if err = h.usecase.DeleteCredentialsByUser(m.From.ID); err != nil {
+	if err = h.usecase.DeleteCredentialsByUser(ctx, m.From.ID); err != nil {
 		return err
 	}
 
+	if warning := h.passwordWarning(m.Text); warning != "" {
+		return h.warnWeakToken(ctx, m, warning)
+	}
+
 	msg := tgbotapi.NewMessage(m.Chat.ID, "Security password updated successfully! \xE2\x9C\x85")
 	msg.ReplyMarkup = bot.MenuKeyboard()
 
@@ -312,26 +568,33 @@ func (h Handler) updateToken(m *tgbotapi.Message) error {
 		return err
 	}
 
-	return h.usecase.SetState(m.From.ID, models.StateDefault)
+	return h.usecase.SetState(ctx, m.From.ID, models.StateDefault)
 }
 
-func (h Handler) set(m *tgbotapi.Message) error {
-	msg := tgbotapi.NewMessage(m.Chat.ID, "Enter service:")
-	msg.ReplyMarkup = h.BackToMenuKeyboard()
+func (h Handler) set(ctx context.Context, m *tgbotapi.Message) error {
+	msg := tgbotapi.NewMessage(m.Chat.ID, "Choose item type:")
+	msg.ReplyMarkup = h.itemTypesKeyboard()
 
 	if _, err := h.bot.BotAPI.Send(msg); err != nil {
 		return err
 	}
 
-	return h.usecase.SetState(m.From.ID, models.StateSetService)
+	return h.usecase.SetState(ctx, m.From.ID, models.StateSetType)
 }
 
-func (h Handler) setService(m *tgbotapi.Message) error {
-	if err := h.usecase.SetService(m.From.ID, m.Text); err != nil {
+func (h Handler) askService(ctx context.Context, m *tgbotapi.Message) error {
+	msg := tgbotapi.NewMessage(m.Chat.ID, "Enter service:")
+	msg.ReplyMarkup = h.BackToMenuKeyboard()
+
+	if _, err := h.bot.BotAPI.Send(msg); err != nil {
 		return err
 	}
 
-	if err := h.usecase.SetStateLastServer(m.From.ID, m.Text); err != nil {
+	return h.usecase.SetState(ctx, m.From.ID, models.StateSetService)
+}
+
+func (h Handler) setService(ctx context.Context, m *tgbotapi.Message) error {
+	if err := h.usecase.SetDraft(ctx, m.From.ID, m.Text, ""); err != nil {
 		return err
 	}
 
@@ -342,43 +605,47 @@ func (h Handler) setService(m *tgbotapi.Message) error {
 		return err
 	}
 
-	return h.usecase.SetState(m.From.ID, models.StateSetUsername)
+	return h.usecase.SetState(ctx, m.From.ID, models.StateSetUsername)
 }
 
-func (h Handler) setUsername(m *tgbotapi.Message, lastService string) error {
-	if err := h.usecase.SetUsername(m.From.ID, lastService, m.Text); err != nil {
+func (h Handler) setUsername(ctx context.Context, m *tgbotapi.Message, lastService string) error {
+	if err := h.usecase.SetDraft(ctx, m.From.ID, lastService, m.Text); err != nil {
 		return err
 	}
 
-	msg := tgbotapi.NewMessage(m.Chat.ID, "Enter password:")
-	msg.ReplyMarkup = h.BackToMenuKeyboard()
+	msg := tgbotapi.NewMessage(m.Chat.ID, "Enter password or let me generate one:")
+	msg.ReplyMarkup = h.GenerateKeyboard()
 
 	if _, err := h.bot.BotAPI.Send(msg); err != nil {
 		return err
 	}
 
-	return h.usecase.SetState(m.From.ID, models.StateSetPassword)
+	return h.usecase.SetState(ctx, m.From.ID, models.StateSetPassword)
 }
 
-func (h Handler) setPassword(m *tgbotapi.Message, lastService string) error {
-	err := h.usecase.SetPassword(m.From.ID, lastService, m.Text, h.bot.EncryptKey)
-	if err != nil {
-		return err
-	}
+func (h Handler) setPassword(ctx context.Context, m *tgbotapi.Message, state models.State) error {
+	lastService, username := state.LastService, state.DraftUsername
 
-	username := ""
+	password := m.Text
+	if m.Text == models.GenerateCMD {
+		var err error
+		if password, err = h.generatePassword(ctx, m.From.ID); err != nil {
+			return err
+		}
+	}
 
-	if username, _, err = h.usecase.Get(m.From.ID, lastService, h.bot.EncryptKey); err != nil {
+	err := h.usecase.SaveCredentials(ctx, m.From.ID, lastService, username, password, h.bot.EncryptKey)
+	if err != nil {
 		return err
 	}
 
-	msg := tgbotapi.NewMessage(
-		m.Chat.ID,
-		`Successfully saved\! \xE2\x9C\x85\n`+
-			"Your new credentials for "+lastService+":\n"+
-			"Username: `"+username+"`\n"+
-			"Password: `"+m.Text+"`",
-	)
+	text := credentialsText("Your new credentials", models.Credentials{
+		ServiceName:  lastService,
+		Username:     username,
+		PasswordHash: password,
+	})
+
+	msg := tgbotapi.NewMessage(m.Chat.ID, "Successfully saved! \xE2\x9C\x85\n"+text)
 	msg.ParseMode = "markdown"
 	msg.ReplyToMessageID = m.MessageID
 
@@ -387,20 +654,31 @@ func (h Handler) setPassword(m *tgbotapi.Message, lastService string) error {
 		return err
 	}
 
-	go bot.NiceTimerCredentials(response.Chat.ID, response.MessageID, h.bot, lastService, username, m.Text)
+	go bot.NiceTimerCredentials(response.Chat.ID, response.MessageID, h.bot, func() string {
+		return text
+	})
 
-	return h.usecase.SetState(m.From.ID, models.StateDefault)
+	// Saving discarded the draft, the optional details need it again
+	if err = h.usecase.SetDraft(ctx, m.From.ID, lastService, username); err != nil {
+		return err
+	}
+
+	if warning := h.passwordWarning(password, username, lastService); warning != "" {
+		return h.warnWeakPassword(ctx, m, warning)
+	}
+
+	return h.askURL(ctx, m)
 }
 
-func (h Handler) get(m *tgbotapi.Message) error {
+func (h Handler) get(ctx context.Context, m *tgbotapi.Message) error {
 	var err error
 
 	msg := tgbotapi.NewMessage(m.Chat.ID, "Correct \xE2\x9C\x85\nEnter service:")
-	if msg.ReplyMarkup, err = h.allServicesKeyboard(m.From.ID); err != nil {
+	if msg.ReplyMarkup, err = h.allServicesKeyboard(ctx, m.From.ID); err != nil {
 		return err
 	}
 
-	if err = h.usecase.SetState(m.From.ID, models.StateGetService); err != nil {
+	if err = h.usecase.SetState(ctx, m.From.ID, models.StateGetService); err != nil {
 		return err
 	}
 
@@ -409,50 +687,83 @@ func (h Handler) get(m *tgbotapi.Message) error {
 	return err
 }
 
-func (h Handler) getService(m *tgbotapi.Message) error {
-	username, password, err := h.usecase.Get(m.From.ID, m.Text, h.bot.EncryptKey)
+func (h Handler) getService(ctx context.Context, m *tgbotapi.Message) error {
+	usernames, err := h.usecase.GetAccounts(ctx, m.From.ID, m.Text)
 	if err != nil {
 		return err
 	}
 
-	if username == "" || password == "" {
-		msg := tgbotapi.NewMessage(m.Chat.ID, "Service not found!")
-		msg.ReplyMarkup = bot.MenuKeyboard()
+	switch len(usernames) {
+	case 0:
+		return h.serviceNotFound(ctx, m)
+	case 1:
+		return h.sendCredentials(ctx, m, m.Text, usernames[0])
+	default:
+		return h.askAccount(ctx, m, usernames, models.StateGetAccount)
+	}
+}
 
-		if _, err = h.bot.BotAPI.Send(msg); err != nil {
-			return err
-		}
+func (h Handler) getAccount(ctx context.Context, m *tgbotapi.Message, lastService string) error {
+	if err := h.usecase.DiscardDraft(ctx, m.From.ID); err != nil {
+		return err
+	}
+
+	return h.sendCredentials(ctx, m, lastService, accountUsername(m.Text))
+}
 
-		return h.usecase.SetState(m.From.ID, models.StateDefault)
+// askAccount offers to pick one of several accounts of the service in m.
+func (h Handler) askAccount(ctx context.Context, m *tgbotapi.Message, usernames []string, state string) error {
+	if err := h.usecase.SetDraft(ctx, m.From.ID, m.Text, ""); err != nil {
+		return err
 	}
 
-	msg := tgbotapi.NewMessage(
-		m.Chat.ID,
-		"Your credentials for "+m.Text+":\n"+
-			"Username: `"+username+"`\n"+
-			"Password: `"+password+"`\n\n",
-	)
+	msg := tgbotapi.NewMessage(m.Chat.ID, "There are several accounts of "+m.Text+".\nChoose username:")
+	msg.ReplyMarkup = h.accountsKeyboard(usernames)
+
+	if _, err := h.bot.BotAPI.Send(msg); err != nil {
+		return err
+	}
+
+	return h.usecase.SetState(ctx, m.From.ID, state)
+}
+
+func (h Handler) sendCredentials(ctx context.Context, m *tgbotapi.Message, service, username string) error {
+	credentials, err := h.usecase.Get(ctx, m.From.ID, service, username, h.bot.EncryptKey)
+	if errors.Is(err, models.ErrNotFound) {
+		return h.serviceNotFound(ctx, m)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	text := func() string {
+		return credentialsText("Your credentials", credentials)
+	}
+
+	msg := tgbotapi.NewMessage(m.Chat.ID, text())
 	msg.ParseMode = "markdown"
+	msg.ReplyMarkup = bot.MenuKeyboard()
 
 	response, err := h.bot.BotAPI.Send(msg)
 	if err != nil {
 		return err
 	}
 
-	go bot.NiceTimerCredentials(response.Chat.ID, response.MessageID, h.bot, m.Text, username, password)
+	go bot.NiceTimerCredentials(response.Chat.ID, response.MessageID, h.bot, text)
 
-	return h.usecase.SetState(m.From.ID, models.StateDefault)
+	return h.usecase.SetState(ctx, m.From.ID, models.StateDefault)
 }
 
-func (h Handler) delete(m *tgbotapi.Message) error {
+func (h Handler) delete(ctx context.Context, m *tgbotapi.Message) error {
 	var err error
 
 	msg := tgbotapi.NewMessage(m.Chat.ID, "Enter service:")
-	if msg.ReplyMarkup, err = h.allServicesKeyboard(m.From.ID); err != nil {
+	if msg.ReplyMarkup, err = h.allServicesKeyboard(ctx, m.From.ID); err != nil {
 		return err
 	}
 
-	if err = h.usecase.SetState(m.From.ID, models.StateDeleteService); err != nil {
+	if err = h.usecase.SetState(ctx, m.From.ID, models.StateDeleteService); err != nil {
 		return err
 	}
 
@@ -461,17 +772,51 @@ func (h Handler) delete(m *tgbotapi.Message) error {
 	return err
 }
 
-func (h Handler) deleteService(m *tgbotapi.Message) error {
-	if err := h.usecase.Delete(m.From.ID, m.Text); err != nil {
+func (h Handler) deleteService(ctx context.Context, m *tgbotapi.Message) error {
+	usernames, err := h.usecase.GetAccounts(ctx, m.From.ID, m.Text)
+	if err != nil {
 		return err
 	}
 
-	msg := tgbotapi.NewMessage(m.Chat.ID, "Successfully deleted! \xE2\x9C\x85")
-	msg.ReplyMarkup = bot.MenuKeyboard()
+	switch len(usernames) {
+	case 0:
+		return h.serviceNotFound(ctx, m)
+	case 1:
+		return h.deleteCredentials(ctx, m, m.Text, usernames[0])
+	default:
+		return h.askAccount(ctx, m, usernames, models.StateDeleteAccount)
+	}
+}
 
-	if _, err := h.bot.BotAPI.Send(msg); err != nil {
+func (h Handler) deleteAccount(ctx context.Context, m *tgbotapi.Message, lastService string) error {
+	if err := h.usecase.DiscardDraft(ctx, m.From.ID); err != nil {
+		return err
+	}
+
+	return h.deleteCredentials(ctx, m, lastService, accountUsername(m.Text))
+}
+
+func (h Handler) deleteCredentials(ctx context.Context, m *tgbotapi.Message, service, username string) error {
+	err := h.usecase.Delete(ctx, m.From.ID, service, username)
+	if errors.Is(err, models.ErrNotFound) {
+		return h.serviceNotFound(ctx, m)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	// The draft keeps the deleted item for Undo
+	if err = h.usecase.SetDraft(ctx, m.From.ID, service, username); err != nil {
+		return err
+	}
+
+	msg := tgbotapi.NewMessage(m.Chat.ID, "Moved to trash \xE2\x9C\x85\n"+retentionText(h.bot.TrashRetention))
+	msg.ReplyMarkup = h.UndoKeyboard()
+
+	if _, err = h.bot.BotAPI.Send(msg); err != nil {
 		return err
 	}
 
-	return h.usecase.SetState(m.From.ID, models.StateDefault)
+	return h.usecase.SetState(ctx, m.From.ID, models.StateTrashUndo)
 }
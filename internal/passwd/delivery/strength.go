@@ -0,0 +1,155 @@
+package passwdHandler
+
+import (
+	"context"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"telegram-bot/internal/bot"
+	"telegram-bot/internal/models"
+	"telegram-bot/pkg/passgen"
+	"telegram-bot/pkg/strength"
+)
+
+// tokenPolicy generates security passwords, which are typed
+// often, so they are passphrases rather than random characters
+var tokenPolicy = passgen.Policy{
+	Mode:      passgen.ModePassphrase,
+	Words:     5,
+	Separator: "-",
+	Upper:     true,
+	Digits:    true,
+}
+
+// warnWeakPassword offers to replace the weak or breached password of the
+// saved credentials. The draft is kept for the details asked for next.
+func (h Handler) warnWeakPassword(ctx context.Context, m *tgbotapi.Message, warning string) error {
+	msg := tgbotapi.NewMessage(m.Chat.ID, warning+"\nKeep it, generate a new one or enter another password:")
+	msg.ReplyMarkup = h.WeakKeyboard()
+
+	if _, err := h.bot.BotAPI.Send(msg); err != nil {
+		return err
+	}
+
+	return h.usecase.SetState(ctx, m.From.ID, models.StateWeakPassword)
+}
+
+func (h Handler) weakPassword(ctx context.Context, m *tgbotapi.Message, state models.State) error {
+	if m.Text == models.KeepCMD {
+		return h.askURL(ctx, m)
+	}
+
+	// A generated or another password replaces the saved one
+	return h.setPassword(ctx, m, state)
+}
+
+// warnWeakToken offers to replace the weak or breached security password just saved.
+func (h Handler) warnWeakToken(ctx context.Context, m *tgbotapi.Message, warning string) error {
+	msg := tgbotapi.NewMessage(m.Chat.ID, warning+"\nKeep it, generate a new one or enter another security password:")
+	msg.ReplyMarkup = h.WeakKeyboard()
+
+	if _, err := h.bot.BotAPI.Send(msg); err != nil {
+		return err
+	}
+
+	return h.usecase.SetState(ctx, m.From.ID, models.StateWeakToken)
+}
+
+func (h Handler) weakToken(ctx context.Context, m *tgbotapi.Message) error {
+	if m.Text == models.KeepCMD {
+		msg := tgbotapi.NewMessage(m.Chat.ID, "Security password kept.")
+		msg.ReplyMarkup = bot.MenuKeyboard()
+
+		if _, err := h.bot.BotAPI.Send(msg); err != nil {
+			return err
+		}
+
+		return h.usecase.SetState(ctx, m.From.ID, models.StateDefault)
+	}
+
+	if m.Text != models.GenerateCMD {
+		return h.replaceToken(ctx, m, m.Text)
+	}
+
+	token, err := passgen.Generate(tokenPolicy)
+	if err != nil {
+		return err
+	}
+
+	if err = h.usecase.UpdateToken(ctx, m.From.ID, token, h.bot.EncryptKey); err != nil {
+		return err
+	}
+
+	text := "Your new security password:\n`" + token + "`\n\nWrite it down or remember it, it can't be recovered.\n"
+
+	msg := tgbotapi.NewMessage(m.Chat.ID, text)
+	msg.ParseMode = "markdown"
+	msg.ReplyMarkup = bot.MenuKeyboard()
+
+	response, err := h.bot.BotAPI.Send(msg)
+	if err != nil {
+		return err
+	}
+
+	go bot.NiceTimerCredentials(response.Chat.ID, response.MessageID, h.bot, func() string {
+		return text
+	})
+
+	return h.usecase.SetState(ctx, m.From.ID, models.StateDefault)
+}
+
+// replaceToken saves another security password typed instead of the weak one.
+func (h Handler) replaceToken(ctx context.Context, m *tgbotapi.Message, token string) error {
+	if err := h.usecase.UpdateToken(ctx, m.From.ID, token, h.bot.EncryptKey); err != nil {
+		return err
+	}
+
+	if warning := h.passwordWarning(token); warning != "" {
+		return h.warnWeakToken(ctx, m, warning)
+	}
+
+	msg := tgbotapi.NewMessage(m.Chat.ID, "Security password saved successfully! \xE2\x9C\x85")
+	msg.ReplyMarkup = bot.MenuKeyboard()
+
+	if _, err := h.bot.BotAPI.Send(msg); err != nil {
+		return err
+	}
+
+	return h.usecase.SetState(ctx, m.From.ID, models.StateDefault)
+}
+
+// passwordWarning explains why the password should be replaced, it's empty
+// when the password is neither weak nor found in the breached password corpus.
+func (h Handler) passwordWarning(password string, inputs ...string) string {
+	result := strength.Estimate(password, inputs...)
+	breached := h.usecase.Breached(password)
+
+	if !result.Weak() && !breached {
+		return ""
+	}
+
+	text := "\xE2\x9A\xA0 This password is " + result.Score.String() + ":\n"
+	if breached {
+		text += "- " + breachedWarning + "\n"
+	}
+	for _, warning := range result.Warnings {
+		text += "- " + warning + "\n"
+	}
+
+	return text
+}
+
+const breachedWarning = "It was found in a data breach, attackers try such passwords first."
+
+// WeakKeyboard offers to keep a weak password or generate a new one.
+func (h Handler) WeakKeyboard() tgbotapi.ReplyKeyboardMarkup {
+	return tgbotapi.NewReplyKeyboard(
+		tgbotapi.NewKeyboardButtonRow(
+			tgbotapi.NewKeyboardButton(models.KeepCMD),
+			tgbotapi.NewKeyboardButton(models.GenerateCMD),
+		),
+		tgbotapi.NewKeyboardButtonRow(
+			tgbotapi.NewKeyboardButton("Back to menu <<"),
+		),
+	)
+}
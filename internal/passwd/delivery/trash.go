@@ -0,0 +1,254 @@
+package passwdHandler
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"telegram-bot/internal/bot"
+	"telegram-bot/internal/models"
+)
+
+// Deleted items go to the trash. The deletion can be undone right away,
+// later /trash restores or purges them until they expire.
+
+// trashUndo restores the item just deleted, the draft keeps its name.
+func (h Handler) trashUndo(ctx context.Context, m *tgbotapi.Message, state models.State) error {
+	if m.Text == models.UndoCMD {
+		return h.restoreTrash(ctx, m, state.LastService, state.DraftUsername)
+	}
+
+	if err := h.usecase.DiscardDraft(ctx, m.From.ID); err != nil {
+		return err
+	}
+
+	if err := h.usecase.SetState(ctx, m.From.ID, models.StateDefault); err != nil {
+		return err
+	}
+
+	return h.help(m)
+}
+
+// A page of the trash is kept within the limits of a message and its
+// keyboard.
+const (
+	trashPageItems = 20
+	trashPageText  = 3000
+)
+
+// trash lists the first page of deleted items to restore or purge one.
+func (h Handler) trash(ctx context.Context, m *tgbotapi.Message) error {
+	return h.trashPage(ctx, m, "", "")
+}
+
+// trashPage lists the deleted items after the one named by service and
+// username. The last item listed is kept as a draft, the next page
+// starts after it.
+func (h Handler) trashPage(ctx context.Context, m *tgbotapi.Message, service, username string) error {
+	items, err := h.usecase.GetTrashPage(ctx, m.From.ID, service, username)
+	if err != nil {
+		return err
+	}
+
+	if len(items) == 0 {
+		text := "Trash is empty."
+		if service != "" || username != "" {
+			text = "There are no more deleted items."
+		}
+
+		return h.finishTrash(ctx, m, text)
+	}
+
+	shown := trashPageLen(items, h.bot.TrashRetention)
+	last := items[shown-1]
+
+	more := shown < len(items)
+	if !more {
+		next, err := h.usecase.GetTrashPage(ctx, m.From.ID, last.ServiceName, last.Username)
+		if err != nil {
+			return err
+		}
+		more = len(next) > 0
+	}
+
+	labels := make([]string, shown, shown+1)
+	for i, c := range items[:shown] {
+		labels[i] = rotateLabel(c.ServiceName, c.Username)
+	}
+
+	text := trashText(items[:shown], h.bot.TrashRetention)
+	if more {
+		labels = append(labels, models.NextPageCMD)
+		text += "There are more on the next page.\n"
+	}
+
+	msg := tgbotapi.NewMessage(m.Chat.ID, text+"\nChoose an item to restore or delete for good:")
+	msg.ReplyMarkup = h.optionsKeyboard(labels)
+
+	if _, err = h.bot.BotAPI.Send(msg); err != nil {
+		return err
+	}
+
+	if err = h.usecase.SetDraft(ctx, m.From.ID, last.ServiceName, last.Username); err != nil {
+		return err
+	}
+
+	return h.usecase.SetState(ctx, m.From.ID, models.StateTrash)
+}
+
+// trashChoose asks what to do with the deleted item chosen in the list,
+// or lists the next page.
+func (h Handler) trashChoose(ctx context.Context, m *tgbotapi.Message, state models.State) error {
+	if m.Text == models.NextPageCMD {
+		return h.trashPage(ctx, m, state.LastService, state.DraftUsername)
+	}
+
+	items, err := h.usecase.GetTrash(ctx, m.From.ID)
+	if err != nil {
+		return err
+	}
+
+	for _, c := range items {
+		if rotateLabel(c.ServiceName, c.Username) != m.Text {
+			continue
+		}
+
+		if err = h.usecase.SetDraft(ctx, m.From.ID, c.ServiceName, c.Username); err != nil {
+			return err
+		}
+
+		msg := tgbotapi.NewMessage(m.Chat.ID, "Restore "+m.Text+" or delete it for good?")
+		msg.ReplyMarkup = h.TrashItemKeyboard()
+
+		if _, err = h.bot.BotAPI.Send(msg); err != nil {
+			return err
+		}
+
+		return h.usecase.SetState(ctx, m.From.ID, models.StateTrashItem)
+	}
+
+	return h.serviceNotFound(ctx, m)
+}
+
+func (h Handler) trashItem(ctx context.Context, m *tgbotapi.Message, state models.State) error {
+	service, username := state.LastService, state.DraftUsername
+
+	switch m.Text {
+	case models.RestoreCMD:
+		return h.restoreTrash(ctx, m, service, username)
+	case models.PurgeCMD:
+		if err := h.usecase.PurgeTrash(ctx, m.From.ID, service, username); err != nil {
+			return err
+		}
+
+		return h.finishTrash(ctx, m, "Deleted for good \xE2\x9C\x85")
+	default:
+		msg := tgbotapi.NewMessage(m.Chat.ID, "Choose with the buttons below.")
+		_, err := h.bot.BotAPI.Send(msg)
+
+		return err
+	}
+}
+
+func (h Handler) restoreTrash(ctx context.Context, m *tgbotapi.Message, service, username string) error {
+	err := h.usecase.RestoreTrash(ctx, m.From.ID, service, username)
+	if errors.Is(err, models.ErrConflict) {
+		return h.finishTrash(ctx, m, rotateLabel(service, username)+" was saved again since it was deleted, "+
+			"delete it first to restore the old one \xE2\x9D\x8C")
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return h.finishTrash(ctx, m, "Restored "+rotateLabel(service, username)+" \xE2\x9C\x85")
+}
+
+// finishTrash ends a trash flow with the text.
+func (h Handler) finishTrash(ctx context.Context, m *tgbotapi.Message, text string) error {
+	msg := tgbotapi.NewMessage(m.Chat.ID, text)
+	msg.ReplyMarkup = bot.MenuKeyboard()
+
+	if _, err := h.bot.BotAPI.Send(msg); err != nil {
+		return err
+	}
+
+	if err := h.usecase.DiscardDraft(ctx, m.From.ID); err != nil {
+		return err
+	}
+
+	return h.usecase.SetState(ctx, m.From.ID, models.StateDefault)
+}
+
+// trashPageLen returns how many of the items fit in a page, at least one.
+func trashPageLen(items []models.Credentials, retention time.Duration) int {
+	size := 0
+	for i, c := range items {
+		if i == trashPageItems {
+			return i
+		}
+
+		size += len(trashLine(c, retention))
+		if i > 0 && size > trashPageText {
+			return i
+		}
+	}
+
+	return len(items)
+}
+
+func trashText(items []models.Credentials, retention time.Duration) string {
+	text := "Deleted items:\n"
+
+	for _, c := range items {
+		text += trashLine(c, retention)
+	}
+
+	return text
+}
+
+func trashLine(c models.Credentials, retention time.Duration) string {
+	line := "- " + rotateLabel(c.ServiceName, c.Username) + ": deleted " + formatDate(c.DeletedAt)
+	if retention > 0 {
+		line += ", gone on " + formatDate(time.Unix(c.DeletedAt, 0).Add(retention).Unix())
+	}
+
+	return line + "\n"
+}
+
+// retentionText tells how long a deleted item is kept.
+func retentionText(retention time.Duration) string {
+	if retention <= 0 {
+		return "It's kept in /trash until you delete it from there."
+	}
+
+	return "It's kept in /trash for " + strconv.Itoa(int(retention.Hours()/24)) + " days."
+}
+
+// UndoKeyboard offers to undo a deletion.
+func (h Handler) UndoKeyboard() tgbotapi.ReplyKeyboardMarkup {
+	return tgbotapi.NewReplyKeyboard(
+		tgbotapi.NewKeyboardButtonRow(
+			tgbotapi.NewKeyboardButton(models.UndoCMD),
+		),
+		tgbotapi.NewKeyboardButtonRow(
+			tgbotapi.NewKeyboardButton("Back to menu <<"),
+		),
+	)
+}
+
+// TrashItemKeyboard offers to restore a deleted item or delete it for good.
+func (h Handler) TrashItemKeyboard() tgbotapi.ReplyKeyboardMarkup {
+	return tgbotapi.NewReplyKeyboard(
+		tgbotapi.NewKeyboardButtonRow(
+			tgbotapi.NewKeyboardButton(models.RestoreCMD),
+			tgbotapi.NewKeyboardButton(models.PurgeCMD),
+		),
+		tgbotapi.NewKeyboardButtonRow(
+			tgbotapi.NewKeyboardButton("Back to menu <<"),
+		),
+	)
+}
@@ -0,0 +1,45 @@
+package passwdHandler
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"telegram-bot/internal/models"
+)
+
+func TestTrashPageLen(t *testing.T) {
+	deleted := func(n int, service string) []models.Credentials {
+		items := make([]models.Credentials, n)
+		for i := range items {
+			items[i] = models.Credentials{ServiceName: fmt.Sprintf("%s-%02d", service, i), Username: "user", DeletedAt: 1700000000}
+		}
+
+		return items
+	}
+
+	long := strings.Repeat("s", 500)
+
+	tests := []struct {
+		name  string
+		items []models.Credentials
+		want  int
+	}{
+		{"few", deleted(3, "service"), 3},
+		{"many", deleted(50, "service"), trashPageItems},
+		{"long names", deleted(20, long), 5},
+		{"one too long", deleted(1, strings.Repeat("s", 5000)), 1},
+	}
+
+	for _, tt := range tests {
+		n := trashPageLen(tt.items, 30*24*time.Hour)
+		if n != tt.want {
+			t.Errorf("%s: expected %d items, got %d", tt.name, tt.want, n)
+		}
+
+		if text := trashText(tt.items[:n], 30*24*time.Hour); n > 1 && len(text) > trashPageText+100 {
+			t.Errorf("%s: page of %d characters", tt.name, len(text))
+		}
+	}
+}
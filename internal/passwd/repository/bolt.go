@@ -0,0 +1,848 @@
+package passwdRepository
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+	"gopkg.in/vmihailenco/msgpack.v2"
+
+	"telegram-bot/internal/models"
+)
+
+var (
+	usersBucket       = []byte("users")
+	credentialsBucket = []byte("credentials")
+	trashBucket       = []byte("trash")
+	stateBucket       = []byte("state")
+	metaBucket        = []byte("meta")
+
+	schemaVersionKey = []byte("schema_version")
+)
+
+// boltSchemaVersion is the layout of keys written by this version.
+// 2: credential keys include the username (several accounts per service).
+const boltSchemaVersion = 2
+
+type Bolt struct {
+	Storage
+	db *bolt.DB
+}
+
+func NewBolt(path string, timeout time.Duration) (*Bolt, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, err
+	}
+
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: timeout})
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{usersBucket, credentialsBucket, trashBucket, stateBucket, metaBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+
+		return upgradeBolt(tx)
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &Bolt{
+		db: db,
+	}, nil
+}
+
+func (b *Bolt) Close() error {
+	return b.db.Close()
+}
+
+// Backup writes a consistent snapshot of the database to w
+// without blocking concurrent readers and writers.
+func (b *Bolt) Backup(w io.Writer) (int64, error) {
+	var n int64
+
+	err := b.db.View(func(tx *bolt.Tx) error {
+		var err error
+		n, err = tx.WriteTo(w)
+		return err
+	})
+
+	return n, err
+}
+
+// BackupFile writes a snapshot to path, replacing the previous one only
+// after the new snapshot was written completely.
+func (b *Bolt) BackupFile(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err = b.Backup(tmp); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err = tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+func userKey(userID int64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, uint64(userID))
+
+	return key
+}
+
+// serviceKey is the prefix of keys of all accounts of a service.
+// The zero byte separates the service from the username, so accounts
+// are ordered by service and then by username.
+func serviceKey(userID int64, serviceName string) []byte {
+	return append(append(userKey(userID), serviceName...), 0)
+}
+
+func credentialKey(userID int64, serviceName, username string) []byte {
+	return append(serviceKey(userID, serviceName), username...)
+}
+
+// upgradeBolt rewrites records of files written by older versions.
+func upgradeBolt(tx *bolt.Tx) error {
+	meta := tx.Bucket(metaBucket)
+
+	version := uint64(1)
+	if v := meta.Get(schemaVersionKey); v != nil {
+		version = binary.BigEndian.Uint64(v)
+	}
+
+	if version >= boltSchemaVersion {
+		return nil
+	}
+
+	// Version 1 keyed credentials by user and service only
+	bucket := openBucket(tx, credentialsBucket)
+
+	var old [][]byte
+	var records []models.Credentials
+	err := bucket.ForEach(func(k, v []byte) error {
+		var credentials models.Credentials
+		if err := bucket.unmarshal(v, &credentials); err != nil {
+			return err
+		}
+
+		old = append(old, k)
+		records = append(records, credentials)
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, k := range old {
+		if err = bucket.Delete(k); err != nil {
+			return err
+		}
+	}
+
+	for _, c := range records {
+		if err = putRecord(bucket, credentialKey(int64(c.UserID), c.ServiceName, c.Username), c); err != nil {
+			return err
+		}
+	}
+
+	v := make([]byte, 8)
+	binary.BigEndian.PutUint64(v, boltSchemaVersion)
+
+	return meta.Put(schemaVersionKey, v)
+}
+
+// bucket is a bolt bucket that knows its name for error reporting.
+type bucket struct {
+	*bolt.Bucket
+	name string
+}
+
+func openBucket(tx *bolt.Tx, name []byte) bucket {
+	return bucket{Bucket: tx.Bucket(name), name: string(name)}
+}
+
+func (b bucket) unmarshal(data []byte, v interface{}) error {
+	if err := msgpack.Unmarshal(data, v); err != nil {
+		return &models.CorruptTupleError{Space: b.name, Err: err}
+	}
+
+	return nil
+}
+
+func getRecord(b bucket, key []byte, v interface{}) (bool, error) {
+	data := b.Get(key)
+	if data == nil {
+		return false, nil
+	}
+
+	return true, b.unmarshal(data, v)
+}
+
+func putRecord(b bucket, key []byte, v interface{}) error {
+	data, err := msgpack.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	return b.Put(key, data)
+}
+
+// update runs fn in a read-write transaction unless ctx is done by the time
+// it starts: bolt serializes writers, so it may wait for the lock for a while.
+func (b *Bolt) update(ctx context.Context, fn func(tx *bolt.Tx) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return b.db.Update(func(tx *bolt.Tx) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		return fn(tx)
+	})
+}
+
+func (b *Bolt) view(ctx context.Context, fn func(tx *bolt.Tx) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return b.db.View(fn)
+}
+
+func (b *Bolt) CreateUser(ctx context.Context, userID int64, token string) error {
+	return b.update(ctx, func(tx *bolt.Tx) error {
+		bucket := openBucket(tx, usersBucket)
+
+		if bucket.Get(userKey(userID)) != nil {
+			return nil
+		}
+
+		return putRecord(bucket, userKey(userID), models.User{ID: uint64(userID), Token: token})
+	})
+}
+
+func (b *Bolt) GetUser(ctx context.Context, userID int64) (models.User, error) {
+	var user models.User
+
+	err := b.view(ctx, func(tx *bolt.Tx) error {
+		found, err := getRecord(openBucket(tx, usersBucket), userKey(userID), &user)
+		if err == nil && !found {
+			return models.ErrNotFound
+		}
+
+		return err
+	})
+	if err != nil {
+		return models.User{}, err
+	}
+
+	return user, nil
+}
+
+func (b *Bolt) SetToken(ctx context.Context, userID int64, token string) error {
+	return b.update(ctx, func(tx *bolt.Tx) error {
+		bucket := openBucket(tx, usersBucket)
+
+		if bucket.Get(userKey(userID)) != nil {
+			return fmt.Errorf("%w: user %d", models.ErrConflict, userID)
+		}
+
+		return putRecord(bucket, userKey(userID), models.User{ID: uint64(userID), Token: token})
+	})
+}
+
+func (b *Bolt) UpdateToken(ctx context.Context, userID int64, token string) error {
+	return b.update(ctx, func(tx *bolt.Tx) error {
+		bucket := openBucket(tx, usersBucket)
+
+		var user models.User
+		found, err := getRecord(bucket, userKey(userID), &user)
+		if err != nil {
+			return err
+		}
+
+		if !found {
+			return models.ErrNotFound
+		}
+
+		user.Token = token
+
+		return putRecord(bucket, userKey(userID), user)
+	})
+}
+
+func (b *Bolt) SetSetting(ctx context.Context, userID int64, key, value string) error {
+	return b.update(ctx, func(tx *bolt.Tx) error {
+		bucket := openBucket(tx, usersBucket)
+
+		var user models.User
+		found, err := getRecord(bucket, userKey(userID), &user)
+		if err != nil {
+			return err
+		}
+
+		if !found {
+			return models.ErrNotFound
+		}
+
+		user.Settings = withSetting(user.Settings, key, value)
+
+		return putRecord(bucket, userKey(userID), user)
+	})
+}
+
+func (b *Bolt) DeleteCredentialsByUser(ctx context.Context, userID int64) error {
+	return b.update(ctx, func(tx *bolt.Tx) error {
+		prefix := userKey(userID)
+
+		for _, name := range [][]byte{credentialsBucket, trashBucket} {
+			c := openBucket(tx, name).Cursor()
+
+			for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Seek(prefix) {
+				if err := c.Delete(); err != nil {
+					return err
+				}
+			}
+		}
+
+		return nil
+	})
+}
+
+func (b *Bolt) SaveCredentials(ctx context.Context, credentials models.Credentials) error {
+	return b.update(ctx, func(tx *bolt.Tx) error {
+		userID := int64(credentials.UserID)
+
+		if err := putRecord(openBucket(tx, credentialsBucket), credentialKey(userID, credentials.ServiceName, credentials.Username), credentials); err != nil {
+			return err
+		}
+
+		bucket := openBucket(tx, stateBucket)
+
+		var state models.State
+		found, err := getRecord(bucket, userKey(userID), &state)
+		if err != nil || !found || state.LastService != credentials.ServiceName {
+			return err
+		}
+
+		return putRecord(bucket, userKey(userID), withoutDraft(state))
+	})
+}
+
+func (b *Bolt) ReEncrypt(ctx context.Context, userID int64, token string, credentials []models.Credentials) error {
+	return b.update(ctx, func(tx *bolt.Tx) error {
+		users := openBucket(tx, usersBucket)
+
+		var user models.User
+		found, err := getRecord(users, userKey(userID), &user)
+		if err != nil {
+			return err
+		}
+
+		if found {
+			user.Token = token
+			if err = putRecord(users, userKey(userID), user); err != nil {
+				return err
+			}
+		}
+
+		for _, c := range credentials {
+			bucket := openBucket(tx, credentialsBucket)
+			if c.DeletedAt != 0 {
+				bucket = openBucket(tx, trashBucket)
+			}
+
+			key := credentialKey(userID, c.ServiceName, c.Username)
+
+			var stored models.Credentials
+			found, err = getRecord(bucket, key, &stored)
+			if err != nil {
+				return err
+			}
+
+			if !found {
+				continue
+			}
+
+			stored.PasswordHash = c.PasswordHash
+			stored.Notes, stored.Fields, stored.OTP = c.Notes, c.Fields, c.OTP
+			stored.History = c.History
+			if err = putRecord(bucket, key, stored); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func (b *Bolt) Get(ctx context.Context, userID int64, serviceName, username string) (models.Credentials, error) {
+	var credentials models.Credentials
+
+	err := b.view(ctx, func(tx *bolt.Tx) error {
+		found, err := getRecord(openBucket(tx, credentialsBucket), credentialKey(userID, serviceName, username), &credentials)
+		if err == nil && !found {
+			return models.ErrNotFound
+		}
+
+		return err
+	})
+	if err != nil {
+		return models.Credentials{}, err
+	}
+
+	return credentials, nil
+}
+
+func (b *Bolt) Touch(ctx context.Context, userID int64, serviceName, username string, accessedAt time.Time) error {
+	return b.update(ctx, func(tx *bolt.Tx) error {
+		bucket := openBucket(tx, credentialsBucket)
+		key := credentialKey(userID, serviceName, username)
+
+		var credentials models.Credentials
+		found, err := getRecord(bucket, key, &credentials)
+		if err != nil {
+			return err
+		}
+
+		if !found {
+			return models.ErrNotFound
+		}
+
+		credentials.AccessedAt = accessedAt.Unix()
+
+		return putRecord(bucket, key, credentials)
+	})
+}
+
+func (b *Bolt) Rename(ctx context.Context, userID int64, serviceName, username, newServiceName, newUsername string) error {
+	return b.update(ctx, func(tx *bolt.Tx) error {
+		bucket := openBucket(tx, credentialsBucket)
+		key := credentialKey(userID, serviceName, username)
+		newKey := credentialKey(userID, newServiceName, newUsername)
+
+		var credentials models.Credentials
+		found, err := getRecord(bucket, key, &credentials)
+		if err != nil {
+			return err
+		}
+
+		if !found {
+			return models.ErrNotFound
+		}
+
+		if bytes.Equal(key, newKey) {
+			return nil
+		}
+
+		if bucket.Get(newKey) != nil {
+			return fmt.Errorf("%w: %s", models.ErrConflict, newServiceName)
+		}
+
+		credentials.ServiceName, credentials.Username = newServiceName, newUsername
+		if err = putRecord(bucket, newKey, credentials); err != nil {
+			return err
+		}
+
+		return bucket.Delete(key)
+	})
+}
+
+func (b *Bolt) GetAccounts(ctx context.Context, userID int64, serviceName string) ([]models.Credentials, error) {
+	return b.list(ctx, credentialsBucket, serviceKey(userID, serviceName), nil)
+}
+
+func (b *Bolt) GetAllByUserID(ctx context.Context, userID int64) ([]models.Credentials, error) {
+	return b.list(ctx, credentialsBucket, userKey(userID), nil)
+}
+
+func (b *Bolt) GetAllByUserIDAfter(ctx context.Context, userID int64, serviceName, username string) ([]models.Credentials, error) {
+	return b.list(ctx, credentialsBucket, userKey(userID), credentialKey(userID, serviceName, username))
+}
+
+// list returns credentials whose keys start with prefix, those after
+// the key after if it's set.
+func (b *Bolt) list(ctx context.Context, name, prefix, after []byte) ([]models.Credentials, error) {
+	var result []models.Credentials
+
+	err := b.view(ctx, func(tx *bolt.Tx) error {
+		bucket := openBucket(tx, name)
+		c := bucket.Cursor()
+
+		seek := prefix
+		if after != nil {
+			seek = after
+		}
+
+		for k, v := c.Seek(seek); k != nil && bytes.HasPrefix(k, prefix) && len(result) < maxServices; k, v = c.Next() {
+			if bytes.Equal(k, after) {
+				continue
+			}
+
+			var credentials models.Credentials
+			if err := bucket.unmarshal(v, &credentials); err != nil {
+				return err
+			}
+
+			result = append(result, credentials)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (b *Bolt) Delete(ctx context.Context, userID int64, serviceName, username string) error {
+	return b.update(ctx, func(tx *bolt.Tx) error {
+		bucket := openBucket(tx, credentialsBucket)
+		key := credentialKey(userID, serviceName, username)
+
+		if bucket.Get(key) == nil {
+			return models.ErrNotFound
+		}
+
+		return bucket.Delete(key)
+	})
+}
+
+func (b *Bolt) Trash(ctx context.Context, userID int64, serviceName, username string, deletedAt time.Time) error {
+	return b.update(ctx, func(tx *bolt.Tx) error {
+		bucket := openBucket(tx, credentialsBucket)
+		key := credentialKey(userID, serviceName, username)
+
+		var credentials models.Credentials
+		found, err := getRecord(bucket, key, &credentials)
+		if err != nil {
+			return err
+		}
+
+		if !found {
+			return models.ErrNotFound
+		}
+
+		credentials.DeletedAt = deletedAt.Unix()
+		if err = putRecord(openBucket(tx, trashBucket), key, credentials); err != nil {
+			return err
+		}
+
+		return bucket.Delete(key)
+	})
+}
+
+func (b *Bolt) GetTrash(ctx context.Context, userID int64) ([]models.Credentials, error) {
+	return b.list(ctx, trashBucket, userKey(userID), nil)
+}
+
+func (b *Bolt) GetTrashAfter(ctx context.Context, userID int64, serviceName, username string) ([]models.Credentials, error) {
+	return b.list(ctx, trashBucket, userKey(userID), credentialKey(userID, serviceName, username))
+}
+
+func (b *Bolt) RestoreTrash(ctx context.Context, userID int64, serviceName, username string) error {
+	return b.update(ctx, func(tx *bolt.Tx) error {
+		trash := openBucket(tx, trashBucket)
+		key := credentialKey(userID, serviceName, username)
+
+		var credentials models.Credentials
+		found, err := getRecord(trash, key, &credentials)
+		if err != nil {
+			return err
+		}
+
+		if !found {
+			return models.ErrNotFound
+		}
+
+		bucket := openBucket(tx, credentialsBucket)
+		if bucket.Get(key) != nil {
+			return fmt.Errorf("%w: %s", models.ErrConflict, serviceName)
+		}
+
+		credentials.DeletedAt = 0
+		if err = putRecord(bucket, key, credentials); err != nil {
+			return err
+		}
+
+		return trash.Delete(key)
+	})
+}
+
+func (b *Bolt) PurgeTrash(ctx context.Context, userID int64, serviceName, username string) error {
+	return b.update(ctx, func(tx *bolt.Tx) error {
+		bucket := openBucket(tx, trashBucket)
+		key := credentialKey(userID, serviceName, username)
+
+		if bucket.Get(key) == nil {
+			return models.ErrNotFound
+		}
+
+		return bucket.Delete(key)
+	})
+}
+
+func (b *Bolt) ExpireTrash(ctx context.Context, olderThan time.Time) (int, error) {
+	expired := 0
+
+	err := b.update(ctx, func(tx *bolt.Tx) error {
+		bucket := openBucket(tx, trashBucket)
+
+		// Keys are deleted after the scan: deleting under a cursor skips records
+		var keys [][]byte
+		err := bucket.ForEach(func(k, v []byte) error {
+			var credentials models.Credentials
+			if err := bucket.unmarshal(v, &credentials); err != nil {
+				return err
+			}
+
+			if credentials.DeletedAt < olderThan.Unix() {
+				keys = append(keys, append([]byte(nil), k...))
+			}
+
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, key := range keys {
+			if err = bucket.Delete(key); err != nil {
+				return err
+			}
+		}
+		expired = len(keys)
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return expired, nil
+}
+
+// updateState applies update to the user's state in one transaction,
+// starting from the default state when none is stored.
+func (b *Bolt) updateState(ctx context.Context, userID int64, update func(*models.State)) error {
+	return b.update(ctx, func(tx *bolt.Tx) error {
+		bucket := openBucket(tx, stateBucket)
+
+		state := models.State{
+			UserID: uint64(userID),
+			State:  models.StateDefault,
+		}
+		if _, err := getRecord(bucket, userKey(userID), &state); err != nil {
+			return err
+		}
+
+		update(&state)
+
+		return putRecord(bucket, userKey(userID), state)
+	})
+}
+
+func (b *Bolt) SetState(ctx context.Context, userID int64, state string) error {
+	return b.updateState(ctx, userID, func(s *models.State) {
+		s.State = state
+	})
+}
+
+func (b *Bolt) SetDraft(ctx context.Context, userID int64, serviceName, username string) error {
+	return b.updateState(ctx, userID, func(s *models.State) {
+		s.LastService = serviceName
+		s.DraftUsername = username
+		s.DraftUpdatedAt = time.Now().Unix()
+	})
+}
+
+func (b *Bolt) DiscardDraft(ctx context.Context, userID int64) error {
+	return b.updateState(ctx, userID, func(s *models.State) {
+		*s = withoutDraft(*s)
+	})
+}
+
+func (b *Bolt) PurgeDrafts(ctx context.Context, olderThan time.Time) (int, error) {
+	purged := 0
+
+	err := b.update(ctx, func(tx *bolt.Tx) error {
+		bucket := openBucket(tx, stateBucket)
+
+		return bucket.ForEach(func(k, v []byte) error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			var state models.State
+			if err := bucket.unmarshal(v, &state); err != nil {
+				return err
+			}
+
+			if !isStaleDraft(state, olderThan) {
+				return nil
+			}
+
+			purged++
+
+			return putRecord(bucket, k, purgeDraft(state))
+		})
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return purged, nil
+}
+
+func (b *Bolt) GetState(ctx context.Context, userID int64) (models.State, error) {
+	state := models.State{
+		UserID: uint64(userID),
+		State:  models.StateDefault,
+	}
+
+	err := b.view(ctx, func(tx *bolt.Tx) error {
+		_, err := getRecord(openBucket(tx, stateBucket), userKey(userID), &state)
+		return err
+	})
+	if err != nil {
+		return models.State{}, err
+	}
+
+	return state, nil
+}
+
+// Dump reads all users in a single read transaction, writers aren't
+// blocked meanwhile.
+func (b *Bolt) Dump(ctx context.Context, fn func(UserSnapshot) error) error {
+	return b.view(ctx, func(tx *bolt.Tx) error {
+		users := openBucket(tx, usersBucket)
+
+		return users.ForEach(func(k, v []byte) error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			var snapshot UserSnapshot
+			if err := users.unmarshal(v, &snapshot.User); err != nil {
+				return err
+			}
+
+			var err error
+			if snapshot.Credentials, err = scanCredentials(openBucket(tx, credentialsBucket), k); err != nil {
+				return err
+			}
+
+			if snapshot.Trash, err = scanCredentials(openBucket(tx, trashBucket), k); err != nil {
+				return err
+			}
+
+			var state models.State
+			found, err := getRecord(openBucket(tx, stateBucket), k, &state)
+			if err != nil {
+				return err
+			}
+
+			if found {
+				snapshot.State = &state
+			}
+
+			return fn(snapshot)
+		})
+	})
+}
+
+// scanCredentials returns all credentials whose keys start with prefix.
+func scanCredentials(bucket bucket, prefix []byte) ([]models.Credentials, error) {
+	var result []models.Credentials
+
+	c := bucket.Cursor()
+	for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+		var credentials models.Credentials
+		if err := bucket.unmarshal(v, &credentials); err != nil {
+			return nil, err
+		}
+
+		result = append(result, credentials)
+	}
+
+	return result, nil
+}
+
+func (b *Bolt) Restore(ctx context.Context, snapshot UserSnapshot) error {
+	return b.update(ctx, func(tx *bolt.Tx) error {
+		userID := int64(snapshot.User.ID)
+		prefix := userKey(userID)
+
+		if err := putRecord(openBucket(tx, usersBucket), prefix, snapshot.User); err != nil {
+			return err
+		}
+
+		for _, space := range []struct {
+			name        []byte
+			credentials []models.Credentials
+		}{
+			{credentialsBucket, snapshot.Credentials},
+			{trashBucket, snapshot.Trash},
+		} {
+			bucket := openBucket(tx, space.name)
+
+			c := bucket.Cursor()
+			for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Seek(prefix) {
+				if err := c.Delete(); err != nil {
+					return err
+				}
+			}
+
+			for _, credentials := range space.credentials {
+				credentials.UserID = snapshot.User.ID
+				key := credentialKey(userID, credentials.ServiceName, credentials.Username)
+				if err := putRecord(bucket, key, credentials); err != nil {
+					return err
+				}
+			}
+		}
+
+		states := openBucket(tx, stateBucket)
+		if snapshot.State == nil {
+			return states.Delete(prefix)
+		}
+
+		state := *snapshot.State
+		state.UserID = snapshot.User.ID
+
+		return putRecord(states, prefix, state)
+	})
+}
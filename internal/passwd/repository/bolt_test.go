@@ -0,0 +1,94 @@
+package passwdRepository
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+	"gopkg.in/vmihailenco/msgpack.v2"
+
+	"telegram-bot/internal/models"
+)
+
+func newTestBolt(t *testing.T) *Bolt {
+	t.Helper()
+
+	b, err := NewBolt(filepath.Join(t.TempDir(), "passwd.db"), time.Second)
+	if err != nil {
+		t.Fatalf("failed to open bolt: %s", err)
+	}
+	t.Cleanup(func() { b.Close() })
+
+	return b
+}
+
+func TestBoltConformance(t *testing.T) {
+	RunConformance(t, func(t *testing.T) Storage {
+		return newTestBolt(t)
+	})
+}
+
+func TestBoltBackup(t *testing.T) {
+	ctx := context.Background()
+	b := newTestBolt(t)
+	mustNoErr(t, b.SetToken(ctx, 1, "token"))
+	mustNoErr(t, b.SaveCredentials(ctx, models.Credentials{UserID: 1, ServiceName: "github"}))
+
+	path := filepath.Join(t.TempDir(), "backup", "passwd.db")
+	mustNoErr(t, b.BackupFile(path))
+
+	restored, err := NewBolt(path, time.Second)
+	mustNoErr(t, err)
+	defer restored.Close()
+
+	user, err := restored.GetUser(ctx, 1)
+	mustNoErr(t, err)
+
+	if user.Token != "token" {
+		t.Fatalf("unexpected user in backup: %+v", user)
+	}
+
+	var buf bytes.Buffer
+	n, err := b.Backup(&buf)
+	mustNoErr(t, err)
+
+	if n == 0 || int64(buf.Len()) != n {
+		t.Fatalf("unexpected backup size %d (buffer %d)", n, buf.Len())
+	}
+}
+
+func TestBoltUpgradeAccountKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "passwd.db")
+
+	// A file written before credential keys included the username
+	db, err := bolt.Open(path, 0o600, nil)
+	mustNoErr(t, err)
+	mustNoErr(t, db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucket(credentialsBucket)
+		if err != nil {
+			return err
+		}
+
+		data, err := msgpack.Marshal(models.Credentials{UserID: 1, ServiceName: "github", Username: "octocat", PasswordHash: "p"})
+		if err != nil {
+			return err
+		}
+
+		return bucket.Put(append(userKey(1), "github"...), data)
+	}))
+	mustNoErr(t, db.Close())
+
+	b, err := NewBolt(path, time.Second)
+	mustNoErr(t, err)
+	defer b.Close()
+
+	got, err := b.Get(context.Background(), 1, "github", "octocat")
+	mustNoErr(t, err)
+
+	if got.PasswordHash != "p" {
+		t.Fatalf("unexpected credentials after upgrade: %+v", got)
+	}
+}
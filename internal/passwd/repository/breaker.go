@@ -0,0 +1,130 @@
+package passwdRepository
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"telegram-bot/internal/models"
+)
+
+type BreakerState int
+
+const (
+	BreakerClosed BreakerState = iota
+	BreakerHalfOpen
+	BreakerOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerHalfOpen:
+		return "half-open"
+	case BreakerOpen:
+		return "open"
+	default:
+		return "unknown"
+	}
+}
+
+// breaker opens after threshold consecutive failures and rejects calls for
+// cooldown. Then it lets a single probe through: success closes it,
+// failure opens it for another cooldown.
+type breaker struct {
+	threshold int
+	cooldown  time.Duration
+	now       func() time.Time
+
+	mu       sync.Mutex
+	state    BreakerState
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+func newBreaker(threshold int, cooldown time.Duration) *breaker {
+	return &breaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+		now:       time.Now,
+	}
+}
+
+// allow reports whether a call may go to the storage.
+func (b *breaker) allow() bool {
+	if b.threshold <= 0 {
+		return true
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case BreakerOpen:
+		if b.now().Sub(b.openedAt) < b.cooldown {
+			return false
+		}
+		b.state = BreakerHalfOpen
+		b.probing = true
+		return true
+	case BreakerHalfOpen:
+		if b.probing {
+			return false
+		}
+		b.probing = true
+		return true
+	default:
+		return true
+	}
+}
+
+// isFailure reports whether err means the storage itself is in trouble.
+// Domain errors are answers of a working storage, a call cancelled by
+// the caller says nothing about it and a rejected one didn't reach it.
+func isFailure(err error) bool {
+	return err != nil &&
+		!errors.Is(err, models.ErrUnavailable) &&
+		!errors.Is(err, models.ErrNotFound) &&
+		!errors.Is(err, models.ErrConflict) &&
+		!errors.Is(err, models.ErrCorruptTuple) &&
+		!errors.Is(err, context.Canceled)
+}
+
+// done records the outcome of an allowed call.
+func (b *breaker) done(err error) {
+	if b.threshold <= 0 {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if errors.Is(err, context.Canceled) {
+		b.probing = false
+		return
+	}
+
+	if !isFailure(err) {
+		b.state = BreakerClosed
+		b.failures = 0
+		b.probing = false
+		return
+	}
+
+	b.failures++
+	if b.state == BreakerHalfOpen || b.failures >= b.threshold {
+		b.state = BreakerOpen
+		b.openedAt = b.now()
+		b.probing = false
+	}
+}
+
+func (b *breaker) State() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.state
+}
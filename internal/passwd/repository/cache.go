@@ -0,0 +1,157 @@
+package passwdRepository
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"telegram-bot/internal/models"
+)
+
+type CacheOpts struct {
+	// Size is the maximum number of users and of states kept
+	Size int
+	// TTL bounds how long a record changed by another bot instance may be served
+	TTL time.Duration
+}
+
+type CacheStats struct {
+	Hits    uint64
+	Misses  uint64
+	Entries int
+}
+
+// Cache wraps a Storage and keeps users and states read through it,
+// the lookups every update starts with. Writes through the Cache
+// invalidate the records they change.
+type Cache struct {
+	Storage
+	users  *lru[int64, models.User]
+	states *lru[int64, models.State]
+
+	hits   uint64
+	misses uint64
+}
+
+func NewCache(storage Storage, opts CacheOpts) *Cache {
+	return &Cache{
+		Storage: storage,
+		users:   newLRU[int64, models.User](opts.Size, opts.TTL),
+		states:  newLRU[int64, models.State](opts.Size, opts.TTL),
+	}
+}
+
+func (c *Cache) Stats() CacheStats {
+	return CacheStats{
+		Hits:    atomic.LoadUint64(&c.hits),
+		Misses:  atomic.LoadUint64(&c.misses),
+		Entries: c.users.len() + c.states.len(),
+	}
+}
+
+// Close closes the wrapped storage if it can be closed.
+func (c *Cache) Close() error {
+	if closer, ok := c.Storage.(interface{ Close() error }); ok {
+		return closer.Close()
+	}
+
+	return nil
+}
+
+func (c *Cache) CreateUser(ctx context.Context, userID int64, token string) error {
+	defer c.users.remove(userID)
+
+	return c.Storage.CreateUser(ctx, userID, token)
+}
+
+func (c *Cache) SetToken(ctx context.Context, userID int64, token string) error {
+	defer c.users.remove(userID)
+
+	return c.Storage.SetToken(ctx, userID, token)
+}
+
+func (c *Cache) UpdateToken(ctx context.Context, userID int64, token string) error {
+	defer c.users.remove(userID)
+
+	return c.Storage.UpdateToken(ctx, userID, token)
+}
+
+func (c *Cache) SetSetting(ctx context.Context, userID int64, key, value string) error {
+	defer c.users.remove(userID)
+
+	return c.Storage.SetSetting(ctx, userID, key, value)
+}
+
+func (c *Cache) GetUser(ctx context.Context, userID int64) (models.User, error) {
+	if user, ok := c.users.get(userID); ok {
+		atomic.AddUint64(&c.hits, 1)
+		return user, nil
+	}
+	atomic.AddUint64(&c.misses, 1)
+
+	version := c.users.currentVersion()
+
+	user, err := c.Storage.GetUser(ctx, userID)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	c.users.addIfVersion(userID, user, version)
+
+	return user, nil
+}
+
+func (c *Cache) SaveCredentials(ctx context.Context, credentials models.Credentials) error {
+	defer c.states.remove(int64(credentials.UserID))
+
+	return c.Storage.SaveCredentials(ctx, credentials)
+}
+
+func (c *Cache) ReEncrypt(ctx context.Context, userID int64, token string, credentials []models.Credentials) error {
+	defer c.users.remove(userID)
+
+	return c.Storage.ReEncrypt(ctx, userID, token, credentials)
+}
+
+func (c *Cache) SetState(ctx context.Context, userID int64, state string) error {
+	defer c.states.remove(userID)
+
+	return c.Storage.SetState(ctx, userID, state)
+}
+
+func (c *Cache) SetDraft(ctx context.Context, userID int64, serviceName, username string) error {
+	defer c.states.remove(userID)
+
+	return c.Storage.SetDraft(ctx, userID, serviceName, username)
+}
+
+func (c *Cache) DiscardDraft(ctx context.Context, userID int64) error {
+	defer c.states.remove(userID)
+
+	return c.Storage.DiscardDraft(ctx, userID)
+}
+
+func (c *Cache) PurgeDrafts(ctx context.Context, olderThan time.Time) (int, error) {
+	defer c.states.clear()
+
+	return c.Storage.PurgeDrafts(ctx, olderThan)
+}
+
+func (c *Cache) GetState(ctx context.Context, userID int64) (models.State, error) {
+	if state, ok := c.states.get(userID); ok {
+		atomic.AddUint64(&c.hits, 1)
+		return state, nil
+	}
+	atomic.AddUint64(&c.misses, 1)
+
+	version := c.states.currentVersion()
+
+	state, err := c.Storage.GetState(ctx, userID)
+	if err != nil {
+		return models.State{}, err
+	}
+
+	c.states.addIfVersion(userID, state, version)
+
+	return state, nil
+}
@@ -0,0 +1,121 @@
+package passwdRepository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"telegram-bot/internal/models"
+)
+
+// counting is a Storage counting GetUser and GetState calls.
+type counting struct {
+	*Memory
+	users  int
+	states int
+}
+
+func (c *counting) GetUser(ctx context.Context, userID int64) (models.User, error) {
+	c.users++
+	return c.Memory.GetUser(ctx, userID)
+}
+
+func (c *counting) GetState(ctx context.Context, userID int64) (models.State, error) {
+	c.states++
+	return c.Memory.GetState(ctx, userID)
+}
+
+func TestCacheConformance(t *testing.T) {
+	RunConformance(t, func(t *testing.T) Storage {
+		return NewCache(NewMemory(), CacheOpts{Size: 100, TTL: time.Minute})
+	})
+}
+
+func TestCacheReadThrough(t *testing.T) {
+	ctx := context.Background()
+	storage := &counting{Memory: NewMemory()}
+	c := NewCache(storage, CacheOpts{Size: 100, TTL: time.Minute})
+
+	mustNoErr(t, c.SetToken(ctx, 1, "token"))
+
+	for i := 0; i < 3; i++ {
+		_, err := c.GetUser(ctx, 1)
+		mustNoErr(t, err)
+		_, err = c.GetState(ctx, 1)
+		mustNoErr(t, err)
+	}
+
+	if storage.users != 1 || storage.states != 1 {
+		t.Fatalf("expected one storage call per record, got %d users and %d states", storage.users, storage.states)
+	}
+
+	mustNoErr(t, c.UpdateToken(ctx, 1, "new"))
+	mustNoErr(t, c.SetState(ctx, 1, models.StateGetService))
+
+	user, err := c.GetUser(ctx, 1)
+	mustNoErr(t, err)
+	state, err := c.GetState(ctx, 1)
+	mustNoErr(t, err)
+
+	if user.Token != "new" || state.State != models.StateGetService {
+		t.Fatalf("stale records after write: %+v, %+v", user, state)
+	}
+
+	if stats := c.Stats(); stats.Hits != 4 || stats.Misses != 4 || stats.Entries != 2 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+}
+
+func TestCacheMissingUserNotCached(t *testing.T) {
+	ctx := context.Background()
+	c := NewCache(NewMemory(), CacheOpts{Size: 100, TTL: time.Minute})
+
+	_, err := c.GetUser(ctx, 1)
+	mustNotFound(t, err)
+
+	mustNoErr(t, c.SetToken(ctx, 1, "token"))
+
+	_, err = c.GetUser(ctx, 1)
+	mustNoErr(t, err)
+}
+
+func TestLRUEvictionAndTTL(t *testing.T) {
+	c := newLRU[int, string](2, time.Minute)
+	now := time.Now()
+	c.now = func() time.Time { return now }
+
+	c.addIfVersion(1, "a", c.currentVersion())
+	c.addIfVersion(2, "b", c.currentVersion())
+	c.get(1)
+	c.addIfVersion(3, "c", c.currentVersion())
+
+	if _, ok := c.get(2); ok {
+		t.Fatal("least recently used entry not evicted")
+	}
+
+	if v, ok := c.get(1); !ok || v != "a" {
+		t.Fatal("recently used entry evicted")
+	}
+
+	now = now.Add(2 * time.Minute)
+	if _, ok := c.get(1); ok {
+		t.Fatal("expired entry returned")
+	}
+
+	if c.len() != 1 {
+		t.Fatalf("expected only entry 3 to remain, got %d entries", c.len())
+	}
+}
+
+func TestLRUStaleFill(t *testing.T) {
+	c := newLRU[int, string](2, time.Minute)
+
+	// A reader loads the old value while a write invalidates the key
+	version := c.currentVersion()
+	c.remove(1)
+	c.addIfVersion(1, "old", version)
+
+	if _, ok := c.get(1); ok {
+		t.Fatal("value loaded before an invalidation was cached")
+	}
+}
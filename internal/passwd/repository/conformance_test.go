@@ -0,0 +1,1158 @@
+package passwdRepository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"telegram-bot/internal/models"
+)
+
+// Factory returns a Storage for a single conformance test. Backends that
+// share state between calls (e.g. a running Tarantool) are fine: every test
+// works with its own user IDs.
+type Factory func(t *testing.T) Storage
+
+var conformanceUserID = time.Now().UnixNano() % (1 << 40)
+
+// nextUserID returns an ID no other conformance test has used in this process.
+func nextUserID() int64 {
+	return atomic.AddInt64(&conformanceUserID, 1)
+}
+
+// RunConformance checks the behaviour the usecase and handler layers expect
+// from every Storage implementation.
+func RunConformance(t *testing.T, newStorage Factory) {
+	tests := []struct {
+		name string
+		run  func(t *testing.T, ctx context.Context, s Storage)
+	}{
+		{"UserMissing", testUserMissing},
+		{"UserSetToken", testUserSetToken},
+		{"UserSetTokenTwice", testUserSetTokenTwice},
+		{"UserCreateKeepsToken", testUserCreateKeepsToken},
+		{"UserUpdateToken", testUserUpdateToken},
+		{"UserSettings", testUserSettings},
+		{"CredentialsCRUD", testCredentialsCRUD},
+		{"CredentialsCiphertext", testCredentialsCiphertext},
+		{"CredentialsDetails", testCredentialsDetails},
+		{"CredentialsMissing", testCredentialsMissing},
+		{"CredentialsPartial", testCredentialsPartial},
+		{"CredentialsOverwrite", testCredentialsOverwrite},
+		{"CredentialsHistory", testCredentialsHistory},
+		{"CredentialsTouch", testCredentialsTouch},
+		{"CredentialsRename", testCredentialsRename},
+		{"CredentialsRenameConflict", testCredentialsRenameConflict},
+		{"CredentialsAccounts", testCredentialsAccounts},
+		{"CredentialsIsolation", testCredentialsIsolation},
+		{"CredentialsPagination", testCredentialsPagination},
+		{"Delete", testDelete},
+		{"DeleteMissing", testDeleteMissing},
+		{"DeleteCredentialsByUser", testDeleteCredentialsByUser},
+		{"Trash", testTrash},
+		{"TrashRestoreConflict", testTrashRestoreConflict},
+		{"TrashPurge", testTrashPurge},
+		{"TrashPagination", testTrashPagination},
+		{"ExpireTrash", testExpireTrash},
+		{"ReEncryptTrash", testReEncryptTrash},
+		{"ReEncrypt", testReEncrypt},
+		{"StateDefault", testStateDefault},
+		{"StateDraft", testStateDraft},
+		{"StateDiscardDraft", testStateDiscardDraft},
+		{"PurgeDrafts", testPurgeDrafts},
+		{"SnapshotDump", testSnapshotDump},
+		{"SnapshotRestore", testSnapshotRestore},
+		{"Concurrency", testConcurrency},
+		{"CancelledContext", testCancelledContext},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			tt.run(t, context.Background(), newStorage(t))
+		})
+	}
+}
+
+func mustNoErr(t *testing.T, err error) {
+	t.Helper()
+
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+}
+
+func saveCredentials(t *testing.T, s Storage, userID int64, c models.Credentials) {
+	t.Helper()
+
+	c.UserID = uint64(userID)
+	mustNoErr(t, s.SaveCredentials(context.Background(), c))
+}
+
+func mustNotFound(t *testing.T, err error) {
+	t.Helper()
+
+	if !errors.Is(err, models.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func testUserMissing(t *testing.T, ctx context.Context, s Storage) {
+	_, err := s.GetUser(ctx, nextUserID())
+	mustNotFound(t, err)
+
+	mustNotFound(t, s.UpdateToken(ctx, nextUserID(), "token"))
+}
+
+func testUserSetToken(t *testing.T, ctx context.Context, s Storage) {
+	userID := nextUserID()
+	mustNoErr(t, s.SetToken(ctx, userID, "token"))
+
+	user, err := s.GetUser(ctx, userID)
+	mustNoErr(t, err)
+
+	if user.ID != uint64(userID) || user.Token != "token" {
+		t.Fatalf("unexpected user: %+v", user)
+	}
+}
+
+func testUserSetTokenTwice(t *testing.T, ctx context.Context, s Storage) {
+	userID := nextUserID()
+	mustNoErr(t, s.SetToken(ctx, userID, "token"))
+
+	if err := s.SetToken(ctx, userID, "token"); !errors.Is(err, models.ErrConflict) {
+		t.Fatalf("expected ErrConflict on second SetToken, got %v", err)
+	}
+}
+
+func testUserCreateKeepsToken(t *testing.T, ctx context.Context, s Storage) {
+	userID := nextUserID()
+	mustNoErr(t, s.CreateUser(ctx, userID, "first"))
+	mustNoErr(t, s.CreateUser(ctx, userID, "first"))
+
+	user, err := s.GetUser(ctx, userID)
+	mustNoErr(t, err)
+
+	if user.Token != "first" {
+		t.Fatalf("expected token %q, got %q", "first", user.Token)
+	}
+}
+
+func testUserSettings(t *testing.T, ctx context.Context, s Storage) {
+	mustNotFound(t, s.SetSetting(ctx, nextUserID(), "key", "value"))
+
+	userID := nextUserID()
+	mustNoErr(t, s.SetToken(ctx, userID, "token"))
+	mustNoErr(t, s.SetSetting(ctx, userID, "first", "1"))
+	mustNoErr(t, s.SetSetting(ctx, userID, "second", "2"))
+	mustNoErr(t, s.UpdateToken(ctx, userID, "new"))
+
+	user, err := s.GetUser(ctx, userID)
+	mustNoErr(t, err)
+
+	if want := map[string]string{"first": "1", "second": "2"}; !reflect.DeepEqual(user.Settings, want) {
+		t.Fatalf("expected settings %v, got %v", want, user.Settings)
+	}
+
+	mustNoErr(t, s.SetSetting(ctx, userID, "first", ""))
+	mustNoErr(t, s.SetSetting(ctx, userID, "second", ""))
+
+	user, err = s.GetUser(ctx, userID)
+	mustNoErr(t, err)
+
+	if len(user.Settings) != 0 || user.Token != "new" {
+		t.Fatalf("unexpected user: %+v", user)
+	}
+}
+
+func testUserUpdateToken(t *testing.T, ctx context.Context, s Storage) {
+	userID := nextUserID()
+	mustNoErr(t, s.SetToken(ctx, userID, "old"))
+	mustNoErr(t, s.UpdateToken(ctx, userID, "new"))
+
+	user, err := s.GetUser(ctx, userID)
+	mustNoErr(t, err)
+
+	if user.Token != "new" {
+		t.Fatalf("expected token %q, got %q", "new", user.Token)
+	}
+}
+
+func testCredentialsCRUD(t *testing.T, ctx context.Context, s Storage) {
+	userID := nextUserID()
+	want := models.Credentials{
+		UserID:       uint64(userID),
+		ServiceName:  "github",
+		Username:     "octocat",
+		PasswordHash: "secret",
+	}
+	saveCredentials(t, s, userID, want)
+
+	got, err := s.Get(ctx, userID, "github", "octocat")
+	mustNoErr(t, err)
+
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %+v, got %+v", want, got)
+	}
+}
+
+// testCredentialsCiphertext checks that encrypted values, which are
+// arbitrary bytes rather than UTF-8 text, are kept intact.
+func testCredentialsCiphertext(t *testing.T, ctx context.Context, s Storage) {
+	userID := nextUserID()
+	token, password := "\xff\x00token\xc3", "\xfe\x80secret\x00"
+
+	mustNoErr(t, s.SetToken(ctx, userID, token))
+	saveCredentials(t, s, userID, models.Credentials{ServiceName: "github", Username: "octocat", PasswordHash: password})
+
+	user, err := s.GetUser(ctx, userID)
+	mustNoErr(t, err)
+
+	if user.Token != token {
+		t.Fatalf("expected token %q, got %q", token, user.Token)
+	}
+
+	got, err := s.Get(ctx, userID, "github", "octocat")
+	mustNoErr(t, err)
+
+	if got.PasswordHash != password {
+		t.Fatalf("expected password %q, got %q", password, got.PasswordHash)
+	}
+}
+
+func testCredentialsDetails(t *testing.T, ctx context.Context, s Storage) {
+	userID := nextUserID()
+	want := models.Credentials{
+		UserID:       uint64(userID),
+		ServiceName:  "github",
+		Username:     "octocat",
+		PasswordHash: "secret",
+		Type:         models.ItemToken,
+		Strength:     3,
+		UpdatedAt:    1700000000,
+		Details: models.Details{
+			URL:    "https://github.com",
+			Notes:  "notes",
+			Tags:   []string{"dev", "work"},
+			Fields: map[string]string{"PIN": "pin", "Recovery email": "email"},
+			OTP:    "otp",
+		},
+	}
+	saveCredentials(t, s, userID, want)
+
+	// Details must not be shared with the saved value
+	want.Tags[0] = "changed"
+
+	got, err := s.Get(ctx, userID, "github", "octocat")
+	mustNoErr(t, err)
+
+	want.Tags[0] = "dev"
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %+v, got %+v", want, got)
+	}
+
+	accounts, err := s.GetAccounts(ctx, userID, "github")
+	mustNoErr(t, err)
+
+	if len(accounts) != 1 || !reflect.DeepEqual(accounts[0], want) {
+		t.Fatalf("expected details in the listing, got %+v", accounts)
+	}
+
+	// Saving without details clears them
+	saveCredentials(t, s, userID, models.Credentials{ServiceName: "github", Username: "octocat", PasswordHash: "secret"})
+
+	got, err = s.Get(ctx, userID, "github", "octocat")
+	mustNoErr(t, err)
+
+	if got.Type != "" || !got.Details.IsZero() {
+		t.Fatalf("expected details to be cleared, got %+v", got)
+	}
+}
+
+func testCredentialsMissing(t *testing.T, ctx context.Context, s Storage) {
+	_, err := s.Get(ctx, nextUserID(), "missing", "")
+	mustNotFound(t, err)
+}
+
+func testCredentialsPartial(t *testing.T, ctx context.Context, s Storage) {
+	userID := nextUserID()
+	saveCredentials(t, s, userID, models.Credentials{ServiceName: "github", PasswordHash: "secret"})
+
+	got, err := s.Get(ctx, userID, "github", "")
+	mustNoErr(t, err)
+
+	if got.ServiceName != "github" || got.Username != "" || got.PasswordHash != "secret" {
+		t.Fatalf("unexpected credentials without username: %+v", got)
+	}
+}
+
+func testCredentialsOverwrite(t *testing.T, ctx context.Context, s Storage) {
+	userID := nextUserID()
+	saveCredentials(t, s, userID, models.Credentials{ServiceName: "github", Username: "octocat", PasswordHash: "old"})
+	saveCredentials(t, s, userID, models.Credentials{ServiceName: "github", Username: "octocat", PasswordHash: "new"})
+
+	got, err := s.Get(ctx, userID, "github", "octocat")
+	mustNoErr(t, err)
+
+	if got.PasswordHash != "new" {
+		t.Fatalf("expected overwritten credentials, got %+v", got)
+	}
+
+	accounts, err := s.GetAccounts(ctx, userID, "github")
+	mustNoErr(t, err)
+
+	if len(accounts) != 1 {
+		t.Fatalf("expected a single account, got %+v", accounts)
+	}
+}
+
+func testCredentialsHistory(t *testing.T, ctx context.Context, s Storage) {
+	userID := nextUserID()
+
+	want := models.Credentials{
+		UserID:       uint64(userID),
+		ServiceName:  "github",
+		Username:     "octocat",
+		PasswordHash: "new",
+		UpdatedAt:    1700000200,
+		CreatedAt:    1700000000,
+		History: []models.PasswordVersion{
+			{Password: "old", Strength: 3, UpdatedAt: 1700000100, ReplacedAt: 1700000200},
+			{Password: "first", ReplacedAt: 1700000100},
+		},
+	}
+	saveCredentials(t, s, userID, want)
+
+	got, err := s.Get(ctx, userID, "github", "octocat")
+	mustNoErr(t, err)
+
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %+v, got %+v", want, got)
+	}
+
+	// Re-encrypted history replaces the stored one
+	mustNoErr(t, s.SetToken(ctx, userID, "token"))
+	want.PasswordHash = "new-2"
+	want.History = want.History[:1]
+	want.History[0].Password = "old-2"
+	mustNoErr(t, s.ReEncrypt(ctx, userID, "token-2", []models.Credentials{want}))
+
+	got, err = s.Get(ctx, userID, "github", "octocat")
+	mustNoErr(t, err)
+
+	if !reflect.DeepEqual(got.History, want.History) {
+		t.Fatalf("expected history %+v, got %+v", want.History, got.History)
+	}
+}
+
+func testCredentialsTouch(t *testing.T, ctx context.Context, s Storage) {
+	userID := nextUserID()
+	saveCredentials(t, s, userID, models.Credentials{ServiceName: "github", Username: "octocat", PasswordHash: "secret"})
+
+	// Viewing credentials in a flow keeps its draft
+	mustNoErr(t, s.SetState(ctx, userID, models.StateGetAccount))
+	mustNoErr(t, s.SetDraft(ctx, userID, "github", ""))
+
+	accessedAt := time.Unix(1700000000, 0)
+	mustNoErr(t, s.Touch(ctx, userID, "github", "octocat", accessedAt))
+
+	got, err := s.Get(ctx, userID, "github", "octocat")
+	mustNoErr(t, err)
+
+	if got.AccessedAt != accessedAt.Unix() || got.PasswordHash != "secret" {
+		t.Fatalf("expected access time %d, got %+v", accessedAt.Unix(), got)
+	}
+
+	state, err := s.GetState(ctx, userID)
+	mustNoErr(t, err)
+
+	if state.LastService != "github" {
+		t.Fatalf("expected the draft to be kept, got %+v", state)
+	}
+
+	mustNotFound(t, s.Touch(ctx, userID, "gitlab", "octocat", accessedAt))
+}
+
+func testCredentialsRename(t *testing.T, ctx context.Context, s Storage) {
+	userID := nextUserID()
+	want := models.Credentials{
+		UserID:       uint64(userID),
+		ServiceName:  "github",
+		Username:     "octocat",
+		PasswordHash: "secret",
+		Strength:     3,
+		UpdatedAt:    1700000000,
+		CreatedAt:    1600000000,
+		Details: models.Details{
+			URL:    "https://github.com",
+			Notes:  "notes",
+			Tags:   []string{"work"},
+			Fields: map[string]string{"PIN": "1234"},
+		},
+		History: []models.PasswordVersion{{Password: "old", UpdatedAt: 1500000000, ReplacedAt: 1700000000}},
+	}
+	saveCredentials(t, s, userID, want)
+
+	mustNoErr(t, s.Rename(ctx, userID, "github", "octocat", "GitHub", "hubot"))
+
+	_, err := s.Get(ctx, userID, "github", "octocat")
+	mustNotFound(t, err)
+
+	got, err := s.Get(ctx, userID, "GitHub", "hubot")
+	mustNoErr(t, err)
+
+	want.ServiceName, want.Username = "GitHub", "hubot"
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %+v, got %+v", want, got)
+	}
+
+	// Renaming to the same name leaves the account alone
+	mustNoErr(t, s.Rename(ctx, userID, "GitHub", "hubot", "GitHub", "hubot"))
+	mustNotFound(t, s.Rename(ctx, userID, "github", "octocat", "gitlab", "octocat"))
+}
+
+func testCredentialsRenameConflict(t *testing.T, ctx context.Context, s Storage) {
+	userID := nextUserID()
+	saveCredentials(t, s, userID, models.Credentials{ServiceName: "github", Username: "octocat", PasswordHash: "first"})
+	saveCredentials(t, s, userID, models.Credentials{ServiceName: "gitlab", Username: "octocat", PasswordHash: "second"})
+
+	if err := s.Rename(ctx, userID, "github", "octocat", "gitlab", "octocat"); !errors.Is(err, models.ErrConflict) {
+		t.Fatalf("expected ErrConflict, got %v", err)
+	}
+
+	accounts, err := s.GetAllByUserID(ctx, userID)
+	mustNoErr(t, err)
+
+	if len(accounts) != 2 || accounts[0].PasswordHash != "first" || accounts[1].PasswordHash != "second" {
+		t.Fatalf("a failed rename changed the accounts: %+v", accounts)
+	}
+}
+
+func testCredentialsAccounts(t *testing.T, ctx context.Context, s Storage) {
+	userID := nextUserID()
+	saveCredentials(t, s, userID, models.Credentials{ServiceName: "github", Username: "work", PasswordHash: "w"})
+	saveCredentials(t, s, userID, models.Credentials{ServiceName: "github", Username: "personal", PasswordHash: "p"})
+	saveCredentials(t, s, userID, models.Credentials{ServiceName: "github", Username: "", PasswordHash: "e"})
+	saveCredentials(t, s, userID, models.Credentials{ServiceName: "githubx", Username: "a", PasswordHash: "x"})
+
+	accounts, err := s.GetAccounts(ctx, userID, "github")
+	mustNoErr(t, err)
+
+	var usernames []string
+	for _, a := range accounts {
+		usernames = append(usernames, a.Username)
+	}
+
+	if fmt.Sprint(usernames) != fmt.Sprint([]string{"", "personal", "work"}) {
+		t.Fatalf("expected accounts ordered by username, got %q", usernames)
+	}
+
+	got, err := s.Get(ctx, userID, "github", "work")
+	mustNoErr(t, err)
+
+	if got.PasswordHash != "w" {
+		t.Fatalf("unexpected work account: %+v", got)
+	}
+
+	mustNoErr(t, s.Delete(ctx, userID, "github", "work"))
+
+	got, err = s.Get(ctx, userID, "github", "personal")
+	mustNoErr(t, err)
+
+	if got.PasswordHash != "p" {
+		t.Fatalf("deleting an account changed another one: %+v", got)
+	}
+
+	all, err := s.GetAllByUserID(ctx, userID)
+	mustNoErr(t, err)
+
+	if len(all) != 3 || all[0].ServiceName != "github" || all[2].ServiceName != "githubx" {
+		t.Fatalf("expected accounts ordered by service, got %+v", all)
+	}
+
+	accounts, err = s.GetAccounts(ctx, userID, "missing")
+	mustNoErr(t, err)
+
+	if len(accounts) != 0 {
+		t.Fatalf("expected no accounts of a missing service, got %+v", accounts)
+	}
+}
+
+func testCredentialsIsolation(t *testing.T, ctx context.Context, s Storage) {
+	first, second := nextUserID(), nextUserID()
+	saveCredentials(t, s, first, models.Credentials{ServiceName: "github", Username: "first", PasswordHash: "first"})
+
+	_, err := s.Get(ctx, second, "github", "first")
+	mustNotFound(t, err)
+
+	all, err := s.GetAllByUserID(ctx, second)
+	mustNoErr(t, err)
+
+	if len(all) != 0 {
+		t.Fatalf("expected no services for another user, got %d", len(all))
+	}
+}
+
+func testCredentialsPagination(t *testing.T, ctx context.Context, s Storage) {
+	userID := nextUserID()
+
+	for i := 0; i < maxServices+5; i++ {
+		saveCredentials(t, s, userID, models.Credentials{ServiceName: fmt.Sprintf("service-%03d", i)})
+	}
+
+	all, err := s.GetAllByUserID(ctx, userID)
+	mustNoErr(t, err)
+
+	if len(all) != maxServices {
+		t.Fatalf("expected %d services, got %d", maxServices, len(all))
+	}
+
+	for i, c := range all {
+		if want := fmt.Sprintf("service-%03d", i); c.ServiceName != want {
+			t.Fatalf("expected services ordered by name: position %d is %q, want %q", i, c.ServiceName, want)
+		}
+
+		if c.UserID != uint64(userID) {
+			t.Fatalf("unexpected user id %d", c.UserID)
+		}
+	}
+
+	// The next page ends with the user's accounts
+	other := nextUserID()
+	saveCredentials(t, s, other, models.Credentials{ServiceName: "service-000"})
+
+	last := all[len(all)-1]
+	next, err := s.GetAllByUserIDAfter(ctx, userID, last.ServiceName, last.Username)
+	mustNoErr(t, err)
+
+	if len(next) != 5 || next[0].ServiceName != fmt.Sprintf("service-%03d", maxServices) {
+		t.Fatalf("expected the last 5 services after %q, got %+v", last.ServiceName, next)
+	}
+
+	for _, c := range next {
+		if c.UserID != uint64(userID) {
+			t.Fatalf("unexpected user id %d", c.UserID)
+		}
+	}
+
+	last = next[len(next)-1]
+	next, err = s.GetAllByUserIDAfter(ctx, userID, last.ServiceName, last.Username)
+	mustNoErr(t, err)
+
+	if len(next) != 0 {
+		t.Fatalf("expected no services after the last one, got %+v", next)
+	}
+}
+
+func testDelete(t *testing.T, ctx context.Context, s Storage) {
+	userID := nextUserID()
+	saveCredentials(t, s, userID, models.Credentials{ServiceName: "github", Username: "u", PasswordHash: "p"})
+	saveCredentials(t, s, userID, models.Credentials{ServiceName: "gitlab", Username: "u", PasswordHash: "p"})
+
+	mustNoErr(t, s.Delete(ctx, userID, "github", "u"))
+
+	_, err := s.Get(ctx, userID, "github", "u")
+	mustNotFound(t, err)
+
+	all, err := s.GetAllByUserID(ctx, userID)
+	mustNoErr(t, err)
+
+	if len(all) != 1 || all[0].ServiceName != "gitlab" {
+		t.Fatalf("expected only gitlab to remain, got %+v", all)
+	}
+}
+
+func testDeleteMissing(t *testing.T, ctx context.Context, s Storage) {
+	mustNotFound(t, s.Delete(ctx, nextUserID(), "missing", ""))
+}
+
+func testDeleteCredentialsByUser(t *testing.T, ctx context.Context, s Storage) {
+	userID, other := nextUserID(), nextUserID()
+
+	for _, name := range []string{"a", "b", "c"} {
+		saveCredentials(t, s, userID, models.Credentials{ServiceName: name, Username: "u", PasswordHash: "p"})
+	}
+	saveCredentials(t, s, other, models.Credentials{ServiceName: "a", Username: "u", PasswordHash: "p"})
+
+	mustNoErr(t, s.DeleteCredentialsByUser(ctx, userID))
+
+	all, err := s.GetAllByUserID(ctx, userID)
+	mustNoErr(t, err)
+
+	if len(all) != 0 {
+		t.Fatalf("expected no credentials to remain, got %+v", all)
+	}
+
+	got, err := s.Get(ctx, other, "a", "u")
+	mustNoErr(t, err)
+
+	if got.ServiceName != "a" {
+		t.Fatal("DeleteCredentialsByUser removed credentials of another user")
+	}
+}
+
+func testReEncrypt(t *testing.T, ctx context.Context, s Storage) {
+	userID := nextUserID()
+	mustNoErr(t, s.SetToken(ctx, userID, "old-token"))
+	saveCredentials(t, s, userID, models.Credentials{
+		ServiceName:  "a",
+		Username:     "ua",
+		PasswordHash: "old-a",
+		Details: models.Details{
+			URL:    "https://a",
+			Notes:  "old-notes",
+			Fields: map[string]string{"PIN": "old-pin"},
+			OTP:    "old-otp",
+		},
+	})
+	saveCredentials(t, s, userID, models.Credentials{ServiceName: "b", Username: "ub", PasswordHash: "old-b"})
+
+	mustNoErr(t, s.ReEncrypt(ctx, userID, "new-token", []models.Credentials{
+		{
+			UserID:       uint64(userID),
+			ServiceName:  "a",
+			Username:     "ua",
+			PasswordHash: "new-a",
+			Details: models.Details{
+				URL:    "https://a",
+				Notes:  "new-notes",
+				Fields: map[string]string{"PIN": "new-pin"},
+				OTP:    "new-otp",
+			},
+		},
+		{UserID: uint64(userID), ServiceName: "b", Username: "ub", PasswordHash: "new-b"},
+	}))
+
+	user, err := s.GetUser(ctx, userID)
+	mustNoErr(t, err)
+
+	if user.Token != "new-token" {
+		t.Fatalf("token not re-encrypted: %q", user.Token)
+	}
+
+	for _, name := range []string{"a", "b"} {
+		got, err := s.Get(ctx, userID, name, "u"+name)
+		mustNoErr(t, err)
+
+		if got.PasswordHash != "new-"+name || got.Username != "u"+name {
+			t.Fatalf("unexpected credentials after ReEncrypt: %+v", got)
+		}
+	}
+
+	got, err := s.Get(ctx, userID, "a", "ua")
+	mustNoErr(t, err)
+
+	if got.URL != "https://a" || got.Notes != "new-notes" || got.Fields["PIN"] != "new-pin" || got.OTP != "new-otp" {
+		t.Fatalf("details not re-encrypted: %+v", got.Details)
+	}
+}
+
+func testTrash(t *testing.T, ctx context.Context, s Storage) {
+	userID := nextUserID()
+	want := models.Credentials{
+		UserID:       uint64(userID),
+		ServiceName:  "github",
+		Username:     "octocat",
+		PasswordHash: "secret",
+		CreatedAt:    1700000000,
+		Details:      models.Details{URL: "https://github.com"},
+	}
+	saveCredentials(t, s, userID, want)
+	saveCredentials(t, s, userID, models.Credentials{ServiceName: "gitlab", Username: "octocat", PasswordHash: "other"})
+
+	deletedAt := time.Unix(1700000100, 0)
+	mustNoErr(t, s.Trash(ctx, userID, "github", "octocat", deletedAt))
+	mustNotFound(t, s.Trash(ctx, userID, "github", "octocat", deletedAt))
+
+	_, err := s.Get(ctx, userID, "github", "octocat")
+	mustNotFound(t, err)
+
+	trash, err := s.GetTrash(ctx, userID)
+	mustNoErr(t, err)
+
+	want.DeletedAt = deletedAt.Unix()
+	if len(trash) != 1 || !reflect.DeepEqual(trash[0], want) {
+		t.Fatalf("expected %+v in the trash, got %+v", want, trash)
+	}
+
+	mustNoErr(t, s.RestoreTrash(ctx, userID, "github", "octocat"))
+	mustNotFound(t, s.RestoreTrash(ctx, userID, "github", "octocat"))
+
+	got, err := s.Get(ctx, userID, "github", "octocat")
+	mustNoErr(t, err)
+
+	want.DeletedAt = 0
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %+v restored, got %+v", want, got)
+	}
+
+	trash, err = s.GetTrash(ctx, userID)
+	mustNoErr(t, err)
+
+	if len(trash) != 0 {
+		t.Fatalf("expected an empty trash, got %+v", trash)
+	}
+}
+
+func testTrashRestoreConflict(t *testing.T, ctx context.Context, s Storage) {
+	userID := nextUserID()
+	saveCredentials(t, s, userID, models.Credentials{ServiceName: "github", Username: "octocat", PasswordHash: "old"})
+	mustNoErr(t, s.Trash(ctx, userID, "github", "octocat", time.Now()))
+	saveCredentials(t, s, userID, models.Credentials{ServiceName: "github", Username: "octocat", PasswordHash: "new"})
+
+	if err := s.RestoreTrash(ctx, userID, "github", "octocat"); !errors.Is(err, models.ErrConflict) {
+		t.Fatalf("expected ErrConflict, got %v", err)
+	}
+
+	got, err := s.Get(ctx, userID, "github", "octocat")
+	mustNoErr(t, err)
+
+	if got.PasswordHash != "new" {
+		t.Fatalf("restoring over a saved account replaced it: %+v", got)
+	}
+
+	trash, err := s.GetTrash(ctx, userID)
+	mustNoErr(t, err)
+
+	if len(trash) != 1 || trash[0].PasswordHash != "old" {
+		t.Fatalf("expected the deleted account kept in the trash, got %+v", trash)
+	}
+}
+
+func testTrashPurge(t *testing.T, ctx context.Context, s Storage) {
+	userID := nextUserID()
+	saveCredentials(t, s, userID, models.Credentials{ServiceName: "github", Username: "octocat", PasswordHash: "secret"})
+	saveCredentials(t, s, userID, models.Credentials{ServiceName: "gitlab", Username: "octocat", PasswordHash: "secret"})
+	mustNoErr(t, s.Trash(ctx, userID, "github", "octocat", time.Now()))
+	mustNoErr(t, s.Trash(ctx, userID, "gitlab", "octocat", time.Now()))
+
+	mustNoErr(t, s.PurgeTrash(ctx, userID, "github", "octocat"))
+	mustNotFound(t, s.PurgeTrash(ctx, userID, "github", "octocat"))
+	mustNotFound(t, s.RestoreTrash(ctx, userID, "github", "octocat"))
+
+	// Deleting all credentials empties the trash too
+	mustNoErr(t, s.DeleteCredentialsByUser(ctx, userID))
+
+	trash, err := s.GetTrash(ctx, userID)
+	mustNoErr(t, err)
+
+	if len(trash) != 0 {
+		t.Fatalf("expected an empty trash, got %+v", trash)
+	}
+}
+
+func testTrashPagination(t *testing.T, ctx context.Context, s Storage) {
+	userID := nextUserID()
+	deletedAt := time.Unix(1700000000, 0)
+
+	for i := 0; i < maxServices+5; i++ {
+		service := fmt.Sprintf("service-%03d", i)
+		saveCredentials(t, s, userID, models.Credentials{ServiceName: service, Username: "u"})
+		mustNoErr(t, s.Trash(ctx, userID, service, "u", deletedAt))
+	}
+
+	trash, err := s.GetTrash(ctx, userID)
+	mustNoErr(t, err)
+
+	if len(trash) != maxServices {
+		t.Fatalf("expected %d items in the trash, got %d", maxServices, len(trash))
+	}
+
+	for i, c := range trash {
+		if want := fmt.Sprintf("service-%03d", i); c.ServiceName != want {
+			t.Fatalf("expected items ordered by name: position %d is %q, want %q", i, c.ServiceName, want)
+		}
+	}
+
+	// The next page ends with the user's items
+	other := nextUserID()
+	saveCredentials(t, s, other, models.Credentials{ServiceName: "service-000", Username: "u"})
+	mustNoErr(t, s.Trash(ctx, other, "service-000", "u", deletedAt))
+
+	last := trash[len(trash)-1]
+	next, err := s.GetTrashAfter(ctx, userID, last.ServiceName, last.Username)
+	mustNoErr(t, err)
+
+	if len(next) != 5 || next[0].ServiceName != fmt.Sprintf("service-%03d", maxServices) {
+		t.Fatalf("expected the last 5 items after %q, got %+v", last.ServiceName, next)
+	}
+
+	for _, c := range next {
+		if c.UserID != uint64(userID) {
+			t.Fatalf("unexpected user id %d", c.UserID)
+		}
+	}
+
+	last = next[len(next)-1]
+	next, err = s.GetTrashAfter(ctx, userID, last.ServiceName, last.Username)
+	mustNoErr(t, err)
+
+	if len(next) != 0 {
+		t.Fatalf("expected no items after the last one, got %+v", next)
+	}
+}
+
+func testExpireTrash(t *testing.T, ctx context.Context, s Storage) {
+	userID := nextUserID()
+	saveCredentials(t, s, userID, models.Credentials{ServiceName: "old", PasswordHash: "secret"})
+	saveCredentials(t, s, userID, models.Credentials{ServiceName: "recent", PasswordHash: "secret"})
+
+	now := time.Now()
+	mustNoErr(t, s.Trash(ctx, userID, "old", "", now.Add(-48*time.Hour)))
+	mustNoErr(t, s.Trash(ctx, userID, "recent", "", now))
+
+	// Backends shared with other tests may expire their trash as well
+	expired, err := s.ExpireTrash(ctx, now.Add(-24*time.Hour))
+	mustNoErr(t, err)
+
+	if expired < 1 {
+		t.Fatalf("expected at least 1 expired account, got %d", expired)
+	}
+
+	trash, err := s.GetTrash(ctx, userID)
+	mustNoErr(t, err)
+
+	if len(trash) != 1 || trash[0].ServiceName != "recent" {
+		t.Fatalf("expected only the recent account left, got %+v", trash)
+	}
+}
+
+func testReEncryptTrash(t *testing.T, ctx context.Context, s Storage) {
+	userID := nextUserID()
+	mustNoErr(t, s.SetToken(ctx, userID, "old-token"))
+	saveCredentials(t, s, userID, models.Credentials{ServiceName: "github", Username: "octocat", PasswordHash: "old"})
+	mustNoErr(t, s.Trash(ctx, userID, "github", "octocat", time.Now()))
+
+	trash, err := s.GetTrash(ctx, userID)
+	mustNoErr(t, err)
+
+	trash[0].PasswordHash = "new"
+	mustNoErr(t, s.ReEncrypt(ctx, userID, "new-token", trash))
+
+	trash, err = s.GetTrash(ctx, userID)
+	mustNoErr(t, err)
+
+	if len(trash) != 1 || trash[0].PasswordHash != "new" {
+		t.Fatalf("expected the trash re-encrypted, got %+v", trash)
+	}
+}
+
+func testStateDefault(t *testing.T, ctx context.Context, s Storage) {
+	userID := nextUserID()
+
+	state, err := s.GetState(ctx, userID)
+	mustNoErr(t, err)
+
+	if state.UserID != uint64(userID) || state.State != models.StateDefault || state.LastService != "" {
+		t.Fatalf("unexpected default state: %+v", state)
+	}
+}
+
+func testStateDraft(t *testing.T, ctx context.Context, s Storage) {
+	userID := nextUserID()
+
+	mustNoErr(t, s.SetState(ctx, userID, models.StateSetUsername))
+	mustNoErr(t, s.SetDraft(ctx, userID, "github", ""))
+	mustNoErr(t, s.SetState(ctx, userID, models.StateSetPassword))
+	mustNoErr(t, s.SetDraft(ctx, userID, "github", "octocat"))
+
+	state, err := s.GetState(ctx, userID)
+	mustNoErr(t, err)
+
+	if state.State != models.StateSetPassword || state.LastService != "github" || state.DraftUsername != "octocat" {
+		t.Fatalf("unexpected state: %+v", state)
+	}
+
+	if state.DraftUpdatedAt == 0 {
+		t.Fatal("draft update time is not set")
+	}
+
+	// Saving the draft service ends the draft
+	saveCredentials(t, s, userID, models.Credentials{ServiceName: "github", Username: "octocat", PasswordHash: "p"})
+
+	state, err = s.GetState(ctx, userID)
+	mustNoErr(t, err)
+
+	if state.State != models.StateSetPassword || state.LastService != "" || state.DraftUsername != "" || state.DraftUpdatedAt != 0 {
+		t.Fatalf("draft not discarded on save: %+v", state)
+	}
+}
+
+func testStateDiscardDraft(t *testing.T, ctx context.Context, s Storage) {
+	userID := nextUserID()
+
+	mustNoErr(t, s.SetState(ctx, userID, models.StateSetPassword))
+	mustNoErr(t, s.SetDraft(ctx, userID, "github", "octocat"))
+	mustNoErr(t, s.DiscardDraft(ctx, userID))
+
+	state, err := s.GetState(ctx, userID)
+	mustNoErr(t, err)
+
+	if state.State != models.StateSetPassword || state.LastService != "" || state.DraftUsername != "" {
+		t.Fatalf("draft not discarded: %+v", state)
+	}
+
+	_, err = s.Get(ctx, userID, "github", "octocat")
+	mustNotFound(t, err)
+}
+
+func testPurgeDrafts(t *testing.T, ctx context.Context, s Storage) {
+	stale, fresh := nextUserID(), nextUserID()
+
+	mustNoErr(t, s.SetState(ctx, stale, models.StateSetPassword))
+	mustNoErr(t, s.SetDraft(ctx, stale, "github", "octocat"))
+	mustNoErr(t, s.SetState(ctx, fresh, models.StateSetPassword))
+	mustNoErr(t, s.SetDraft(ctx, fresh, "gitlab", "octocat"))
+
+	// Nothing is older than an hour ago
+	_, err := s.PurgeDrafts(ctx, time.Now().Add(-time.Hour))
+	mustNoErr(t, err)
+
+	state, err := s.GetState(ctx, stale)
+	mustNoErr(t, err)
+
+	if state.LastService != "github" {
+		t.Fatalf("fresh draft purged: %+v", state)
+	}
+
+	// Everything is older than a second from now. Backends shared between
+	// tests may purge drafts of other tests as well.
+	purged, err := s.PurgeDrafts(ctx, time.Now().Add(2*time.Second))
+	mustNoErr(t, err)
+
+	if purged < 2 {
+		t.Fatalf("expected at least 2 purged drafts, got %d", purged)
+	}
+
+	for _, id := range []int64{stale, fresh} {
+		state, err = s.GetState(ctx, id)
+		mustNoErr(t, err)
+
+		if state.State != models.StateDefault || state.LastService != "" || state.DraftUsername != "" {
+			t.Fatalf("draft not purged: %+v", state)
+		}
+	}
+}
+
+// dumpUsers returns the snapshots of the given users, Dump of a shared
+// backend returns those of other tests too.
+func dumpUsers(t *testing.T, ctx context.Context, s Storage, userIDs ...int64) map[int64]UserSnapshot {
+	t.Helper()
+
+	snapshotter, ok := s.(Snapshotter)
+	if !ok {
+		t.Skip("storage doesn't implement Snapshotter")
+	}
+
+	wanted := make(map[int64]bool, len(userIDs))
+	for _, userID := range userIDs {
+		wanted[userID] = true
+	}
+
+	snapshots := make(map[int64]UserSnapshot)
+	var last uint64
+
+	err := snapshotter.Dump(ctx, func(snapshot UserSnapshot) error {
+		if snapshot.User.ID <= last {
+			return fmt.Errorf("user %d dumped after %d", snapshot.User.ID, last)
+		}
+		last = snapshot.User.ID
+
+		if wanted[int64(snapshot.User.ID)] {
+			snapshots[int64(snapshot.User.ID)] = snapshot
+		}
+
+		return nil
+	})
+	mustNoErr(t, err)
+
+	return snapshots
+}
+
+func testSnapshotDump(t *testing.T, ctx context.Context, s Storage) {
+	userID, otherID := nextUserID(), nextUserID()
+
+	mustNoErr(t, s.SetToken(ctx, userID, "token"))
+	mustNoErr(t, s.SetSetting(ctx, userID, models.SettingGenerator, "words"))
+	saveCredentials(t, s, userID, models.Credentials{
+		ServiceName:  "github",
+		Username:     "octocat",
+		PasswordHash: "secret",
+		Details:      models.Details{Tags: []string{"work"}, Fields: map[string]string{"pin": "1234"}},
+		History:      []models.PasswordVersion{{Password: "old", ReplacedAt: 1700000000}},
+	})
+	saveCredentials(t, s, userID, models.Credentials{ServiceName: "gitlab", Username: "octocat", PasswordHash: "deleted"})
+	mustNoErr(t, s.Trash(ctx, userID, "gitlab", "octocat", time.Unix(1700000000, 0)))
+	mustNoErr(t, s.SetState(ctx, userID, models.StateSetPassword))
+	mustNoErr(t, s.SetDraft(ctx, userID, "jira", "octocat"))
+
+	mustNoErr(t, s.SetToken(ctx, otherID, "other"))
+
+	snapshots := dumpUsers(t, ctx, s, userID, otherID)
+
+	user, err := s.GetUser(ctx, userID)
+	mustNoErr(t, err)
+
+	credentials, err := s.GetAllByUserID(ctx, userID)
+	mustNoErr(t, err)
+
+	trash, err := s.GetTrash(ctx, userID)
+	mustNoErr(t, err)
+
+	state, err := s.GetState(ctx, userID)
+	mustNoErr(t, err)
+
+	want := UserSnapshot{User: user, Credentials: credentials, Trash: trash, State: &state}
+	if got := snapshots[userID]; !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected snapshot %+v, got %+v", want, got)
+	}
+
+	other := snapshots[otherID]
+	if other.User.Token != "other" || len(other.Credentials) != 0 || len(other.Trash) != 0 || other.State != nil {
+		t.Fatalf("unexpected snapshot of a user without data: %+v", other)
+	}
+
+	// An error of fn stops the dump
+	stop := errors.New("stop")
+	calls := 0
+	err = s.(Snapshotter).Dump(ctx, func(UserSnapshot) error {
+		calls++
+		return stop
+	})
+	if !errors.Is(err, stop) || calls != 1 {
+		t.Fatalf("expected the dump to stop with its error after a call, got %v after %d calls", err, calls)
+	}
+}
+
+func testSnapshotRestore(t *testing.T, ctx context.Context, s Storage) {
+	userID := nextUserID()
+
+	mustNoErr(t, s.SetToken(ctx, userID, "token"))
+	saveCredentials(t, s, userID, models.Credentials{ServiceName: "github", Username: "octocat", PasswordHash: "secret"})
+	saveCredentials(t, s, userID, models.Credentials{ServiceName: "gitlab", Username: "octocat", PasswordHash: "deleted"})
+	mustNoErr(t, s.Trash(ctx, userID, "gitlab", "octocat", time.Unix(1700000000, 0)))
+
+	snapshot := dumpUsers(t, ctx, s, userID)[userID]
+
+	// Everything changed since the snapshot is replaced
+	mustNoErr(t, s.UpdateToken(ctx, userID, "new-token"))
+	mustNoErr(t, s.SetSetting(ctx, userID, models.SettingGenerator, "words"))
+	mustNoErr(t, s.Delete(ctx, userID, "github", "octocat"))
+	saveCredentials(t, s, userID, models.Credentials{ServiceName: "jira", Username: "octocat", PasswordHash: "new"})
+	mustNoErr(t, s.RestoreTrash(ctx, userID, "gitlab", "octocat"))
+	mustNoErr(t, s.SetState(ctx, userID, models.StateSetService))
+
+	mustNoErr(t, s.(Snapshotter).Restore(ctx, snapshot))
+
+	if restored := dumpUsers(t, ctx, s, userID)[userID]; !reflect.DeepEqual(restored, snapshot) {
+		t.Fatalf("expected %+v restored, got %+v", snapshot, restored)
+	}
+
+	state, err := s.GetState(ctx, userID)
+	mustNoErr(t, err)
+
+	if state.State != models.StateDefault {
+		t.Fatalf("expected the state stored since the snapshot deleted, got %+v", state)
+	}
+
+	// A snapshot restores a user that doesn't exist
+	newID := nextUserID()
+	snapshot.User.ID = uint64(newID)
+	snapshot.State = &models.State{State: models.StateSetToken}
+	mustNoErr(t, s.(Snapshotter).Restore(ctx, snapshot))
+
+	credentials, err := s.GetAllByUserID(ctx, newID)
+	mustNoErr(t, err)
+
+	if len(credentials) != 1 || credentials[0].UserID != uint64(newID) || credentials[0].ServiceName != "github" ||
+		credentials[0].PasswordHash != "secret" {
+		t.Fatalf("unexpected credentials of the restored user: %+v", credentials)
+	}
+
+	if state, err = s.GetState(ctx, newID); err != nil || state.UserID != uint64(newID) || state.State != models.StateSetToken {
+		t.Fatalf("unexpected state of the restored user: %+v, %v", state, err)
+	}
+}
+
+func testConcurrency(t *testing.T, ctx context.Context, s Storage) {
+	const workers = 20
+
+	userID := nextUserID()
+	users := make([]int64, workers)
+	for i := range users {
+		users[i] = nextUserID()
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, workers*2)
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			errs <- s.SaveCredentials(ctx, models.Credentials{UserID: uint64(userID), ServiceName: fmt.Sprintf("service-%02d", i)})
+			errs <- s.SetState(ctx, users[i], models.StateGetService)
+		}(i)
+	}
+
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		mustNoErr(t, err)
+	}
+
+	all, err := s.GetAllByUserID(ctx, userID)
+	mustNoErr(t, err)
+
+	if len(all) != workers {
+		t.Fatalf("expected %d services, got %d", workers, len(all))
+	}
+
+	for _, id := range users {
+		state, err := s.GetState(ctx, id)
+		mustNoErr(t, err)
+
+		if state.State != models.StateGetService {
+			t.Fatalf("unexpected state for user %d: %+v", id, state)
+		}
+	}
+}
+
+func testCancelledContext(t *testing.T, ctx context.Context, s Storage) {
+	userID := nextUserID()
+	mustNoErr(t, s.SetToken(ctx, userID, "token"))
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+
+	if _, err := s.GetUser(cancelled, userID); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled from GetUser, got %v", err)
+	}
+
+	err := s.SaveCredentials(cancelled, models.Credentials{UserID: uint64(userID), ServiceName: "github"})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled from SaveCredentials, got %v", err)
+	}
+
+	if err = s.SetState(cancelled, userID, models.StateGetService); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled from SetState, got %v", err)
+	}
+
+	// Nothing is written with a cancelled context
+	_, err = s.Get(ctx, userID, "github", "")
+	mustNotFound(t, err)
+
+	state, err := s.GetState(ctx, userID)
+	mustNoErr(t, err)
+
+	if state.State != models.StateDefault {
+		t.Fatalf("state changed with a cancelled context: %+v", state)
+	}
+}
@@ -0,0 +1,123 @@
+package passwdRepository
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+type lruEntry[K comparable, V any] struct {
+	key       K
+	value     V
+	expiresAt time.Time
+}
+
+// lru is a size-bounded cache whose entries also expire after ttl.
+//
+// A value loaded from the storage may be stale by the time it's added if
+// a write invalidated the key meanwhile, so callers take version before
+// loading and addIfVersion drops the value if anything was invalidated since.
+type lru[K comparable, V any] struct {
+	size int
+	ttl  time.Duration
+	now  func() time.Time
+
+	mu      sync.Mutex
+	order   *list.List
+	entries map[K]*list.Element
+	version uint64
+}
+
+func newLRU[K comparable, V any](size int, ttl time.Duration) *lru[K, V] {
+	return &lru[K, V]{
+		size:    size,
+		ttl:     ttl,
+		now:     time.Now,
+		order:   list.New(),
+		entries: make(map[K]*list.Element),
+	}
+}
+
+func (c *lru[K, V]) get(key K) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var zero V
+
+	elem, ok := c.entries[key]
+	if !ok {
+		return zero, false
+	}
+
+	entry := elem.Value.(*lruEntry[K, V])
+	if c.now().After(entry.expiresAt) {
+		c.removeElement(elem)
+		return zero, false
+	}
+
+	c.order.MoveToFront(elem)
+
+	return entry.value, true
+}
+
+func (c *lru[K, V]) currentVersion() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.version
+}
+
+func (c *lru[K, V]) addIfVersion(key K, value V, version uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if version != c.version {
+		return
+	}
+
+	entry := &lruEntry[K, V]{key: key, value: value, expiresAt: c.now().Add(c.ttl)}
+
+	if elem, ok := c.entries[key]; ok {
+		elem.Value = entry
+		c.order.MoveToFront(elem)
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(entry)
+
+	for c.order.Len() > c.size {
+		c.removeElement(c.order.Back())
+	}
+}
+
+func (c *lru[K, V]) remove(key K) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.version++
+
+	if elem, ok := c.entries[key]; ok {
+		c.removeElement(elem)
+	}
+}
+
+func (c *lru[K, V]) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.version++
+	c.order.Init()
+	c.entries = make(map[K]*list.Element)
+}
+
+func (c *lru[K, V]) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.order.Len()
+}
+
+func (c *lru[K, V]) removeElement(elem *list.Element) {
+	c.order.Remove(elem)
+	delete(c.entries, elem.Value.(*lruEntry[K, V]).key)
+}
@@ -0,0 +1,669 @@
+package passwdRepository
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"telegram-bot/internal/models"
+)
+
+// Memory is a non-persistent Storage used for tests and local development.
+type Memory struct {
+	Storage
+	mu          sync.RWMutex
+	users       map[int64]models.User
+	credentials map[int64]map[account]models.Credentials
+	trash       map[int64]map[account]models.Credentials
+	state       map[int64]models.State
+}
+
+// account identifies credentials of a user.
+type account struct {
+	service  string
+	username string
+}
+
+func accountOf(c models.Credentials) account {
+	return account{service: c.ServiceName, username: c.Username}
+}
+
+// copyCredentials keeps stored tags and fields apart from the caller's,
+// like the other backends do by encoding them.
+func copyCredentials(c models.Credentials) models.Credentials {
+	if c.Tags != nil {
+		c.Tags = append([]string(nil), c.Tags...)
+	}
+
+	if c.Fields != nil {
+		fields := make(map[string]string, len(c.Fields))
+		for name, value := range c.Fields {
+			fields[name] = value
+		}
+		c.Fields = fields
+	}
+
+	if c.History != nil {
+		c.History = append([]models.PasswordVersion(nil), c.History...)
+	}
+
+	return c
+}
+
+func NewMemory() *Memory {
+	return &Memory{
+		users:       make(map[int64]models.User),
+		credentials: make(map[int64]map[account]models.Credentials),
+		trash:       make(map[int64]map[account]models.Credentials),
+		state:       make(map[int64]models.State),
+	}
+}
+
+func (m *Memory) Close() error {
+	return nil
+}
+
+func (m *Memory) CreateUser(ctx context.Context, userID int64, token string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.users[userID]; !ok {
+		m.users[userID] = models.User{ID: uint64(userID), Token: token}
+	}
+
+	return nil
+}
+
+func (m *Memory) GetUser(ctx context.Context, userID int64) (models.User, error) {
+	if err := ctx.Err(); err != nil {
+		return models.User{}, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	user, ok := m.users[userID]
+	if !ok {
+		return models.User{}, models.ErrNotFound
+	}
+
+	return user, nil
+}
+
+func (m *Memory) SetToken(ctx context.Context, userID int64, token string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.users[userID]; ok {
+		return fmt.Errorf("%w: user %d", models.ErrConflict, userID)
+	}
+
+	m.users[userID] = models.User{ID: uint64(userID), Token: token}
+
+	return nil
+}
+
+func (m *Memory) UpdateToken(ctx context.Context, userID int64, token string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.users[userID]
+	if !ok {
+		return models.ErrNotFound
+	}
+
+	user.Token = token
+	m.users[userID] = user
+
+	return nil
+}
+
+func (m *Memory) SetSetting(ctx context.Context, userID int64, key, value string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.users[userID]
+	if !ok {
+		return models.ErrNotFound
+	}
+
+	// Settings are replaced, not changed in place: GetUser shares them
+	user.Settings = withSetting(user.Settings, key, value)
+	m.users[userID] = user
+
+	return nil
+}
+
+func (m *Memory) DeleteCredentialsByUser(ctx context.Context, userID int64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.credentials, userID)
+	delete(m.trash, userID)
+
+	return nil
+}
+
+func (m *Memory) SaveCredentials(ctx context.Context, credentials models.Credentials) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	userID := int64(credentials.UserID)
+
+	accounts, ok := m.credentials[userID]
+	if !ok {
+		accounts = make(map[account]models.Credentials)
+		m.credentials[userID] = accounts
+	}
+	accounts[accountOf(credentials)] = copyCredentials(credentials)
+
+	if state, ok := m.state[userID]; ok && state.LastService == credentials.ServiceName {
+		m.state[userID] = withoutDraft(state)
+	}
+
+	return nil
+}
+
+func (m *Memory) ReEncrypt(ctx context.Context, userID int64, token string, credentials []models.Credentials) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if user, ok := m.users[userID]; ok {
+		user.Token = token
+		m.users[userID] = user
+	}
+
+	for _, c := range credentials {
+		accounts := m.credentials[userID]
+		if c.DeletedAt != 0 {
+			accounts = m.trash[userID]
+		}
+
+		if stored, ok := accounts[accountOf(c)]; ok {
+			stored.PasswordHash = c.PasswordHash
+			stored.Notes, stored.Fields, stored.OTP = c.Notes, c.Fields, c.OTP
+			stored.History = c.History
+			accounts[accountOf(c)] = copyCredentials(stored)
+		}
+	}
+
+	return nil
+}
+
+func (m *Memory) Get(ctx context.Context, userID int64, serviceName, username string) (models.Credentials, error) {
+	if err := ctx.Err(); err != nil {
+		return models.Credentials{}, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	credentials, ok := m.credentials[userID][account{service: serviceName, username: username}]
+	if !ok {
+		return models.Credentials{}, models.ErrNotFound
+	}
+
+	return copyCredentials(credentials), nil
+}
+
+func (m *Memory) Touch(ctx context.Context, userID int64, serviceName, username string, accessedAt time.Time) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := account{service: serviceName, username: username}
+
+	credentials, ok := m.credentials[userID][key]
+	if !ok {
+		return models.ErrNotFound
+	}
+
+	credentials.AccessedAt = accessedAt.Unix()
+	m.credentials[userID][key] = credentials
+
+	return nil
+}
+
+func (m *Memory) Rename(ctx context.Context, userID int64, serviceName, username, newServiceName, newUsername string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := account{service: serviceName, username: username}
+	newKey := account{service: newServiceName, username: newUsername}
+
+	credentials, ok := m.credentials[userID][key]
+	if !ok {
+		return models.ErrNotFound
+	}
+
+	if newKey == key {
+		return nil
+	}
+
+	if _, ok = m.credentials[userID][newKey]; ok {
+		return fmt.Errorf("%w: %s", models.ErrConflict, newServiceName)
+	}
+
+	credentials.ServiceName, credentials.Username = newServiceName, newUsername
+	m.credentials[userID][newKey] = credentials
+	delete(m.credentials[userID], key)
+
+	return nil
+}
+
+func (m *Memory) GetAccounts(ctx context.Context, userID int64, serviceName string) ([]models.Credentials, error) {
+	return m.list(ctx, m.credentials, userID, func(c models.Credentials) bool {
+		return c.ServiceName == serviceName
+	})
+}
+
+func (m *Memory) GetAllByUserID(ctx context.Context, userID int64) ([]models.Credentials, error) {
+	return m.list(ctx, m.credentials, userID, func(models.Credentials) bool {
+		return true
+	})
+}
+
+func (m *Memory) GetAllByUserIDAfter(ctx context.Context, userID int64, serviceName, username string) ([]models.Credentials, error) {
+	return m.list(ctx, m.credentials, userID, after(serviceName, username))
+}
+
+// after matches accounts ordered after the service and username.
+func after(serviceName, username string) func(models.Credentials) bool {
+	return func(c models.Credentials) bool {
+		return c.ServiceName > serviceName || c.ServiceName == serviceName && c.Username > username
+	}
+}
+
+// list returns credentials of the user in space matching filter in the
+// order of the Tarantool primary index.
+func (m *Memory) list(ctx context.Context, space map[int64]map[account]models.Credentials, userID int64, filter func(models.Credentials) bool) ([]models.Credentials, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var result []models.Credentials
+	for _, credentials := range space[userID] {
+		if filter(credentials) {
+			result = append(result, copyCredentials(credentials))
+		}
+	}
+
+	sortAccounts(result)
+
+	if len(result) > maxServices {
+		result = result[:maxServices]
+	}
+
+	return result, nil
+}
+
+func (m *Memory) Delete(ctx context.Context, userID int64, serviceName, username string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := account{service: serviceName, username: username}
+	if _, ok := m.credentials[userID][key]; !ok {
+		return models.ErrNotFound
+	}
+
+	delete(m.credentials[userID], key)
+
+	return nil
+}
+
+func (m *Memory) Trash(ctx context.Context, userID int64, serviceName, username string, deletedAt time.Time) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := account{service: serviceName, username: username}
+
+	credentials, ok := m.credentials[userID][key]
+	if !ok {
+		return models.ErrNotFound
+	}
+
+	trash, ok := m.trash[userID]
+	if !ok {
+		trash = make(map[account]models.Credentials)
+		m.trash[userID] = trash
+	}
+
+	credentials.DeletedAt = deletedAt.Unix()
+	trash[key] = credentials
+	delete(m.credentials[userID], key)
+
+	return nil
+}
+
+func (m *Memory) GetTrash(ctx context.Context, userID int64) ([]models.Credentials, error) {
+	return m.list(ctx, m.trash, userID, func(models.Credentials) bool {
+		return true
+	})
+}
+
+func (m *Memory) GetTrashAfter(ctx context.Context, userID int64, serviceName, username string) ([]models.Credentials, error) {
+	return m.list(ctx, m.trash, userID, after(serviceName, username))
+}
+
+func (m *Memory) RestoreTrash(ctx context.Context, userID int64, serviceName, username string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := account{service: serviceName, username: username}
+
+	credentials, ok := m.trash[userID][key]
+	if !ok {
+		return models.ErrNotFound
+	}
+
+	if _, ok = m.credentials[userID][key]; ok {
+		return fmt.Errorf("%w: %s", models.ErrConflict, serviceName)
+	}
+
+	accounts, ok := m.credentials[userID]
+	if !ok {
+		accounts = make(map[account]models.Credentials)
+		m.credentials[userID] = accounts
+	}
+
+	credentials.DeletedAt = 0
+	accounts[key] = credentials
+	delete(m.trash[userID], key)
+
+	return nil
+}
+
+func (m *Memory) PurgeTrash(ctx context.Context, userID int64, serviceName, username string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := account{service: serviceName, username: username}
+	if _, ok := m.trash[userID][key]; !ok {
+		return models.ErrNotFound
+	}
+
+	delete(m.trash[userID], key)
+
+	return nil
+}
+
+func (m *Memory) ExpireTrash(ctx context.Context, olderThan time.Time) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	expired := 0
+	for _, trash := range m.trash {
+		for key, credentials := range trash {
+			if credentials.DeletedAt < olderThan.Unix() {
+				delete(trash, key)
+				expired++
+			}
+		}
+	}
+
+	return expired, nil
+}
+
+func (m *Memory) updateState(ctx context.Context, userID int64, update func(*models.State)) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	state, ok := m.state[userID]
+	if !ok {
+		state = models.State{UserID: uint64(userID), State: models.StateDefault}
+	}
+
+	update(&state)
+	m.state[userID] = state
+
+	return nil
+}
+
+func (m *Memory) SetState(ctx context.Context, userID int64, state string) error {
+	return m.updateState(ctx, userID, func(s *models.State) {
+		s.State = state
+	})
+}
+
+func (m *Memory) SetDraft(ctx context.Context, userID int64, serviceName, username string) error {
+	return m.updateState(ctx, userID, func(s *models.State) {
+		s.LastService = serviceName
+		s.DraftUsername = username
+		s.DraftUpdatedAt = time.Now().Unix()
+	})
+}
+
+func (m *Memory) DiscardDraft(ctx context.Context, userID int64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if state, ok := m.state[userID]; ok {
+		m.state[userID] = withoutDraft(state)
+	}
+
+	return nil
+}
+
+func (m *Memory) PurgeDrafts(ctx context.Context, olderThan time.Time) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	purged := 0
+	for userID, state := range m.state {
+		if isStaleDraft(state, olderThan) {
+			m.state[userID] = purgeDraft(state)
+			purged++
+		}
+	}
+
+	return purged, nil
+}
+
+func (m *Memory) GetState(ctx context.Context, userID int64) (models.State, error) {
+	if err := ctx.Err(); err != nil {
+		return models.State{}, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	state, ok := m.state[userID]
+	if !ok {
+		return models.State{
+			UserID: uint64(userID),
+			State:  models.StateDefault,
+		}, nil
+	}
+
+	return state, nil
+}
+
+// Dump copies all users at once, fn is called after the lock is released.
+func (m *Memory) Dump(ctx context.Context, fn func(UserSnapshot) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.RLock()
+	snapshots := make([]UserSnapshot, 0, len(m.users))
+	for userID, user := range m.users {
+		snapshot := UserSnapshot{
+			User:        copyUser(user),
+			Credentials: sortedCredentials(m.credentials[userID]),
+			Trash:       sortedCredentials(m.trash[userID]),
+		}
+
+		if state, ok := m.state[userID]; ok {
+			snapshot.State = &state
+		}
+
+		snapshots = append(snapshots, snapshot)
+	}
+	m.mu.RUnlock()
+
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].User.ID < snapshots[j].User.ID
+	})
+
+	for _, snapshot := range snapshots {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if err := fn(snapshot); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m *Memory) Restore(ctx context.Context, snapshot UserSnapshot) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	userID := int64(snapshot.User.ID)
+	m.users[userID] = copyUser(snapshot.User)
+
+	delete(m.credentials, userID)
+	delete(m.trash, userID)
+
+	for _, space := range []struct {
+		accounts    map[int64]map[account]models.Credentials
+		credentials []models.Credentials
+	}{
+		{m.credentials, snapshot.Credentials},
+		{m.trash, snapshot.Trash},
+	} {
+		if len(space.credentials) == 0 {
+			continue
+		}
+
+		accounts := make(map[account]models.Credentials, len(space.credentials))
+		for _, c := range space.credentials {
+			c.UserID = snapshot.User.ID
+			accounts[accountOf(c)] = copyCredentials(c)
+		}
+		space.accounts[userID] = accounts
+	}
+
+	if snapshot.State != nil {
+		state := *snapshot.State
+		state.UserID = snapshot.User.ID
+		m.state[userID] = state
+	} else {
+		delete(m.state, userID)
+	}
+
+	return nil
+}
+
+func copyUser(user models.User) models.User {
+	if user.Settings != nil {
+		settings := make(map[string]string, len(user.Settings))
+		for key, value := range user.Settings {
+			settings[key] = value
+		}
+		user.Settings = settings
+	}
+
+	return user
+}
+
+// sortedCredentials copies accounts in the order of the primary index.
+func sortedCredentials(accounts map[account]models.Credentials) []models.Credentials {
+	var result []models.Credentials
+	for _, c := range accounts {
+		result = append(result, copyCredentials(c))
+	}
+
+	sortAccounts(result)
+
+	return result
+}
+
+// sortAccounts orders credentials by service and username.
+func sortAccounts(credentials []models.Credentials) {
+	sort.Slice(credentials, func(i, j int) bool {
+		if credentials[i].ServiceName != credentials[j].ServiceName {
+			return credentials[i].ServiceName < credentials[j].ServiceName
+		}
+		return credentials[i].Username < credentials[j].Username
+	})
+}
@@ -0,0 +1,9 @@
+package passwdRepository
+
+import "testing"
+
+func TestMemoryConformance(t *testing.T) {
+	RunConformance(t, func(t *testing.T) Storage {
+		return NewMemory()
+	})
+}
@@ -0,0 +1,137 @@
+package passwdRepository
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/tarantool/go-tarantool"
+	"github.com/tarantool/go-tarantool/connection_pool"
+)
+
+type ReplicationOpts struct {
+	// CheckInterval is how often instance roles and replica lag are checked
+	CheckInterval time.Duration
+	// MaxLag is the replication lag after which reads go to the master,
+	// 0 disables the check
+	MaxLag time.Duration
+}
+
+// replicaLagLua returns the largest upstream lag of the instance in seconds
+// or -1 if it doesn't follow some of its upstreams.
+const replicaLagLua = `
+local lag = 0
+for _, r in pairs(box.info.replication) do
+    local upstream = r.upstream
+    if upstream ~= nil then
+        if upstream.status ~= 'follow' then
+            return -1
+        end
+        lag = math.max(lag, upstream.lag)
+    end
+end
+return lag
+`
+
+// replicaMonitor tracks replicas of the pool and sends reads to the master
+// while any of them lags behind. Role changes (the master becoming read-only,
+// a replica promoted) are handled by the pool itself, which calls
+// Deactivated and Discovered for the switched connection.
+type replicaMonitor struct {
+	maxLag   time.Duration
+	mu       sync.Mutex
+	replicas map[*tarantool.Connection]bool
+	lagging  int32
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+func newReplicaMonitor(maxLag time.Duration) *replicaMonitor {
+	return &replicaMonitor{
+		maxLag:   maxLag,
+		replicas: make(map[*tarantool.Connection]bool),
+		done:     make(chan struct{}),
+	}
+}
+
+func (m *replicaMonitor) Discovered(conn *tarantool.Connection, role connection_pool.Role) error {
+	if role != connection_pool.ReplicaRole {
+		return nil
+	}
+
+	m.mu.Lock()
+	m.replicas[conn] = true
+	m.mu.Unlock()
+
+	return nil
+}
+
+func (m *replicaMonitor) Deactivated(conn *tarantool.Connection, role connection_pool.Role) error {
+	m.mu.Lock()
+	delete(m.replicas, conn)
+	m.mu.Unlock()
+
+	return nil
+}
+
+// readMode returns the pool mode for reads that tolerate replication lag.
+func (m *replicaMonitor) readMode() connection_pool.Mode {
+	if atomic.LoadInt32(&m.lagging) == 1 {
+		return connection_pool.RW
+	}
+
+	return connection_pool.PreferRO
+}
+
+func (m *replicaMonitor) run(interval time.Duration) {
+	if m.maxLag <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.done:
+			return
+		case <-ticker.C:
+			m.check()
+		}
+	}
+}
+
+func (m *replicaMonitor) stop() {
+	m.stopOnce.Do(func() {
+		close(m.done)
+	})
+}
+
+func (m *replicaMonitor) check() {
+	m.mu.Lock()
+	replicas := make([]*tarantool.Connection, 0, len(m.replicas))
+	for conn := range m.replicas {
+		replicas = append(replicas, conn)
+	}
+	m.mu.Unlock()
+
+	lagging := int32(0)
+	for _, conn := range replicas {
+		if !m.keepsUp(conn) {
+			lagging = 1
+			break
+		}
+	}
+
+	atomic.StoreInt32(&m.lagging, lagging)
+}
+
+func (m *replicaMonitor) keepsUp(conn *tarantool.Connection) bool {
+	var lag []float64
+
+	if err := conn.EvalTyped(replicaLagLua, []interface{}{}, &lag); err != nil || len(lag) == 0 {
+		return false
+	}
+
+	return lag[0] >= 0 && time.Duration(lag[0]*float64(time.Second)) <= m.maxLag
+}
@@ -0,0 +1,329 @@
+package passwdRepository
+
+import (
+	"context"
+	"math/rand"
+	"sync/atomic"
+	"time"
+
+	"telegram-bot/internal/models"
+)
+
+const maxRetryBackoff = 2 * time.Second
+
+type ResilientOpts struct {
+	// Retries is the number of extra attempts of a failed read
+	Retries int
+	// Backoff is the base delay between attempts, it doubles with every
+	// retry and is jittered
+	Backoff time.Duration
+	// Threshold is the number of consecutive failures that opens the
+	// breaker, 0 disables it
+	Threshold int
+	// Cooldown is how long the open breaker rejects calls
+	Cooldown time.Duration
+}
+
+// ResilientStats are counters of calls since the storage was made.
+type ResilientStats struct {
+	Retries  uint64
+	Failures uint64
+	Rejected uint64
+}
+
+// Resilient wraps a Storage: reads (which are idempotent) are retried with
+// jittered exponential backoff and a circuit breaker stops calling a storage
+// that keeps failing. While the breaker is open calls fail fast with
+// models.ErrUnavailable.
+type Resilient struct {
+	Storage
+	opts    ResilientOpts
+	breaker *breaker
+
+	retries  uint64
+	failures uint64
+	rejected uint64
+}
+
+func NewResilient(storage Storage, opts ResilientOpts) *Resilient {
+	return &Resilient{
+		Storage: storage,
+		opts:    opts,
+		breaker: newBreaker(opts.Threshold, opts.Cooldown),
+	}
+}
+
+func (r *Resilient) BreakerState() BreakerState {
+	return r.breaker.State()
+}
+
+func (r *Resilient) Stats() ResilientStats {
+	return ResilientStats{
+		Retries:  atomic.LoadUint64(&r.retries),
+		Failures: atomic.LoadUint64(&r.failures),
+		Rejected: atomic.LoadUint64(&r.rejected),
+	}
+}
+
+// Close closes the wrapped storage if it can be closed.
+func (r *Resilient) Close() error {
+	if closer, ok := r.Storage.(interface{ Close() error }); ok {
+		return closer.Close()
+	}
+
+	return nil
+}
+
+// call runs fn once through the breaker.
+func (r *Resilient) call(fn func() error) error {
+	if !r.breaker.allow() {
+		atomic.AddUint64(&r.rejected, 1)
+		return models.ErrUnavailable
+	}
+
+	err := fn()
+	if isFailure(err) {
+		atomic.AddUint64(&r.failures, 1)
+	}
+	r.breaker.done(err)
+
+	return err
+}
+
+// retry runs the read fn through the breaker until it succeeds, fails with
+// an error that isn't a storage failure or runs out of attempts.
+func (r *Resilient) retry(ctx context.Context, fn func() error) error {
+	err := r.call(fn)
+
+	for attempt := 0; attempt < r.opts.Retries && isFailure(err); attempt++ {
+		timer := time.NewTimer(r.backoff(attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+
+		atomic.AddUint64(&r.retries, 1)
+		err = r.call(fn)
+	}
+
+	return err
+}
+
+// backoff returns a random delay up to Backoff*2^attempt ("full jitter"),
+// so that instances retrying after the same outage don't hit it in step.
+func (r *Resilient) backoff(attempt int) time.Duration {
+	limit := r.opts.Backoff << attempt
+	if limit <= 0 || limit > maxRetryBackoff {
+		limit = maxRetryBackoff
+	}
+
+	return time.Duration(rand.Int63n(int64(limit) + 1))
+}
+
+func (r *Resilient) CreateUser(ctx context.Context, userID int64, token string) error {
+	return r.call(func() error {
+		return r.Storage.CreateUser(ctx, userID, token)
+	})
+}
+
+func (r *Resilient) SetToken(ctx context.Context, userID int64, token string) error {
+	return r.call(func() error {
+		return r.Storage.SetToken(ctx, userID, token)
+	})
+}
+
+func (r *Resilient) UpdateToken(ctx context.Context, userID int64, token string) error {
+	return r.call(func() error {
+		return r.Storage.UpdateToken(ctx, userID, token)
+	})
+}
+
+func (r *Resilient) GetUser(ctx context.Context, userID int64) (models.User, error) {
+	var user models.User
+
+	err := r.retry(ctx, func() (err error) {
+		user, err = r.Storage.GetUser(ctx, userID)
+		return err
+	})
+
+	return user, err
+}
+
+func (r *Resilient) SetSetting(ctx context.Context, userID int64, key, value string) error {
+	return r.call(func() error {
+		return r.Storage.SetSetting(ctx, userID, key, value)
+	})
+}
+
+func (r *Resilient) DeleteCredentialsByUser(ctx context.Context, userID int64) error {
+	return r.call(func() error {
+		return r.Storage.DeleteCredentialsByUser(ctx, userID)
+	})
+}
+
+func (r *Resilient) SaveCredentials(ctx context.Context, credentials models.Credentials) error {
+	return r.call(func() error {
+		return r.Storage.SaveCredentials(ctx, credentials)
+	})
+}
+
+func (r *Resilient) ReEncrypt(ctx context.Context, userID int64, token string, credentials []models.Credentials) error {
+	return r.call(func() error {
+		return r.Storage.ReEncrypt(ctx, userID, token, credentials)
+	})
+}
+
+func (r *Resilient) Get(ctx context.Context, userID int64, serviceName, username string) (models.Credentials, error) {
+	var credentials models.Credentials
+
+	err := r.retry(ctx, func() (err error) {
+		credentials, err = r.Storage.Get(ctx, userID, serviceName, username)
+		return err
+	})
+
+	return credentials, err
+}
+
+func (r *Resilient) Touch(ctx context.Context, userID int64, serviceName, username string, accessedAt time.Time) error {
+	return r.call(func() error {
+		return r.Storage.Touch(ctx, userID, serviceName, username, accessedAt)
+	})
+}
+
+func (r *Resilient) Rename(ctx context.Context, userID int64, serviceName, username, newServiceName, newUsername string) error {
+	return r.call(func() error {
+		return r.Storage.Rename(ctx, userID, serviceName, username, newServiceName, newUsername)
+	})
+}
+
+func (r *Resilient) GetAccounts(ctx context.Context, userID int64, serviceName string) ([]models.Credentials, error) {
+	var credentials []models.Credentials
+
+	err := r.retry(ctx, func() (err error) {
+		credentials, err = r.Storage.GetAccounts(ctx, userID, serviceName)
+		return err
+	})
+
+	return credentials, err
+}
+
+func (r *Resilient) GetAllByUserID(ctx context.Context, userID int64) ([]models.Credentials, error) {
+	var credentials []models.Credentials
+
+	err := r.retry(ctx, func() (err error) {
+		credentials, err = r.Storage.GetAllByUserID(ctx, userID)
+		return err
+	})
+
+	return credentials, err
+}
+
+func (r *Resilient) GetAllByUserIDAfter(ctx context.Context, userID int64, serviceName, username string) ([]models.Credentials, error) {
+	var credentials []models.Credentials
+
+	err := r.retry(ctx, func() (err error) {
+		credentials, err = r.Storage.GetAllByUserIDAfter(ctx, userID, serviceName, username)
+		return err
+	})
+
+	return credentials, err
+}
+
+func (r *Resilient) Delete(ctx context.Context, userID int64, serviceName, username string) error {
+	return r.call(func() error {
+		return r.Storage.Delete(ctx, userID, serviceName, username)
+	})
+}
+
+func (r *Resilient) Trash(ctx context.Context, userID int64, serviceName, username string, deletedAt time.Time) error {
+	return r.call(func() error {
+		return r.Storage.Trash(ctx, userID, serviceName, username, deletedAt)
+	})
+}
+
+func (r *Resilient) GetTrash(ctx context.Context, userID int64) ([]models.Credentials, error) {
+	var credentials []models.Credentials
+
+	err := r.retry(ctx, func() (err error) {
+		credentials, err = r.Storage.GetTrash(ctx, userID)
+		return err
+	})
+
+	return credentials, err
+}
+
+func (r *Resilient) GetTrashAfter(ctx context.Context, userID int64, serviceName, username string) ([]models.Credentials, error) {
+	var credentials []models.Credentials
+
+	err := r.retry(ctx, func() (err error) {
+		credentials, err = r.Storage.GetTrashAfter(ctx, userID, serviceName, username)
+		return err
+	})
+
+	return credentials, err
+}
+
+func (r *Resilient) RestoreTrash(ctx context.Context, userID int64, serviceName, username string) error {
+	return r.call(func() error {
+		return r.Storage.RestoreTrash(ctx, userID, serviceName, username)
+	})
+}
+
+func (r *Resilient) PurgeTrash(ctx context.Context, userID int64, serviceName, username string) error {
+	return r.call(func() error {
+		return r.Storage.PurgeTrash(ctx, userID, serviceName, username)
+	})
+}
+
+func (r *Resilient) ExpireTrash(ctx context.Context, olderThan time.Time) (int, error) {
+	var expired int
+
+	err := r.call(func() (err error) {
+		expired, err = r.Storage.ExpireTrash(ctx, olderThan)
+		return err
+	})
+
+	return expired, err
+}
+
+func (r *Resilient) SetState(ctx context.Context, userID int64, state string) error {
+	return r.call(func() error {
+		return r.Storage.SetState(ctx, userID, state)
+	})
+}
+
+func (r *Resilient) SetDraft(ctx context.Context, userID int64, serviceName, username string) error {
+	return r.call(func() error {
+		return r.Storage.SetDraft(ctx, userID, serviceName, username)
+	})
+}
+
+func (r *Resilient) DiscardDraft(ctx context.Context, userID int64) error {
+	return r.call(func() error {
+		return r.Storage.DiscardDraft(ctx, userID)
+	})
+}
+
+func (r *Resilient) PurgeDrafts(ctx context.Context, olderThan time.Time) (int, error) {
+	var purged int
+
+	err := r.call(func() (err error) {
+		purged, err = r.Storage.PurgeDrafts(ctx, olderThan)
+		return err
+	})
+
+	return purged, err
+}
+
+func (r *Resilient) GetState(ctx context.Context, userID int64) (models.State, error) {
+	var state models.State
+
+	err := r.retry(ctx, func() (err error) {
+		state, err = r.Storage.GetState(ctx, userID)
+		return err
+	})
+
+	return state, err
+}
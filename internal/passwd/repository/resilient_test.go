@@ -0,0 +1,98 @@
+package passwdRepository
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"telegram-bot/internal/models"
+)
+
+var errDown = errors.New("connection refused")
+
+// flaky is a Storage whose GetUser fails while down is set.
+type flaky struct {
+	*Memory
+	down  bool
+	calls int
+}
+
+func (f *flaky) GetUser(ctx context.Context, userID int64) (models.User, error) {
+	f.calls++
+	if f.down {
+		return models.User{}, errDown
+	}
+
+	return f.Memory.GetUser(ctx, userID)
+}
+
+func TestResilientConformance(t *testing.T) {
+	RunConformance(t, func(t *testing.T) Storage {
+		return NewResilient(NewMemory(), ResilientOpts{Retries: 2, Backoff: time.Millisecond, Threshold: 5, Cooldown: time.Second})
+	})
+}
+
+func TestResilientRetriesReads(t *testing.T) {
+	ctx := context.Background()
+	storage := &flaky{Memory: NewMemory(), down: true}
+	r := NewResilient(storage, ResilientOpts{Retries: 2, Backoff: time.Millisecond})
+
+	if _, err := r.GetUser(ctx, 1); !errors.Is(err, errDown) {
+		t.Fatalf("expected the storage error, got %v", err)
+	}
+
+	if storage.calls != 3 {
+		t.Fatalf("expected 3 attempts, got %d", storage.calls)
+	}
+
+	storage.down = false
+	storage.calls = 0
+	if _, err := r.GetUser(ctx, 1); !errors.Is(err, models.ErrNotFound) || storage.calls != 1 {
+		t.Fatalf("expected a single attempt ending with ErrNotFound, got %v after %d calls", err, storage.calls)
+	}
+
+	if stats := r.Stats(); stats.Retries != 2 || stats.Failures != 3 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+}
+
+func TestResilientBreaker(t *testing.T) {
+	ctx := context.Background()
+	storage := &flaky{Memory: NewMemory(), down: true}
+	r := NewResilient(storage, ResilientOpts{Threshold: 3, Cooldown: time.Minute})
+
+	now := time.Now()
+	r.breaker.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		if _, err := r.GetUser(ctx, 1); !errors.Is(err, errDown) {
+			t.Fatalf("expected the storage error, got %v", err)
+		}
+	}
+
+	if r.BreakerState() != BreakerOpen {
+		t.Fatalf("expected the breaker to open, it is %s", r.BreakerState())
+	}
+
+	if _, err := r.GetUser(ctx, 1); !errors.Is(err, models.ErrUnavailable) || storage.calls != 3 {
+		t.Fatalf("expected ErrUnavailable without calling the storage, got %v after %d calls", err, storage.calls)
+	}
+
+	// A failed probe after the cooldown opens the breaker again
+	now = now.Add(time.Minute)
+	if _, err := r.GetUser(ctx, 1); !errors.Is(err, errDown) || r.BreakerState() != BreakerOpen {
+		t.Fatalf("expected a failed probe, got %v and %s breaker", err, r.BreakerState())
+	}
+
+	// A successful one closes it
+	now = now.Add(time.Minute)
+	storage.down = false
+	if _, err := r.GetUser(ctx, 1); !errors.Is(err, models.ErrNotFound) || r.BreakerState() != BreakerClosed {
+		t.Fatalf("expected a successful probe, got %v and %s breaker", err, r.BreakerState())
+	}
+
+	if stats := r.Stats(); stats.Rejected != 1 || stats.Failures != 4 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+}
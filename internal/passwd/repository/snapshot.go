@@ -0,0 +1,32 @@
+package passwdRepository
+
+import (
+	"context"
+
+	"telegram-bot/internal/models"
+)
+
+// dumpBatch is the number of users read at once by Dump
+const dumpBatch = 20
+
+// UserSnapshot is everything stored for a user.
+type UserSnapshot struct {
+	User        models.User
+	Credentials []models.Credentials
+	Trash       []models.Credentials
+	// State is nil when none is stored
+	State *models.State
+}
+
+// Snapshotter is implemented by storages that can be backed up and
+// restored. Credentials and states of user IDs without a user aren't part
+// of snapshots.
+type Snapshotter interface {
+	// Dump calls fn with the snapshot of each user in the order of their
+	// IDs until fn returns an error. The snapshot of a user is consistent,
+	// Memory and Bolt snapshots of all users are too.
+	Dump(ctx context.Context, fn func(UserSnapshot) error) error
+	// Restore atomically replaces everything stored for the user with the
+	// snapshot
+	Restore(ctx context.Context, snapshot UserSnapshot) error
+}
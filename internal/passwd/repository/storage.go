@@ -0,0 +1,132 @@
+package passwdRepository
+
+import (
+	"context"
+	"time"
+
+	"telegram-bot/internal/models"
+)
+
+// maxServices limits the accounts returned at once
+const maxServices = 50
+
+// Storage keeps users, their credentials and dialog state.
+//
+// Lookups of missing users and credentials return models.ErrNotFound,
+// creating a user twice returns models.ErrConflict and records that can't
+// be decoded return a *models.CorruptTupleError. GetState never returns
+// ErrNotFound: users without a stored state are in models.StateDefault.
+// A cancelled or expired ctx makes methods return ctx.Err().
+type Storage interface {
+	CreateUser(ctx context.Context, userID int64, token string) error
+	SetToken(ctx context.Context, userID int64, token string) error
+	UpdateToken(ctx context.Context, userID int64, token string) error
+	GetUser(ctx context.Context, userID int64) (models.User, error)
+	// SetSetting stores a preference of the user, an empty value removes it
+	SetSetting(ctx context.Context, userID int64, key, value string) error
+	// DeleteCredentialsByUser atomically deletes all credentials of the
+	// user, including the trash
+	DeleteCredentialsByUser(ctx context.Context, userID int64) error
+	// SaveCredentials atomically creates or replaces the account identified
+	// by the service and username and discards the user's draft for the
+	// same service
+	SaveCredentials(ctx context.Context, credentials models.Credentials) error
+	// ReEncrypt atomically replaces the user's token and the secrets and
+	// password history of the given credentials, all encrypted with a new
+	// key. Credentials with DeletedAt set are replaced in the trash.
+	ReEncrypt(ctx context.Context, userID int64, token string, credentials []models.Credentials) error
+	Get(ctx context.Context, userID int64, serviceName, username string) (models.Credentials, error)
+	// Touch sets the time the credentials were last accessed, leaving
+	// the draft alone
+	Touch(ctx context.Context, userID int64, serviceName, username string, accessedAt time.Time) error
+	// Rename atomically moves the account to a new service and username,
+	// it returns models.ErrConflict if an account with the new name exists
+	Rename(ctx context.Context, userID int64, serviceName, username, newServiceName, newUsername string) error
+	// GetAccounts returns the accounts of a service ordered by username
+	GetAccounts(ctx context.Context, userID int64, serviceName string) ([]models.Credentials, error)
+	// GetAllByUserID returns accounts of all services ordered by service and username
+	GetAllByUserID(ctx context.Context, userID int64) ([]models.Credentials, error)
+	// GetAllByUserIDAfter returns the next accounts in the same order,
+	// those after the given service and username
+	GetAllByUserIDAfter(ctx context.Context, userID int64, serviceName, username string) ([]models.Credentials, error)
+	// Delete deletes the account for good, Trash keeps it for a while
+	Delete(ctx context.Context, userID int64, serviceName, username string) error
+	// Trash atomically moves the account to the trash, replacing an account
+	// with the same service and username deleted before
+	Trash(ctx context.Context, userID int64, serviceName, username string, deletedAt time.Time) error
+	// GetTrash returns deleted accounts ordered by service and username
+	GetTrash(ctx context.Context, userID int64) ([]models.Credentials, error)
+	// GetTrashAfter returns the next deleted accounts in the same order,
+	// those after the given service and username
+	GetTrashAfter(ctx context.Context, userID int64, serviceName, username string) ([]models.Credentials, error)
+	// RestoreTrash atomically moves the account back from the trash, it
+	// returns models.ErrConflict if an account with its name was saved since
+	RestoreTrash(ctx context.Context, userID int64, serviceName, username string) error
+	// PurgeTrash deletes the account in the trash for good
+	PurgeTrash(ctx context.Context, userID int64, serviceName, username string) error
+	// ExpireTrash deletes accounts of all users deleted before olderThan
+	// and returns their count
+	ExpireTrash(ctx context.Context, olderThan time.Time) (int, error)
+	SetState(ctx context.Context, userID int64, state string) error
+	// SetDraft remembers the service and username chosen in a multi-step flow
+	SetDraft(ctx context.Context, userID int64, serviceName, username string) error
+	DiscardDraft(ctx context.Context, userID int64) error
+	// PurgeDrafts discards drafts not touched since olderThan and returns their count
+	PurgeDrafts(ctx context.Context, olderThan time.Time) (int, error)
+	GetState(ctx context.Context, userID int64) (models.State, error)
+}
+
+// withSetting returns a copy of settings with key set to value,
+// nil when no settings are left.
+func withSetting(settings map[string]string, key, value string) map[string]string {
+	updated := make(map[string]string, len(settings)+1)
+	for k, v := range settings {
+		updated[k] = v
+	}
+
+	if value == "" {
+		delete(updated, key)
+	} else {
+		updated[key] = value
+	}
+
+	if len(updated) == 0 {
+		return nil
+	}
+
+	return updated
+}
+
+func withoutDraft(state models.State) models.State {
+	return models.State{
+		UserID: state.UserID,
+		State:  state.State,
+	}
+}
+
+func isStaleDraft(state models.State, olderThan time.Time) bool {
+	return state.DraftUpdatedAt != 0 && state.DraftUpdatedAt < olderThan.Unix()
+}
+
+// purgeDraft discards the draft of an abandoned flow and returns
+// the user to the menu if they are still inside it.
+func purgeDraft(state models.State) models.State {
+	if _, _, ok := models.ParseItemState(state.State); ok {
+		state.State = models.StateDefault
+	}
+
+	if _, ok := models.ParseEditValueState(state.State); ok {
+		state.State = models.StateDefault
+	}
+
+	switch state.State {
+	case models.StateSetType, models.StateSetService, models.StateSetUsername, models.StateSetPassword, models.StateWeakPassword,
+		models.StateSetURL, models.StateSetNotes, models.StateSetTags, models.StateSetOTP, models.StateSetField,
+		models.StateGetAccount, models.StateDeleteAccount, models.StateRotatePassword,
+		models.StateHistoryAccount, models.StateHistoryRestore, models.StateTrashUndo, models.StateTrashItem,
+		models.StateEditAccount, models.StateEditField:
+		state.State = models.StateDefault
+	}
+
+	return withoutDraft(state)
+}
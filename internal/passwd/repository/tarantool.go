@@ -1,324 +1,593 @@
 package passwdRepository
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"time"
 
 	"github.com/tarantool/go-tarantool"
+	"github.com/tarantool/go-tarantool/connection_pool"
 
 	"telegram-bot/internal/models"
 )
 
-const maxServices = 50
-
-type Storage interface {
-	CreateUser(userID int64, token string) error
-	SetToken(userID int64, token string) error
-	UpdateToken(userID int64, token string) error
-	GetUser(userID int64) (models.User, error)
-	DeleteCredentialsByUser(userID int64, serviceNames []string) error
-	SetService(userID int64, serviceName string) error
-	SetUsername(userID int64, serviceName string, username string) error
-	SetPassword(userID int64, serviceName string, password string) error
-	Get(userID int64, serviceName string) (models.Credentials, error)
-	GetAllByUserID(userID int64) ([]models.Credentials, error)
-	Delete(userID int64, serviceName string) error
-	SetState(userID int64, state string) error
-	SetStateLastServer(userID int64, lastService string) error
-	GetState(userID int64) (models.State, error)
+// Tarantool keeps a connection pool over the master and its replicas.
+// Writes go to the master, GetUser, GetState, GetAccounts and the pages of
+// GetAllByUserID and GetTrash go to replicas while they keep up with it
+// (see replicaMonitor).
+type Tarantool struct {
+	Storage
+	pool    *connection_pool.ConnectionPool
+	replica *replicaMonitor
+	timeout time.Duration
 }
 
-func parseUser(data []interface{}) models.User {
-	if data == nil {
-		return models.User{}
+func NewTarantool(addrs []string, opts tarantool.Opts, replication ReplicationOpts) (*Tarantool, error) {
+	if replication.CheckInterval <= 0 {
+		replication.CheckInterval = time.Second
 	}
 
-	return models.User{
-		ID:    data[0].(uint64),
-		Token: data[1].(string),
+	replica := newReplicaMonitor(replication.MaxLag)
+
+	pool, err := connection_pool.ConnectWithOpts(addrs, opts, connection_pool.OptsPool{
+		CheckTimeout:      replication.CheckInterval,
+		ConnectionHandler: replica,
+	})
+	if err != nil {
+		return nil, err
 	}
-}
 
-func parseCredential(data []interface{}) models.Credentials {
-	if data == nil {
-		return models.Credentials{}
+	if _, err = pool.Ping(connection_pool.ANY); err != nil {
+		pool.Close()
+		return nil, err
 	}
 
-	if len(data) == 2 {
-		return models.Credentials{
-			UserID:      data[0].(uint64),
-			ServiceName: data[1].(string),
-		}
-	} else if len(data) == 3 {
-		return models.Credentials{
-			UserID:      data[0].(uint64),
-			ServiceName: data[1].(string),
-			Username:    data[2].(string),
-		}
+	go replica.run(replication.CheckInterval)
+
+	return &Tarantool{
+		pool:    pool,
+		replica: replica,
+		timeout: opts.Timeout,
+	}, nil
+}
+
+func (t *Tarantool) Close() error {
+	t.replica.stop()
+
+	if errs := t.pool.Close(); len(errs) > 0 {
+		return errors.Join(errs...)
 	}
 
-	return models.Credentials{
-		UserID:       data[0].(uint64),
-		ServiceName:  data[1].(string),
-		Username:     data[2].(string),
-		PasswordHash: data[3].(string),
+	return nil
+}
+
+// mapError converts Tarantool errors the handlers care about to models errors.
+func mapError(err error) error {
+	var tntErr tarantool.Error
+	if errors.As(err, &tntErr) && tntErr.Code == tarantool.ErrTupleFound {
+		return fmt.Errorf("%w: %s", models.ErrConflict, tntErr.Msg)
 	}
+
+	return err
 }
 
-func parseCredentials(resp *tarantool.Response) []models.Credentials {
-	var result []models.Credentials
+// do sends req to an instance of the pool in mode and decodes the response
+// into result unless it's nil. Requests with a context ignore the connection
+// timeout, so ctx without a deadline gets it here. The connector reports
+// cancelled requests with a plain error, do returns ctx.Err() for them.
+func (t *Tarantool) do(ctx context.Context, req tarantool.Request, mode connection_pool.Mode, result interface{}) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 
-	for _, data := range resp.Data {
-		convertedData, ok := data.([]interface{})
-		if ok {
-			result = append(result, parseCredential(convertedData))
-		}
+	var err error
+	fut := t.pool.Do(req, mode)
+	if result != nil {
+		err = fut.GetTyped(result)
+	} else {
+		_, err = fut.Get()
 	}
 
-	return result
+	if err != nil && ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	return mapError(err)
 }
 
-func parseState(data []interface{}) models.State {
-	if data == nil {
-		return models.State{}
+// withTimeout bounds ctx by the connection timeout if it has no deadline.
+func (t *Tarantool) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if _, ok := ctx.Deadline(); ok || t.timeout <= 0 {
+		return context.WithCancel(ctx)
 	}
 
-	if len(data) == 2 {
-		return models.State{
-			UserID: data[0].(uint64),
-			State:  data[1].(string),
-		}
+	return context.WithTimeout(ctx, t.timeout)
+}
+
+func (t *Tarantool) CreateUser(ctx context.Context, userID int64, token string) error {
+	ctx, cancel := t.withTimeout(ctx)
+	defer cancel()
+
+	req := tarantool.NewUpsertRequest("users").
+		Tuple([]interface{}{userID, token}).
+		Operations(tarantool.NewOperations()).
+		Context(ctx)
+
+	return t.do(ctx, req, connection_pool.RW, nil)
+}
+
+func (t *Tarantool) GetUser(ctx context.Context, userID int64) (models.User, error) {
+	ctx, cancel := t.withTimeout(ctx)
+	defer cancel()
+
+	var users []userTuple
+
+	req := tarantool.NewSelectRequest("users").
+		Index("primary").
+		Limit(1).
+		Iterator(tarantool.IterEq).
+		Key([]interface{}{userID}).
+		Context(ctx)
+
+	if err := t.do(ctx, req, t.replica.readMode(), &users); err != nil {
+		return models.User{}, err
 	}
 
-	return models.State{
-		UserID:      data[0].(uint64),
-		State:       data[1].(string),
-		LastService: data[2].(string),
+	if len(users) == 0 {
+		return models.User{}, models.ErrNotFound
 	}
+
+	return users[0].User, nil
 }
 
-type Tarantool struct {
-	Storage
-	conn *tarantool.Connection
+func (t *Tarantool) SetToken(ctx context.Context, userID int64, token string) error {
+	ctx, cancel := t.withTimeout(ctx)
+	defer cancel()
+
+	req := tarantool.NewInsertRequest("users").
+		Tuple([]interface{}{userID, token}).
+		Context(ctx)
+
+	return t.do(ctx, req, connection_pool.RW, nil)
 }
 
-func NewTarantool(host, port string, opts tarantool.Opts) (*Tarantool, error) {
-	conn, err := tarantool.Connect(fmt.Sprintf("%s:%s", host, port), opts)
-	if err != nil {
-		return nil, err
+func (t *Tarantool) UpdateToken(ctx context.Context, userID int64, token string) error {
+	ctx, cancel := t.withTimeout(ctx)
+	defer cancel()
+
+	var users []userTuple
+
+	req := tarantool.NewUpdateRequest("users").
+		Index("primary").
+		Key([]interface{}{userID}).
+		Operations(tarantool.NewOperations().Assign(1, token)).
+		Context(ctx)
+
+	if err := t.do(ctx, req, connection_pool.RW, &users); err != nil {
+		return err
 	}
 
-	if _, err = conn.Ping(); err != nil {
-		return nil, err
+	if len(users) == 0 {
+		return models.ErrNotFound
 	}
 
-	return &Tarantool{
-		conn: conn,
-	}, nil
+	return nil
 }
 
-func (t *Tarantool) Close() error {
-	return t.conn.Close()
-}
-
-func (t *Tarantool) CreateUser(userID int64, token string) error {
-	_, err := t.conn.Upsert(
-		"users",
-		[]interface{}{
-			userID,
-			token,
-		},
-		[]interface{}{},
-	)
-	if err != nil {
+func (t *Tarantool) SetSetting(ctx context.Context, userID int64, key, value string) error {
+	var found []bool
+
+	if err := t.call(ctx, "passwd_set_setting", []interface{}{userID, key, value}, &found); err != nil {
 		return err
 	}
 
+	if len(found) == 0 || !found[0] {
+		return models.ErrNotFound
+	}
+
 	return nil
 }
 
-func (t *Tarantool) GetUser(userID int64) (models.User, error) {
-	resp, err := t.conn.Select("users", "primary", 0, 1, tarantool.IterEq, []interface{}{userID})
-	if err != nil {
-		return models.User{}, err
+// call calls a persistent function on the master.
+func (t *Tarantool) call(ctx context.Context, function string, args []interface{}, result interface{}) error {
+	ctx, cancel := t.withTimeout(ctx)
+	defer cancel()
+
+	req := tarantool.NewCall17Request(function).
+		Args(args).
+		Context(ctx)
+
+	return t.do(ctx, req, connection_pool.RW, result)
+}
+
+func (t *Tarantool) DeleteCredentialsByUser(ctx context.Context, userID int64) error {
+	return t.call(ctx, "passwd_delete_credentials_by_user", []interface{}{userID}, nil)
+}
+
+func (t *Tarantool) SaveCredentials(ctx context.Context, credentials models.Credentials) error {
+	return t.call(ctx, "passwd_save_credentials", []interface{}{
+		credentials.UserID,
+		credentials.ServiceName,
+		credentials.Username,
+		credentials.PasswordHash,
+		encodeDetails(credentials),
+	}, nil)
+}
+
+func (t *Tarantool) ReEncrypt(ctx context.Context, userID int64, token string, credentials []models.Credentials) error {
+	passwords := make([]interface{}, len(credentials))
+	for i, c := range credentials {
+		passwords[i] = []interface{}{c.ServiceName, c.Username, c.PasswordHash, encodeDetails(c), c.DeletedAt != 0}
 	}
 
-	if len(resp.Data) == 0 || resp.Data == nil {
-		return models.User{}, nil
+	return t.call(ctx, "passwd_reencrypt", []interface{}{userID, token, passwords}, nil)
+}
+
+// Get reads from the master: it follows a listing or a save, and a replica
+// that hasn't caught up yet would answer with a stale password.
+func (t *Tarantool) Get(ctx context.Context, userID int64, serviceName, username string) (models.Credentials, error) {
+	ctx, cancel := t.withTimeout(ctx)
+	defer cancel()
+
+	var credentials []credentialTuple
+
+	req := tarantool.NewSelectRequest("credentials").
+		Index("primary").
+		Limit(1).
+		Iterator(tarantool.IterEq).
+		Key([]interface{}{userID, serviceName, username}).
+		Context(ctx)
+
+	if err := t.do(ctx, req, connection_pool.PreferRW, &credentials); err != nil {
+		return models.Credentials{}, err
+	}
+
+	if len(credentials) == 0 {
+		return models.Credentials{}, models.ErrNotFound
 	}
 
-	return parseUser(resp.Data[0].([]interface{})), nil
+	return credentials[0].Credentials, nil
 }
 
-func (t *Tarantool) SetToken(userID int64, token string) error {
-	_, err := t.conn.Insert(
-		"users",
-		[]interface{}{
-			userID,
-			token,
-		},
-	)
-	if err != nil {
+func (t *Tarantool) Touch(ctx context.Context, userID int64, serviceName, username string, accessedAt time.Time) error {
+	var found []bool
+
+	if err := t.call(ctx, "passwd_touch_credentials", []interface{}{userID, serviceName, username, accessedAt.Unix()}, &found); err != nil {
 		return err
 	}
 
+	if len(found) == 0 || !found[0] {
+		return models.ErrNotFound
+	}
+
 	return nil
 }
 
-func (t *Tarantool) UpdateToken(userID int64, token string) error {
-	_, err := t.conn.Update(
-		"users",
-		"primary",
-		[]interface{}{userID},
-		[]interface{}{
-			[]interface{}{"=", 1, token},
-		})
-	if err != nil {
+func (t *Tarantool) Rename(ctx context.Context, userID int64, serviceName, username, newServiceName, newUsername string) error {
+	var result []string
+
+	args := []interface{}{userID, serviceName, username, newServiceName, newUsername}
+	if err := t.call(ctx, "passwd_rename_credentials", args, &result); err != nil {
 		return err
 	}
 
-	return nil
+	if len(result) == 0 {
+		return errors.New("passwd_rename_credentials returned no result")
+	}
+
+	switch result[0] {
+	case "renamed":
+		return nil
+	case "conflict":
+		return fmt.Errorf("%w: %s", models.ErrConflict, newServiceName)
+	default:
+		return models.ErrNotFound
+	}
 }
 
-func (t *Tarantool) DeleteCredentialsByUser(userID int64, serviceNames []string) error {
-	for _, serviceName := range serviceNames {
-		_, err := t.conn.Delete("credentials", "primary", []interface{}{userID, serviceName})
-		if err != nil {
-			return err
+func (t *Tarantool) GetAccounts(ctx context.Context, userID int64, serviceName string) ([]models.Credentials, error) {
+	return t.selectCredentials(ctx, tarantool.IterEq, []interface{}{userID, serviceName})
+}
+
+func (t *Tarantool) GetAllByUserID(ctx context.Context, userID int64) ([]models.Credentials, error) {
+	return t.selectCredentials(ctx, tarantool.IterEq, []interface{}{userID})
+}
+
+func (t *Tarantool) GetAllByUserIDAfter(ctx context.Context, userID int64, serviceName, username string) ([]models.Credentials, error) {
+	credentials, err := t.selectCredentials(ctx, tarantool.IterGt, []interface{}{userID, serviceName, username})
+	if err != nil {
+		return nil, err
+	}
+
+	return ofUser(credentials, userID), nil
+}
+
+// ofUser cuts credentials selected with a GT iterator at the first account
+// of another user, the iterator goes on to the accounts of the next users.
+func ofUser(credentials []models.Credentials, userID int64) []models.Credentials {
+	for i, c := range credentials {
+		if c.UserID != uint64(userID) {
+			return credentials[:i]
 		}
 	}
 
-	return nil
+	return credentials
 }
 
-func (t *Tarantool) SetService(userID int64, serviceName string) error {
-	_, err := t.conn.Upsert(
-		"credentials",
-		[]interface{}{
-			userID,
-			serviceName,
-		},
-		[]interface{}{},
-	)
-	if err != nil {
-		return err
+// selectCredentials returns credentials by the primary key with the iterator.
+func (t *Tarantool) selectCredentials(ctx context.Context, iterator uint32, key []interface{}) ([]models.Credentials, error) {
+	ctx, cancel := t.withTimeout(ctx)
+	defer cancel()
+
+	var tuples []credentialTuple
+
+	req := tarantool.NewSelectRequest("credentials").
+		Index("primary").
+		Limit(maxServices).
+		Iterator(iterator).
+		Key(key).
+		Context(ctx)
+
+	if err := t.do(ctx, req, t.replica.readMode(), &tuples); err != nil {
+		return nil, err
 	}
 
-	return nil
+	result := make([]models.Credentials, len(tuples))
+	for i, tuple := range tuples {
+		result[i] = tuple.Credentials
+	}
+
+	return result, nil
 }
 
-func (t *Tarantool) SetUsername(userID int64, serviceName, username string) error {
-	_, err := t.conn.Upsert(
-		"credentials",
-		[]interface{}{
-			userID,
-			serviceName,
-			username,
-		},
-		[]interface{}{
-			[]interface{}{"=", 2, username},
-		})
-	if err != nil {
+func (t *Tarantool) Delete(ctx context.Context, userID int64, serviceName, username string) error {
+	ctx, cancel := t.withTimeout(ctx)
+	defer cancel()
+
+	var deleted []credentialTuple
+
+	req := tarantool.NewDeleteRequest("credentials").
+		Index("primary").
+		Key([]interface{}{userID, serviceName, username}).
+		Context(ctx)
+
+	if err := t.do(ctx, req, connection_pool.RW, &deleted); err != nil {
 		return err
 	}
 
+	if len(deleted) == 0 {
+		return models.ErrNotFound
+	}
+
 	return nil
 }
 
-func (t *Tarantool) SetPassword(userID int64, serviceName, password string) error {
-	_, err := t.conn.Upsert(
-		"credentials",
-		[]interface{}{
-			userID,
-			serviceName,
-			password,
-		},
-		[]interface{}{
-			[]interface{}{"=", 3, password},
-		})
-	if err != nil {
+func (t *Tarantool) Trash(ctx context.Context, userID int64, serviceName, username string, deletedAt time.Time) error {
+	var found []bool
+
+	if err := t.call(ctx, "passwd_trash", []interface{}{userID, serviceName, username, deletedAt.Unix()}, &found); err != nil {
 		return err
 	}
 
+	if len(found) == 0 || !found[0] {
+		return models.ErrNotFound
+	}
+
 	return nil
 }
 
-func (t *Tarantool) Get(userID int64, serviceName string) (models.Credentials, error) {
-	resp, err := t.conn.Select("credentials", "primary", 0, 1, tarantool.IterEq, []interface{}{userID, serviceName})
-	if err != nil {
-		return models.Credentials{}, err
-	}
+func (t *Tarantool) GetTrash(ctx context.Context, userID int64) ([]models.Credentials, error) {
+	return t.selectTrash(ctx, tarantool.IterEq, []interface{}{userID})
+}
 
-	if len(resp.Data) == 0 || resp.Data == nil {
-		return models.Credentials{}, nil
+func (t *Tarantool) GetTrashAfter(ctx context.Context, userID int64, serviceName, username string) ([]models.Credentials, error) {
+	credentials, err := t.selectTrash(ctx, tarantool.IterGt, []interface{}{userID, serviceName, username})
+	if err != nil {
+		return nil, err
 	}
 
-	return parseCredential(resp.Data[0].([]interface{})), nil
+	return ofUser(credentials, userID), nil
 }
 
-func (t *Tarantool) GetAllByUserID(userID int64) ([]models.Credentials, error) {
-	resp, err := t.conn.Select("credentials", "primary", 0, maxServices, tarantool.IterEq, []interface{}{userID})
-	if err != nil {
+// selectTrash returns deleted credentials by the primary key with the iterator.
+func (t *Tarantool) selectTrash(ctx context.Context, iterator uint32, key []interface{}) ([]models.Credentials, error) {
+	ctx, cancel := t.withTimeout(ctx)
+	defer cancel()
+
+	var tuples []trashTuple
+
+	req := tarantool.NewSelectRequest("trash").
+		Index("primary").
+		Limit(maxServices).
+		Iterator(iterator).
+		Key(key).
+		Context(ctx)
+
+	if err := t.do(ctx, req, t.replica.readMode(), &tuples); err != nil {
 		return nil, err
 	}
 
-	return parseCredentials(resp), nil
+	result := make([]models.Credentials, len(tuples))
+	for i, tuple := range tuples {
+		result[i] = tuple.Credentials
+	}
+
+	return result, nil
 }
 
-func (t *Tarantool) Delete(userID int64, serviceName string) error {
-	_, err := t.conn.Delete("credentials", "primary", []interface{}{userID, serviceName})
-	if err != nil {
+func (t *Tarantool) RestoreTrash(ctx context.Context, userID int64, serviceName, username string) error {
+	var result []string
+
+	if err := t.call(ctx, "passwd_restore_trash", []interface{}{userID, serviceName, username}, &result); err != nil {
 		return err
 	}
 
-	return nil
+	if len(result) == 0 {
+		return errors.New("passwd_restore_trash returned no result")
+	}
+
+	switch result[0] {
+	case "restored":
+		return nil
+	case "conflict":
+		return fmt.Errorf("%w: %s", models.ErrConflict, serviceName)
+	default:
+		return models.ErrNotFound
+	}
 }
 
-func (t *Tarantool) SetState(userID int64, state string) error {
-	_, err := t.conn.Upsert(
-		"state",
-		[]interface{}{
-			userID,
-			state,
-		},
-		[]interface{}{
-			[]interface{}{"=", 1, state},
-		})
-	if err != nil {
+func (t *Tarantool) PurgeTrash(ctx context.Context, userID int64, serviceName, username string) error {
+	ctx, cancel := t.withTimeout(ctx)
+	defer cancel()
+
+	var deleted []trashTuple
+
+	req := tarantool.NewDeleteRequest("trash").
+		Index("primary").
+		Key([]interface{}{userID, serviceName, username}).
+		Context(ctx)
+
+	if err := t.do(ctx, req, connection_pool.RW, &deleted); err != nil {
 		return err
 	}
 
+	if len(deleted) == 0 {
+		return models.ErrNotFound
+	}
+
 	return nil
 }
 
-func (t *Tarantool) SetStateLastServer(userID int64, lastService string) error {
-	_, err := t.conn.Upsert(
-		"state",
-		[]interface{}{
-			userID,
-			lastService,
-		},
-		[]interface{}{
-			[]interface{}{"=", 2, lastService},
-		})
-	if err != nil {
-		return err
+func (t *Tarantool) ExpireTrash(ctx context.Context, olderThan time.Time) (int, error) {
+	var expired []int
+
+	if err := t.call(ctx, "passwd_expire_trash", []interface{}{olderThan.Unix()}, &expired); err != nil {
+		return 0, err
 	}
 
-	return nil
+	if len(expired) == 0 {
+		return 0, nil
+	}
+
+	return expired[0], nil
 }
 
-func (t *Tarantool) GetState(userID int64) (models.State, error) {
-	resp, err := t.conn.Select("state", "primary", 0, 1, tarantool.IterEq, []interface{}{userID})
-	if err != nil {
+func (t *Tarantool) SetState(ctx context.Context, userID int64, state string) error {
+	ctx, cancel := t.withTimeout(ctx)
+	defer cancel()
+
+	req := tarantool.NewUpsertRequest("state").
+		Tuple([]interface{}{userID, state}).
+		Operations(tarantool.NewOperations().Assign(1, state)).
+		Context(ctx)
+
+	return t.do(ctx, req, connection_pool.RW, nil)
+}
+
+func (t *Tarantool) SetDraft(ctx context.Context, userID int64, serviceName, username string) error {
+	return t.call(ctx, "passwd_set_draft", []interface{}{userID, serviceName, username, time.Now().Unix()}, nil)
+}
+
+func (t *Tarantool) DiscardDraft(ctx context.Context, userID int64) error {
+	return t.call(ctx, "passwd_discard_draft", []interface{}{userID}, nil)
+}
+
+func (t *Tarantool) PurgeDrafts(ctx context.Context, olderThan time.Time) (int, error) {
+	var purged []int
+
+	if err := t.call(ctx, "passwd_purge_drafts", []interface{}{olderThan.Unix()}, &purged); err != nil {
+		return 0, err
+	}
+
+	if len(purged) == 0 {
+		return 0, nil
+	}
+
+	return purged[0], nil
+}
+
+func (t *Tarantool) GetState(ctx context.Context, userID int64) (models.State, error) {
+	ctx, cancel := t.withTimeout(ctx)
+	defer cancel()
+
+	var states []stateTuple
+
+	req := tarantool.NewSelectRequest("state").
+		Index("primary").
+		Limit(1).
+		Iterator(tarantool.IterEq).
+		Key([]interface{}{userID}).
+		Context(ctx)
+
+	if err := t.do(ctx, req, t.replica.readMode(), &states); err != nil {
 		return models.State{}, err
 	}
 
-	if len(resp.Data) == 0 || resp.Data == nil {
+	if len(states) == 0 {
 		return models.State{
 			UserID: uint64(userID),
-			State:  "default",
+			State:  models.StateDefault,
 		}, nil
 	}
 
-	return parseState(resp.Data[0].([]interface{})), nil
+	return states[0].State, nil
+}
+
+// Dump reads users from the master a batch at a time. Each user is read
+// with its credentials, trash and state in a single call, so its snapshot
+// is consistent, but users may change between batches.
+func (t *Tarantool) Dump(ctx context.Context, fn func(UserSnapshot) error) error {
+	var after interface{}
+
+	for {
+		var result [][]snapshotTuple
+		if err := t.call(ctx, "passwd_dump_users", []interface{}{after, dumpBatch}, &result); err != nil {
+			return err
+		}
+
+		if len(result) == 0 {
+			return errors.New("passwd_dump_users returned no result")
+		}
+
+		for _, snapshot := range result[0] {
+			if err := fn(snapshot.UserSnapshot); err != nil {
+				return err
+			}
+		}
+
+		if len(result[0]) < dumpBatch {
+			return nil
+		}
+
+		after = result[0][len(result[0])-1].User.ID
+	}
+}
+
+func (t *Tarantool) Restore(ctx context.Context, snapshot UserSnapshot) error {
+	user := []interface{}{snapshot.User.ID, snapshot.User.Token}
+	if len(snapshot.User.Settings) > 0 {
+		user = append(user, snapshot.User.Settings)
+	}
+
+	credentials := make([]interface{}, len(snapshot.Credentials))
+	for i, c := range snapshot.Credentials {
+		credentials[i] = []interface{}{snapshot.User.ID, c.ServiceName, c.Username, c.PasswordHash, encodeDetails(c)}
+	}
+
+	trash := make([]interface{}, len(snapshot.Trash))
+	for i, c := range snapshot.Trash {
+		trash[i] = []interface{}{snapshot.User.ID, c.ServiceName, c.Username, c.PasswordHash, encodeDetails(c), c.DeletedAt}
+	}
+
+	var state interface{}
+	if s := snapshot.State; s != nil {
+		if s.LastService != "" || s.DraftUsername != "" || s.DraftUpdatedAt != 0 {
+			state = []interface{}{snapshot.User.ID, s.State, s.LastService, s.DraftUsername, s.DraftUpdatedAt}
+		} else {
+			state = []interface{}{snapshot.User.ID, s.State}
+		}
+	}
+
+	return t.call(ctx, "passwd_restore_user", []interface{}{user, credentials, trash, state}, nil)
 }
@@ -0,0 +1,43 @@
+package passwdRepository
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/tarantool/go-tarantool"
+
+	"telegram-bot/internal/migrations"
+)
+
+// TestTarantoolConformance runs against the instance in TARANTOOL_TEST_ADDR
+// (host:port) with the schema from configs/tarantool and all migrations, e.g.
+//
+//	TARANTOOL_TEST_ADDR=localhost:3301 TARANTOOL_TEST_USER=replicator TARANTOOL_PASSWORD=... go test ./...
+func TestTarantoolConformance(t *testing.T) {
+	addr := os.Getenv("TARANTOOL_TEST_ADDR")
+	if addr == "" {
+		t.Skip("TARANTOOL_TEST_ADDR is not set")
+	}
+
+	opts := tarantool.Opts{
+		Timeout: 2 * time.Second,
+		User:    os.Getenv("TARANTOOL_TEST_USER"),
+		Pass:    os.Getenv("TARANTOOL_PASSWORD"),
+	}
+
+	conn, err := tarantool.Connect(addr, opts)
+	mustNoErr(t, err)
+
+	_, err = migrations.New(conn, migrations.All).Up(0)
+	conn.Close()
+	mustNoErr(t, err)
+
+	storage, err := NewTarantool([]string{addr}, opts, ReplicationOpts{})
+	mustNoErr(t, err)
+	defer storage.Close()
+
+	RunConformance(t, func(t *testing.T) Storage {
+		return storage
+	})
+}
@@ -0,0 +1,400 @@
+package passwdRepository
+
+import (
+	"fmt"
+
+	"gopkg.in/vmihailenco/msgpack.v2"
+	"gopkg.in/vmihailenco/msgpack.v2/codes"
+
+	"telegram-bot/internal/models"
+)
+
+// Tuples decode straight from msgpack, so a tuple with missing or mistyped
+// fields results in a *models.CorruptTupleError instead of a panic.
+
+type userTuple struct {
+	models.User
+}
+
+func (t *userTuple) DecodeMsgpack(d *msgpack.Decoder) error {
+	return decodeTuple(d, "users", 2, func(i int) (err error) {
+		switch i {
+		case 0:
+			t.ID, err = d.DecodeUint64()
+		case 1:
+			t.Token, err = d.DecodeString()
+		case 2:
+			err = d.Decode(&t.Settings)
+		default:
+			err = d.Skip()
+		}
+
+		return err
+	})
+}
+
+type credentialTuple struct {
+	models.Credentials
+}
+
+func (t *credentialTuple) DecodeMsgpack(d *msgpack.Decoder) error {
+	return decodeTuple(d, "credentials", 2, func(i int) (err error) {
+		switch i {
+		case 0:
+			t.UserID, err = d.DecodeUint64()
+		case 1:
+			t.ServiceName, err = d.DecodeString()
+		case 2:
+			t.Username, err = d.DecodeString()
+		case 3:
+			t.PasswordHash, err = d.DecodeString()
+		case 4:
+			err = decodeDetails(d, &t.Credentials)
+		default:
+			err = d.Skip()
+		}
+
+		return err
+	})
+}
+
+// trashTuple is a credentials tuple followed by the time it was deleted.
+type trashTuple struct {
+	models.Credentials
+}
+
+func (t *trashTuple) DecodeMsgpack(d *msgpack.Decoder) error {
+	return decodeTuple(d, "trash", 6, func(i int) (err error) {
+		switch i {
+		case 0:
+			t.UserID, err = d.DecodeUint64()
+		case 1:
+			t.ServiceName, err = d.DecodeString()
+		case 2:
+			t.Username, err = d.DecodeString()
+		case 3:
+			t.PasswordHash, err = d.DecodeString()
+		case 4:
+			err = decodeDetails(d, &t.Credentials)
+		case 5:
+			t.DeletedAt, err = d.DecodeInt64()
+		default:
+			err = d.Skip()
+		}
+
+		return err
+	})
+}
+
+// Details are stored as a map, so details added later are skipped by
+// readers that don't know them instead of shifting tuple fields.
+const (
+	detailType   = "type"
+	detailURL    = "url"
+	detailNotes  = "notes"
+	detailTags   = "tags"
+	detailFields = "fields"
+	detailOTP    = "otp"
+	// The score of the password, timestamps and previous passwords aren't
+	// details but are kept with them to leave the tuple layout alone
+	detailStrength   = "strength"
+	detailUpdatedAt  = "updated_at"
+	detailCreatedAt  = "created_at"
+	detailAccessedAt = "accessed_at"
+	detailHistory    = "history"
+)
+
+// Keys of a previous password in the history
+const (
+	versionPassword   = "password"
+	versionStrength   = "strength"
+	versionUpdatedAt  = "updated_at"
+	versionReplacedAt = "replaced_at"
+)
+
+func decodeDetails(d *msgpack.Decoder, c *models.Credentials) error {
+	// A nil map has length -1
+	n, err := d.DecodeMapLen()
+	if err != nil {
+		return err
+	}
+
+	for i := 0; i < n; i++ {
+		key, err := d.DecodeString()
+		if err != nil {
+			return err
+		}
+
+		switch key {
+		case detailType:
+			c.Type, err = d.DecodeString()
+		case detailURL:
+			c.URL, err = d.DecodeString()
+		case detailNotes:
+			c.Notes, err = d.DecodeString()
+		case detailTags:
+			err = d.Decode(&c.Tags)
+		case detailFields:
+			err = d.Decode(&c.Fields)
+		case detailOTP:
+			c.OTP, err = d.DecodeString()
+		case detailStrength:
+			c.Strength, err = d.DecodeInt()
+		case detailUpdatedAt:
+			c.UpdatedAt, err = d.DecodeInt64()
+		case detailCreatedAt:
+			c.CreatedAt, err = d.DecodeInt64()
+		case detailAccessedAt:
+			c.AccessedAt, err = d.DecodeInt64()
+		case detailHistory:
+			c.History, err = decodeHistory(d)
+		default:
+			err = d.Skip()
+		}
+
+		if err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+	}
+
+	return nil
+}
+
+func decodeHistory(d *msgpack.Decoder) ([]models.PasswordVersion, error) {
+	n, err := d.DecodeArrayLen()
+	if err != nil || n <= 0 {
+		return nil, err
+	}
+
+	history := make([]models.PasswordVersion, n)
+	for i := range history {
+		if err = decodeVersion(d, &history[i]); err != nil {
+			return nil, fmt.Errorf("version %d: %w", i+1, err)
+		}
+	}
+
+	return history, nil
+}
+
+func decodeVersion(d *msgpack.Decoder, v *models.PasswordVersion) error {
+	n, err := d.DecodeMapLen()
+	if err != nil {
+		return err
+	}
+
+	for i := 0; i < n; i++ {
+		key, err := d.DecodeString()
+		if err != nil {
+			return err
+		}
+
+		switch key {
+		case versionPassword:
+			v.Password, err = d.DecodeString()
+		case versionStrength:
+			v.Strength, err = d.DecodeInt()
+		case versionUpdatedAt:
+			v.UpdatedAt, err = d.DecodeInt64()
+		case versionReplacedAt:
+			v.ReplacedAt, err = d.DecodeInt64()
+		default:
+			err = d.Skip()
+		}
+
+		if err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+	}
+
+	return nil
+}
+
+// encodeDetails returns the stored form of the type, metadata and details, nil if
+// there are none. Empty values are left out: Lua turns an empty map into
+// an array.
+func encodeDetails(c models.Credentials) map[string]interface{} {
+	if c.Type == "" && c.Strength == 0 && c.UpdatedAt == 0 && c.CreatedAt == 0 && c.AccessedAt == 0 &&
+		len(c.History) == 0 && c.Details.IsZero() {
+		return nil
+	}
+
+	m := make(map[string]interface{})
+	if c.Type != "" {
+		m[detailType] = c.Type
+	}
+	if c.URL != "" {
+		m[detailURL] = c.URL
+	}
+	if c.Notes != "" {
+		m[detailNotes] = c.Notes
+	}
+	if len(c.Tags) > 0 {
+		m[detailTags] = c.Tags
+	}
+	if len(c.Fields) > 0 {
+		m[detailFields] = c.Fields
+	}
+	if c.OTP != "" {
+		m[detailOTP] = c.OTP
+	}
+	if c.Strength != 0 {
+		m[detailStrength] = c.Strength
+	}
+	if c.UpdatedAt != 0 {
+		m[detailUpdatedAt] = c.UpdatedAt
+	}
+	if c.CreatedAt != 0 {
+		m[detailCreatedAt] = c.CreatedAt
+	}
+	if c.AccessedAt != 0 {
+		m[detailAccessedAt] = c.AccessedAt
+	}
+	if len(c.History) > 0 {
+		m[detailHistory] = encodeHistory(c.History)
+	}
+
+	return m
+}
+
+func encodeHistory(history []models.PasswordVersion) []interface{} {
+	result := make([]interface{}, len(history))
+	for i, v := range history {
+		version := map[string]interface{}{
+			versionPassword:   v.Password,
+			versionReplacedAt: v.ReplacedAt,
+		}
+		if v.Strength != 0 {
+			version[versionStrength] = v.Strength
+		}
+		if v.UpdatedAt != 0 {
+			version[versionUpdatedAt] = v.UpdatedAt
+		}
+		result[i] = version
+	}
+
+	return result
+}
+
+type stateTuple struct {
+	models.State
+}
+
+func (t *stateTuple) DecodeMsgpack(d *msgpack.Decoder) error {
+	return decodeTuple(d, "state", 2, func(i int) (err error) {
+		switch i {
+		case 0:
+			t.UserID, err = d.DecodeUint64()
+		case 1:
+			t.State.State, err = d.DecodeString()
+		case 2:
+			t.LastService, err = d.DecodeString()
+		case 3:
+			t.DraftUsername, err = d.DecodeString()
+		case 4:
+			t.DraftUpdatedAt, err = d.DecodeInt64()
+		default:
+			err = d.Skip()
+		}
+
+		return err
+	})
+}
+
+// snapshotTuple is a user tuple followed by its credentials and trash
+// tuples and its state tuple or nil, as passwd_dump_users returns them.
+type snapshotTuple struct {
+	UserSnapshot
+}
+
+func (t *snapshotTuple) DecodeMsgpack(d *msgpack.Decoder) error {
+	n, err := d.DecodeArrayLen()
+	if err != nil {
+		return &models.CorruptTupleError{Space: "users", Err: err}
+	}
+
+	if n < 3 {
+		return &models.CorruptTupleError{Space: "users", Err: fmt.Errorf("expected a snapshot of at least 3 parts, got %d", n)}
+	}
+
+	var user userTuple
+	if err = d.Decode(&user); err != nil {
+		return err
+	}
+	t.User = user.User
+
+	var credentials []credentialTuple
+	if err = d.Decode(&credentials); err != nil {
+		return err
+	}
+
+	for _, c := range credentials {
+		t.Credentials = append(t.Credentials, c.Credentials)
+	}
+
+	var trash []trashTuple
+	if err = d.Decode(&trash); err != nil {
+		return err
+	}
+
+	for _, c := range trash {
+		t.Trash = append(t.Trash, c.Credentials)
+	}
+
+	// Lua drops a nil state at the end of the snapshot
+	if n > 3 {
+		if err = decodeState(d, &t.State); err != nil {
+			return err
+		}
+	}
+
+	for i := 4; i < n; i++ {
+		if err = d.Skip(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func decodeState(d *msgpack.Decoder, state **models.State) error {
+	code, err := d.PeekCode()
+	if err != nil {
+		return &models.CorruptTupleError{Space: "state", Err: err}
+	}
+
+	if code == codes.Nil {
+		return d.DecodeNil()
+	}
+
+	var tuple stateTuple
+	if err = d.Decode(&tuple); err != nil {
+		return err
+	}
+	*state = &tuple.State
+
+	return nil
+}
+
+// decodeTuple reads an array of at least required fields calling field
+// for each of them. Nullable fields decode as zero values.
+func decodeTuple(d *msgpack.Decoder, space string, required int, field func(i int) error) error {
+	n, err := d.DecodeArrayLen()
+	if err != nil {
+		return &models.CorruptTupleError{Space: space, Err: err}
+	}
+
+	if n < required {
+		return &models.CorruptTupleError{
+			Space: space,
+			Err:   fmt.Errorf("expected at least %d fields, got %d", required, n),
+		}
+	}
+
+	for i := 0; i < n; i++ {
+		if err = field(i); err != nil {
+			return &models.CorruptTupleError{Space: space, Err: fmt.Errorf("field %d: %w", i+1, err)}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,274 @@
+package passwdRepository
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"gopkg.in/vmihailenco/msgpack.v2"
+
+	"telegram-bot/internal/models"
+)
+
+func decodeTuples(t *testing.T, tuples []interface{}, result interface{}) error {
+	t.Helper()
+
+	data, err := msgpack.Marshal(tuples)
+	mustNoErr(t, err)
+
+	return msgpack.Unmarshal(data, result)
+}
+
+func TestCredentialTupleDecode(t *testing.T) {
+	var credentials []credentialTuple
+
+	err := decodeTuples(t, []interface{}{
+		[]interface{}{uint64(1), "github", "octocat", "secret"},
+		// Half-filled tuple from the old set flow
+		[]interface{}{uint64(1), "gitlab"},
+		// Nullable login and unknown trailing fields
+		[]interface{}{uint64(1), "jira", nil, "secret", nil, "future"},
+	}, &credentials)
+	mustNoErr(t, err)
+
+	want := []models.Credentials{
+		{UserID: 1, ServiceName: "github", Username: "octocat", PasswordHash: "secret"},
+		{UserID: 1, ServiceName: "gitlab"},
+		{UserID: 1, ServiceName: "jira", PasswordHash: "secret"},
+	}
+
+	if len(credentials) != len(want) {
+		t.Fatalf("expected %d credentials, got %d", len(want), len(credentials))
+	}
+
+	for i := range want {
+		if !reflect.DeepEqual(credentials[i].Credentials, want[i]) {
+			t.Fatalf("expected %+v, got %+v", want[i], credentials[i].Credentials)
+		}
+	}
+}
+
+func TestCredentialDetailsDecode(t *testing.T) {
+	var credentials []credentialTuple
+
+	details := encodeDetails(models.Credentials{
+		Type:      models.ItemToken,
+		Strength:  4,
+		UpdatedAt: 1700000000,
+		Details: models.Details{
+			URL:    "https://github.com",
+			Notes:  "notes",
+			Tags:   []string{"dev"},
+			Fields: map[string]string{"PIN": "pin"},
+			OTP:    "otpauth://totp/x?secret=A",
+		},
+	})
+	// Written by a newer version
+	details["icon"] = []interface{}{"github", 1}
+
+	err := decodeTuples(t, []interface{}{
+		[]interface{}{uint64(1), "github", "octocat", "secret", details},
+		[]interface{}{uint64(1), "gitlab", "octocat", "secret", nil},
+	}, &credentials)
+	mustNoErr(t, err)
+
+	want := models.Details{
+		URL:    "https://github.com",
+		Notes:  "notes",
+		Tags:   []string{"dev"},
+		Fields: map[string]string{"PIN": "pin"},
+		OTP:    "otpauth://totp/x?secret=A",
+	}
+
+	if len(credentials) != 2 {
+		t.Fatalf("expected 2 credentials, got %d", len(credentials))
+	}
+
+	if credentials[0].Type != models.ItemToken || credentials[0].Strength != 4 ||
+		credentials[0].UpdatedAt != 1700000000 || !reflect.DeepEqual(credentials[0].Details, want) {
+		t.Fatalf("expected %+v of a token, got %+v", want, credentials[0].Credentials)
+	}
+
+	if !credentials[1].Details.IsZero() {
+		t.Fatalf("expected no details, got %+v", credentials[1].Details)
+	}
+}
+
+func TestCredentialHistoryDecode(t *testing.T) {
+	var credentials []credentialTuple
+
+	want := models.Credentials{
+		UserID:       1,
+		ServiceName:  "github",
+		Username:     "octocat",
+		PasswordHash: "secret",
+		UpdatedAt:    1700000300,
+		CreatedAt:    1700000000,
+		AccessedAt:   1700000400,
+		History: []models.PasswordVersion{
+			{Password: "older", Strength: 2, UpdatedAt: 1700000100, ReplacedAt: 1700000300},
+			{Password: "oldest", ReplacedAt: 1700000100},
+		},
+	}
+
+	details := encodeDetails(want)
+	// Version keys written by a newer version
+	details[detailHistory].([]interface{})[0].(map[string]interface{})["note"] = "reset"
+
+	err := decodeTuples(t, []interface{}{
+		[]interface{}{uint64(1), "github", "octocat", "secret", details},
+	}, &credentials)
+	mustNoErr(t, err)
+
+	if len(credentials) != 1 || !reflect.DeepEqual(credentials[0].Credentials, want) {
+		t.Fatalf("expected %+v, got %+v", want, credentials)
+	}
+}
+
+func TestUserTupleDecode(t *testing.T) {
+	var users []userTuple
+
+	err := decodeTuples(t, []interface{}{
+		[]interface{}{uint64(1), "token"},
+		[]interface{}{uint64(2), "token", map[string]string{models.SettingGenerator: "passphrase 6"}},
+	}, &users)
+	mustNoErr(t, err)
+
+	want := []models.User{
+		{ID: 1, Token: "token"},
+		{ID: 2, Token: "token", Settings: map[string]string{models.SettingGenerator: "passphrase 6"}},
+	}
+
+	if len(users) != len(want) {
+		t.Fatalf("expected %d users, got %d", len(want), len(users))
+	}
+
+	for i := range want {
+		if !reflect.DeepEqual(users[i].User, want[i]) {
+			t.Errorf("user %d: expected %+v, got %+v", i, want[i], users[i].User)
+		}
+	}
+}
+
+func TestTrashTupleDecode(t *testing.T) {
+	var trash []trashTuple
+
+	err := decodeTuples(t, []interface{}{
+		[]interface{}{uint64(1), "github", "octocat", "secret", map[string]interface{}{detailURL: "https://github.com"}, uint64(1700000000)},
+	}, &trash)
+	mustNoErr(t, err)
+
+	want := models.Credentials{
+		UserID:       1,
+		ServiceName:  "github",
+		Username:     "octocat",
+		PasswordHash: "secret",
+		DeletedAt:    1700000000,
+		Details:      models.Details{URL: "https://github.com"},
+	}
+
+	if len(trash) != 1 || !reflect.DeepEqual(trash[0].Credentials, want) {
+		t.Fatalf("expected %+v, got %+v", want, trash)
+	}
+
+	// A credentials tuple without the deletion time
+	err = decodeTuples(t, []interface{}{
+		[]interface{}{uint64(1), "github", "octocat", "secret", nil},
+	}, &trash)
+	if !errors.Is(err, models.ErrCorruptTuple) {
+		t.Fatalf("expected a corrupt tuple error, got %v", err)
+	}
+}
+
+func TestStateTupleDecode(t *testing.T) {
+	var states []stateTuple
+
+	err := decodeTuples(t, []interface{}{
+		[]interface{}{uint64(1), models.StateSetPassword, "github", "octocat", uint64(1700000000)},
+	}, &states)
+	mustNoErr(t, err)
+
+	want := models.State{
+		UserID:         1,
+		State:          models.StateSetPassword,
+		LastService:    "github",
+		DraftUsername:  "octocat",
+		DraftUpdatedAt: 1700000000,
+	}
+
+	if len(states) != 1 || states[0].State != want {
+		t.Fatalf("expected %+v, got %+v", want, states)
+	}
+}
+
+func TestSnapshotTupleDecode(t *testing.T) {
+	var snapshots []snapshotTuple
+
+	err := decodeTuples(t, []interface{}{
+		[]interface{}{
+			[]interface{}{uint64(1), "token", map[string]string{models.SettingGenerator: "words"}},
+			[]interface{}{[]interface{}{uint64(1), "github", "octocat", "secret"}},
+			[]interface{}{[]interface{}{uint64(1), "gitlab", "octocat", "deleted", nil, int64(1700000000)}},
+			[]interface{}{uint64(1), models.StateSetPassword},
+		},
+		// Lua drops the nil state of a user without one
+		[]interface{}{
+			[]interface{}{uint64(2), "token"},
+			[]interface{}{},
+			[]interface{}{},
+		},
+	}, &snapshots)
+	mustNoErr(t, err)
+
+	want := []UserSnapshot{
+		{
+			User:        models.User{ID: 1, Token: "token", Settings: map[string]string{models.SettingGenerator: "words"}},
+			Credentials: []models.Credentials{{UserID: 1, ServiceName: "github", Username: "octocat", PasswordHash: "secret"}},
+			Trash:       []models.Credentials{{UserID: 1, ServiceName: "gitlab", Username: "octocat", PasswordHash: "deleted", DeletedAt: 1700000000}},
+			State:       &models.State{UserID: 1, State: models.StateSetPassword},
+		},
+		{User: models.User{ID: 2, Token: "token"}},
+	}
+
+	if len(snapshots) != len(want) {
+		t.Fatalf("expected %d snapshots, got %d", len(want), len(snapshots))
+	}
+
+	for i := range want {
+		if !reflect.DeepEqual(snapshots[i].UserSnapshot, want[i]) {
+			t.Fatalf("expected %+v, got %+v", want[i], snapshots[i].UserSnapshot)
+		}
+	}
+
+	var corrupt []snapshotTuple
+
+	err = decodeTuples(t, []interface{}{[]interface{}{[]interface{}{uint64(1), "token"}}}, &corrupt)
+
+	var tupleErr *models.CorruptTupleError
+	if !errors.As(err, &tupleErr) {
+		t.Fatalf("expected CorruptTupleError for a snapshot without credentials, got %v", err)
+	}
+}
+
+func TestCorruptTupleDecode(t *testing.T) {
+	tests := []struct {
+		name  string
+		tuple interface{}
+	}{
+		{"TooShort", []interface{}{uint64(1)}},
+		{"WrongType", []interface{}{"1", "token"}},
+		{"NotArray", "token"},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			var users []userTuple
+
+			err := decodeTuples(t, []interface{}{tt.tuple}, &users)
+			if !errors.Is(err, models.ErrCorruptTuple) {
+				t.Fatalf("expected ErrCorruptTuple, got %v", err)
+			}
+		})
+	}
+}
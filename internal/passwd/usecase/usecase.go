@@ -1,76 +1,164 @@
 package passwdUsecase
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
 	"telegram-bot/internal/models"
 	passwdRepository "telegram-bot/internal/passwd/repository"
 	"telegram-bot/pkg"
+	"telegram-bot/pkg/bitwarden"
+	"telegram-bot/pkg/breach"
+	"telegram-bot/pkg/importer"
+	"telegram-bot/pkg/kdbx"
+	"telegram-bot/pkg/passgen"
+	"telegram-bot/pkg/sealed"
+	"telegram-bot/pkg/strength"
+	"telegram-bot/pkg/totp"
 )
 
 type PasswdUsecase interface {
-	CreateUser(userID int64, token string, key string) error
-	SetToken(userID int64, token string, key string) error
-	UpdateToken(userID int64, token string, key string) error
-	GetUser(userID int64, key string) (models.User, error)
-	DeleteCredentialsByUser(userID int64) error
-	SetService(userID int64, serviceName string) error
-	SetUsername(userID int64, serviceName, username string) error
-	SetPassword(userID int64, serviceName, password, key string) error
-	Get(userID int64, serviceName, key string) (string, string, error)
-	GetAllServices(userID int64) ([]string, error)
-	Delete(userID int64, serviceName string) error
-	SetState(userID int64, state string) error
-	SetStateLastServer(userID int64, lastService string) error
-	GetState(userID int64) (models.State, error)
+	CreateUser(ctx context.Context, userID int64, token string, key string) error
+	SetToken(ctx context.Context, userID int64, token string, key string) error
+	UpdateToken(ctx context.Context, userID int64, token string, key string) error
+	GetUser(ctx context.Context, userID int64, key string) (models.User, error)
+	// GeneratorPolicy returns the user's default password generator options,
+	// passgen.DefaultPolicy if they haven't chosen any
+	GeneratorPolicy(ctx context.Context, userID int64) (passgen.Policy, error)
+	SetGeneratorPolicy(ctx context.Context, userID int64, policy passgen.Policy) error
+	DeleteCredentialsByUser(ctx context.Context, userID int64) error
+	// SaveCredentials creates or replaces an account and keeps the
+	// estimated strength of its password for audits
+	SaveCredentials(ctx context.Context, userID int64, serviceName, username, password, key string) error
+	// SetPassword replaces the password of saved credentials keeping their
+	// details, the replaced password is added to the history
+	SetPassword(ctx context.Context, userID int64, serviceName, username, password, key string) error
+	// RestorePassword makes a previous password of the history current again,
+	// version 0 is the most recent one
+	RestorePassword(ctx context.Context, userID int64, serviceName, username string, version int, key string) error
+	// ReEncrypt re-encrypts the token and secrets of the user, the trash
+	// included, from oldKey to newKey in a single write
+	ReEncrypt(ctx context.Context, userID int64, oldKey, newKey string) error
+	// SaveItem creates or replaces an item of a declared type
+	SaveItem(ctx context.Context, userID int64, item models.Credentials, key string) error
+	// SetDetails adds details to saved credentials: URL, notes and tags
+	// replace the stored ones when set, fields are added to the stored ones
+	SetDetails(ctx context.Context, userID int64, serviceName, username string, details models.Details, key string) error
+	// EditField sets one part of saved credentials by its key: the service
+	// or username, which renames the account, the password, URL, notes,
+	// comma separated tags, TOTP secret, a field declared by the item type
+	// or a custom field. An empty value clears an optional part.
+	EditField(ctx context.Context, userID int64, serviceName, username, field, value, key string) error
+	// Get returns credentials with the password, notes, fields and history
+	// decrypted and records the access
+	Get(ctx context.Context, userID int64, serviceName, username, key string) (models.Credentials, error)
+	// GetAccounts returns usernames of the service accounts
+	GetAccounts(ctx context.Context, userID int64, serviceName string) ([]string, error)
+	GetAllServices(ctx context.Context, userID int64) ([]string, error)
+	// OTP returns decrypted accounts of the service that have a TOTP secret
+	OTP(ctx context.Context, userID int64, serviceName, key string) ([]models.Credentials, error)
+	// Search returns decrypted items whose name, username, URL, tags or
+	// type contain the query
+	Search(ctx context.Context, userID int64, query, key string) ([]models.Credentials, error)
+	// Export returns every item of the user decrypted as JSON of a
+	// models.Export, sealed with the passphrase
+	Export(ctx context.Context, userID int64, passphrase, key string) ([]byte, error)
+	// ExportKeePass returns every item of the user decrypted as a KeePass
+	// database protected by the password, grouped by their first tag
+	ExportKeePass(ctx context.Context, userID int64, password, key string) ([]byte, error)
+	// ExportBitwarden returns every item of the user decrypted as a
+	// Bitwarden JSON export, protected by the password unless it's empty,
+	// in folders named by their first tag
+	ExportBitwarden(ctx context.Context, userID int64, password, key string) ([]byte, error)
+	// Import saves entries of another password manager, handling those
+	// named like saved items as duplicates says. A dry run saves nothing.
+	Import(ctx context.Context, userID int64, entries []importer.Entry, duplicates string, dryRun bool, key string) (models.ImportResult, error)
+	// Breached reports whether the password is probably in the breached
+	// password corpus, always false without one
+	Breached(password string) bool
+	// Audit decrypts the vault in memory and reports weak, breached and
+	// reused passwords of logins, passwords unchanged for longer than
+	// staleAfter and logins without a username. Other items are counted
+	// as unchecked
+	Audit(ctx context.Context, userID int64, staleAfter time.Duration, key string) (models.Audit, error)
+	// Delete moves the account to the trash
+	Delete(ctx context.Context, userID int64, serviceName, username string) error
+	// GetTrash returns deleted accounts, their secrets are left encrypted
+	GetTrash(ctx context.Context, userID int64) ([]models.Credentials, error)
+	// GetTrashPage returns a page of deleted accounts ordered by service and
+	// username after the given one, the first page when both are empty
+	GetTrashPage(ctx context.Context, userID int64, serviceName, username string) ([]models.Credentials, error)
+	RestoreTrash(ctx context.Context, userID int64, serviceName, username string) error
+	// PurgeTrash deletes an account in the trash for good
+	PurgeTrash(ctx context.Context, userID int64, serviceName, username string) error
+	// ExpireTrash deletes accounts of all users deleted before olderThan
+	ExpireTrash(ctx context.Context, olderThan time.Time) (int, error)
+	SetState(ctx context.Context, userID int64, state string) error
+	SetDraft(ctx context.Context, userID int64, serviceName, username string) error
+	DiscardDraft(ctx context.Context, userID int64) error
+	PurgeDrafts(ctx context.Context, olderThan time.Time) (int, error)
+	GetState(ctx context.Context, userID int64) (models.State, error)
 }
 
 type passwdUsecase struct {
 	PasswdUsecase
 	storage passwdRepository.Storage
+	opts    Opts
+}
+
+type Opts struct {
+	// Breaches is the breached password corpus, nil when passwords
+	// aren't checked against one
+	Breaches *breach.Corpus
+	// HistoryDepth is the number of previous passwords kept, 0 keeps none
+	HistoryDepth int
 }
 
-func NewPasswdUsecase(storage passwdRepository.Storage) PasswdUsecase {
+func NewPasswdUsecase(storage passwdRepository.Storage, opts Opts) PasswdUsecase {
 	return &passwdUsecase{
 		storage: storage,
+		opts:    opts,
 	}
 }
 
-func (u *passwdUsecase) CreateUser(userID int64, token string, key string) error {
+func (u *passwdUsecase) CreateUser(ctx context.Context, userID int64, token string, key string) error {
 	token, err := pkg.Encrypt(token, key)
 	if err != nil {
 		return err
 	}
 
-	return u.storage.CreateUser(userID, token)
+	return u.storage.CreateUser(ctx, userID, token)
 }
 
-func (u *passwdUsecase) SetToken(userID int64, token string, key string) error {
+func (u *passwdUsecase) SetToken(ctx context.Context, userID int64, token string, key string) error {
 	token, err := pkg.Encrypt(token, key)
 	if err != nil {
 		return err
 	}
 
-	return u.storage.SetToken(userID, token)
+	return u.storage.SetToken(ctx, userID, token)
 }
 
-func (u *passwdUsecase) UpdateToken(userID int64, token string, key string) error {
+func (u *passwdUsecase) UpdateToken(ctx context.Context, userID int64, token string, key string) error {
 	token, err := pkg.Encrypt(token, key)
 	if err != nil {
 		return err
 	}
 
-	return u.storage.UpdateToken(userID, token)
+	return u.storage.UpdateToken(ctx, userID, token)
 }
 
-func (u *passwdUsecase) GetUser(userID int64, key string) (models.User, error) {
-	user, err := u.storage.GetUser(userID)
+func (u *passwdUsecase) GetUser(ctx context.Context, userID int64, key string) (models.User, error) {
+	user, err := u.storage.GetUser(ctx, userID)
 	if err != nil {
 		return models.User{}, err
 	}
 
-	if user == (models.User{}) {
-		return models.User{}, nil
-	}
-
 	if user.Token, err = pkg.Decrypt(user.Token, key); err != nil {
 		return models.User{}, err
 	}
@@ -78,96 +166,1101 @@ func (u *passwdUsecase) GetUser(userID int64, key string) (models.User, error) {
 	return user, nil
 }
 
-func (u *passwdUsecase) DeleteCredentialsByUser(userID int64) error {
-	s, err := u.GetAllServices(userID)
+func (u *passwdUsecase) GeneratorPolicy(ctx context.Context, userID int64) (passgen.Policy, error) {
+	user, err := u.storage.GetUser(ctx, userID)
+	if err != nil {
+		return passgen.Policy{}, err
+	}
+
+	options, ok := user.Settings[models.SettingGenerator]
+	if !ok {
+		return passgen.DefaultPolicy, nil
+	}
+
+	// Options a newer version saved and this one doesn't know fall back
+	// to the default rather than blocking the user
+	policy, err := passgen.Parse(options, passgen.DefaultPolicy)
 	if err != nil {
+		return passgen.DefaultPolicy, nil
+	}
+
+	return policy, nil
+}
+
+func (u *passwdUsecase) SetGeneratorPolicy(ctx context.Context, userID int64, policy passgen.Policy) error {
+	if err := policy.Validate(); err != nil {
 		return err
 	}
 
-	return u.storage.DeleteCredentialsByUser(userID, s)
+	return u.storage.SetSetting(ctx, userID, models.SettingGenerator, policy.String())
 }
 
-func (u *passwdUsecase) SetService(userID int64, serviceName string) error {
-	return u.storage.SetService(userID, serviceName)
+func (u *passwdUsecase) DeleteCredentialsByUser(ctx context.Context, userID int64) error {
+	return u.storage.DeleteCredentialsByUser(ctx, userID)
 }
 
-func (u *passwdUsecase) SetUsername(userID int64, serviceName, username string) error {
-	return u.storage.SetUsername(userID, serviceName, username)
+// SaveCredentials replaces the details of an existing account, but not
+// its history: the replaced password is added to it.
+func (u *passwdUsecase) SaveCredentials(ctx context.Context, userID int64, serviceName, username, password, key string) error {
+	data := models.Credentials{
+		UserID:      uint64(userID),
+		ServiceName: serviceName,
+		Username:    username,
+	}
+
+	stored, err := u.storage.Get(ctx, userID, serviceName, username)
+	if err != nil && !errors.Is(err, models.ErrNotFound) {
+		return err
+	}
+
+	if err == nil {
+		data.PasswordHash, data.Strength, data.UpdatedAt = stored.PasswordHash, stored.Strength, stored.UpdatedAt
+		data.CreatedAt, data.AccessedAt, data.History = stored.CreatedAt, stored.AccessedAt, stored.History
+	}
+
+	if err = u.replacePassword(&data, password, key, time.Now()); err != nil {
+		return err
+	}
+
+	return u.storage.SaveCredentials(ctx, data)
+}
+
+func (u *passwdUsecase) SetPassword(ctx context.Context, userID int64, serviceName, username, password, key string) error {
+	data, err := u.storage.Get(ctx, userID, serviceName, username)
+	if err != nil {
+		return err
+	}
+
+	if err = u.replacePassword(&data, password, key, time.Now()); err != nil {
+		return err
+	}
+
+	return u.storage.SaveCredentials(ctx, data)
+}
+
+func (u *passwdUsecase) RestorePassword(ctx context.Context, userID int64, serviceName, username string, version int, key string) error {
+	data, err := u.storage.Get(ctx, userID, serviceName, username)
+	if err != nil {
+		return err
+	}
+
+	if version < 0 || version >= len(data.History) {
+		return models.ErrNotFound
+	}
+
+	password, err := pkg.Decrypt(data.History[version].Password, key)
+	if err != nil {
+		return err
+	}
+
+	// The restored version leaves the history, the current password takes its place
+	history := make([]models.PasswordVersion, 0, len(data.History)-1)
+	history = append(history, data.History[:version]...)
+	data.History = append(history, data.History[version+1:]...)
+
+	if err = u.replacePassword(&data, password, key, time.Now()); err != nil {
+		return err
+	}
+
+	return u.storage.SaveCredentials(ctx, data)
 }
 
-func (u *passwdUsecase) SetPassword(userID int64, serviceName, password, key string) error {
-	password, err := pkg.Encrypt(password, key)
+// replacePassword sets the password of c, created now if it had none, and
+// adds the replaced one to its history unless the password is the same.
+func (u *passwdUsecase) replacePassword(c *models.Credentials, password, key string, now time.Time) error {
+	if c.CreatedAt == 0 {
+		c.CreatedAt = now.Unix()
+	}
+
+	if c.PasswordHash != "" {
+		previous, err := pkg.Decrypt(c.PasswordHash, key)
+		if err != nil {
+			return err
+		}
+
+		if previous != password {
+			c.History = u.trimHistory(append([]models.PasswordVersion{{
+				Password:   c.PasswordHash,
+				Strength:   c.Strength,
+				UpdatedAt:  c.UpdatedAt,
+				ReplacedAt: now.Unix(),
+			}}, c.History...))
+		}
+	}
+
+	encrypted, err := pkg.Encrypt(password, key)
 	if err != nil {
 		return err
 	}
 
-	return u.storage.SetPassword(userID, serviceName, password)
+	c.PasswordHash = encrypted
+	c.Strength = int(strength.Estimate(password, c.Username, c.ServiceName).Score)
+	c.UpdatedAt = now.Unix()
+
+	return nil
+}
+
+// trimHistory drops the oldest versions beyond the configured depth.
+func (u *passwdUsecase) trimHistory(history []models.PasswordVersion) []models.PasswordVersion {
+	if len(history) <= u.opts.HistoryDepth {
+		return history
+	}
+
+	if u.opts.HistoryDepth <= 0 {
+		return nil
+	}
+
+	return history[:u.opts.HistoryDepth]
 }
 
-func (u *passwdUsecase) Get(userID int64, serviceName, key string) (string, string, error) {
-	data, err := u.storage.Get(userID, serviceName)
+func (u *passwdUsecase) ReEncrypt(ctx context.Context, userID int64, oldKey, newKey string) error {
+	user, err := u.GetUser(ctx, userID, oldKey)
+	if err != nil {
+		return err
+	}
+
+	token, err := pkg.Encrypt(user.Token, newKey)
 	if err != nil {
-		return "", "", err
+		return err
 	}
 
-	if data.PasswordHash, err = pkg.Decrypt(data.PasswordHash, key); err != nil {
-		return "", "", err
+	credentials, err := u.allCredentials(ctx, userID)
+	if err != nil {
+		return err
 	}
 
-	return data.Username, data.PasswordHash, nil
+	trash, err := u.GetTrash(ctx, userID)
+	if err != nil {
+		return err
+	}
+	credentials = append(credentials, trash...)
+
+	for i := range credentials {
+		if err = decryptCredentials(&credentials[i], oldKey); err != nil {
+			return err
+		}
+
+		if err = encryptCredentials(&credentials[i], newKey); err != nil {
+			return err
+		}
+	}
+
+	return u.storage.ReEncrypt(ctx, userID, token, credentials)
 }
 
-func (u *passwdUsecase) GetAllServices(userID int64) ([]string, error) {
-	data, err := u.storage.GetAllByUserID(userID)
+func (u *passwdUsecase) SaveItem(ctx context.Context, userID int64, item models.Credentials, key string) error {
+	now := time.Now().Unix()
+	item.UserID = uint64(userID)
+	item.UpdatedAt = now
+	item.CreatedAt = now
+
+	stored, err := u.storage.Get(ctx, userID, item.ServiceName, item.Username)
+	switch {
+	case err == nil && stored.CreatedAt != 0:
+		item.CreatedAt = stored.CreatedAt
+	case err != nil && !errors.Is(err, models.ErrNotFound):
+		return err
+	}
+
+	if err = encryptCredentials(&item, key); err != nil {
+		return err
+	}
+
+	return u.storage.SaveCredentials(ctx, item)
+}
+
+func (u *passwdUsecase) SetDetails(ctx context.Context, userID int64, serviceName, username string, details models.Details, key string) error {
+	data, err := u.storage.Get(ctx, userID, serviceName, username)
+	if err != nil {
+		return err
+	}
+
+	if details.URL != "" {
+		data.URL = details.URL
+	}
+
+	if details.Notes != "" {
+		if data.Notes, err = pkg.Encrypt(details.Notes, key); err != nil {
+			return err
+		}
+	}
+
+	if details.Tags != nil {
+		data.Tags = details.Tags
+	}
+
+	if details.OTP != "" {
+		if data.OTP, err = pkg.Encrypt(details.OTP, key); err != nil {
+			return err
+		}
+	}
+
+	for name, value := range details.Fields {
+		if data.Fields == nil {
+			data.Fields = make(map[string]string)
+		}
+
+		if data.Fields[name], err = pkg.Encrypt(value, key); err != nil {
+			return err
+		}
+	}
+
+	return u.storage.SaveCredentials(ctx, data)
+}
+
+func (u *passwdUsecase) EditField(ctx context.Context, userID int64, serviceName, username, field, value, key string) error {
+	// The name is the primary key, renaming moves the account
+	switch field {
+	case models.FieldService:
+		return u.storage.Rename(ctx, userID, serviceName, username, value, username)
+	case models.FieldUsername:
+		return u.storage.Rename(ctx, userID, serviceName, username, serviceName, value)
+	}
+
+	data, err := u.storage.Get(ctx, userID, serviceName, username)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+
+	if _, declared := data.ItemType().Field(field); declared {
+		// Items other than logins are dated by their values
+		data.UpdatedAt = now.Unix()
+
+		if err = setValue(&data, field, value, key); err != nil {
+			return err
+		}
+
+		return u.storage.SaveCredentials(ctx, data)
+	}
+
+	switch field {
+	case models.FieldPassword:
+		err = u.replacePassword(&data, value, key, now)
+	case models.FieldURL:
+		data.URL = value
+	case models.FieldTags:
+		data.Tags = models.ParseTags(value)
+	case models.FieldOTP:
+		data.OTP, err = encryptValue(value, key)
+	default:
+		err = setValue(&data, field, value, key)
+	}
+	if err != nil {
+		return err
+	}
+
+	return u.storage.SaveCredentials(ctx, data)
+}
+
+func (u *passwdUsecase) Get(ctx context.Context, userID int64, serviceName, username, key string) (models.Credentials, error) {
+	data, err := u.storage.Get(ctx, userID, serviceName, username)
+	if err != nil {
+		return models.Credentials{}, err
+	}
+
+	if err = decryptCredentials(&data, key); err != nil {
+		return models.Credentials{}, err
+	}
+
+	// data keeps the previous access to show it
+	if err = u.storage.Touch(ctx, userID, serviceName, username, time.Now()); err != nil {
+		return models.Credentials{}, err
+	}
+
+	return data, nil
+}
+
+func (u *passwdUsecase) GetAccounts(ctx context.Context, userID int64, serviceName string) ([]string, error) {
+	data, err := u.storage.GetAccounts(ctx, userID, serviceName)
 	if err != nil {
 		return nil, err
 	}
 
 	result := make([]string, len(data))
 	for i, v := range data {
-		result[i] = v.ServiceName
+		result[i] = v.Username
 	}
 
 	return result, nil
 }
 
-func (u *passwdUsecase) Delete(userID int64, serviceName string) error {
-	return u.storage.Delete(userID, serviceName)
+func (u *passwdUsecase) GetAllServices(ctx context.Context, userID int64) ([]string, error) {
+	data, err := u.storage.GetAllByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Accounts come ordered by service, so repeated services are adjacent
+	var result []string
+	for _, v := range data {
+		if len(result) == 0 || result[len(result)-1] != v.ServiceName {
+			result = append(result, v.ServiceName)
+		}
+	}
+
+	return result, nil
 }
 
-func (u *passwdUsecase) SetState(userID int64, state string) error {
-	return u.storage.SetState(userID, state)
+func (u *passwdUsecase) OTP(ctx context.Context, userID int64, serviceName, key string) ([]models.Credentials, error) {
+	data, err := u.storage.GetAccounts(ctx, userID, serviceName)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []models.Credentials
+	for _, c := range data {
+		if c.OTP == "" {
+			continue
+		}
+
+		if err = decryptCredentials(&c, key); err != nil {
+			return nil, err
+		}
+
+		result = append(result, c)
+	}
+
+	return result, nil
 }
 
-func (u *passwdUsecase) SetStateLastServer(userID int64, lastService string) error {
-	return u.storage.SetStateLastServer(userID, lastService)
+func (u *passwdUsecase) Search(ctx context.Context, userID int64, query, key string) ([]models.Credentials, error) {
+	data, err := u.allCredentials(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	query = strings.ToLower(query)
+
+	var result []models.Credentials
+	for _, c := range data {
+		if !matches(c, query) {
+			continue
+		}
+
+		if err = decryptCredentials(&c, key); err != nil {
+			return nil, err
+		}
+
+		result = append(result, c)
+	}
+
+	return result, nil
 }
 
-func (u *passwdUsecase) GetState(userID int64) (models.State, error) {
-	data, err := u.storage.GetState(userID)
+// matches looks for the lowercase query in the parts of c that aren't encrypted.
+func matches(c models.Credentials, query string) bool {
+	parts := append([]string{c.ServiceName, c.Username, c.URL, c.ItemType().Title}, c.Tags...)
+
+	for _, part := range parts {
+		if strings.Contains(strings.ToLower(part), query) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (u *passwdUsecase) Audit(ctx context.Context, userID int64, staleAfter time.Duration, key string) (models.Audit, error) {
+	data, err := u.allCredentials(ctx, userID)
 	if err != nil {
-		return models.State{}, err
+		return models.Audit{}, err
+	}
+
+	var audit models.Audit
+	staleBefore := time.Now().Add(-staleAfter).Unix()
+
+	// Accounts by password, in the order they were first seen
+	var passwords []string
+	sharing := make(map[string][]models.Credentials)
+
+	for _, c := range data {
+		if c.ItemType().Name != models.ItemLogin {
+			audit.Unchecked++
+			continue
+		}
+
+		if c.PasswordHash == "" {
+			continue
+		}
+
+		password, err := pkg.Decrypt(c.PasswordHash, key)
+		if err != nil {
+			return models.Audit{}, err
+		}
+
+		// Secrets don't leave the audit
+		c = models.Credentials{
+			UserID:      c.UserID,
+			ServiceName: c.ServiceName,
+			Username:    c.Username,
+			Type:        c.Type,
+			Strength:    c.Strength,
+			UpdatedAt:   c.UpdatedAt,
+		}
+
+		// Passwords saved before scores were kept are estimated now
+		if c.Strength == 0 {
+			c.Strength = int(strength.Estimate(password, c.Username, c.ServiceName).Score)
+		}
+
+		audit.Checked++
+
+		if strength.Score(c.Strength) <= strength.Weak {
+			audit.Weak = append(audit.Weak, c)
+		}
+
+		if u.opts.Breaches.Breached(password) {
+			audit.Breached = append(audit.Breached, c)
+		}
+
+		if c.UpdatedAt != 0 && c.UpdatedAt < staleBefore {
+			audit.Stale = append(audit.Stale, c)
+		}
+
+		if c.Username == "" {
+			audit.NoUsername = append(audit.NoUsername, c)
+		}
+
+		if _, ok := sharing[password]; !ok {
+			passwords = append(passwords, password)
+		}
+		sharing[password] = append(sharing[password], c)
 	}
 
-	if data == (models.State{}) {
-		return models.State{
-			UserID: uint64(userID),
-			State:  "default",
-		}, nil
+	for _, password := range passwords {
+		if len(sharing[password]) > 1 {
+			audit.Reused = append(audit.Reused, sharing[password])
+		}
 	}
 
-	return data, nil
+	return audit, nil
 }
 
-func (u *passwdUsecase) GetLastService(userID int64) (string, error) {
-	data, err := u.storage.GetState(userID)
+func (u *passwdUsecase) Export(ctx context.Context, userID int64, passphrase, key string) ([]byte, error) {
+	data, err := u.allCredentials(ctx, userID)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	if data == (models.State{}) {
+	export := models.Export{
+		Version:    models.ExportVersion,
+		ExportedAt: time.Now().Unix(),
+		Items:      make([]models.ExportItem, 0, len(data)),
+	}
+
+	for _, c := range data {
+		if err = decryptCredentials(&c, key); err != nil {
+			return nil, err
+		}
+
+		export.Items = append(export.Items, models.ExportItemOf(c))
+	}
+
+	plaintext, err := json.MarshalIndent(export, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	return sealed.Seal(plaintext, passphrase)
+}
+
+// keePassName names the database and root group of KeePass exports
+const keePassName = "Passwords"
+
+func (u *passwdUsecase) ExportKeePass(ctx context.Context, userID int64, password, key string) ([]byte, error) {
+	data, err := u.allCredentials(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	db := kdbx.Database{Name: keePassName, Root: kdbx.Group{Name: keePassName}}
+	groups := make(map[string]int)
+
+	for _, c := range data {
+		if err = decryptCredentials(&c, key); err != nil {
+			return nil, err
+		}
+
+		if len(c.Tags) == 0 {
+			db.Root.Entries = append(db.Root.Entries, keePassEntry(c))
+			continue
+		}
+
+		i, ok := groups[c.Tags[0]]
+		if !ok {
+			i = len(db.Root.Groups)
+			groups[c.Tags[0]] = i
+			db.Root.Groups = append(db.Root.Groups, kdbx.Group{Name: c.Tags[0]})
+		}
+
+		db.Root.Groups[i].Entries = append(db.Root.Groups[i].Entries, keePassEntry(c))
+	}
+
+	return kdbx.Write(db, password)
+}
+
+// keePassEntry returns the KeePass entry of decrypted credentials. Items
+// other than logins keep their type in custom data and their fields as
+// strings, previous passwords are versions of the entry.
+func keePassEntry(c models.Credentials) kdbx.Entry {
+	e := kdbx.Entry{
+		Title:    c.ServiceName,
+		Username: c.Username,
+		Password: c.PasswordHash,
+		URL:      c.URL,
+		Notes:    c.Notes,
+		Tags:     c.Tags,
+		Created:  timeOf(c.CreatedAt),
+		Modified: timeOf(c.UpdatedAt),
+		Accessed: timeOf(c.AccessedAt),
+	}
+
+	if len(c.Fields) > 0 || c.OTP != "" {
+		e.Fields = make(map[string]string, len(c.Fields)+1)
+		for name, value := range c.Fields {
+			e.Fields[name] = value
+		}
+
+		if c.OTP != "" {
+			e.Fields["otp"] = c.OTP
+		}
+	}
+
+	if c.Type != "" && c.Type != models.ItemLogin {
+		e.CustomData = map[string]string{importer.KeePassKindKey: c.Type}
+	}
+
+	// KeePass keeps the oldest version first
+	for i := len(c.History) - 1; i >= 0; i-- {
+		v := c.History[i]
+		e.History = append(e.History, kdbx.Entry{
+			Title:    c.ServiceName,
+			Username: c.Username,
+			Password: v.Password,
+			URL:      c.URL,
+			Created:  e.Created,
+			Modified: timeOf(v.UpdatedAt),
+			Accessed: timeOf(v.UpdatedAt),
+		})
+	}
+
+	return e
+}
+
+func (u *passwdUsecase) ExportBitwarden(ctx context.Context, userID int64, password, key string) ([]byte, error) {
+	data, err := u.allCredentials(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	export := bitwarden.Export{Items: make([]bitwarden.Item, 0, len(data))}
+	folders := make(map[string]string)
+
+	for _, c := range data {
+		if err = decryptCredentials(&c, key); err != nil {
+			return nil, err
+		}
+
+		item, err := bitwardenItem(c)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(c.Tags) > 0 {
+			id, ok := folders[c.Tags[0]]
+			if !ok {
+				if id, err = bitwarden.NewID(); err != nil {
+					return nil, err
+				}
+
+				folders[c.Tags[0]] = id
+				export.Folders = append(export.Folders, bitwarden.Folder{ID: id, Name: c.Tags[0]})
+			}
+
+			item.FolderID = &id
+		}
+
+		export.Items = append(export.Items, item)
+	}
+
+	if password == "" {
+		return bitwarden.Write(export)
+	}
+
+	return bitwarden.Protect(export, password)
+}
+
+// bitwardenItem returns the Bitwarden item of decrypted credentials.
+// Logins, notes and cards are items of the same type, other items are
+// secure notes naming their type in a field. Custom fields are hidden.
+func bitwardenItem(c models.Credentials) (bitwarden.Item, error) {
+	id, err := bitwarden.NewID()
+	if err != nil {
+		return bitwarden.Item{}, err
+	}
+
+	item := bitwarden.Item{
+		ID:           id,
+		Name:         c.ServiceName,
+		Notes:        bitwarden.Str(c.Notes),
+		CreationDate: timePointer(c.CreatedAt),
+		RevisionDate: timePointer(c.UpdatedAt),
+	}
+
+	fields := make(map[string]string, len(c.Fields)+1)
+	for name, value := range c.Fields {
+		fields[name] = value
+	}
+
+	switch t := c.ItemType().Name; t {
+	case models.ItemLogin:
+		item.Type = bitwarden.TypeLogin
+		item.Login = &bitwarden.Login{
+			Username:             bitwarden.Str(c.Username),
+			Password:             bitwarden.Str(c.PasswordHash),
+			TOTP:                 bitwarden.Str(c.OTP),
+			PasswordRevisionDate: timePointer(c.UpdatedAt),
+		}
+
+		if c.URL != "" {
+			item.Login.URIs = []bitwarden.URI{{URI: c.URL}}
+		}
+
+		for _, v := range c.History {
+			item.PasswordHistory = append(item.PasswordHistory, bitwarden.Password{
+				LastUsedDate: timeOf(v.ReplacedAt).UTC(),
+				Password:     v.Password,
+			})
+		}
+	case models.ItemNote:
+		item.Type = bitwarden.TypeSecureNote
+		item.SecureNote = &bitwarden.SecureNote{}
+	case models.ItemCard:
+		item.Type = bitwarden.TypeCard
+		month, year := importer.SplitCardExpiry(fields[importer.CardExpiry])
+		item.Card = &bitwarden.Card{
+			CardholderName: bitwarden.Str(fields[importer.CardHolder]),
+			Brand:          bitwarden.Str(fields[importer.CardBrand]),
+			Number:         bitwarden.Str(fields[importer.CardNumber]),
+			ExpMonth:       bitwarden.Str(month),
+			ExpYear:        bitwarden.Str(year),
+			Code:           bitwarden.Str(fields[importer.CardCVV]),
+		}
+
+		delete(fields, importer.CardHolder)
+		delete(fields, importer.CardBrand)
+		delete(fields, importer.CardNumber)
+		delete(fields, importer.CardCVV)
+		if month != "" {
+			delete(fields, importer.CardExpiry)
+		}
+	default:
+		item.Type = bitwarden.TypeSecureNote
+		item.SecureNote = &bitwarden.SecureNote{}
+		item.Fields = append(item.Fields, bitwarden.Field{
+			Name:  importer.BitwardenKindField,
+			Value: bitwarden.Str(t),
+			Type:  bitwarden.FieldText,
+		})
+	}
+
+	// Only logins have a TOTP secret in Bitwarden
+	if c.OTP != "" && item.Type != bitwarden.TypeLogin {
+		fields["TOTP"] = c.OTP
+	}
+
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		item.Fields = append(item.Fields, bitwarden.Field{
+			Name:  name,
+			Value: bitwarden.Str(fields[name]),
+			Type:  bitwarden.FieldHidden,
+		})
+	}
+
+	return item, nil
+}
+
+func (u *passwdUsecase) Import(
+	ctx context.Context, userID int64, entries []importer.Entry, duplicates string, dryRun bool, key string,
+) (models.ImportResult, error) {
+	var result models.ImportResult
+
+	// Earlier entries count as saved, even in a dry run
+	taken := make(map[[2]string]bool)
+	exists := func(service, username string) (bool, error) {
+		if taken[[2]string{service, username}] {
+			return true, nil
+		}
+
+		_, err := u.storage.Get(ctx, userID, service, username)
+		if errors.Is(err, models.ErrNotFound) {
+			return false, nil
+		}
+
+		return err == nil, err
+	}
+
+	for _, e := range entries {
+		c := importedCredentials(userID, e)
+
+		duplicate, err := exists(c.ServiceName, c.Username)
+		if err != nil {
+			return models.ImportResult{}, err
+		}
+
+		switch {
+		case !duplicate:
+			result.Added++
+		case dryRun:
+			result.Duplicates++
+		case duplicates == models.DuplicatesOverwrite:
+			result.Duplicates++
+			result.Overwritten++
+		case duplicates == models.DuplicatesKeepBoth:
+			result.Duplicates++
+			result.Renamed++
+
+			name := c.ServiceName
+			for i := 2; duplicate; i++ {
+				c.ServiceName = name + " (" + strconv.Itoa(i) + ")"
+				if duplicate, err = exists(c.ServiceName, c.Username); err != nil {
+					return models.ImportResult{}, err
+				}
+			}
+		default:
+			result.Duplicates++
+			result.Skipped++
+			continue
+		}
+
+		taken[[2]string{c.ServiceName, c.Username}] = true
+
+		if dryRun {
+			continue
+		}
+
+		if err = u.saveImported(ctx, userID, c, e, key); err != nil {
+			return models.ImportResult{}, err
+		}
+	}
+
+	return result, nil
+}
+
+// importedCredentials returns the plaintext item of an imported entry,
+// without its password but with its previous ones.
+func importedCredentials(userID int64, e importer.Entry) models.Credentials {
+	c := models.Credentials{
+		UserID:      uint64(userID),
+		ServiceName: e.Name,
+		Username:    e.Username,
+		Details: models.Details{
+			URL:    e.URL,
+			Notes:  e.Notes,
+			Tags:   models.ParseTags(strings.Join(e.Tags, ",")),
+			Fields: e.Fields,
+		},
+	}
+
+	if t, ok := models.ItemTypeOf(string(e.Kind)); ok && t.Name != models.ItemLogin {
+		c.Type = t.Name
+	}
+
+	for _, v := range e.History {
+		c.History = append(c.History, models.PasswordVersion{
+			Password:   v.Password,
+			Strength:   int(strength.Estimate(v.Password, e.Username, e.Name).Score),
+			UpdatedAt:  unixOf(v.Updated),
+			ReplacedAt: unixOf(v.Replaced),
+		})
+	}
+
+	if e.OTP != "" {
+		// Secrets that aren't TOTP, such as Steam codes, are kept as a field
+		key, err := totp.Parse(e.OTP)
+		if err != nil {
+			fields := make(map[string]string, len(c.Fields)+1)
+			for name, value := range c.Fields {
+				fields[name] = value
+			}
+			fields["TOTP"] = e.OTP
+			c.Fields = fields
+		} else {
+			if key.Account == "" {
+				key.Issuer, key.Account = e.Name, e.Username
+			}
+			c.OTP = key.URI()
+		}
+	}
+
+	return c
+}
+
+// saveImported encrypts and saves an imported item. An item it
+// overwrites keeps its history and creation time, and its password if
+// the entry has none, new ones keep the history of the entry.
+func (u *passwdUsecase) saveImported(ctx context.Context, userID int64, c models.Credentials, e importer.Entry, key string) error {
+	if err := encryptCredentials(&c, key); err != nil {
+		return err
+	}
+
+	stored, err := u.storage.Get(ctx, userID, c.ServiceName, c.Username)
+	switch {
+	case err == nil:
+		c.PasswordHash, c.Strength, c.UpdatedAt = stored.PasswordHash, stored.Strength, stored.UpdatedAt
+		c.CreatedAt, c.AccessedAt, c.History = stored.CreatedAt, stored.AccessedAt, stored.History
+	case errors.Is(err, models.ErrNotFound):
+		c.CreatedAt = unixOf(e.Created)
+		c.History = u.trimHistory(c.History)
+	default:
+		return err
+	}
+
+	now := time.Now()
+
+	if e.Password != "" {
+		if err = u.replacePassword(&c, e.Password, key, now); err != nil {
+			return err
+		}
+	}
+
+	if c.CreatedAt == 0 {
+		c.CreatedAt = now.Unix()
+	}
+
+	// The export knows when the password was changed
+	if !e.Updated.IsZero() {
+		c.UpdatedAt = e.Updated.Unix()
+	} else if c.UpdatedAt == 0 {
+		c.UpdatedAt = now.Unix()
+	}
+
+	return u.storage.SaveCredentials(ctx, c)
+}
+
+// unixOf returns the Unix time of t, 0 if it's zero.
+func unixOf(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+
+	return t.Unix()
+}
+
+// timeOf returns the time of a Unix time, zero if it's 0.
+func timeOf(unix int64) time.Time {
+	if unix == 0 {
+		return time.Time{}
+	}
+
+	return time.Unix(unix, 0)
+}
+
+// timePointer returns the time of a Unix time, nil if it's 0.
+func timePointer(unix int64) *time.Time {
+	if unix == 0 {
+		return nil
+	}
+
+	t := time.Unix(unix, 0).UTC()
+
+	return &t
+}
+
+// allCredentials returns every account of the user, page by page.
+func (u *passwdUsecase) allCredentials(ctx context.Context, userID int64) ([]models.Credentials, error) {
+	all, err := u.storage.GetAllByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return nextPages(all, func(last models.Credentials) ([]models.Credentials, error) {
+		return u.storage.GetAllByUserIDAfter(ctx, userID, last.ServiceName, last.Username)
+	})
+}
+
+// nextPages appends the pages that follow the first one until next
+// returns an empty page.
+func nextPages(all []models.Credentials, next func(last models.Credentials) ([]models.Credentials, error)) ([]models.Credentials, error) {
+	page := all
+	for len(page) > 0 {
+		var err error
+		if page, err = next(page[len(page)-1]); err != nil {
+			return nil, err
+		}
+
+		all = append(all, page...)
+	}
+
+	return all, nil
+}
+
+func (u *passwdUsecase) Breached(password string) bool {
+	return u.opts.Breaches.Breached(password)
+}
+
+func (u *passwdUsecase) Delete(ctx context.Context, userID int64, serviceName, username string) error {
+	return u.storage.Trash(ctx, userID, serviceName, username, time.Now())
+}
+
+func (u *passwdUsecase) GetTrash(ctx context.Context, userID int64) ([]models.Credentials, error) {
+	trash, err := u.storage.GetTrash(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return nextPages(trash, func(last models.Credentials) ([]models.Credentials, error) {
+		return u.storage.GetTrashAfter(ctx, userID, last.ServiceName, last.Username)
+	})
+}
+
+func (u *passwdUsecase) GetTrashPage(ctx context.Context, userID int64, serviceName, username string) ([]models.Credentials, error) {
+	if serviceName == "" && username == "" {
+		return u.storage.GetTrash(ctx, userID)
+	}
+
+	return u.storage.GetTrashAfter(ctx, userID, serviceName, username)
+}
+
+func (u *passwdUsecase) RestoreTrash(ctx context.Context, userID int64, serviceName, username string) error {
+	return u.storage.RestoreTrash(ctx, userID, serviceName, username)
+}
+
+func (u *passwdUsecase) PurgeTrash(ctx context.Context, userID int64, serviceName, username string) error {
+	return u.storage.PurgeTrash(ctx, userID, serviceName, username)
+}
+
+func (u *passwdUsecase) ExpireTrash(ctx context.Context, olderThan time.Time) (int, error) {
+	return u.storage.ExpireTrash(ctx, olderThan)
+}
+
+func (u *passwdUsecase) SetState(ctx context.Context, userID int64, state string) error {
+	return u.storage.SetState(ctx, userID, state)
+}
+
+func (u *passwdUsecase) SetDraft(ctx context.Context, userID int64, serviceName, username string) error {
+	return u.storage.SetDraft(ctx, userID, serviceName, username)
+}
+
+func (u *passwdUsecase) DiscardDraft(ctx context.Context, userID int64) error {
+	return u.storage.DiscardDraft(ctx, userID)
+}
+
+func (u *passwdUsecase) PurgeDrafts(ctx context.Context, olderThan time.Time) (int, error) {
+	return u.storage.PurgeDrafts(ctx, olderThan)
+}
+
+func (u *passwdUsecase) GetState(ctx context.Context, userID int64) (models.State, error) {
+	return u.storage.GetState(ctx, userID)
+}
+
+// encryptCredentials encrypts the password, notes, field values, TOTP secret
+// and previous passwords in place.
+func encryptCredentials(c *models.Credentials, key string) error {
+	return transformSecrets(c, func(s string) (string, error) {
+		return pkg.Encrypt(s, key)
+	})
+}
+
+// decryptCredentials decrypts the password, notes, field values, TOTP secret
+// and previous passwords in place.
+func decryptCredentials(c *models.Credentials, key string) error {
+	return transformSecrets(c, func(s string) (string, error) {
+		return pkg.Decrypt(s, key)
+	})
+}
+
+// setValue sets the notes or a field of c to the encrypted value,
+// an empty value clears it.
+func setValue(c *models.Credentials, field, value, key string) error {
+	encrypted, err := encryptValue(value, key)
+	if err != nil {
+		return err
+	}
+
+	if field == models.FieldNotes {
+		c.Notes = encrypted
+		return nil
+	}
+
+	fields := make(map[string]string, len(c.Fields)+1)
+	for name, v := range c.Fields {
+		fields[name] = v
+	}
+
+	if encrypted == "" {
+		delete(fields, field)
+	} else {
+		fields[field] = encrypted
+	}
+
+	c.Fields = nil
+	if len(fields) > 0 {
+		c.Fields = fields
+	}
+
+	return nil
+}
+
+// encryptValue encrypts an optional value, empty values stay empty.
+func encryptValue(value, key string) (string, error) {
+	if value == "" {
 		return "", nil
 	}
 
-	return data.LastService, nil
+	return pkg.Encrypt(value, key)
+}
+
+func transformSecrets(c *models.Credentials, transform func(string) (string, error)) error {
+	var err error
+
+	// Items other than logins have no password
+	if c.PasswordHash != "" {
+		if c.PasswordHash, err = transform(c.PasswordHash); err != nil {
+			return err
+		}
+	}
+
+	if c.Notes != "" {
+		if c.Notes, err = transform(c.Notes); err != nil {
+			return err
+		}
+	}
+
+	if c.OTP != "" {
+		if c.OTP, err = transform(c.OTP); err != nil {
+			return err
+		}
+	}
+
+	if len(c.Fields) > 0 {
+		fields := make(map[string]string, len(c.Fields))
+		for name, value := range c.Fields {
+			if fields[name], err = transform(value); err != nil {
+				return err
+			}
+		}
+		c.Fields = fields
+	}
+
+	if len(c.History) > 0 {
+		history := make([]models.PasswordVersion, len(c.History))
+		for i, v := range c.History {
+			if v.Password, err = transform(v.Password); err != nil {
+				return err
+			}
+			history[i] = v
+		}
+		c.History = history
+	}
+
+	return nil
 }
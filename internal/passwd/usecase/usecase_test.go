@@ -0,0 +1,449 @@
+package passwdUsecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"telegram-bot/internal/models"
+	passwdRepository "telegram-bot/internal/passwd/repository"
+	"telegram-bot/pkg"
+	"telegram-bot/pkg/importer"
+)
+
+// testKey is an AES-256 key like the bot's encryption key
+const testKey = "0123456789abcdef0123456789abcdef"
+
+const testUserID = 1
+
+func newTestUsecase(t *testing.T, opts Opts) (*passwdUsecase, passwdRepository.Storage) {
+	t.Helper()
+
+	storage := passwdRepository.NewMemory()
+	mustNoErr(t, storage.SetToken(context.Background(), testUserID, "token"))
+
+	return &passwdUsecase{storage: storage, opts: opts}, storage
+}
+
+func mustNoErr(t *testing.T, err error) {
+	t.Helper()
+
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+}
+
+func names(credentials []models.Credentials) []string {
+	result := make([]string, len(credentials))
+	for i, c := range credentials {
+		result[i] = c.ServiceName + "/" + c.Username
+	}
+
+	return result
+}
+
+func TestAuditReused(t *testing.T) {
+	ctx := context.Background()
+	u, _ := newTestUsecase(t, Opts{})
+
+	// More accounts than a storage page, reuse spans pages
+	for i := 0; i < 60; i++ {
+		password := fmt.Sprintf("unique-%02d-Xq8#vLm2@pR", i)
+		switch i {
+		case 3, 41, 57:
+			password = "shared-Tz7!kWp4&nQ"
+		case 10, 55:
+			password = "other-Hs9$bYc3*eJ"
+		}
+
+		mustNoErr(t, u.SaveCredentials(ctx, testUserID, fmt.Sprintf("service-%02d", i), "user", password, testKey))
+	}
+
+	audit, err := u.Audit(ctx, testUserID, 0, testKey)
+	mustNoErr(t, err)
+
+	if audit.Checked != 60 {
+		t.Fatalf("expected 60 logins checked, got %d", audit.Checked)
+	}
+
+	want := [][]string{
+		{"service-03/user", "service-41/user", "service-57/user"},
+		{"service-10/user", "service-55/user"},
+	}
+
+	if len(audit.Reused) != len(want) {
+		t.Fatalf("expected %d groups of reused passwords, got %v", len(want), audit.Reused)
+	}
+
+	for i, group := range audit.Reused {
+		if got := names(group); fmt.Sprint(got) != fmt.Sprint(want[i]) {
+			t.Errorf("group %d: expected %v, got %v", i, want[i], got)
+		}
+
+		for _, c := range group {
+			if c.PasswordHash != "" {
+				t.Errorf("%s: the audit keeps the password", c.ServiceName)
+			}
+		}
+	}
+}
+
+func TestSearchAllPages(t *testing.T) {
+	ctx := context.Background()
+	u, _ := newTestUsecase(t, Opts{})
+
+	for i := 0; i < 60; i++ {
+		mustNoErr(t, u.SaveCredentials(ctx, testUserID, fmt.Sprintf("service-%02d", i), "user", "secret", testKey))
+	}
+
+	found, err := u.Search(ctx, testUserID, "SERVICE-5", testKey)
+	mustNoErr(t, err)
+
+	if len(found) != 10 || found[9].ServiceName != "service-59" {
+		t.Fatalf("expected service-50 to service-59, got %v", names(found))
+	}
+
+	if found[0].PasswordHash != "secret" {
+		t.Fatalf("expected decrypted items, got %q", found[0].PasswordHash)
+	}
+}
+
+// passwords returns the decrypted password and history of the account.
+func passwords(t *testing.T, s passwdRepository.Storage, service, username string) (string, []string) {
+	t.Helper()
+
+	c, err := s.Get(context.Background(), testUserID, service, username)
+	mustNoErr(t, err)
+
+	current, err := pkg.Decrypt(c.PasswordHash, testKey)
+	mustNoErr(t, err)
+
+	var history []string
+	for _, v := range c.History {
+		password, err := pkg.Decrypt(v.Password, testKey)
+		mustNoErr(t, err)
+
+		history = append(history, password)
+	}
+
+	return current, history
+}
+
+func TestImport(t *testing.T) {
+	entries := []importer.Entry{
+		{Name: "github", Username: "octocat", Password: "new"},
+		{Name: "gitlab", Username: "me", Password: "first"},
+		// The same account again later in the file
+		{Name: "gitlab", Username: "me", Password: "second"},
+	}
+
+	type account struct {
+		service, username string
+		password          string
+		history           []string
+	}
+
+	tests := []struct {
+		duplicates string
+		want       models.ImportResult
+		accounts   []account
+	}{
+		{
+			duplicates: models.DuplicatesSkip,
+			want:       models.ImportResult{Added: 1, Duplicates: 2, Skipped: 2},
+			accounts: []account{
+				{"github", "octocat", "old", nil},
+				{"github (2)", "octocat", "other", nil},
+				{"gitlab", "me", "first", nil},
+			},
+		},
+		{
+			duplicates: models.DuplicatesOverwrite,
+			want:       models.ImportResult{Added: 1, Duplicates: 2, Overwritten: 2},
+			accounts: []account{
+				{"github", "octocat", "new", []string{"old"}},
+				{"github (2)", "octocat", "other", nil},
+				{"gitlab", "me", "second", []string{"first"}},
+			},
+		},
+		{
+			duplicates: models.DuplicatesKeepBoth,
+			want:       models.ImportResult{Added: 1, Duplicates: 2, Renamed: 2},
+			accounts: []account{
+				{"github", "octocat", "old", nil},
+				{"github (2)", "octocat", "other", nil},
+				{"github (3)", "octocat", "new", nil},
+				{"gitlab", "me", "first", nil},
+				{"gitlab (2)", "me", "second", nil},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.duplicates, func(t *testing.T) {
+			ctx := context.Background()
+			u, storage := newTestUsecase(t, Opts{HistoryDepth: 5})
+
+			mustNoErr(t, u.SaveCredentials(ctx, testUserID, "github", "octocat", "old", testKey))
+			mustNoErr(t, u.SaveCredentials(ctx, testUserID, "github (2)", "octocat", "other", testKey))
+
+			result, err := u.Import(ctx, testUserID, entries, tt.duplicates, false, testKey)
+			mustNoErr(t, err)
+
+			if result != tt.want {
+				t.Fatalf("expected %+v, got %+v", tt.want, result)
+			}
+
+			all, err := storage.GetAllByUserID(ctx, testUserID)
+			mustNoErr(t, err)
+
+			if len(all) != len(tt.accounts) {
+				t.Fatalf("expected %d accounts, got %v", len(tt.accounts), names(all))
+			}
+
+			for _, a := range tt.accounts {
+				password, history := passwords(t, storage, a.service, a.username)
+				if password != a.password || !reflect.DeepEqual(history, a.history) {
+					t.Errorf("%s/%s: expected %q with history %q, got %q with %q", a.service, a.username, a.password, a.history, password, history)
+				}
+			}
+		})
+	}
+}
+
+func TestImportDryRun(t *testing.T) {
+	ctx := context.Background()
+	u, storage := newTestUsecase(t, Opts{HistoryDepth: 5})
+
+	mustNoErr(t, u.SaveCredentials(ctx, testUserID, "github", "octocat", "old", testKey))
+
+	before, err := storage.GetAllByUserID(ctx, testUserID)
+	mustNoErr(t, err)
+
+	entries := []importer.Entry{
+		{Name: "github", Username: "octocat", Password: "new"},
+		{Name: "gitlab", Username: "me", Password: "first"},
+		{Name: "gitlab", Username: "me", Password: "second"},
+	}
+
+	for _, duplicates := range []string{models.DuplicatesSkip, models.DuplicatesOverwrite, models.DuplicatesKeepBoth} {
+		result, err := u.Import(ctx, testUserID, entries, duplicates, true, testKey)
+		mustNoErr(t, err)
+
+		if want := (models.ImportResult{Added: 1, Duplicates: 2}); result != want {
+			t.Fatalf("%s: expected %+v, got %+v", duplicates, want, result)
+		}
+	}
+
+	after, err := storage.GetAllByUserID(ctx, testUserID)
+	mustNoErr(t, err)
+
+	if !reflect.DeepEqual(after, before) {
+		t.Fatalf("expected the storage unchanged by a dry run:\nbefore %+v\nafter  %+v", before, after)
+	}
+}
+
+func TestSetPasswordHistory(t *testing.T) {
+	ctx := context.Background()
+	u, storage := newTestUsecase(t, Opts{HistoryDepth: 2})
+
+	mustNoErr(t, u.SaveCredentials(ctx, testUserID, "github", "octocat", "first", testKey))
+
+	for _, password := range []string{"second", "third", "third", "fourth"} {
+		mustNoErr(t, u.SetPassword(ctx, testUserID, "github", "octocat", password, testKey))
+	}
+
+	// Saving the same password doesn't add it, the oldest are dropped at the limit
+	password, history := passwords(t, storage, "github", "octocat")
+	if password != "fourth" || !reflect.DeepEqual(history, []string{"third", "second"}) {
+		t.Fatalf("expected fourth with history [third second], got %s with %q", password, history)
+	}
+}
+
+func TestRestorePassword(t *testing.T) {
+	ctx := context.Background()
+	u, storage := newTestUsecase(t, Opts{HistoryDepth: 3})
+
+	mustNoErr(t, u.SaveCredentials(ctx, testUserID, "github", "octocat", "first", testKey))
+	mustNoErr(t, u.SetPassword(ctx, testUserID, "github", "octocat", "second", testKey))
+	mustNoErr(t, u.SetPassword(ctx, testUserID, "github", "octocat", "third", testKey))
+
+	// Version 1 is the second most recent previous password
+	mustNoErr(t, u.RestorePassword(ctx, testUserID, "github", "octocat", 1, testKey))
+
+	password, history := passwords(t, storage, "github", "octocat")
+	if password != "first" || !reflect.DeepEqual(history, []string{"third", "second"}) {
+		t.Fatalf("expected first with history [third second], got %s with %q", password, history)
+	}
+
+	for _, version := range []int{-1, 2} {
+		if err := u.RestorePassword(ctx, testUserID, "github", "octocat", version, testKey); !errors.Is(err, models.ErrNotFound) {
+			t.Fatalf("version %d: expected ErrNotFound, got %v", version, err)
+		}
+	}
+}
+
+func TestTrimHistory(t *testing.T) {
+	history := []models.PasswordVersion{{ReplacedAt: 3}, {ReplacedAt: 2}, {ReplacedAt: 1}}
+
+	tests := []struct {
+		depth int
+		want  []models.PasswordVersion
+	}{
+		{depth: 0, want: nil},
+		{depth: 2, want: history[:2]},
+		{depth: 3, want: history},
+		{depth: 5, want: history},
+	}
+
+	for _, tt := range tests {
+		u := &passwdUsecase{opts: Opts{HistoryDepth: tt.depth}}
+
+		if got := u.trimHistory(history); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("depth %d: expected %+v, got %+v", tt.depth, tt.want, got)
+		}
+	}
+}
+
+func TestReplacePassword(t *testing.T) {
+	u := &passwdUsecase{opts: Opts{HistoryDepth: 2}}
+	now := time.Unix(1700000000, 0)
+
+	var c models.Credentials
+	mustNoErr(t, u.replacePassword(&c, "first", testKey, now))
+
+	if c.CreatedAt != now.Unix() || c.UpdatedAt != now.Unix() || len(c.History) != 0 {
+		t.Fatalf("expected new credentials created now without history, got %+v", c)
+	}
+
+	first := c.PasswordHash
+	later := now.Add(time.Hour)
+	mustNoErr(t, u.replacePassword(&c, "second", testKey, later))
+
+	want := models.PasswordVersion{Password: first, Strength: c.History[0].Strength, UpdatedAt: now.Unix(), ReplacedAt: later.Unix()}
+	if len(c.History) != 1 || c.History[0] != want {
+		t.Fatalf("expected history %+v, got %+v", want, c.History)
+	}
+
+	if c.CreatedAt != now.Unix() || c.UpdatedAt != later.Unix() {
+		t.Fatalf("expected created %d and updated %d, got %+v", now.Unix(), later.Unix(), c)
+	}
+}
+
+// exportItems returns the decrypted items of the user as they are exported,
+// without the access time, which isn't imported.
+func exportItems(t *testing.T, s passwdRepository.Storage) []models.ExportItem {
+	t.Helper()
+
+	all, err := s.GetAllByUserID(context.Background(), testUserID)
+	mustNoErr(t, err)
+
+	items := make([]models.ExportItem, len(all))
+	for i, c := range all {
+		mustNoErr(t, decryptCredentials(&c, testKey))
+
+		items[i] = models.ExportItemOf(c)
+		items[i].AccessedAt = 0
+	}
+
+	return items
+}
+
+func TestExportImport(t *testing.T) {
+	ctx := context.Background()
+	u, storage := newTestUsecase(t, Opts{HistoryDepth: 5})
+
+	mustNoErr(t, u.SaveCredentials(ctx, testUserID, "github", "octocat", "first", testKey))
+	mustNoErr(t, u.SetPassword(ctx, testUserID, "github", "octocat", "second", testKey))
+	mustNoErr(t, u.SetDetails(ctx, testUserID, "github", "octocat", models.Details{
+		URL:   "https://github.com",
+		Notes: "recovery codes in the safe",
+		Tags:  []string{"work"},
+	}, testKey))
+	mustNoErr(t, u.SaveItem(ctx, testUserID, models.Credentials{
+		Type:         models.ItemWiFi,
+		ServiceName:  "Home",
+		PasswordHash: "hunter22",
+		Details:      models.Details{Fields: map[string]string{"ssid": "home"}},
+	}, testKey))
+
+	data, err := u.Export(ctx, testUserID, "correct horse battery staple", testKey)
+	mustNoErr(t, err)
+
+	file, err := importer.ParseWithPassword(data, "correct horse battery staple")
+	mustNoErr(t, err)
+
+	if file.Format != importer.Sealed {
+		t.Fatalf("expected an export of the bot, got %s", file.Format)
+	}
+
+	imported, importedStorage := newTestUsecase(t, Opts{HistoryDepth: 5})
+
+	result, err := imported.Import(ctx, testUserID, file.Entries, models.DuplicatesSkip, false, testKey)
+	mustNoErr(t, err)
+
+	if result.Added != 2 {
+		t.Fatalf("expected 2 items added, got %+v", result)
+	}
+
+	if got, want := exportItems(t, importedStorage), exportItems(t, storage); !reflect.DeepEqual(got, want) {
+		t.Fatalf("imported items differ:\nexpected %+v\ngot      %+v", want, got)
+	}
+}
+
+func TestAuditOnlyLogins(t *testing.T) {
+	ctx := context.Background()
+	u, _ := newTestUsecase(t, Opts{})
+
+	mustNoErr(t, u.SaveCredentials(ctx, testUserID, "github", "octocat", "shared-Tz7!kWp4&nQ", testKey))
+	mustNoErr(t, u.SaveItem(ctx, testUserID, models.Credentials{
+		Type:        models.ItemWiFi,
+		ServiceName: "Home",
+		Details:     models.Details{Fields: map[string]string{"ssid": "home", "password": "shared-Tz7!kWp4&nQ"}},
+	}, testKey))
+
+	audit, err := u.Audit(ctx, testUserID, 0, testKey)
+	mustNoErr(t, err)
+
+	if audit.Checked != 1 || audit.Unchecked != 1 || len(audit.Reused) != 0 {
+		t.Fatalf("expected the login checked and the Wi-Fi network counted as unchecked, got %+v", audit)
+	}
+}
+
+func TestGetTrashPage(t *testing.T) {
+	ctx := context.Background()
+	u, _ := newTestUsecase(t, Opts{})
+
+	for i := 0; i < 60; i++ {
+		service := fmt.Sprintf("service-%02d", i)
+		mustNoErr(t, u.SaveCredentials(ctx, testUserID, service, "user", "password", testKey))
+		mustNoErr(t, u.Delete(ctx, testUserID, service, "user"))
+	}
+
+	var all []models.Credentials
+	for page, last := 0, (models.Credentials{}); ; page++ {
+		items, err := u.GetTrashPage(ctx, testUserID, last.ServiceName, last.Username)
+		mustNoErr(t, err)
+
+		if len(items) == 0 {
+			break
+		}
+
+		if page > 60 {
+			t.Fatal("paging doesn't end")
+		}
+
+		all = append(all, items...)
+		last = items[len(items)-1]
+	}
+
+	trash, err := u.GetTrash(ctx, testUserID)
+	mustNoErr(t, err)
+
+	if len(all) != 60 || !reflect.DeepEqual(names(all), names(trash)) {
+		t.Fatalf("expected the 60 items of the trash, got %v", names(all))
+	}
+}
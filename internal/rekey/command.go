@@ -0,0 +1,89 @@
+// Package rekey re-encrypts what every user stored with a new AES key.
+package rekey
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+
+	passwdRepository "telegram-bot/internal/passwd/repository"
+	passwdUsecase "telegram-bot/internal/passwd/usecase"
+	"telegram-bot/pkg"
+)
+
+const usage = `usage: rekey
+
+Re-encrypts the security password and the secrets of every user, the trash
+included, from AES_KEY to NEW_AES_KEY. Each user is re-encrypted in a single
+write, users re-encrypted by an interrupted run are skipped. Stop the bot
+first, its cache keeps the old secrets for a while, and start it again with
+NEW_AES_KEY as AES_KEY.
+`
+
+// Command implements the "rekey" subcommand of the bot binary.
+func Command(ctx context.Context, storage passwdRepository.Storage, oldKey, newKey string, args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("rekey", flag.ContinueOnError)
+	fs.SetOutput(out)
+	fs.Usage = func() { fmt.Fprint(out, usage) }
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if fs.NArg() > 0 {
+		fs.Usage()
+		return fmt.Errorf("unexpected rekey arguments %q", fs.Args())
+	}
+
+	if oldKey == "" || newKey == "" {
+		return errors.New("both AES_KEY and NEW_AES_KEY are needed")
+	}
+
+	if oldKey == newKey {
+		return errors.New("NEW_AES_KEY is the same as AES_KEY")
+	}
+
+	// A key of the wrong size fails before anything is written
+	if _, err := pkg.Encrypt("", newKey); err != nil {
+		return fmt.Errorf("invalid NEW_AES_KEY: %w", err)
+	}
+
+	snapshotter, ok := storage.(passwdRepository.Snapshotter)
+	if !ok {
+		return errors.New("the storage can't list its users")
+	}
+
+	// Users are listed first, storages don't allow writes while dumping
+	var userIDs []int64
+	err := snapshotter.Dump(ctx, func(snapshot passwdRepository.UserSnapshot) error {
+		userIDs = append(userIDs, int64(snapshot.User.ID))
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	u := passwdUsecase.NewPasswdUsecase(storage, passwdUsecase.Opts{})
+
+	var reencrypted, skipped int
+	for _, userID := range userIDs {
+		// The token only decrypts with the key it was encrypted with
+		if _, err = u.GetUser(ctx, userID, newKey); err == nil {
+			skipped++
+			continue
+		}
+
+		if err = u.ReEncrypt(ctx, userID, oldKey, newKey); err != nil {
+			fmt.Fprintf(out, "re-encrypted %d users, skipped %d\n", reencrypted, skipped)
+			return fmt.Errorf("re-encrypt user %d: %w", userID, err)
+		}
+
+		reencrypted++
+	}
+
+	fmt.Fprintf(out, "re-encrypted %d users, skipped %d already re-encrypted\n", reencrypted, skipped)
+
+	return nil
+}
@@ -0,0 +1,133 @@
+package rekey
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	passwdRepository "telegram-bot/internal/passwd/repository"
+	passwdUsecase "telegram-bot/internal/passwd/usecase"
+	"telegram-bot/pkg"
+)
+
+const (
+	oldKey = "0123456789abcdef0123456789abcdef"
+	newKey = "fedcba9876543210fedcba9876543210"
+)
+
+func mustNoErr(t *testing.T, err error) {
+	t.Helper()
+
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+}
+
+// newTestStorage returns a storage with users that have more items than
+// a storage page, some of them in the trash.
+func newTestStorage(t *testing.T) *passwdRepository.Memory {
+	t.Helper()
+
+	ctx := context.Background()
+	storage := passwdRepository.NewMemory()
+	u := passwdUsecase.NewPasswdUsecase(storage, passwdUsecase.Opts{HistoryDepth: 2})
+
+	for userID := int64(1); userID <= 2; userID++ {
+		mustNoErr(t, u.CreateUser(ctx, userID, fmt.Sprintf("token-%d", userID), oldKey))
+
+		for i := 0; i < 60; i++ {
+			service := fmt.Sprintf("service-%02d", i)
+			mustNoErr(t, u.SaveCredentials(ctx, userID, service, "user", "first-"+service, oldKey))
+			mustNoErr(t, u.SetPassword(ctx, userID, service, "user", "second-"+service, oldKey))
+		}
+
+		for i := 0; i < 55; i++ {
+			mustNoErr(t, storage.Trash(ctx, userID, fmt.Sprintf("service-%02d", i), "user", time.Now()))
+		}
+	}
+
+	return storage
+}
+
+// checkKey checks every secret of the users decrypts with the key.
+func checkKey(t *testing.T, storage *passwdRepository.Memory, key string) {
+	t.Helper()
+
+	ctx := context.Background()
+
+	err := storage.Dump(ctx, func(snapshot passwdRepository.UserSnapshot) error {
+		if _, err := pkg.Decrypt(snapshot.User.Token, key); err != nil {
+			return fmt.Errorf("token of user %d: %w", snapshot.User.ID, err)
+		}
+
+		if len(snapshot.Credentials) != 5 || len(snapshot.Trash) != 55 {
+			return fmt.Errorf("user %d has %d items and %d in the trash", snapshot.User.ID, len(snapshot.Credentials), len(snapshot.Trash))
+		}
+
+		for _, c := range append(snapshot.Credentials, snapshot.Trash...) {
+			if _, err := pkg.Decrypt(c.PasswordHash, key); err != nil {
+				return fmt.Errorf("%s of user %d: %w", c.ServiceName, snapshot.User.ID, err)
+			}
+
+			for _, v := range c.History {
+				if _, err := pkg.Decrypt(v.Password, key); err != nil {
+					return fmt.Errorf("history of %s of user %d: %w", c.ServiceName, snapshot.User.ID, err)
+				}
+			}
+		}
+
+		return nil
+	})
+	mustNoErr(t, err)
+}
+
+func TestCommand(t *testing.T) {
+	ctx := context.Background()
+	storage := newTestStorage(t)
+
+	var out bytes.Buffer
+	mustNoErr(t, Command(ctx, storage, oldKey, newKey, nil, &out))
+
+	if !strings.Contains(out.String(), "re-encrypted 2 users, skipped 0") {
+		t.Fatalf("unexpected output %q", out.String())
+	}
+
+	checkKey(t, storage, newKey)
+
+	// Another run, as after an interruption, skips the users done
+	out.Reset()
+	mustNoErr(t, Command(ctx, storage, oldKey, newKey, nil, &out))
+
+	if !strings.Contains(out.String(), "re-encrypted 0 users, skipped 2") {
+		t.Fatalf("unexpected output %q", out.String())
+	}
+
+	checkKey(t, storage, newKey)
+}
+
+func TestCommandInvalidKeys(t *testing.T) {
+	ctx := context.Background()
+	storage := newTestStorage(t)
+
+	tests := []struct {
+		name           string
+		oldKey, newKey string
+	}{
+		{"no new key", oldKey, ""},
+		{"same keys", oldKey, oldKey},
+		{"short new key", oldKey, "short"},
+		{"wrong old key", newKey[:16] + oldKey[16:], newKey},
+	}
+
+	for _, tt := range tests {
+		var out bytes.Buffer
+		if err := Command(ctx, storage, tt.oldKey, tt.newKey, nil, &out); err == nil {
+			t.Errorf("%s: expected an error", tt.name)
+		}
+	}
+
+	checkKey(t, storage, oldKey)
+}
@@ -0,0 +1,102 @@
+package server
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	config "telegram-bot/internal/configuration"
+	passwdRepository "telegram-bot/internal/passwd/repository"
+	"telegram-bot/pkg/breach"
+	"telegram-bot/pkg/metrics"
+)
+
+type health struct {
+	Status  string `json:"status"`
+	Storage string `json:"storage,omitempty"`
+}
+
+// MakeHealthRoutes serves liveness, readiness and metrics. They are available
+// before the bot is created and aren't guarded by the webhook token.
+func (s *Server) MakeHealthRoutes() {
+	s.Echo.GET("/health/live", s.live)
+	s.Echo.GET("/health/ready", s.ready)
+	s.Echo.GET("/metrics", echo.WrapHandler(s.metrics))
+}
+
+func (s *Server) live(c echo.Context) error {
+	return c.JSON(http.StatusOK, health{Status: "ok"})
+}
+
+// ready fails while the storage isn't made yet or its breaker is open.
+func (s *Server) ready(c echo.Context) error {
+	r := s.resilient.Load()
+	if r == nil {
+		return c.JSON(http.StatusServiceUnavailable, health{Status: "starting"})
+	}
+
+	state := r.BreakerState()
+	if state == passwdRepository.BreakerOpen {
+		return c.JSON(http.StatusServiceUnavailable, health{Status: "unavailable", Storage: state.String()})
+	}
+
+	return c.JSON(http.StatusOK, health{Status: "ok", Storage: state.String()})
+}
+
+func resilientOpts(cfg *config.Config) passwdRepository.ResilientOpts {
+	return passwdRepository.ResilientOpts{
+		Retries:   cfg.Storage.Resilience.Retries,
+		Backoff:   time.Duration(cfg.Storage.Resilience.Backoff) * time.Millisecond,
+		Threshold: cfg.Storage.Resilience.Threshold,
+		Cooldown:  time.Duration(cfg.Storage.Resilience.Cooldown) * time.Second,
+	}
+}
+
+func registerStorageMetrics(m *metrics.Registry, r *passwdRepository.Resilient) {
+	m.GaugeFunc("passwd_storage_breaker_state", "Storage circuit breaker state: 0 closed, 1 half-open, 2 open.", func() float64 {
+		return float64(r.BreakerState())
+	})
+	m.CounterFunc("passwd_storage_retries_total", "Retried storage reads.", func() float64 {
+		return float64(r.Stats().Retries)
+	})
+	m.CounterFunc("passwd_storage_failures_total", "Storage calls failed because of the storage.", func() float64 {
+		return float64(r.Stats().Failures)
+	})
+	m.CounterFunc("passwd_storage_rejected_total", "Storage calls rejected by the open breaker.", func() float64 {
+		return float64(r.Stats().Rejected)
+	})
+}
+
+func registerCacheMetrics(m *metrics.Registry, c *passwdRepository.Cache) {
+	m.CounterFunc("passwd_cache_hits_total", "User and state lookups served from the cache.", func() float64 {
+		return float64(c.Stats().Hits)
+	})
+	m.CounterFunc("passwd_cache_misses_total", "User and state lookups read from the storage.", func() float64 {
+		return float64(c.Stats().Misses)
+	})
+	m.GaugeFunc("passwd_cache_entries", "Users and states in the cache.", func() float64 {
+		return float64(c.Stats().Entries)
+	})
+}
+
+func registerBreachMetrics(m *metrics.Registry, c *breach.Corpus) {
+	m.GaugeFunc("passwd_breach_hashes_loaded", "Breached password hashes loaded into the filter.", func() float64 {
+		return float64(c.Stats().Loaded)
+	})
+	m.GaugeFunc("passwd_breach_load_done", "Whether the breached password corpus is fully loaded: 0 or 1.", func() float64 {
+		if c.Stats().Done {
+			return 1
+		}
+		return 0
+	})
+}
+
+func registerBackupMetrics(m *metrics.Registry, s *backupStats) {
+	m.GaugeFunc("passwd_backup_last_success_timestamp_seconds", "Unix time of the last verified backup, 0 before the first.", func() float64 {
+		return float64(s.lastSuccess.Load())
+	})
+	m.CounterFunc("passwd_backup_failures_total", "Scheduled backups that failed to be written or verified.", func() float64 {
+		return float64(s.failures.Load())
+	})
+}
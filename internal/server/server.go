@@ -1,7 +1,15 @@
 package server
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
 	"os"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"telegram-bot/pkg/logger"
@@ -9,13 +17,20 @@ import (
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
 	"github.com/tarantool/go-tarantool"
+	"github.com/tarantool/go-tarantool/connection_pool"
 
+	"telegram-bot/internal/backup"
 	"telegram-bot/internal/bot"
 	config "telegram-bot/internal/configuration"
 	middlewareBot "telegram-bot/internal/middleware"
+	"telegram-bot/internal/migrations"
 	passwdHandler "telegram-bot/internal/passwd/delivery"
 	passwdRepository "telegram-bot/internal/passwd/repository"
 	passwdUsecase "telegram-bot/internal/passwd/usecase"
+	"telegram-bot/internal/rekey"
+	"telegram-bot/pkg/breach"
+	"telegram-bot/pkg/cron"
+	"telegram-bot/pkg/metrics"
 )
 
 type Server struct {
@@ -24,6 +39,9 @@ type Server struct {
 	Config *config.Config
 
 	passwdHandler *passwdHandler.Handler
+	storage       passwdRepository.Storage
+	resilient     atomic.Pointer[passwdRepository.Resilient]
+	metrics       *metrics.Registry
 }
 
 func New(cfg *config.Config) *Server {
@@ -31,53 +49,476 @@ func New(cfg *config.Config) *Server {
 	e.Logger = logger.GetInstance()
 	e.Debug = cfg.Logger.Debug
 
+	e.Use(middlewareBot.RequestContext(time.Duration(cfg.Server.RequestTimeout) * time.Second))
 	e.Use(logger.Middleware())
-	e.Use(middlewareBot.TokenCheck())
 	e.Use(middleware.Secure())
 
-	return &Server{
-		Echo:   e,
-		Config: cfg,
+	s := &Server{
+		Echo:    e,
+		Config:  cfg,
+		metrics: metrics.NewRegistry(),
 	}
+	s.MakeHealthRoutes()
+
+	return s
 }
 
-func (s *Server) Start(botChan chan *bot.Bot) error {
+// Start serves updates until ctx is done, then shuts the server down.
+// In-flight updates get the shutdown timeout to finish, after that their
+// contexts and the background jobs are cancelled and the storage is closed.
+func (s *Server) Start(ctx context.Context, botChan chan *bot.Bot) error {
+	base, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	s.Echo.Server.BaseContext = func(net.Listener) context.Context {
+		return base
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
 	go func() {
-		for createdBot := range botChan {
-			s.Bot = createdBot
+		defer wg.Done()
+
+		select {
+		case s.Bot = <-botChan:
+		case <-base.Done():
+			return
 		}
 
-		err := s.MakePasswd()
+		err := s.MakePasswd(base)
 		if err != nil {
 			logger.GetInstance().Fatalf("failed to make passwd service: %s", err)
 		}
 		s.MakeRoute()
+
+		<-base.Done()
+		if closer, ok := s.storage.(io.Closer); ok {
+			if err = closer.Close(); err != nil {
+				logger.GetInstance().Errorf("failed to close storage: %s", err)
+			}
+		}
+	}()
+
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- s.Echo.Start(s.Config.Server.Host + ":" + s.Config.Server.Port)
 	}()
 
-	return s.Echo.Start(
-		s.Config.Server.Host + ":" + s.Config.Server.Port,
-	)
+	select {
+	case err := <-errChan:
+		cancel()
+		wg.Wait()
+		return err
+	case <-ctx.Done():
+	}
+
+	logger.GetInstance().Info("shutting down")
+
+	shutdownCtx, stop := context.WithTimeout(context.Background(), time.Duration(s.Config.Server.ShutdownTimeout)*time.Second)
+	defer stop()
+
+	err := s.Echo.Shutdown(shutdownCtx)
+	cancel()
+	wg.Wait()
+
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	return nil
 }
 
 func (s *Server) MakeRoute() {
 	s.Echo.Pre(middleware.RemoveTrailingSlash())
 
-	s.Echo.POST("", s.passwdHandler.GetMessage)
+	s.Echo.POST("", s.passwdHandler.GetMessage, middlewareBot.TokenCheck())
 }
 
-func (s *Server) MakePasswd() error {
-	opts := tarantool.Opts{
-		Timeout:       time.Duration(s.Config.Tarantool.Timeout) * time.Second,
-		Reconnect:     time.Duration(s.Config.Tarantool.Reconnect) * time.Second,
-		MaxReconnects: s.Config.Tarantool.MaxReconnects,
-		User:          s.Config.Tarantool.User,
-		Pass:          os.Getenv("TARANTOOL_PASSWORD"),
+// MakePasswd builds the passwd service, its background jobs stop when ctx is done.
+func (s *Server) MakePasswd(ctx context.Context) error {
+	backend, err := s.MakeStorage(ctx)
+	if err != nil {
+		return err
 	}
-	t, err := passwdRepository.NewTarantool(s.Config.Tarantool.Host, s.Config.Tarantool.Port, opts)
+
+	resilient := passwdRepository.NewResilient(backend, resilientOpts(s.Config))
+	registerStorageMetrics(s.metrics, resilient)
+	s.resilient.Store(resilient)
+
+	var storage passwdRepository.Storage = resilient
+	if s.Config.Storage.Cache.Enabled {
+		cache := passwdRepository.NewCache(resilient, passwdRepository.CacheOpts{
+			Size: s.Config.Storage.Cache.Size,
+			TTL:  time.Duration(s.Config.Storage.Cache.TTL) * time.Second,
+		})
+		registerCacheMetrics(s.metrics, cache)
+		storage = cache
+	}
+	s.storage = storage
+
+	breaches, err := s.makeBreaches(ctx)
 	if err != nil {
 		return err
 	}
-	s.passwdHandler = passwdHandler.NewHandler(passwdUsecase.NewPasswdUsecase(t), s.Bot)
+
+	usecase := passwdUsecase.NewPasswdUsecase(storage, passwdUsecase.Opts{
+		Breaches:     breaches,
+		HistoryDepth: s.Config.Bot.HistoryDepth,
+	})
+	s.passwdHandler = passwdHandler.NewHandler(usecase, s.Bot)
+
+	if s.Config.Bot.DraftTTL > 0 {
+		go purgeDrafts(ctx, usecase, time.Duration(s.Config.Bot.DraftTTL)*time.Minute)
+	}
+
+	if s.Config.Bot.TrashRetention > 0 {
+		go expireTrash(ctx, usecase, time.Duration(s.Config.Bot.TrashRetention)*24*time.Hour)
+	}
+
+	if s.Config.Backup.Schedule != "" {
+		if err = s.startBackups(ctx, backend); err != nil {
+			return err
+		}
+	}
 
 	return nil
 }
+
+// startBackups makes snapshots of the storage on the configured schedule.
+// They are made from the backend: neither retried nor served by the cache.
+func (s *Server) startBackups(ctx context.Context, storage passwdRepository.Storage) error {
+	schedule, err := cron.Parse(s.Config.Backup.Schedule)
+	if err != nil {
+		return err
+	}
+
+	snapshotter, ok := storage.(passwdRepository.Snapshotter)
+	if !ok {
+		return fmt.Errorf("storage driver %s can't be backed up", s.Config.Storage.Driver)
+	}
+
+	opts := backupOpts(s.Config)
+	if opts.Passphrase == "" {
+		return errors.New("backups are scheduled but BACKUP_PASSPHRASE is empty")
+	}
+
+	stats := &backupStats{}
+	registerBackupMetrics(s.metrics, stats)
+
+	go backups(ctx, snapshotter, schedule, opts, stats)
+
+	return nil
+}
+
+// backupStats are the results of scheduled backups for metrics.
+type backupStats struct {
+	lastSuccess atomic.Int64
+	failures    atomic.Int64
+}
+
+// backups writes a snapshot each time the schedule fires.
+func backups(ctx context.Context, storage passwdRepository.Snapshotter, schedule cron.Schedule, opts backup.Opts, stats *backupStats) {
+	l := logger.GetInstance()
+
+	for {
+		next := schedule.Next(time.Now())
+		if next.IsZero() {
+			l.Errorf("backup schedule %q never fires", schedule)
+			return
+		}
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		start := time.Now()
+		path, summary, err := backup.Create(ctx, storage, opts)
+		if err != nil {
+			stats.failures.Add(1)
+			l.Errorf("failed to backup storage: %s", err)
+			continue
+		}
+
+		stats.lastSuccess.Store(time.Now().Unix())
+		l.Infof("storage backed up to %s in %s: %s", path, time.Since(start).Round(time.Millisecond), summary)
+	}
+}
+
+func backupOpts(cfg *config.Config) backup.Opts {
+	return backup.Opts{
+		Dir:        cfg.Backup.Dir,
+		Passphrase: os.Getenv("BACKUP_PASSPHRASE"),
+		Keep:       cfg.Backup.Keep,
+	}
+}
+
+// makeBreaches opens the breached password corpus and loads it in the
+// background, passwords are checked against the hashes loaded so far.
+// It returns nil when the corpus isn't configured.
+func (s *Server) makeBreaches(ctx context.Context) (*breach.Corpus, error) {
+	cfg := s.Config.Breach
+	if cfg.Path == "" {
+		return nil, nil
+	}
+
+	kind, err := breach.ParseKind(cfg.Hash)
+	if err != nil {
+		return nil, err
+	}
+
+	corpus, err := breach.Open(cfg.Path, kind, cfg.MaxMemory<<20)
+	if err != nil {
+		return nil, err
+	}
+	registerBreachMetrics(s.metrics, corpus)
+
+	go loadBreaches(ctx, corpus)
+
+	return corpus, nil
+}
+
+func loadBreaches(ctx context.Context, corpus *breach.Corpus) {
+	l := logger.GetInstance()
+
+	start := time.Now()
+	if err := corpus.Load(ctx); err != nil {
+		l.Errorf("failed to load breached password corpus: %s", err)
+		return
+	}
+
+	stats := corpus.Stats()
+	l.Infof("loaded %d breached password hashes in %s, %d lines skipped, false positive rate %.4f%%",
+		stats.Loaded, time.Since(start).Round(time.Second), stats.Skipped, stats.FalsePositiveRate*100)
+}
+
+// purgeDrafts discards drafts of flows abandoned for longer than ttl.
+func purgeDrafts(ctx context.Context, usecase passwdUsecase.PasswdUsecase, ttl time.Duration) {
+	l := logger.GetInstance()
+
+	ticker := time.NewTicker(ttl)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		purged, err := usecase.PurgeDrafts(ctx, time.Now().Add(-ttl))
+		if err != nil {
+			l.Errorf("failed to purge drafts: %s", err)
+			continue
+		}
+
+		if purged > 0 {
+			l.Infof("purged %d abandoned drafts", purged)
+		}
+	}
+}
+
+// trashExpiryInterval is how often deleted items past the retention are purged
+const trashExpiryInterval = time.Hour
+
+// expireTrash deletes items kept in the trash for longer than retention.
+func expireTrash(ctx context.Context, usecase passwdUsecase.PasswdUsecase, retention time.Duration) {
+	l := logger.GetInstance()
+
+	ticker := time.NewTicker(trashExpiryInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		expired, err := usecase.ExpireTrash(ctx, time.Now().Add(-retention))
+		if err != nil {
+			l.Errorf("failed to expire trash: %s", err)
+			continue
+		}
+
+		if expired > 0 {
+			l.Infof("expired %d deleted items", expired)
+		}
+	}
+}
+
+func (s *Server) MakeStorage(ctx context.Context) (passwdRepository.Storage, error) {
+	switch s.Config.Storage.Driver {
+	case "bolt":
+		return s.makeBolt(ctx)
+	case "memory":
+		return passwdRepository.NewMemory(), nil
+	case "tarantool", "":
+		return s.makeTarantool()
+	default:
+		return nil, fmt.Errorf("unknown storage driver: %s", s.Config.Storage.Driver)
+	}
+}
+
+func (s *Server) makeBolt(ctx context.Context) (passwdRepository.Storage, error) {
+	cfg := s.Config.Storage.Bolt
+
+	b, err := passwdRepository.NewBolt(cfg.Path, time.Duration(cfg.Timeout)*time.Second)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.BackupPath != "" && cfg.BackupInterval > 0 {
+		go boltBackup(ctx, b, cfg.BackupPath, time.Duration(cfg.BackupInterval)*time.Minute)
+	}
+
+	return b, nil
+}
+
+func boltBackup(ctx context.Context, b *passwdRepository.Bolt, path string, interval time.Duration) {
+	l := logger.GetInstance()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if err := b.BackupFile(path); err != nil {
+			l.Errorf("failed to backup bolt storage: %s", err)
+			continue
+		}
+
+		l.Infof("bolt storage backed up to %s", path)
+	}
+}
+
+func (s *Server) makeTarantool() (passwdRepository.Storage, error) {
+	if s.Config.Tarantool.Migrate {
+		if err := migrate(s.Config); err != nil {
+			return nil, err
+		}
+	}
+
+	t, err := passwdRepository.NewTarantool(tarantoolAddrs(s.Config), tarantoolOpts(s.Config), passwdRepository.ReplicationOpts{
+		CheckInterval: time.Duration(s.Config.Tarantool.CheckInterval) * time.Second,
+		MaxLag:        time.Duration(s.Config.Tarantool.MaxReplicaLag) * time.Second,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+func tarantoolOpts(cfg *config.Config) tarantool.Opts {
+	return tarantool.Opts{
+		Timeout:       time.Duration(cfg.Tarantool.Timeout) * time.Second,
+		Reconnect:     time.Duration(cfg.Tarantool.Reconnect) * time.Second,
+		MaxReconnects: cfg.Tarantool.MaxReconnects,
+		User:          cfg.Tarantool.User,
+		Pass:          os.Getenv("TARANTOOL_PASSWORD"),
+	}
+}
+
+// tarantoolAddrs returns the configured instances, falling back to host and port.
+func tarantoolAddrs(cfg *config.Config) []string {
+	if len(cfg.Tarantool.Addrs) > 0 {
+		return cfg.Tarantool.Addrs
+	}
+
+	return []string{fmt.Sprintf("%s:%s", cfg.Tarantool.Host, cfg.Tarantool.Port)}
+}
+
+// connectTarantool returns a connector to the current master of the configured instances.
+func connectTarantool(cfg *config.Config) (tarantool.Connector, error) {
+	pool, err := connection_pool.Connect(tarantoolAddrs(cfg), tarantoolOpts(cfg))
+	if err != nil {
+		return nil, err
+	}
+
+	return connection_pool.NewConnectorAdapter(pool, connection_pool.RW), nil
+}
+
+// migrate applies pending migrations on startup. Migrations run on a separate
+// connection, so the storage connection loads the already migrated schema.
+func migrate(cfg *config.Config) error {
+	conn, err := connectTarantool(cfg)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	applied, err := migrations.New(conn, migrations.All).Up(0)
+	if errors.Is(err, migrations.ErrReadOnly) || errors.Is(err, connection_pool.ErrNoRwInstance) {
+		logger.GetInstance().Warn("skipping migrations: no writable tarantool instance")
+		return nil
+	}
+
+	for _, migration := range applied {
+		logger.GetInstance().Infof("applied migration %s", migration)
+	}
+
+	return err
+}
+
+// Migrate runs the migrate subcommand with args against the configured Tarantool.
+func Migrate(cfg *config.Config, args []string, out io.Writer) error {
+	conn, err := connectTarantool(cfg)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	return migrations.Command(conn, args, out)
+}
+
+// Backup runs the backup subcommand with args against the configured storage.
+func Backup(cfg *config.Config, args []string, out io.Writer) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	s := &Server{Config: cfg}
+
+	storage, err := s.MakeStorage(ctx)
+	if err != nil {
+		return err
+	}
+
+	if closer, ok := storage.(io.Closer); ok {
+		defer closer.Close()
+	}
+
+	snapshotter, ok := storage.(passwdRepository.Snapshotter)
+	if !ok {
+		return fmt.Errorf("storage driver %s can't be backed up", cfg.Storage.Driver)
+	}
+
+	return backup.Command(ctx, snapshotter, backupOpts(cfg), args, out)
+}
+
+// Rekey runs the rekey subcommand with args against the configured storage.
+func Rekey(cfg *config.Config, args []string, out io.Writer) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	s := &Server{Config: cfg}
+
+	storage, err := s.MakeStorage(ctx)
+	if err != nil {
+		return err
+	}
+
+	if closer, ok := storage.(io.Closer); ok {
+		defer closer.Close()
+	}
+
+	return rekey.Command(ctx, storage, os.Getenv("AES_KEY"), os.Getenv("NEW_AES_KEY"), args, out)
+}
@@ -0,0 +1,267 @@
+// Package bitwarden reads and writes the JSON exports of Bitwarden, in
+// plaintext or protected by a password.
+//
+// A password protected export holds the plaintext export encrypted with
+// AES-256-CBC and HMAC-SHA256 under keys expanded with HKDF from the
+// PBKDF2-SHA256 or Argon2id key of the password. Written exports use
+// PBKDF2 with the iterations Bitwarden defaults to. Exports encrypted
+// with the key of a Bitwarden account can't be read without it.
+package bitwarden
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	// ErrFormat is returned for data that isn't a Bitwarden JSON export
+	// or is damaged
+	ErrFormat = errors.New("not a Bitwarden JSON export")
+	// ErrUnsupported is returned for exports encrypted with the key of
+	// an account and for unknown key derivations
+	ErrUnsupported = errors.New("unsupported Bitwarden export")
+	// ErrPassword is returned when a protected export can't be opened
+	// with the password
+	ErrPassword = errors.New("wrong password")
+)
+
+// ItemType is the type of a Bitwarden item.
+type ItemType int
+
+const (
+	TypeLogin      ItemType = 1
+	TypeSecureNote ItemType = 2
+	TypeCard       ItemType = 3
+	TypeIdentity   ItemType = 4
+)
+
+// FieldType is the type of a custom field.
+type FieldType int
+
+const (
+	FieldText    FieldType = 0
+	FieldHidden  FieldType = 1
+	FieldBoolean FieldType = 2
+	// FieldLinked fields show another value of the item, they have none
+	FieldLinked FieldType = 3
+)
+
+// Export is a plaintext export of a vault.
+type Export struct {
+	Encrypted bool     `json:"encrypted"`
+	Folders   []Folder `json:"folders"`
+	Items     []Item   `json:"items"`
+}
+
+// Folder is a folder items are in, it's flat: a nested folder is named
+// by its path, such as "Work/Servers".
+type Folder struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// Item is an item of any type, only the part of its type is set.
+type Item struct {
+	ID       string   `json:"id"`
+	FolderID *string  `json:"folderId"`
+	Type     ItemType `json:"type"`
+	Reprompt int      `json:"reprompt"`
+	Name     string   `json:"name"`
+	Notes    *string  `json:"notes"`
+	Favorite bool     `json:"favorite"`
+	Fields   []Field  `json:"fields,omitempty"`
+
+	Login      *Login      `json:"login,omitempty"`
+	SecureNote *SecureNote `json:"secureNote,omitempty"`
+	Card       *Card       `json:"card,omitempty"`
+	Identity   *Identity   `json:"identity,omitempty"`
+
+	// PasswordHistory are the previous passwords, the most recent first
+	PasswordHistory []Password `json:"passwordHistory"`
+	RevisionDate    *time.Time `json:"revisionDate,omitempty"`
+	CreationDate    *time.Time `json:"creationDate,omitempty"`
+	DeletedDate     *time.Time `json:"deletedDate,omitempty"`
+}
+
+// Field is a custom field of an item.
+type Field struct {
+	Name  string    `json:"name"`
+	Value *string   `json:"value"`
+	Type  FieldType `json:"type"`
+}
+
+// Login is the part of login items.
+type Login struct {
+	URIs     []URI   `json:"uris,omitempty"`
+	Username *string `json:"username"`
+	Password *string `json:"password"`
+	// TOTP is an otpauth URI, a base32 secret or a "steam://" secret
+	TOTP                 *string    `json:"totp"`
+	PasswordRevisionDate *time.Time `json:"passwordRevisionDate,omitempty"`
+}
+
+// URI is a website of a login.
+type URI struct {
+	Match *int   `json:"match"`
+	URI   string `json:"uri"`
+}
+
+// SecureNote is the part of secure notes, whose text are the notes of
+// the item.
+type SecureNote struct {
+	Type int `json:"type"`
+}
+
+// Card is the part of payment cards. ExpMonth is "1" to "12" and ExpYear
+// has four digits.
+type Card struct {
+	CardholderName *string `json:"cardholderName"`
+	Brand          *string `json:"brand"`
+	Number         *string `json:"number"`
+	ExpMonth       *string `json:"expMonth"`
+	ExpYear        *string `json:"expYear"`
+	Code           *string `json:"code"`
+}
+
+// Identity is the part of identities.
+type Identity struct {
+	Title          *string `json:"title"`
+	FirstName      *string `json:"firstName"`
+	MiddleName     *string `json:"middleName"`
+	LastName       *string `json:"lastName"`
+	Address1       *string `json:"address1"`
+	Address2       *string `json:"address2"`
+	Address3       *string `json:"address3"`
+	City           *string `json:"city"`
+	State          *string `json:"state"`
+	PostalCode     *string `json:"postalCode"`
+	Country        *string `json:"country"`
+	Company        *string `json:"company"`
+	Email          *string `json:"email"`
+	Phone          *string `json:"phone"`
+	SSN            *string `json:"ssn"`
+	Username       *string `json:"username"`
+	PassportNumber *string `json:"passportNumber"`
+	LicenseNumber  *string `json:"licenseNumber"`
+}
+
+// Password is a previous password, LastUsedDate is when it was replaced.
+type Password struct {
+	LastUsedDate time.Time `json:"lastUsedDate"`
+	Password     string    `json:"password"`
+}
+
+// Str returns a pointer to s, nil if it's empty, as Bitwarden writes
+// missing values as null.
+func Str(s string) *string {
+	if s == "" {
+		return nil
+	}
+
+	return &s
+}
+
+// Value returns the string s points to, empty if it's nil.
+func Value(s *string) string {
+	if s == nil {
+		return ""
+	}
+
+	return *s
+}
+
+// envelope has what tells the kinds of export apart and the parameters
+// of password protected ones.
+type envelope struct {
+	Encrypted         bool            `json:"encrypted"`
+	PasswordProtected bool            `json:"passwordProtected"`
+	Items             json.RawMessage `json:"items,omitempty"`
+
+	Salt           string `json:"salt"`
+	KDFType        int    `json:"kdfType"`
+	KDFIterations  uint32 `json:"kdfIterations"`
+	KDFMemory      uint32 `json:"kdfMemory,omitempty"`
+	KDFParallelism uint32 `json:"kdfParallelism,omitempty"`
+	KeyValidation  string `json:"encKeyValidation_DO_NOT_EDIT"`
+	Data           string `json:"data"`
+}
+
+func readEnvelope(data []byte) (envelope, bool) {
+	var e envelope
+
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 || data[0] != '{' || json.Unmarshal(data, &e) != nil {
+		return envelope{}, false
+	}
+
+	return e, e.PasswordProtected || e.Encrypted || e.Items != nil
+}
+
+// IsExport reports whether data looks like a Bitwarden JSON export of
+// any kind.
+func IsExport(data []byte) bool {
+	_, ok := readEnvelope(data)
+	return ok
+}
+
+// IsProtected reports whether data is a password protected export.
+func IsProtected(data []byte) bool {
+	e, ok := readEnvelope(data)
+	return ok && e.PasswordProtected
+}
+
+// Read reads an export, decrypting it with the password if it's password
+// protected. The password of plaintext exports is ignored.
+func Read(data []byte, password string) (Export, error) {
+	e, ok := readEnvelope(data)
+	if !ok {
+		return Export{}, ErrFormat
+	}
+
+	switch {
+	case e.PasswordProtected:
+		plaintext, err := e.open(password)
+		if err != nil {
+			return Export{}, err
+		}
+
+		data = plaintext
+	case e.Encrypted:
+		return Export{}, fmt.Errorf("%w: it's encrypted with the key of an account, export it with a password", ErrUnsupported)
+	}
+
+	var export Export
+	if err := json.Unmarshal(data, &export); err != nil {
+		return Export{}, fmt.Errorf("%w: %s", ErrFormat, err)
+	}
+
+	return export, nil
+}
+
+// Write returns the plaintext export.
+func Write(export Export) ([]byte, error) {
+	export.Encrypted = false
+	return json.MarshalIndent(export, "", "  ")
+}
+
+// Protect returns the export protected by the password.
+func Protect(export Export, password string) ([]byte, error) {
+	return protect(export, password, defaultKDF)
+}
+
+func protect(export Export, password string, k kdf) ([]byte, error) {
+	plaintext, err := Write(export)
+	if err != nil {
+		return nil, err
+	}
+
+	e, err := seal(plaintext, password, k)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.MarshalIndent(e, "", "  ")
+}
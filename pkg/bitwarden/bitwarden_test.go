@@ -0,0 +1,199 @@
+package bitwarden
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// protected.json is plain.json protected by testdata/generate.py with
+// Python and OpenSSL, not by this package.
+const fixturePassword = "correct horse battery staple"
+
+func readFixture(t *testing.T, name string) []byte {
+	t.Helper()
+
+	data, err := os.ReadFile("testdata/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return data
+}
+
+func TestReadFixtures(t *testing.T) {
+	plain, err := Read(readFixture(t, "plain.json"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(plain.Folders) != 1 || plain.Folders[0].Name != "Work" || len(plain.Items) != 4 {
+		t.Fatalf("unexpected export %+v", plain)
+	}
+
+	github := plain.Items[0]
+	if github.Type != TypeLogin || Value(github.FolderID) != plain.Folders[0].ID || Value(github.Notes) != "2FA on" {
+		t.Fatalf("unexpected login %+v", github)
+	}
+
+	revised := time.Date(2023, 3, 1, 10, 0, 0, 0, time.UTC)
+	if github.Login == nil || Value(github.Login.Password) != "third" || len(github.Login.URIs) != 2 ||
+		github.Login.PasswordRevisionDate == nil || !github.Login.PasswordRevisionDate.Equal(revised) {
+		t.Fatalf("unexpected login %+v", github.Login)
+	}
+
+	history := []Password{
+		{LastUsedDate: revised, Password: "second"},
+		{LastUsedDate: time.Date(2023, 2, 1, 10, 0, 0, 0, time.UTC), Password: "first"},
+	}
+	if !reflect.DeepEqual(github.PasswordHistory, history) {
+		t.Fatalf("expected history %+v, got %+v", history, github.PasswordHistory)
+	}
+
+	if len(github.Fields) != 3 || github.Fields[2].Type != FieldLinked || github.Fields[2].Value != nil {
+		t.Fatalf("unexpected fields %+v", github.Fields)
+	}
+
+	if card := plain.Items[2].Card; card == nil || Value(card.Number) != "4111111111111111" || Value(card.ExpMonth) != "3" {
+		t.Fatalf("unexpected card %+v", card)
+	}
+
+	if IsProtected(readFixture(t, "plain.json")) {
+		t.Fatal("expected the plaintext export not to be protected")
+	}
+
+	data := readFixture(t, "protected.json")
+	if !IsExport(data) || !IsProtected(data) {
+		t.Fatal("expected the protected export to be recognized")
+	}
+
+	protected, err := Read(data, fixturePassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(protected, plain) {
+		t.Fatalf("expected %+v, got %+v", plain, protected)
+	}
+
+	if _, err = Read(data, "wrong"); !errors.Is(err, ErrPassword) {
+		t.Fatalf("expected ErrPassword, got %v", err)
+	}
+}
+
+func TestProtectRead(t *testing.T) {
+	created := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	folder := Folder{ID: "folder", Name: "Work"}
+	export := Export{
+		Folders: []Folder{folder},
+		Items: []Item{
+			{
+				ID:       "login",
+				FolderID: Str(folder.ID),
+				Type:     TypeLogin,
+				Name:     "GitHub",
+				Fields:   []Field{{Name: "PIN", Value: Str("1234"), Type: FieldHidden}},
+				Login: &Login{
+					URIs:     []URI{{URI: "https://github.com"}},
+					Username: Str("octocat"),
+					Password: Str("pässword\x00"),
+					TOTP:     Str("JBSWY3DPEHPK3PXP"),
+				},
+				PasswordHistory: []Password{{LastUsedDate: created, Password: "old"}},
+				CreationDate:    &created,
+				RevisionDate:    &created,
+			},
+			{ID: "note", Type: TypeSecureNote, Name: "Door", Notes: Str("code"), SecureNote: &SecureNote{}},
+		},
+	}
+
+	kdfs := map[string]kdf{
+		"PBKDF2":   {kind: kdfPBKDF2, iterations: 1000},
+		"Argon2id": {kind: kdfArgon2id, iterations: 1, memory: 1, parallelism: 2},
+	}
+
+	for name, k := range kdfs {
+		t.Run(name, func(t *testing.T) {
+			data, err := protect(export, "password", k)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if strings.Contains(string(data), "GitHub") {
+				t.Fatal("expected the export to be encrypted")
+			}
+
+			read, err := Read(data, "password")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(read, export) {
+				t.Fatalf("expected %+v, got %+v", export, read)
+			}
+
+			if _, err = Read(data, "wrong"); !errors.Is(err, ErrPassword) {
+				t.Fatalf("expected ErrPassword, got %v", err)
+			}
+		})
+	}
+}
+
+func TestReadInvalid(t *testing.T) {
+	data, err := protect(Export{}, "password", kdf{kind: kdfPBKDF2, iterations: 1000})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	change := func(f func(e *envelope)) []byte {
+		var e envelope
+		if err := json.Unmarshal(data, &e); err != nil {
+			t.Fatal(err)
+		}
+
+		f(&e)
+
+		changed, err := json.Marshal(e)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return changed
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+		err  error
+	}{
+		{"empty", nil, ErrFormat},
+		{"CSV", []byte("name,login_uri,login_username,login_password\n"), ErrFormat},
+		{"other JSON", []byte(`{"version": 1}`), ErrFormat},
+		{"items not a list", []byte(`{"encrypted": false, "items": 1}`), ErrFormat},
+		{"account encrypted", []byte(`{"encrypted": true, "items": [{"name": "2.abc|def|ghi"}]}`), ErrUnsupported},
+		{"damaged data", change(func(e *envelope) { e.Data = strings.Replace(e.Data, "|", "|A", 1) }), ErrFormat},
+		{"changed data", change(func(e *envelope) { e.Data = e.KeyValidation }), ErrFormat},
+		{"other encryption", change(func(e *envelope) { e.Data = "0" + e.Data[1:] }), ErrUnsupported},
+		{"unknown key derivation", change(func(e *envelope) { e.KDFType = 2 }), ErrUnsupported},
+		{"too many iterations", change(func(e *envelope) { e.KDFIterations = maxPBKDF2Iterations + 1 }), ErrUnsupported},
+		{
+			"too much memory",
+			change(func(e *envelope) {
+				e.KDFType, e.KDFIterations, e.KDFMemory, e.KDFParallelism = kdfArgon2id, 1, 1<<20, 1
+			}),
+			ErrUnsupported,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Read(tt.data, "password"); !errors.Is(err, tt.err) {
+				t.Fatalf("expected %v, got %v", tt.err, err)
+			}
+		})
+	}
+}
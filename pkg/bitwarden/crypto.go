@@ -0,0 +1,233 @@
+package bitwarden
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/hkdf"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// Key derivations of protected exports
+const (
+	kdfPBKDF2   = 0
+	kdfArgon2id = 1
+)
+
+// Limits of the key derivation of a read export, the highest Bitwarden
+// allows except memory, which is capped like the KeePass one.
+const (
+	maxPBKDF2Iterations = 2000000
+	maxArgon2Iterations = 10
+	maxArgon2Memory     = 512
+	maxArgon2Lanes      = 16
+)
+
+// encAESCBC256HMAC is the type of encrypted strings of protected exports
+const encAESCBC256HMAC = "2"
+
+// kdf is the key derivation of a protected export.
+type kdf struct {
+	kind       int
+	iterations uint32
+	// memory is in MB and parallelism the lanes of Argon2id
+	memory      uint32
+	parallelism uint32
+}
+
+// defaultKDF is PBKDF2 with the iterations Bitwarden defaults to, it
+// takes about two hundred milliseconds.
+var defaultKDF = kdf{kind: kdfPBKDF2, iterations: 600000}
+
+// keys derives the encryption and MAC keys of the password. The salt is
+// used as text, Argon2id uses its SHA-256.
+func (k kdf) keys(password, salt string) (encKey, macKey []byte, err error) {
+	var master []byte
+
+	switch k.kind {
+	case kdfPBKDF2:
+		if k.iterations == 0 || k.iterations > maxPBKDF2Iterations {
+			return nil, nil, fmt.Errorf("%w: %d PBKDF2 iterations", ErrUnsupported, k.iterations)
+		}
+
+		master = pbkdf2.Key([]byte(password), []byte(salt), int(k.iterations), 32, sha256.New)
+	case kdfArgon2id:
+		if k.iterations == 0 || k.iterations > maxArgon2Iterations || k.memory == 0 || k.memory > maxArgon2Memory ||
+			k.parallelism == 0 || k.parallelism > maxArgon2Lanes {
+			return nil, nil, fmt.Errorf("%w: Argon2id cost %d/%d MB/%d", ErrUnsupported, k.iterations, k.memory, k.parallelism)
+		}
+
+		hash := sha256.Sum256([]byte(salt))
+		master = argon2.IDKey([]byte(password), hash[:], k.iterations, k.memory*1024, uint8(k.parallelism), 32)
+	default:
+		return nil, nil, fmt.Errorf("%w: key derivation %d", ErrUnsupported, k.kind)
+	}
+
+	// The key is stretched with HKDF-Expand alone
+	encKey, macKey = make([]byte, 32), make([]byte, 32)
+	if _, err = io.ReadFull(hkdf.Expand(sha256.New, master, []byte("enc")), encKey); err != nil {
+		return nil, nil, err
+	}
+
+	if _, err = io.ReadFull(hkdf.Expand(sha256.New, master, []byte("mac")), macKey); err != nil {
+		return nil, nil, err
+	}
+
+	return encKey, macKey, nil
+}
+
+func (e envelope) kdf() kdf {
+	return kdf{kind: e.KDFType, iterations: e.KDFIterations, memory: e.KDFMemory, parallelism: e.KDFParallelism}
+}
+
+// open decrypts the plaintext export. The key validation is a random
+// value, the password is wrong if it can't be decrypted.
+func (e envelope) open(password string) ([]byte, error) {
+	encKey, macKey, err := e.kdf().keys(password, e.Salt)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err = decryptString(e.KeyValidation, encKey, macKey); err != nil {
+		return nil, err
+	}
+
+	return decryptString(e.Data, encKey, macKey)
+}
+
+// seal encrypts the plaintext export with the password.
+func seal(plaintext []byte, password string, k kdf) (envelope, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return envelope{}, err
+	}
+
+	e := envelope{
+		Encrypted:         true,
+		PasswordProtected: true,
+		Salt:              base64.StdEncoding.EncodeToString(salt),
+		KDFType:           k.kind,
+		KDFIterations:     k.iterations,
+		KDFMemory:         k.memory,
+		KDFParallelism:    k.parallelism,
+	}
+
+	encKey, macKey, err := k.keys(password, e.Salt)
+	if err != nil {
+		return envelope{}, err
+	}
+
+	validation, err := NewID()
+	if err != nil {
+		return envelope{}, err
+	}
+
+	if e.KeyValidation, err = encryptString([]byte(validation), encKey, macKey); err != nil {
+		return envelope{}, err
+	}
+
+	if e.Data, err = encryptString(plaintext, encKey, macKey); err != nil {
+		return envelope{}, err
+	}
+
+	return e, nil
+}
+
+// encryptString returns the encrypted string "2.iv|data|mac" of the
+// plaintext, encrypted with AES-256-CBC and authenticated with
+// HMAC-SHA256 of the IV and data, all in base64.
+func encryptString(plaintext, encKey, macKey []byte) (string, error) {
+	block, err := aes.NewCipher(encKey)
+	if err != nil {
+		return "", err
+	}
+
+	iv := make([]byte, aes.BlockSize)
+	if _, err = rand.Read(iv); err != nil {
+		return "", err
+	}
+
+	padding := aes.BlockSize - len(plaintext)%aes.BlockSize
+	data := append(append([]byte(nil), plaintext...), bytes.Repeat([]byte{byte(padding)}, padding)...)
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(data, data)
+
+	b64 := base64.StdEncoding.EncodeToString
+
+	return encAESCBC256HMAC + "." + b64(iv) + "|" + b64(data) + "|" + b64(stringMAC(macKey, iv, data)), nil
+}
+
+func decryptString(s string, encKey, macKey []byte) ([]byte, error) {
+	kind, rest, _ := strings.Cut(s, ".")
+	if kind != encAESCBC256HMAC {
+		return nil, fmt.Errorf("%w: encrypted string of type %q", ErrUnsupported, kind)
+	}
+
+	parts := strings.Split(rest, "|")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: malformed encrypted string", ErrFormat)
+	}
+
+	var decoded [3][]byte
+	for i, part := range parts {
+		var err error
+		if decoded[i], err = base64.StdEncoding.DecodeString(part); err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrFormat, err)
+		}
+	}
+
+	iv, data, mac := decoded[0], decoded[1], decoded[2]
+	if len(iv) != aes.BlockSize || len(data) == 0 || len(data)%aes.BlockSize != 0 {
+		return nil, fmt.Errorf("%w: malformed encrypted string", ErrFormat)
+	}
+
+	if !hmac.Equal(mac, stringMAC(macKey, iv, data)) {
+		return nil, ErrPassword
+	}
+
+	block, err := aes.NewCipher(encKey)
+	if err != nil {
+		return nil, err
+	}
+
+	plaintext := make([]byte, len(data))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(plaintext, data)
+
+	padding := int(plaintext[len(plaintext)-1])
+	if padding == 0 || padding > aes.BlockSize ||
+		!bytes.Equal(plaintext[len(plaintext)-padding:], bytes.Repeat([]byte{byte(padding)}, padding)) {
+		return nil, fmt.Errorf("%w: invalid padding", ErrFormat)
+	}
+
+	return plaintext[:len(plaintext)-padding], nil
+}
+
+func stringMAC(macKey, iv, data []byte) []byte {
+	mac := hmac.New(sha256.New, macKey)
+	mac.Write(iv)
+	mac.Write(data)
+
+	return mac.Sum(nil)
+}
+
+// NewID returns a random version 4 UUID, as Bitwarden ids of items and
+// folders are.
+func NewID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
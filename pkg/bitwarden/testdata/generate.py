@@ -0,0 +1,65 @@
+#!/usr/bin/env python3
+"""Writes protected.json, plain.json protected by a password, with Python's
+hashlib and the OpenSSL command line, independently of the Go package.
+
+The key is derived with PBKDF2 and few iterations to keep the tests fast.
+
+    python3 generate.py
+"""
+
+import base64
+import hashlib
+import hmac
+import json
+import os
+import subprocess
+import uuid
+
+PASSWORD = "correct horse battery staple"
+ITERATIONS = 5000
+
+
+def hkdf_expand(prk, info):
+    # One block is the 32 bytes of a key
+    return hmac.new(prk, info + b"\x01", hashlib.sha256).digest()
+
+
+def encrypt(plaintext, enc_key, mac_key):
+    iv = os.urandom(16)
+    data = subprocess.run(
+        ["openssl", "enc", "-aes-256-cbc", "-K", enc_key.hex(), "-iv", iv.hex()],
+        input=plaintext, capture_output=True, check=True,
+    ).stdout
+    mac = hmac.new(mac_key, iv + data, hashlib.sha256).digest()
+    b64 = lambda b: base64.b64encode(b).decode()
+    return f"2.{b64(iv)}|{b64(data)}|{b64(mac)}"
+
+
+def main():
+    here = os.path.dirname(os.path.abspath(__file__))
+    with open(os.path.join(here, "plain.json"), "rb") as f:
+        plaintext = f.read()
+
+    salt = base64.b64encode(os.urandom(16)).decode()
+    master = hashlib.pbkdf2_hmac("sha256", PASSWORD.encode(), salt.encode(), ITERATIONS, 32)
+    enc_key, mac_key = hkdf_expand(master, b"enc"), hkdf_expand(master, b"mac")
+
+    export = {
+        "encrypted": True,
+        "passwordProtected": True,
+        "salt": salt,
+        "kdfType": 0,
+        "kdfIterations": ITERATIONS,
+        "kdfMemory": None,
+        "kdfParallelism": None,
+        "encKeyValidation_DO_NOT_EDIT": encrypt(str(uuid.uuid4()).encode(), enc_key, mac_key),
+        "data": encrypt(plaintext, enc_key, mac_key),
+    }
+
+    with open(os.path.join(here, "protected.json"), "w") as f:
+        json.dump(export, f, indent=2)
+        f.write("\n")
+
+
+if __name__ == "__main__":
+    main()
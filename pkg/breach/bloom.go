@@ -0,0 +1,98 @@
+package breach
+
+import (
+	"encoding/binary"
+	"math"
+	"sync/atomic"
+)
+
+// falsePositiveRate is the rate filters are sized for when memory allows
+const falsePositiveRate = 0.001
+
+// Filter is a Bloom filter of password hashes. Hashes are already uniformly
+// distributed, so bit positions are taken from the hash itself. Add and
+// Contains are safe to call concurrently, so a filter can be queried while
+// it's loaded.
+type Filter struct {
+	words []uint64
+	bits  uint64
+	k     uint64
+}
+
+// NewFilter returns a filter for about n hashes using at most maxBytes.
+// When the limit is lower than n needs, more passwords are falsely
+// reported as breached, see FalsePositiveRate.
+func NewFilter(n int, maxBytes int) *Filter {
+	if n < 1 {
+		n = 1
+	}
+
+	bits := uint64(math.Ceil(-float64(n) * math.Log(falsePositiveRate) / (math.Ln2 * math.Ln2)))
+	if limit := uint64(maxBytes) * 8; maxBytes > 0 && bits > limit {
+		bits = limit
+	}
+
+	// Whole words, at least one
+	words := (bits + 63) / 64
+	if words == 0 {
+		words = 1
+	}
+	bits = words * 64
+
+	k := uint64(math.Round(float64(bits) / float64(n) * math.Ln2))
+	if k < 1 {
+		k = 1
+	}
+	if k > 16 {
+		k = 16
+	}
+
+	return &Filter{words: make([]uint64, words), bits: bits, k: k}
+}
+
+// Bytes returns the memory used by the filter bits.
+func (f *Filter) Bytes() int {
+	return len(f.words) * 8
+}
+
+// FalsePositiveRate estimates the rate after n hashes were added.
+func (f *Filter) FalsePositiveRate(n int) float64 {
+	return math.Pow(1-math.Exp(-float64(f.k)*float64(n)/float64(f.bits)), float64(f.k))
+}
+
+// Add adds a hash of at least 16 bytes.
+func (f *Filter) Add(hash []byte) {
+	h1, h2 := split(hash)
+
+	for i := uint64(0); i < f.k; i++ {
+		bit := (h1 + i*h2) % f.bits
+		word, mask := &f.words[bit/64], uint64(1)<<(bit%64)
+
+		for {
+			old := atomic.LoadUint64(word)
+			if old&mask != 0 || atomic.CompareAndSwapUint64(word, old, old|mask) {
+				break
+			}
+		}
+	}
+}
+
+// Contains reports whether the hash was probably added.
+func (f *Filter) Contains(hash []byte) bool {
+	h1, h2 := split(hash)
+
+	for i := uint64(0); i < f.k; i++ {
+		bit := (h1 + i*h2) % f.bits
+		if atomic.LoadUint64(&f.words[bit/64])&(uint64(1)<<(bit%64)) == 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// split derives the two hashes of double hashing. The second is made odd,
+// so it's never zero and the k positions don't collapse into one.
+func split(hash []byte) (uint64, uint64) {
+	return binary.BigEndian.Uint64(hash[0:8]), binary.BigEndian.Uint64(hash[8:16]) | 1
+}
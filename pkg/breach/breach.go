@@ -0,0 +1,252 @@
+// Package breach checks passwords against a local corpus of breached
+// password hashes, such as a Have I Been Pwned dump, without network calls.
+//
+// The corpus is a file with a hash per line or a directory of range files
+// named by the first 5 hex digits of their hashes, with the rest of a hash
+// per line, as the HIBP downloader writes them. Lines may end with
+// ":count", which is ignored. Hashes are streamed into a Bloom filter, so
+// the memory used doesn't depend on the size of the corpus.
+package breach
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"unicode/utf16"
+
+	"golang.org/x/crypto/md4"
+)
+
+// Kind is the hash function of a corpus.
+type Kind string
+
+const (
+	SHA1 Kind = "sha1"
+	NTLM Kind = "ntlm"
+)
+
+// rangePrefix is the length of the hash prefix naming range files
+const rangePrefix = 5
+
+// bytesPerHash estimates the number of hashes from the corpus size:
+// 35 to 40 hex digits, a count and a line break
+const bytesPerHash = 40
+
+var ErrUnknownKind = errors.New("unknown hash kind")
+
+// ParseKind returns the kind by name, case-insensitive.
+func ParseKind(name string) (Kind, error) {
+	switch kind := Kind(strings.ToLower(name)); kind {
+	case SHA1, NTLM:
+		return kind, nil
+	default:
+		return "", fmt.Errorf("%w: %s", ErrUnknownKind, name)
+	}
+}
+
+// Hash returns the hash of the password as stored in a corpus of the kind.
+func (k Kind) Hash(password string) []byte {
+	if k == NTLM {
+		h := md4.New()
+		for _, c := range utf16.Encode([]rune(password)) {
+			h.Write([]byte{byte(c), byte(c >> 8)})
+		}
+
+		return h.Sum(nil)
+	}
+
+	sum := sha1.Sum([]byte(password))
+
+	return sum[:]
+}
+
+func (k Kind) size() int {
+	if k == NTLM {
+		return md4.Size
+	}
+
+	return sha1.Size
+}
+
+// Corpus is a set of breached password hashes, usable while it's loaded.
+type Corpus struct {
+	path   string
+	kind   Kind
+	filter *Filter
+
+	loaded  atomic.Int64
+	skipped atomic.Int64
+	done    atomic.Bool
+}
+
+// Open sizes the filter of the corpus at path, a file or a directory of
+// range files, using at most maxBytes. Hashes are read by Load.
+func Open(path string, kind Kind, maxBytes int) (*Corpus, error) {
+	size, err := corpusSize(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Corpus{
+		path:   path,
+		kind:   kind,
+		filter: NewFilter(int(size/bytesPerHash), maxBytes),
+	}, nil
+}
+
+func corpusSize(path string) (int64, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, err
+	}
+
+	if !info.IsDir() {
+		return info.Size(), nil
+	}
+
+	var size int64
+	err = filepath.WalkDir(path, func(_ string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		size += info.Size()
+
+		return nil
+	})
+
+	return size, err
+}
+
+// Load streams the hashes into the filter until done or ctx is cancelled.
+// Passwords are checked against the hashes loaded so far.
+func (c *Corpus) Load(ctx context.Context) error {
+	info, err := os.Stat(c.path)
+	if err != nil {
+		return err
+	}
+
+	if !info.IsDir() {
+		if err = c.loadFile(ctx, c.path, ""); err != nil {
+			return err
+		}
+
+		c.done.Store(true)
+
+		return nil
+	}
+
+	entries, err := os.ReadDir(c.path)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+
+		// 0A1B2.txt holds hashes starting with 0A1B2
+		prefix := strings.TrimSuffix(entry.Name(), filepath.Ext(entry.Name()))
+		if len(prefix) != rangePrefix {
+			continue
+		}
+
+		if err = c.loadFile(ctx, filepath.Join(c.path, entry.Name()), prefix); err != nil {
+			return err
+		}
+	}
+
+	c.done.Store(true)
+
+	return nil
+}
+
+func (c *Corpus) loadFile(ctx context.Context, path, prefix string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return c.load(ctx, file, prefix)
+}
+
+// load reads hashes, or suffixes of hashes starting with prefix, a line each.
+func (c *Corpus) load(ctx context.Context, r io.Reader, prefix string) error {
+	scanner := bufio.NewScanner(r)
+	hash := make([]byte, c.kind.size())
+
+	for n := 0; scanner.Scan(); n++ {
+		// Checking the context for every line would slow the loading down
+		if n%4096 == 0 {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+		}
+
+		line, _, _ := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if line == "" {
+			continue
+		}
+
+		if hex.DecodedLen(len(prefix+line)) != len(hash) {
+			c.skipped.Add(1)
+			continue
+		}
+
+		if _, err := hex.Decode(hash, []byte(prefix+line)); err != nil {
+			c.skipped.Add(1)
+			continue
+		}
+
+		c.filter.Add(hash)
+		c.loaded.Add(1)
+	}
+
+	return scanner.Err()
+}
+
+// Breached reports whether the password is probably in the corpus.
+// A nil corpus reports nothing.
+func (c *Corpus) Breached(password string) bool {
+	if c == nil {
+		return false
+	}
+
+	return c.filter.Contains(c.kind.Hash(password))
+}
+
+// Stats describe the loading of a corpus.
+type Stats struct {
+	Loaded  int64
+	Skipped int64
+	Done    bool
+	Bytes   int
+	// FalsePositiveRate is the estimated rate for the hashes loaded so far
+	FalsePositiveRate float64
+}
+
+func (c *Corpus) Stats() Stats {
+	loaded := c.loaded.Load()
+
+	return Stats{
+		Loaded:            loaded,
+		Skipped:           c.skipped.Load(),
+		Done:              c.done.Load(),
+		Bytes:             c.filter.Bytes(),
+		FalsePositiveRate: c.filter.FalsePositiveRate(int(loaded)),
+	}
+}
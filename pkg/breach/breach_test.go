@@ -0,0 +1,125 @@
+package breach
+
+import (
+	"context"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestHash(t *testing.T) {
+	tests := []struct {
+		kind Kind
+		hash string
+	}{
+		{SHA1, "5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8"},
+		{NTLM, "8846F7EAEE8FB117AD06BDD830B7586C"},
+	}
+
+	for _, tt := range tests {
+		if hash := strings.ToUpper(hex.EncodeToString(tt.kind.Hash("password"))); hash != tt.hash {
+			t.Errorf("%s: expected %s, got %s", tt.kind, tt.hash, hash)
+		}
+	}
+}
+
+func TestFilter(t *testing.T) {
+	f := NewFilter(1000, 0)
+
+	for i := 0; i < 1000; i++ {
+		f.Add(SHA1.Hash(strconv.Itoa(i)))
+	}
+
+	for i := 0; i < 1000; i++ {
+		if !f.Contains(SHA1.Hash(strconv.Itoa(i))) {
+			t.Fatalf("%d was added but isn't found", i)
+		}
+	}
+
+	falsePositives := 0
+	for i := 1000; i < 11000; i++ {
+		if f.Contains(SHA1.Hash(strconv.Itoa(i))) {
+			falsePositives++
+		}
+	}
+
+	// Sized for 0.1%
+	if falsePositives > 50 {
+		t.Fatalf("expected about 10 false positives of 10000, got %d", falsePositives)
+	}
+}
+
+func TestFilterMemoryLimit(t *testing.T) {
+	f := NewFilter(1000000, 1024)
+
+	if f.Bytes() != 1024 {
+		t.Fatalf("expected 1024 bytes, got %d", f.Bytes())
+	}
+}
+
+func TestLoadFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pwned.txt")
+
+	lines := []string{
+		"5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8:9545824",
+		"7C4A8D09CA3762AF61E59520943DC26494F8941B:37359195",
+		"not a hash",
+		"",
+	}
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\r\n")), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := Open(path, SHA1, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if err = c.Load(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if !c.Breached("password") || !c.Breached("123456") || c.Breached("correct horse battery staple") {
+		t.Fatal("unexpected breach check result")
+	}
+
+	if stats := c.Stats(); stats.Loaded != 2 || stats.Skipped != 1 || !stats.Done {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+}
+
+func TestLoadRanges(t *testing.T) {
+	dir := t.TempDir()
+
+	// HIBP range files of NTLM hashes
+	if err := os.WriteFile(filepath.Join(dir, "8846F.txt"), []byte("7EAEE8FB117AD06BDD830B7586C:1\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "README"), []byte("not a range\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := Open(dir, NTLM, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if err = c.Load(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if !c.Breached("password") || c.Breached("Password") {
+		t.Fatal("unexpected breach check result")
+	}
+}
+
+func TestNilCorpus(t *testing.T) {
+	var c *Corpus
+
+	if c.Breached("password") {
+		t.Fatal("expected a nil corpus to report nothing")
+	}
+}
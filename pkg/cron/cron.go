@@ -0,0 +1,195 @@
+// Package cron parses crontab schedules and finds the times they fire.
+//
+// A schedule has the five fields of crontab(5): minute, hour, day of month,
+// month and day of week, each "*", a number, a range "a-b" or a list of
+// them, optionally stepped with "/n". Sunday is 0 or 7 and names of months
+// and days aren't supported. As in cron, a time matches when the day of the
+// month or the day of the week matches if both are restricted. @hourly,
+// @daily, @weekly, @monthly and @yearly stand for their usual schedules.
+package cron
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrSyntax is returned for schedules that can't be parsed
+var ErrSyntax = errors.New("invalid cron schedule")
+
+var descriptors = map[string]string{
+	"@hourly":   "0 * * * *",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@weekly":   "0 0 * * 0",
+	"@monthly":  "0 0 1 * *",
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+}
+
+// field is a set of the values of a field as a bit mask.
+type field uint64
+
+func (f field) has(v int) bool {
+	return f&(1<<uint(v)) != 0
+}
+
+// Schedule is a parsed schedule.
+type Schedule struct {
+	minute, hour, dom, month, dow field
+	// anyDay is set when the day of the month or of the week is "*",
+	// then the other one alone restricts days
+	anyDay bool
+	spec   string
+}
+
+// Parse parses a schedule.
+func Parse(spec string) (Schedule, error) {
+	spec = strings.TrimSpace(spec)
+
+	fields := strings.Fields(spec)
+	if expanded, ok := descriptors[spec]; ok {
+		fields = strings.Fields(expanded)
+	}
+
+	if len(fields) != 5 {
+		return Schedule{}, fmt.Errorf("%w %q: expected 5 fields, got %d", ErrSyntax, spec, len(fields))
+	}
+
+	s := Schedule{spec: spec}
+	bounds := []struct {
+		f        *field
+		min, max int
+	}{
+		{&s.minute, 0, 59},
+		{&s.hour, 0, 23},
+		{&s.dom, 1, 31},
+		{&s.month, 1, 12},
+		{&s.dow, 0, 7},
+	}
+
+	for i, b := range bounds {
+		f, err := parseField(fields[i], b.min, b.max)
+		if err != nil {
+			return Schedule{}, fmt.Errorf("%w %q: %s", ErrSyntax, spec, err)
+		}
+		*b.f = f
+	}
+
+	// 7 is another Sunday
+	if s.dow.has(7) {
+		s.dow |= 1
+	}
+
+	s.anyDay = strings.HasPrefix(fields[2], "*") || strings.HasPrefix(fields[4], "*")
+
+	return s, nil
+}
+
+// parseField parses a comma separated list of values, ranges and steps.
+func parseField(text string, min, max int) (field, error) {
+	var f field
+
+	for _, part := range strings.Split(text, ",") {
+		span, stepText, stepped := strings.Cut(part, "/")
+
+		step := 1
+		if stepped {
+			var err error
+			if step, err = strconv.Atoi(stepText); err != nil || step < 1 {
+				return 0, fmt.Errorf("invalid step %q", stepText)
+			}
+		}
+
+		low, high := min, max
+		switch from, to, isRange := strings.Cut(span, "-"); {
+		case span == "*":
+		case isRange:
+			var err error
+			if low, err = parseValue(from, min, max); err != nil {
+				return 0, err
+			}
+
+			if high, err = parseValue(to, min, max); err != nil {
+				return 0, err
+			}
+
+			if low > high {
+				return 0, fmt.Errorf("invalid range %q", span)
+			}
+		default:
+			var err error
+			if low, err = parseValue(span, min, max); err != nil {
+				return 0, err
+			}
+
+			// "5/15" runs from 5 to the end, a single value otherwise
+			if !stepped {
+				high = low
+			}
+		}
+
+		for v := low; v <= high; v += step {
+			f |= 1 << uint(v)
+		}
+	}
+
+	return f, nil
+}
+
+func parseValue(text string, min, max int) (int, error) {
+	v, err := strconv.Atoi(text)
+	if err != nil || v < min || v > max {
+		return 0, fmt.Errorf("%q isn't between %d and %d", text, min, max)
+	}
+
+	return v, nil
+}
+
+// maxSearch bounds the search of Next, a schedule such as "0 0 30 2 *"
+// never fires
+const maxSearch = 5 * 366 * 24 * time.Hour
+
+// Next returns the first time after t the schedule fires, in the location
+// of t. It's the zero time if the schedule never fires. Times skipped by
+// a daylight saving change don't fire, repeated ones fire once.
+func (s Schedule) Next(t time.Time) time.Time {
+	loc := t.Location()
+	limit := t.Add(maxSearch)
+
+	t = t.Truncate(time.Minute).Add(time.Minute)
+
+	// Mismatched fields skip to the start of the next month, day or hour,
+	// time.Date normalizes overflows and DST gaps
+	for t.Before(limit) {
+		switch {
+		case !s.month.has(int(t.Month())):
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+		case !s.day(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+		case !s.hour.has(t.Hour()):
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+		case !s.minute.has(t.Minute()):
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+
+	return time.Time{}
+}
+
+func (s Schedule) day(t time.Time) bool {
+	dom, dow := s.dom.has(t.Day()), s.dow.has(int(t.Weekday()))
+	if s.anyDay {
+		return dom && dow
+	}
+
+	return dom || dow
+}
+
+func (s Schedule) String() string {
+	return s.spec
+}
@@ -0,0 +1,97 @@
+package cron
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestNext(t *testing.T) {
+	// A Wednesday
+	from := time.Date(2026, 10, 14, 10, 17, 30, 0, time.UTC)
+
+	tests := []struct {
+		spec string
+		want time.Time
+	}{
+		{"* * * * *", time.Date(2026, 10, 14, 10, 18, 0, 0, time.UTC)},
+		{"0 3 * * *", time.Date(2026, 10, 15, 3, 0, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2026, 10, 14, 10, 30, 0, 0, time.UTC)},
+		{"5/20 10 * * *", time.Date(2026, 10, 14, 10, 25, 0, 0, time.UTC)},
+		{"0 9-17/4 * * *", time.Date(2026, 10, 14, 13, 0, 0, 0, time.UTC)},
+		{"30 2 1,15 * *", time.Date(2026, 10, 15, 2, 30, 0, 0, time.UTC)},
+		{"0 0 * * 0", time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * 1 *", time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+		// Either day restriction matches when both are set
+		{"0 0 1 * 5", time.Date(2026, 10, 16, 0, 0, 0, 0, time.UTC)},
+		{"0 0 1-31/10 * 1", time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC)},
+		// Both have to match when one starts with "*"
+		{"0 0 */10 * 1", time.Date(2026, 12, 21, 0, 0, 0, 0, time.UTC)},
+		{"@daily", time.Date(2026, 10, 15, 0, 0, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2026, 10, 14, 11, 0, 0, 0, time.UTC)},
+		{"0 0 30 2 *", time.Time{}},
+	}
+
+	for _, tt := range tests {
+		s, err := Parse(tt.spec)
+		if err != nil {
+			t.Fatalf("%q: %v", tt.spec, err)
+		}
+
+		if got := s.Next(from); !got.Equal(tt.want) {
+			t.Errorf("%q: expected %s, got %s", tt.spec, tt.want, got)
+		}
+	}
+}
+
+func TestNextDST(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip(err)
+	}
+
+	s, err := Parse("30 2 * * *")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 02:30 doesn't exist on March 29, when clocks go forward
+	next := s.Next(time.Date(2026, 3, 28, 12, 0, 0, 0, berlin))
+	if want := time.Date(2026, 3, 30, 2, 30, 0, 0, berlin); !next.Equal(want) {
+		t.Fatalf("expected %s, got %s", want, next)
+	}
+
+	// 02:30 happens twice on October 25, when clocks go back
+	next = s.Next(time.Date(2026, 10, 24, 12, 0, 0, 0, berlin))
+	if next.Day() != 25 || next.Hour() != 2 || next.Minute() != 30 {
+		t.Fatalf("expected 02:30 on October 25, got %s", next)
+	}
+
+	if next = s.Next(next); next.Day() != 26 {
+		t.Fatalf("expected October 26, got %s", next)
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, spec := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"a * * * *",
+		"1,,2 * * * *",
+		"@reboot",
+	} {
+		if _, err := Parse(spec); !errors.Is(err, ErrSyntax) {
+			t.Errorf("%q: expected ErrSyntax, got %v", spec, err)
+		}
+	}
+}
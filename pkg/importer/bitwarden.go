@@ -0,0 +1,232 @@
+package importer
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"telegram-bot/pkg/bitwarden"
+)
+
+// BitwardenKindField is the custom field of Bitwarden secure notes
+// exported by the bot naming the kind of item, for the kinds Bitwarden
+// doesn't have.
+const BitwardenKindField = "telegram-bot.kind"
+
+// Fields of card entries, named like the fields of cards of the bot.
+const (
+	CardNumber = "number"
+	CardHolder = "holder"
+	// CardExpiry is written as MM/YY
+	CardExpiry = "expiry"
+	CardCVV    = "cvv"
+	CardBrand  = "brand"
+)
+
+func parseBitwarden(data []byte, password string) (File, error) {
+	export, err := bitwarden.Read(data, password)
+	switch {
+	case errors.Is(err, bitwarden.ErrPassword):
+		return File{}, ErrPassword
+	case errors.Is(err, bitwarden.ErrFormat), errors.Is(err, bitwarden.ErrUnsupported):
+		return File{Format: Bitwarden}, fmt.Errorf("%w: %s", ErrUnknownFormat, err)
+	case err != nil:
+		return File{}, err
+	}
+
+	folders := make(map[string]string, len(export.Folders))
+	for _, folder := range export.Folders {
+		folders[folder.ID] = folder.Name
+	}
+
+	file := File{Format: Bitwarden}
+
+	for _, item := range export.Items {
+		// Items in the trash
+		if item.DeletedDate != nil {
+			continue
+		}
+
+		e, ok := bitwardenEntry(item)
+		if !ok {
+			file.Skipped++
+			continue
+		}
+
+		if folder := folders[bitwarden.Value(item.FolderID)]; folder != "" {
+			e.Tags = []string{folder}
+		}
+
+		file.add(e)
+	}
+
+	return file, nil
+}
+
+// bitwardenEntry returns the entry of an item, false for types other
+// than logins, secure notes, cards and identities.
+func bitwardenEntry(item bitwarden.Item) (Entry, bool) {
+	e := Entry{
+		Name:    item.Name,
+		Notes:   bitwarden.Value(item.Notes),
+		Created: timeOf(item.CreationDate),
+		Updated: timeOf(item.RevisionDate),
+	}
+
+	for _, field := range item.Fields {
+		value := bitwarden.Value(field.Value)
+		if field.Type == bitwarden.FieldLinked || field.Name == "" || value == "" {
+			continue
+		}
+
+		if field.Name == BitwardenKindField {
+			e.Kind = Kind(value)
+			continue
+		}
+
+		e.setField(field.Name, value)
+	}
+
+	switch {
+	case item.Type == bitwarden.TypeLogin && item.Login != nil:
+		login := item.Login
+		e.Username = bitwarden.Value(login.Username)
+		e.Password = bitwarden.Value(login.Password)
+		e.OTP = bitwarden.Value(login.TOTP)
+
+		// The first URI is kept
+		if len(login.URIs) > 0 {
+			e.URL = login.URIs[0].URI
+		}
+
+		if login.PasswordRevisionDate != nil {
+			e.Updated = *login.PasswordRevisionDate
+		}
+
+		e.History = bitwardenHistory(item.PasswordHistory, e.Created)
+	case item.Type == bitwarden.TypeSecureNote:
+		if e.Kind == "" {
+			e.Kind = KindNote
+		}
+	case item.Type == bitwarden.TypeCard && item.Card != nil:
+		card := item.Card
+		e.Kind = KindCard
+		e.setField(CardNumber, bitwarden.Value(card.Number))
+		e.setField(CardHolder, bitwarden.Value(card.CardholderName))
+		e.setField(CardExpiry, cardExpiry(bitwarden.Value(card.ExpMonth), bitwarden.Value(card.ExpYear)))
+		e.setField(CardCVV, bitwarden.Value(card.Code))
+		e.setField(CardBrand, bitwarden.Value(card.Brand))
+	case item.Type == bitwarden.TypeIdentity && item.Identity != nil:
+		// The bot has no identities, they are notes with their fields
+		e.Kind = KindNote
+		for _, field := range identityFields(item.Identity) {
+			e.setField(field[0], field[1])
+		}
+	default:
+		return Entry{}, false
+	}
+
+	return e, true
+}
+
+// setField sets a custom field of the entry unless the value is empty.
+func (e *Entry) setField(name, value string) {
+	if value = strings.TrimSpace(value); value == "" {
+		return
+	}
+
+	if e.Fields == nil {
+		e.Fields = make(map[string]string)
+	}
+	e.Fields[name] = value
+}
+
+// bitwardenHistory returns the previous passwords, Bitwarden keeps when
+// they were replaced, so a password was set when the one before it was
+// replaced or when the item was created.
+func bitwardenHistory(passwords []bitwarden.Password, created time.Time) []Version {
+	var history []Version
+
+	for i, p := range passwords {
+		if p.Password == "" {
+			continue
+		}
+
+		v := Version{Password: p.Password, Updated: created, Replaced: p.LastUsedDate}
+		if i+1 < len(passwords) {
+			v.Updated = passwords[i+1].LastUsedDate
+		}
+
+		history = append(history, v)
+	}
+
+	return history
+}
+
+// cardExpiry returns the MM/YY expiry of a card, empty unless both the
+// month and the year are valid.
+func cardExpiry(month, year string) string {
+	m, err := strconv.Atoi(strings.TrimSpace(month))
+	if err != nil || m < 1 || m > 12 {
+		return ""
+	}
+
+	y, err := strconv.Atoi(strings.TrimSpace(year))
+	if err != nil || y < 0 {
+		return ""
+	}
+
+	return fmt.Sprintf("%02d/%02d", m, y%100)
+}
+
+// SplitCardExpiry splits an MM/YY expiry into the month "1" to "12" and the
+// four digit year Bitwarden writes, both empty if it's not valid.
+func SplitCardExpiry(expiry string) (month, year string) {
+	mm, yy, ok := strings.Cut(expiry, "/")
+
+	m, err := strconv.Atoi(mm)
+	if !ok || err != nil || m < 1 || m > 12 {
+		return "", ""
+	}
+
+	y, err := strconv.Atoi(yy)
+	if err != nil || y < 0 || y > 99 {
+		return "", ""
+	}
+
+	return strconv.Itoa(m), strconv.Itoa(2000 + y)
+}
+
+// identityFields returns the titles and values of an identity.
+func identityFields(id *bitwarden.Identity) [][2]string {
+	return [][2]string{
+		{"Title", bitwarden.Value(id.Title)},
+		{"First name", bitwarden.Value(id.FirstName)},
+		{"Middle name", bitwarden.Value(id.MiddleName)},
+		{"Last name", bitwarden.Value(id.LastName)},
+		{"Username", bitwarden.Value(id.Username)},
+		{"Company", bitwarden.Value(id.Company)},
+		{"Email", bitwarden.Value(id.Email)},
+		{"Phone", bitwarden.Value(id.Phone)},
+		{"Address 1", bitwarden.Value(id.Address1)},
+		{"Address 2", bitwarden.Value(id.Address2)},
+		{"Address 3", bitwarden.Value(id.Address3)},
+		{"City", bitwarden.Value(id.City)},
+		{"State", bitwarden.Value(id.State)},
+		{"Postal code", bitwarden.Value(id.PostalCode)},
+		{"Country", bitwarden.Value(id.Country)},
+		{"SSN", bitwarden.Value(id.SSN)},
+		{"Passport number", bitwarden.Value(id.PassportNumber)},
+		{"License number", bitwarden.Value(id.LicenseNumber)},
+	}
+}
+
+func timeOf(t *time.Time) time.Time {
+	if t == nil {
+		return time.Time{}
+	}
+
+	return *t
+}
@@ -0,0 +1,125 @@
+package importer
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseBitwarden(t *testing.T) {
+	at := func(month time.Month, day int) time.Time { return time.Date(2023, month, day, 10, 0, 0, 0, time.UTC) }
+
+	want := []Entry{
+		{
+			Kind:     KindLogin,
+			Name:     "GitHub",
+			Username: "octocat",
+			Password: "third",
+			URL:      "https://github.com/login",
+			Notes:    "2FA on",
+			OTP:      "otpauth://totp/GitHub:octocat?secret=JBSWY3DPEHPK3PXP&issuer=GitHub",
+			Tags:     []string{"Work"},
+			Fields:   map[string]string{"PIN": "1234", "Recovery": "on"},
+			Created:  at(1, 1),
+			Updated:  at(3, 1),
+			History: []Version{
+				{Password: "second", Updated: at(2, 1), Replaced: at(3, 1)},
+				{Password: "first", Updated: at(1, 1), Replaced: at(2, 1)},
+			},
+		},
+		{Kind: KindNote, Name: "Door", Notes: "code 1234", Created: at(1, 1), Updated: at(1, 1)},
+		{
+			Kind: KindCard,
+			Name: "Visa",
+			Tags: []string{"Work"},
+			Fields: map[string]string{
+				CardNumber: "4111111111111111",
+				CardHolder: "Jane Doe",
+				CardExpiry: "03/27",
+				CardCVV:    "123",
+				CardBrand:  "Visa",
+			},
+			Created: at(1, 1),
+			Updated: at(1, 1),
+		},
+		{
+			Kind: KindNote,
+			Name: "Me",
+			Fields: map[string]string{
+				"Title":           "Ms",
+				"First name":      "Jane",
+				"Last name":       "Doe",
+				"City":            "Berlin",
+				"Country":         "DE",
+				"Email":           "jane@example.com",
+				"Passport number": "C01X00T47",
+			},
+			Created: at(1, 1),
+			Updated: at(1, 1),
+		},
+	}
+
+	plain, err := os.ReadFile("../bitwarden/testdata/plain.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := Parse(plain)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if file.Format != Bitwarden || !reflect.DeepEqual(file.Entries, want) {
+		t.Fatalf("expected %+v, got %s %+v", want, file.Format, file.Entries)
+	}
+
+	protected, err := os.ReadFile("../bitwarden/testdata/protected.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if file, err = Parse(protected); file.Format != Bitwarden || !errors.Is(err, ErrPasswordRequired) {
+		t.Fatalf("expected a Bitwarden file and ErrPasswordRequired, got %s and %v", file.Format, err)
+	}
+
+	if _, err = ParseWithPassword(protected, "wrong"); !errors.Is(err, ErrPassword) {
+		t.Fatalf("expected ErrPassword, got %v", err)
+	}
+
+	if file, err = ParseWithPassword(protected, "correct horse battery staple"); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(file.Entries, want) {
+		t.Fatalf("expected %+v, got %+v", want, file.Entries)
+	}
+
+	if _, err = Parse([]byte(`{"encrypted": true, "items": []}`)); !errors.Is(err, ErrUnknownFormat) {
+		t.Fatalf("expected ErrUnknownFormat for an export encrypted with an account key, got %v", err)
+	}
+}
+
+func TestCardExpiry(t *testing.T) {
+	tests := []struct {
+		expiry, month, year string
+	}{
+		{"03/27", "3", "2027"},
+		{"12/30", "12", "2030"},
+		{"13/27", "", ""},
+		{"2027-03", "", ""},
+		{"", "", ""},
+	}
+
+	for _, tt := range tests {
+		month, year := SplitCardExpiry(tt.expiry)
+		if month != tt.month || year != tt.year {
+			t.Errorf("SplitCardExpiry(%q) = %q, %q, expected %q, %q", tt.expiry, month, year, tt.month, tt.year)
+		}
+
+		if tt.month != "" && cardExpiry(month, year) != tt.expiry {
+			t.Errorf("cardExpiry(%q, %q) = %q, expected %q", month, year, cardExpiry(month, year), tt.expiry)
+		}
+	}
+}
@@ -0,0 +1,217 @@
+package importer
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// header finds the columns of a CSV row by name, case-insensitive.
+type header map[string]int
+
+func (h header) has(names ...string) bool {
+	for _, name := range names {
+		if _, ok := h[name]; !ok {
+			return false
+		}
+	}
+
+	return true
+}
+
+// get returns the value of the first named column the header has.
+func (h header) get(row []string, names ...string) string {
+	for _, name := range names {
+		if i, ok := h[name]; ok && i < len(row) {
+			return strings.TrimSpace(row[i])
+		}
+	}
+
+	return ""
+}
+
+// detectCSV returns the format that writes the header and the function
+// reading its rows.
+func detectCSV(h header) (Format, func(*File, header, []string), bool) {
+	switch {
+	case h.has("login_uri", "login_username", "login_password"):
+		return Bitwarden, bitwardenRow, true
+	case h.has("url", "username", "password", "httprealm"):
+		return Firefox, firefoxRow, true
+	case h.has("group", "title", "username", "password"):
+		return KeePassXC, keepassRow, true
+	case h.has("title", "password"):
+		return OnePass, onePasswordRow, true
+	case h.has("name", "url", "username", "password"):
+		return Chrome, chromeRow, true
+	default:
+		return "", nil, false
+	}
+}
+
+func parseCSV(data []byte) (File, error) {
+	r := csv.NewReader(bytes.NewReader(data))
+	r.FieldsPerRecord = -1
+	r.LazyQuotes = true
+
+	names, err := r.Read()
+	if errors.Is(err, io.EOF) {
+		return File{}, fmt.Errorf("%w: the file is empty", ErrUnknownFormat)
+	}
+
+	if err != nil {
+		return File{}, fmt.Errorf("%w: %s", ErrUnknownFormat, err)
+	}
+
+	h := make(header, len(names))
+	for i, name := range names {
+		h[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+
+	format, readRow, ok := detectCSV(h)
+	if !ok {
+		return File{}, fmt.Errorf("%w: unexpected columns %s", ErrUnknownFormat, strings.Join(names, ", "))
+	}
+
+	file := File{Format: format}
+
+	for {
+		row, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		if err != nil {
+			return File{}, err
+		}
+
+		readRow(&file, h, row)
+	}
+
+	return file, nil
+}
+
+func chromeRow(f *File, h header, row []string) {
+	f.add(Entry{
+		Name:     h.get(row, "name"),
+		URL:      h.get(row, "url"),
+		Username: h.get(row, "username"),
+		Password: h.get(row, "password"),
+		Notes:    h.get(row, "note", "notes"),
+	})
+}
+
+func firefoxRow(f *File, h header, row []string) {
+	f.add(Entry{
+		URL:      h.get(row, "url"),
+		Username: h.get(row, "username"),
+		Password: h.get(row, "password"),
+		Created:  unixMilli(h.get(row, "timecreated")),
+		Updated:  unixMilli(h.get(row, "timepasswordchanged")),
+	})
+}
+
+func bitwardenRow(f *File, h header, row []string) {
+	e := Entry{
+		Name:     h.get(row, "name"),
+		Username: h.get(row, "login_username"),
+		Password: h.get(row, "login_password"),
+		Notes:    h.get(row, "notes"),
+		OTP:      h.get(row, "login_totp"),
+		Fields:   parseFields(h.get(row, "fields")),
+	}
+
+	// Several URIs are separated by commas, the first one is kept
+	e.URL, _, _ = strings.Cut(h.get(row, "login_uri"), ",")
+
+	if folder := h.get(row, "folder"); folder != "" {
+		e.Tags = []string{folder}
+	}
+
+	if h.get(row, "type") == "note" {
+		e.Kind = KindNote
+	}
+
+	f.add(e)
+}
+
+func onePasswordRow(f *File, h header, row []string) {
+	f.add(Entry{
+		Name:     h.get(row, "title"),
+		URL:      h.get(row, "url", "website", "urls"),
+		Username: h.get(row, "username"),
+		Password: h.get(row, "password"),
+		Notes:    h.get(row, "notes", "notesplain"),
+		OTP:      h.get(row, "otpauth", "one-time password"),
+		Tags:     splitTags(h.get(row, "tags")),
+	})
+}
+
+func keepassRow(f *File, h header, row []string) {
+	e := Entry{
+		Name:     h.get(row, "title"),
+		URL:      h.get(row, "url"),
+		Username: h.get(row, "username"),
+		Password: h.get(row, "password"),
+		Notes:    h.get(row, "notes"),
+		OTP:      h.get(row, "totp"),
+		Created:  rfc3339(h.get(row, "created")),
+		Updated:  rfc3339(h.get(row, "last modified")),
+	}
+
+	// Groups are paths under the root group, the innermost one is the tag
+	group := h.get(row, "group")
+	if i := strings.LastIndex(group, "/"); i >= 0 {
+		group = group[i+1:]
+	}
+
+	if group != "" && group != "Root" {
+		e.Tags = []string{group}
+	}
+
+	f.add(e)
+}
+
+// parseFields reads custom fields written as "name: value" lines.
+func parseFields(text string) map[string]string {
+	var fields map[string]string
+
+	for _, line := range strings.Split(text, "\n") {
+		name, value, ok := strings.Cut(line, ":")
+		name, value = strings.TrimSpace(name), strings.TrimSpace(value)
+
+		if !ok || name == "" || value == "" {
+			continue
+		}
+
+		if fields == nil {
+			fields = make(map[string]string)
+		}
+		fields[name] = value
+	}
+
+	return fields
+}
+
+func unixMilli(value string) time.Time {
+	ms, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || ms <= 0 {
+		return time.Time{}
+	}
+
+	return time.UnixMilli(ms)
+}
+
+func rfc3339(value string) time.Time {
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}
+	}
+
+	return t
+}
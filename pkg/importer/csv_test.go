@@ -0,0 +1,145 @@
+package importer
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseCSV(t *testing.T) {
+	tests := []struct {
+		name   string
+		data   string
+		format Format
+		want   []Entry
+	}{
+		{
+			name: "chrome",
+			data: "name,url,username,password,note\n" +
+				"github.com,https://github.com/login,octocat,secret,work account\n" +
+				",https://www.example.com/,me,pw,\n",
+			format: Chrome,
+			want: []Entry{
+				{Kind: KindLogin, Name: "github.com", URL: "https://github.com/login", Username: "octocat", Password: "secret", Notes: "work account"},
+				{Kind: KindLogin, Name: "example.com", URL: "https://www.example.com/", Username: "me", Password: "pw"},
+			},
+		},
+		{
+			name: "firefox",
+			data: `"url","username","password","httpRealm","formActionOrigin","guid","timeCreated","timeLastUsed","timePasswordChanged"` + "\n" +
+				`"https://accounts.example.org","me@example.org","pw","","https://accounts.example.org","{1}","1600000000000","1700000000000","1650000000000"` + "\n",
+			format: Firefox,
+			want: []Entry{
+				{
+					Kind:     KindLogin,
+					Name:     "accounts.example.org",
+					URL:      "https://accounts.example.org",
+					Username: "me@example.org",
+					Password: "pw",
+					Created:  time.UnixMilli(1600000000000),
+					Updated:  time.UnixMilli(1650000000000),
+				},
+			},
+		},
+		{
+			name: "bitwarden",
+			data: "folder,favorite,type,name,notes,fields,reprompt,login_uri,login_username,login_password,login_totp\n" +
+				"Work,1,login,GitHub,,\"PIN: 1234\nQuestion: blue\",0,\"https://github.com,https://gist.github.com\",octocat,secret,JBSWY3DPEHPK3PXP\n" +
+				",,note,Wi-Fi at home,the password is on the router,,0,,,,\n",
+			format: Bitwarden,
+			want: []Entry{
+				{
+					Kind:     KindLogin,
+					Name:     "GitHub",
+					URL:      "https://github.com",
+					Username: "octocat",
+					Password: "secret",
+					OTP:      "JBSWY3DPEHPK3PXP",
+					Tags:     []string{"Work"},
+					Fields:   map[string]string{"PIN": "1234", "Question": "blue"},
+				},
+				{Kind: KindNote, Name: "Wi-Fi at home", Notes: "the password is on the router"},
+			},
+		},
+		{
+			name: "1password",
+			data: "Title,Url,Username,Password,OTPAuth,Favorite,Archived,Tags,Notes\n" +
+				"GitHub,https://github.com,octocat,secret,otpauth://totp/GitHub?secret=JBSWY3DPEHPK3PXP,false,false,\"work;dev\",notes\n",
+			format: OnePass,
+			want: []Entry{
+				{
+					Kind:     KindLogin,
+					Name:     "GitHub",
+					URL:      "https://github.com",
+					Username: "octocat",
+					Password: "secret",
+					OTP:      "otpauth://totp/GitHub?secret=JBSWY3DPEHPK3PXP",
+					Tags:     []string{"work", "dev"},
+					Notes:    "notes",
+				},
+			},
+		},
+		{
+			name: "keepassxc",
+			data: `"Group","Title","Username","Password","URL","Notes","TOTP","Icon","Last Modified","Created"` + "\n" +
+				`"Root/Work","GitHub","octocat","secret","https://github.com","","","0","2023-06-01T10:00:00Z","2022-01-01T09:00:00Z"` + "\n" +
+				`"Root","Bank","me","pw","","","","0","",""` + "\n",
+			format: KeePassXC,
+			want: []Entry{
+				{
+					Kind:     KindLogin,
+					Name:     "GitHub",
+					URL:      "https://github.com",
+					Username: "octocat",
+					Password: "secret",
+					Tags:     []string{"Work"},
+					Created:  time.Date(2022, 1, 1, 9, 0, 0, 0, time.UTC),
+					Updated:  time.Date(2023, 6, 1, 10, 0, 0, 0, time.UTC),
+				},
+				{Kind: KindLogin, Name: "Bank", Username: "me", Password: "pw"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file, err := Parse([]byte(tt.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if file.Format != tt.format {
+				t.Fatalf("expected format %s, got %s", tt.format, file.Format)
+			}
+
+			if !reflect.DeepEqual(file.Entries, tt.want) {
+				t.Fatalf("expected %+v, got %+v", tt.want, file.Entries)
+			}
+		})
+	}
+}
+
+func TestParseCSVSkipped(t *testing.T) {
+	data := "\xEF\xBB\xBFname,url,username,password\n" +
+		",,octocat,secret\n" +
+		"github.com,https://github.com,,\n" +
+		"gitlab.com,https://gitlab.com,me,pw\n"
+
+	file, err := Parse([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(file.Entries) != 1 || file.Entries[0].Name != "gitlab.com" || file.Skipped != 2 {
+		t.Fatalf("expected one entry and two skipped rows, got %+v", file)
+	}
+}
+
+func TestParseUnknown(t *testing.T) {
+	for _, data := range []string{"", "a,b,c\n1,2,3\n", "not a csv"} {
+		if _, err := Parse([]byte(data)); !errors.Is(err, ErrUnknownFormat) {
+			t.Errorf("%q: expected ErrUnknownFormat, got %v", data, err)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+// Package importer reads exports of other password managers into entries
+// that don't depend on the storage of the bot.
+//
+// CSV exports of Chrome and Edge, Firefox, Bitwarden, 1Password and
+// KeePassXC are recognized by their header row. KeePass databases are
+// recognized by their signature and JSON exports of Bitwarden by their
+// fields, both are read with their password if they have one. Exports of
+// the bot itself sealed with a passphrase (see pkg/sealed) are read with
+// the passphrase.
+package importer
+
+import (
+	"bytes"
+	"errors"
+	"net/url"
+	"strings"
+	"time"
+
+	"telegram-bot/pkg/bitwarden"
+	"telegram-bot/pkg/kdbx"
+	"telegram-bot/pkg/sealed"
+)
+
+// Format is the password manager that wrote a file.
+type Format string
+
+const (
+	Chrome    Format = "Chrome or Edge"
+	Firefox   Format = "Firefox"
+	Bitwarden Format = "Bitwarden"
+	OnePass   Format = "1Password"
+	KeePassXC Format = "KeePassXC"
+	KeePass   Format = "KeePass"
+	// Sealed is an export of the bot sealed with a passphrase
+	Sealed Format = "bot"
+)
+
+// Kind is the kind of an entry.
+type Kind string
+
+const (
+	KindLogin Kind = "login"
+	// KindNote entries only have a name and notes
+	KindNote Kind = "note"
+	// Kinds of the other items of the bot, which are only read from
+	// files it exported
+	KindCard  Kind = "card"
+	KindWiFi  Kind = "wifi"
+	KindToken Kind = "token"
+)
+
+var (
+	ErrUnknownFormat = errors.New("unknown file format")
+	// ErrPasswordRequired is returned by Parse for encrypted files, which
+	// are read by ParseWithPassword
+	ErrPasswordRequired = errors.New("the file is encrypted")
+	ErrPassword         = errors.New("wrong password")
+)
+
+// Entry is an item read from an export.
+type Entry struct {
+	Kind     Kind
+	Name     string
+	Username string
+	Password string
+	URL      string
+	Notes    string
+	// OTP is a TOTP secret as an otpauth URI or base32, as it was exported
+	OTP    string
+	Tags   []string
+	Fields map[string]string
+	// Created and Updated are zero when the export doesn't have them
+	Created time.Time
+	Updated time.Time
+	// History are the previous passwords, the most recent first
+	History []Version
+}
+
+// Version is a previous password of an entry, its times are zero when
+// the export doesn't have them.
+type Version struct {
+	Password string
+	Updated  time.Time
+	Replaced time.Time
+}
+
+// File is a parsed export.
+type File struct {
+	Format  Format
+	Entries []Entry
+	// Skipped counts rows without a name or anything to keep
+	Skipped int
+}
+
+// Parse detects the format of an export and reads its entries. Encrypted
+// files are returned with their format and ErrPasswordRequired.
+func Parse(data []byte) (File, error) {
+	if kdbx.IsKDBX(data) {
+		return File{Format: KeePass}, ErrPasswordRequired
+	}
+
+	if sealed.IsSealed(data) {
+		return File{Format: Sealed}, ErrPasswordRequired
+	}
+
+	data = bytes.TrimPrefix(data, []byte("\xEF\xBB\xBF"))
+
+	switch {
+	case bitwarden.IsProtected(data):
+		return File{Format: Bitwarden}, ErrPasswordRequired
+	case bitwarden.IsExport(data):
+		return parseBitwarden(data, "")
+	default:
+		return parseCSV(data)
+	}
+}
+
+// ParseWithPassword reads an encrypted export with its password, other
+// files are read as Parse does.
+func ParseWithPassword(data []byte, password string) (File, error) {
+	if kdbx.IsKDBX(data) {
+		return parseKeePass(data, password)
+	}
+
+	if sealed.IsSealed(data) {
+		return parseSealed(data, password)
+	}
+
+	if data = bytes.TrimPrefix(data, []byte("\xEF\xBB\xBF")); bitwarden.IsProtected(data) {
+		return parseBitwarden(data, password)
+	}
+
+	return Parse(data)
+}
+
+// add appends the entry to the file if it has a name and something to
+// keep, entries without a name are named by the host of their URL.
+func (f *File) add(e Entry) {
+	e.Name = strings.TrimSpace(e.Name)
+	if e.Name == "" {
+		e.Name = hostOf(e.URL)
+	}
+
+	if e.Kind == "" {
+		e.Kind = KindLogin
+	}
+
+	if e.Name == "" || e.Username == "" && e.Password == "" && e.Notes == "" && len(e.Fields) == 0 {
+		f.Skipped++
+		return
+	}
+
+	f.Entries = append(f.Entries, e)
+}
+
+// hostOf returns the host of a URL without "www.", empty if it has none.
+func hostOf(rawURL string) string {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil || u.Host == "" {
+		return ""
+	}
+
+	return strings.TrimPrefix(u.Hostname(), "www.")
+}
+
+// splitTags splits tags separated by commas or semicolons.
+func splitTags(text string) []string {
+	var tags []string
+	for _, tag := range strings.FieldsFunc(text, func(r rune) bool { return r == ',' || r == ';' }) {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+
+	return tags
+}
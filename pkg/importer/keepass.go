@@ -0,0 +1,125 @@
+package importer
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"telegram-bot/pkg/kdbx"
+)
+
+// KeePassKindKey is the custom data of KeePass entries exported by the
+// bot naming the kind of item, so they are imported as what they were.
+const KeePassKindKey = "telegram-bot.kind"
+
+// Strings of KeePass entries holding a TOTP secret: the otpauth URI of
+// KeePassXC and the base32 secret of KeePass 2.
+const (
+	keePassOTP       = "otp"
+	keePassOTPSecret = "TimeOtp-Secret-Base32"
+)
+
+func parseKeePass(data []byte, password string) (File, error) {
+	db, err := kdbx.Read(data, password)
+	switch {
+	case errors.Is(err, kdbx.ErrPassword):
+		return File{}, ErrPassword
+	case errors.Is(err, kdbx.ErrFormat), errors.Is(err, kdbx.ErrUnsupported):
+		return File{}, fmt.Errorf("%w: %s", ErrUnknownFormat, err)
+	case err != nil:
+		return File{}, err
+	}
+
+	file := File{Format: KeePass}
+	keePassGroup(&file, db.Root, "")
+
+	return file, nil
+}
+
+// keePassGroup adds the entries of the group and its subgroups. The
+// innermost group of an entry is one of its tags, entries of the root
+// group have none.
+func keePassGroup(f *File, g kdbx.Group, tag string) {
+	for _, e := range g.Entries {
+		f.add(keePassEntry(e, tag))
+	}
+
+	for _, sub := range g.Groups {
+		keePassGroup(f, sub, sub.Name)
+	}
+}
+
+func keePassEntry(e kdbx.Entry, tag string) Entry {
+	entry := Entry{
+		Kind:     Kind(e.CustomData[KeePassKindKey]),
+		Name:     e.Title,
+		Username: e.Username,
+		Password: e.Password,
+		URL:      e.URL,
+		Notes:    e.Notes,
+		OTP:      e.Fields[keePassOTP],
+		Created:  e.Created,
+	}
+
+	if tag != "" {
+		entry.Tags = append(entry.Tags, tag)
+	}
+
+	for _, t := range e.Tags {
+		if t != tag {
+			entry.Tags = append(entry.Tags, t)
+		}
+	}
+
+	if entry.OTP == "" {
+		entry.OTP = e.Fields[keePassOTPSecret]
+	}
+
+	for name, value := range e.Fields {
+		if name == keePassOTP || name == keePassOTPSecret {
+			continue
+		}
+
+		if entry.Fields == nil {
+			entry.Fields = make(map[string]string)
+		}
+		entry.Fields[name] = value
+	}
+
+	entry.History, entry.Updated = keePassHistory(e)
+
+	if entry.Kind == "" && entry.Username == "" && entry.Password == "" && entry.URL == "" && entry.Notes != "" {
+		entry.Kind = KindNote
+	}
+
+	return entry
+}
+
+// keePassHistory returns the previous passwords of the entry, the most
+// recent first, and when its password was set. KeePass keeps a version
+// of the entry for any change, the oldest first.
+func keePassHistory(e kdbx.Entry) ([]Version, time.Time) {
+	var history []Version
+
+	versions := append(append([]kdbx.Entry(nil), e.History...), e)
+	set := versions[0].Modified
+
+	for i := 1; i < len(versions); i++ {
+		previous := versions[i-1]
+		if versions[i].Password == previous.Password {
+			continue
+		}
+
+		if previous.Password != "" {
+			history = append([]Version{{
+				Password: previous.Password,
+				Updated:  set,
+				Replaced: versions[i].Modified,
+			}}, history...)
+		}
+
+		set = versions[i].Modified
+	}
+
+	return history, set
+}
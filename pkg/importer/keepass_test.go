@@ -0,0 +1,108 @@
+package importer
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"telegram-bot/pkg/kdbx"
+)
+
+func TestParseKeePass(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2023, 1, d, 0, 0, 0, 0, time.UTC) }
+
+	db := kdbx.Database{
+		Name: "Passwords",
+		Root: kdbx.Group{
+			Entries: []kdbx.Entry{{Title: "Bank", Username: "me", Password: "pw", Created: day(1), Modified: day(2)}},
+			Groups: []kdbx.Group{
+				{
+					Name: "Work",
+					Entries: []kdbx.Entry{
+						{
+							Title:    "GitHub",
+							Username: "octocat",
+							Password: "third",
+							URL:      "https://github.com",
+							Fields:   map[string]string{"otp": "otpauth://totp/GitHub?secret=JBSWY3DPEHPK3PXP", "PIN": "1234"},
+							Tags:     []string{"Work", "dev"},
+							Created:  day(1),
+							Modified: day(9),
+							History: []kdbx.Entry{
+								{Title: "GitHub", Password: "first", Modified: day(1)},
+								{Title: "GitHub", Password: "second", Modified: day(3)},
+								// Only the notes changed
+								{Title: "GitHub", Password: "second", Notes: "2FA", Modified: day(4)},
+								{Title: "GitHub", Password: "third", Modified: day(5)},
+							},
+						},
+						{Title: "Door", Notes: "code 1234", Created: day(1), Modified: day(1)},
+						{
+							Title:      "Visa",
+							Fields:     map[string]string{"number": "4111111111111111"},
+							CustomData: map[string]string{KeePassKindKey: "card"},
+							Created:    day(1),
+							Modified:   day(1),
+						},
+					},
+				},
+			},
+		},
+	}
+
+	data, err := kdbx.WriteCost(db, "password", kdbx.Cost{Iterations: 1, Memory: 64 << 10, Parallelism: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = Parse(data); !errors.Is(err, ErrPasswordRequired) {
+		t.Fatalf("expected ErrPasswordRequired, got %v", err)
+	}
+
+	if _, err = ParseWithPassword(data, "wrong"); !errors.Is(err, ErrPassword) {
+		t.Fatalf("expected ErrPassword, got %v", err)
+	}
+
+	file, err := ParseWithPassword(data, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []Entry{
+		{Kind: KindLogin, Name: "Bank", Username: "me", Password: "pw", Created: day(1), Updated: day(2)},
+		{
+			Kind:     KindLogin,
+			Name:     "GitHub",
+			Username: "octocat",
+			Password: "third",
+			URL:      "https://github.com",
+			OTP:      "otpauth://totp/GitHub?secret=JBSWY3DPEHPK3PXP",
+			Tags:     []string{"Work", "dev"},
+			Fields:   map[string]string{"PIN": "1234"},
+			Created:  day(1),
+			Updated:  day(5),
+			History: []Version{
+				{Password: "second", Updated: day(3), Replaced: day(5)},
+				{Password: "first", Updated: day(1), Replaced: day(3)},
+			},
+		},
+		{Kind: KindNote, Name: "Door", Notes: "code 1234", Tags: []string{"Work"}, Created: day(1), Updated: day(1)},
+		{
+			Kind:    KindCard,
+			Name:    "Visa",
+			Fields:  map[string]string{"number": "4111111111111111"},
+			Tags:    []string{"Work"},
+			Created: day(1),
+			Updated: day(1),
+		},
+	}
+
+	if file.Format != KeePass {
+		t.Fatalf("expected format %s, got %s", KeePass, file.Format)
+	}
+
+	if !reflect.DeepEqual(file.Entries, want) {
+		t.Fatalf("expected %+v, got %+v", want, file.Entries)
+	}
+}
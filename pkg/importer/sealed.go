@@ -0,0 +1,99 @@
+package importer
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"telegram-bot/pkg/sealed"
+)
+
+// sealedVersion is the newest version of exports of the bot read here
+const sealedVersion = 1
+
+// sealedExport is the JSON of an export of the bot sealed with a
+// passphrase, see models.Export. Times are Unix times, 0 if unknown.
+type sealedExport struct {
+	Version int          `json:"version"`
+	Items   []sealedItem `json:"items"`
+}
+
+type sealedItem struct {
+	Type      string            `json:"type"`
+	Name      string            `json:"name"`
+	Username  string            `json:"username"`
+	Password  string            `json:"password"`
+	URL       string            `json:"url"`
+	Notes     string            `json:"notes"`
+	Tags      []string          `json:"tags"`
+	Fields    map[string]string `json:"fields"`
+	OTP       string            `json:"otp"`
+	CreatedAt int64             `json:"created_at"`
+	UpdatedAt int64             `json:"updated_at"`
+	History   []struct {
+		Password   string `json:"password"`
+		UpdatedAt  int64  `json:"updated_at"`
+		ReplacedAt int64  `json:"replaced_at"`
+	} `json:"history"`
+}
+
+func parseSealed(data []byte, passphrase string) (File, error) {
+	plaintext, err := sealed.Open(data, passphrase)
+	switch {
+	case errors.Is(err, sealed.ErrPassphrase):
+		return File{}, ErrPassword
+	case errors.Is(err, sealed.ErrFormat):
+		return File{Format: Sealed}, fmt.Errorf("%w: %s", ErrUnknownFormat, err)
+	case err != nil:
+		return File{}, err
+	}
+
+	var export sealedExport
+	if err = json.Unmarshal(plaintext, &export); err != nil {
+		return File{Format: Sealed}, fmt.Errorf("%w: %s", ErrUnknownFormat, err)
+	}
+
+	if export.Version < 1 || export.Version > sealedVersion {
+		return File{Format: Sealed}, fmt.Errorf("%w: export version %d", ErrUnknownFormat, export.Version)
+	}
+
+	file := File{Format: Sealed}
+
+	for _, item := range export.Items {
+		e := Entry{
+			Kind:     Kind(item.Type),
+			Name:     item.Name,
+			Username: item.Username,
+			Password: item.Password,
+			URL:      item.URL,
+			Notes:    item.Notes,
+			OTP:      item.OTP,
+			Tags:     item.Tags,
+			Fields:   item.Fields,
+			Created:  unixTime(item.CreatedAt),
+			Updated:  unixTime(item.UpdatedAt),
+		}
+
+		for _, v := range item.History {
+			e.History = append(e.History, Version{
+				Password: v.Password,
+				Updated:  unixTime(v.UpdatedAt),
+				Replaced: unixTime(v.ReplacedAt),
+			})
+		}
+
+		file.add(e)
+	}
+
+	return file, nil
+}
+
+// unixTime returns the zero time for 0.
+func unixTime(sec int64) time.Time {
+	if sec == 0 {
+		return time.Time{}
+	}
+
+	return time.Unix(sec, 0).UTC()
+}
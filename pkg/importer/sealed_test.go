@@ -0,0 +1,83 @@
+package importer
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"telegram-bot/pkg/sealed"
+)
+
+func TestParseSealed(t *testing.T) {
+	plaintext := []byte(`{
+  "version": 1,
+  "exported_at": 1700000000,
+  "items": [
+    {
+      "type": "login",
+      "name": "GitHub",
+      "username": "octocat",
+      "password": "third",
+      "url": "https://github.com",
+      "tags": ["work"],
+      "otp": "otpauth://totp/GitHub:octocat?secret=JBSWY3DPEHPK3PXP&issuer=GitHub",
+      "created_at": 1600000000,
+      "updated_at": 1650000000,
+      "accessed_at": 1690000000,
+      "history": [{"password": "second", "updated_at": 1620000000, "replaced_at": 1650000000}]
+    },
+    {"type": "wifi", "name": "Home", "password": "hunter22", "fields": {"ssid": "home"}},
+    {"type": "note", "name": "Empty"}
+  ]
+}`)
+
+	want := []Entry{
+		{
+			Kind:     KindLogin,
+			Name:     "GitHub",
+			Username: "octocat",
+			Password: "third",
+			URL:      "https://github.com",
+			Tags:     []string{"work"},
+			OTP:      "otpauth://totp/GitHub:octocat?secret=JBSWY3DPEHPK3PXP&issuer=GitHub",
+			Created:  time.Unix(1600000000, 0).UTC(),
+			Updated:  time.Unix(1650000000, 0).UTC(),
+			History: []Version{
+				{Password: "second", Updated: time.Unix(1620000000, 0).UTC(), Replaced: time.Unix(1650000000, 0).UTC()},
+			},
+		},
+		{Kind: KindWiFi, Name: "Home", Password: "hunter22", Fields: map[string]string{"ssid": "home"}},
+	}
+
+	data, err := sealed.SealCost(plaintext, "correct horse battery staple", sealed.Cost{LogN: 10, R: 8, P: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := Parse(data)
+	if file.Format != Sealed || !errors.Is(err, ErrPasswordRequired) {
+		t.Fatalf("expected a sealed file and ErrPasswordRequired, got %s and %v", file.Format, err)
+	}
+
+	if _, err = ParseWithPassword(data, "wrong"); !errors.Is(err, ErrPassword) {
+		t.Fatalf("expected ErrPassword, got %v", err)
+	}
+
+	if file, err = ParseWithPassword(data, "correct horse battery staple"); err != nil {
+		t.Fatal(err)
+	}
+
+	if file.Format != Sealed || file.Skipped != 1 || !reflect.DeepEqual(file.Entries, want) {
+		t.Fatalf("expected %+v and 1 skipped, got %s %+v and %d skipped", want, file.Format, file.Entries, file.Skipped)
+	}
+
+	newer, err := sealed.SealCost([]byte(`{"version": 2, "items": []}`), "passphrase", sealed.Cost{LogN: 10, R: 8, P: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = ParseWithPassword(newer, "passphrase"); !errors.Is(err, ErrUnknownFormat) {
+		t.Fatalf("expected ErrUnknownFormat for a newer export, got %v", err)
+	}
+}
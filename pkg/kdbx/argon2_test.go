@@ -0,0 +1,33 @@
+package kdbx
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+
+	"golang.org/x/crypto/argon2"
+)
+
+func TestArgon2d(t *testing.T) {
+	// Test vector of RFC 9106
+	key := deriveKey(argon2d,
+		bytes.Repeat([]byte{1}, 32),
+		bytes.Repeat([]byte{2}, 16),
+		bytes.Repeat([]byte{3}, 8),
+		bytes.Repeat([]byte{4}, 12),
+		3, 32, 4, 32,
+	)
+
+	if want := "512b391b6f1162975371d30919734294f868e3be3984f3c1a13a4db9fabe4acb"; hex.EncodeToString(key) != want {
+		t.Fatalf("expected %s, got %x", want, key)
+	}
+}
+
+func TestArgon2id(t *testing.T) {
+	password, salt := []byte("password"), []byte("somesaltsomesalt")
+
+	got := deriveKey(argon2id, password, salt, nil, nil, 2, 256, 2, 32)
+	if want := argon2.IDKey(password, salt, 2, 256, 2, 32); !bytes.Equal(got, want) {
+		t.Fatalf("expected %x, got %x", want, got)
+	}
+}
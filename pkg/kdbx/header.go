@@ -0,0 +1,442 @@
+package kdbx
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/chacha20"
+	"golang.org/x/crypto/twofish"
+)
+
+// A KDBX 4 file is the signatures and version, the outer header, its
+// SHA-256 and HMAC-SHA-256, then the encrypted payload split in blocks
+// each authenticated by an HMAC-SHA-256.
+
+const (
+	signature1 = 0x9AA2D903
+	signature2 = 0xB54BFB67
+	// version4 is KDBX 4.0, the major version is in the high 16 bits
+	version4 = 0x00040000
+)
+
+// Fields of the outer header.
+const (
+	fieldEnd         = 0
+	fieldCipher      = 2
+	fieldCompression = 3
+	fieldMasterSeed  = 4
+	fieldIV          = 7
+	fieldKDF         = 11
+)
+
+// Cipher UUIDs.
+var (
+	cipherAES      = uuid("31c1f2e6bf714350be5805216afc5aff")
+	cipherChaCha20 = uuid("d6038a2b8b6f4cb5a524339a31dbb59a")
+	cipherTwofish  = uuid("ad68f29f576f4bb9a36ad47af965346c")
+)
+
+const (
+	seedSize = 32
+	// blockSize is the size of the payload blocks written
+	blockSize = 1 << 20
+	// maxPayloadSize keeps a crafted file from being decompressed into
+	// gigabytes
+	maxPayloadSize = 64 << 20
+)
+
+// uuid returns the bytes of a UUID written in hex.
+func uuid(s string) string {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+
+	return string(b)
+}
+
+// header is the outer header of a database.
+type header struct {
+	cipher     string
+	compressed bool
+	masterSeed []byte
+	iv         []byte
+	kdf        variants
+	// raw are the bytes of the header, which its hashes authenticate
+	raw []byte
+	// mac is the HMAC of the header, checked once the key is known
+	mac []byte
+}
+
+// readHeader reads the header and its hashes from r, leaving r at the
+// first block of the payload.
+func readHeader(r *bytes.Reader) (header, error) {
+	var h header
+	var hr bytes.Buffer
+	tr := io.TeeReader(r, &hr)
+
+	var start [3]uint32
+	if err := binary.Read(tr, binary.LittleEndian, &start); err != nil {
+		return header{}, ErrFormat
+	}
+
+	if start[0] != signature1 || start[1] != signature2 {
+		return header{}, ErrFormat
+	}
+
+	if major := start[2] >> 16; major != version4>>16 {
+		return header{}, fmt.Errorf("%w: KDBX %d, save it as KDBX 4", ErrUnsupported, major)
+	}
+
+	for {
+		var id uint8
+		var size uint32
+		if err := binary.Read(tr, binary.LittleEndian, &id); err != nil {
+			return header{}, ErrFormat
+		}
+
+		if err := binary.Read(tr, binary.LittleEndian, &size); err != nil || int64(size) > int64(r.Len()) {
+			return header{}, ErrFormat
+		}
+
+		value := make([]byte, size)
+		if _, err := io.ReadFull(tr, value); err != nil {
+			return header{}, ErrFormat
+		}
+
+		if id == fieldEnd {
+			break
+		}
+
+		switch id {
+		case fieldCipher:
+			h.cipher = string(value)
+		case fieldCompression:
+			h.compressed = len(value) == 4 && binary.LittleEndian.Uint32(value) == 1
+		case fieldMasterSeed:
+			h.masterSeed = value
+		case fieldIV:
+			h.iv = value
+		case fieldKDF:
+			kdf, err := readVariants(value)
+			if err != nil {
+				return header{}, err
+			}
+			h.kdf = kdf
+		}
+	}
+
+	h.raw = hr.Bytes()
+
+	sum := make([]byte, sha256.Size)
+	h.mac = make([]byte, sha256.Size)
+	if _, err := io.ReadFull(r, sum); err != nil {
+		return header{}, ErrFormat
+	}
+
+	if _, err := io.ReadFull(r, h.mac); err != nil {
+		return header{}, ErrFormat
+	}
+
+	if expected := sha256.Sum256(h.raw); !bytes.Equal(sum, expected[:]) {
+		return header{}, fmt.Errorf("%w: damaged header", ErrFormat)
+	}
+
+	switch {
+	case h.cipher != cipherAES && h.cipher != cipherChaCha20 && h.cipher != cipherTwofish:
+		return header{}, fmt.Errorf("%w: cipher %x", ErrUnsupported, h.cipher)
+	case len(h.masterSeed) != seedSize || h.kdf == nil:
+		return header{}, ErrFormat
+	}
+
+	return h, nil
+}
+
+// newHeader returns the header of a database written with AES-256 and
+// gzip under the key derived as kdf says.
+func newHeader(kdf variants) (header, error) {
+	h := header{
+		cipher:     cipherAES,
+		compressed: true,
+		masterSeed: make([]byte, seedSize),
+		iv:         make([]byte, aes.BlockSize),
+		kdf:        kdf,
+	}
+
+	if _, err := rand.Read(h.masterSeed); err != nil {
+		return header{}, err
+	}
+
+	if _, err := rand.Read(h.iv); err != nil {
+		return header{}, err
+	}
+
+	var b bytes.Buffer
+	_ = binary.Write(&b, binary.LittleEndian, [3]uint32{signature1, signature2, version4})
+
+	writeField := func(id uint8, value []byte) {
+		b.WriteByte(id)
+		_ = binary.Write(&b, binary.LittleEndian, uint32(len(value)))
+		b.Write(value)
+	}
+
+	writeField(fieldCipher, []byte(h.cipher))
+	writeField(fieldCompression, binary.LittleEndian.AppendUint32(nil, 1))
+	writeField(fieldMasterSeed, h.masterSeed)
+	writeField(fieldIV, h.iv)
+	writeField(fieldKDF, kdf.bytes())
+	writeField(fieldEnd, []byte("\r\n\r\n"))
+
+	h.raw = b.Bytes()
+
+	return h, nil
+}
+
+// keys returns the key the payload is encrypted with and the key its
+// HMACs are derived from.
+func (h header) keys(password string) (key, hmacKey []byte, err error) {
+	// The composite key of a password alone
+	sum := sha256.Sum256([]byte(password))
+	composite := sha256.Sum256(sum[:])
+
+	transformed, err := transformKey(h.kdf, composite[:])
+	if err != nil {
+		return nil, nil, err
+	}
+
+	encryption := sha256.Sum256(concat(h.masterSeed, transformed))
+	authentication := sha512.Sum512(concat(h.masterSeed, transformed, []byte{1}))
+
+	return encryption[:], authentication[:], nil
+}
+
+// open authenticates and decrypts the payload read from r.
+func (h header) open(r *bytes.Reader, password string) ([]byte, error) {
+	key, hmacKey, err := h.keys(password)
+	if err != nil {
+		return nil, err
+	}
+
+	if !hmac.Equal(h.mac, headerMAC(hmacKey, h.raw)) {
+		return nil, ErrPassword
+	}
+
+	ciphertext, err := readBlocks(r, hmacKey)
+	if err != nil {
+		return nil, err
+	}
+
+	payload, err := crypt(h.cipher, key, h.iv, ciphertext, false)
+	if err != nil {
+		return nil, err
+	}
+
+	if !h.compressed {
+		return payload, nil
+	}
+
+	zr, err := gzip.NewReader(bytes.NewReader(payload))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrFormat, err)
+	}
+
+	payload, err = io.ReadAll(io.LimitReader(zr, maxPayloadSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrFormat, err)
+	}
+
+	if len(payload) > maxPayloadSize {
+		return nil, fmt.Errorf("%w: the database is larger than %d MB", ErrUnsupported, maxPayloadSize>>20)
+	}
+
+	return payload, nil
+}
+
+// seal encrypts the payload and returns the whole file.
+func (h header) seal(payload []byte, password string) ([]byte, error) {
+	key, hmacKey, err := h.keys(password)
+	if err != nil {
+		return nil, err
+	}
+
+	if h.compressed {
+		var b bytes.Buffer
+		zw := gzip.NewWriter(&b)
+		if _, err = zw.Write(payload); err != nil {
+			return nil, err
+		}
+
+		if err = zw.Close(); err != nil {
+			return nil, err
+		}
+
+		payload = b.Bytes()
+	}
+
+	ciphertext, err := crypt(h.cipher, key, h.iv, payload, true)
+	if err != nil {
+		return nil, err
+	}
+
+	var out bytes.Buffer
+	sum := sha256.Sum256(h.raw)
+	out.Write(h.raw)
+	out.Write(sum[:])
+	out.Write(headerMAC(hmacKey, h.raw))
+	writeBlocks(&out, ciphertext, hmacKey)
+
+	return out.Bytes(), nil
+}
+
+// readBlocks reads the payload blocks up to the empty one ending them.
+func readBlocks(r *bytes.Reader, hmacKey []byte) ([]byte, error) {
+	var payload []byte
+
+	for index := uint64(0); ; index++ {
+		mac := make([]byte, sha256.Size)
+		if _, err := io.ReadFull(r, mac); err != nil {
+			return nil, fmt.Errorf("%w: truncated", ErrFormat)
+		}
+
+		var size uint32
+		if err := binary.Read(r, binary.LittleEndian, &size); err != nil || int64(size) > int64(r.Len()) {
+			return nil, fmt.Errorf("%w: truncated", ErrFormat)
+		}
+
+		block := make([]byte, size)
+		if _, err := io.ReadFull(r, block); err != nil {
+			return nil, fmt.Errorf("%w: truncated", ErrFormat)
+		}
+
+		if !hmac.Equal(mac, blockMAC(hmacKey, index, block)) {
+			return nil, fmt.Errorf("%w: damaged block %d", ErrFormat, index)
+		}
+
+		if size == 0 {
+			return payload, nil
+		}
+
+		payload = append(payload, block...)
+	}
+}
+
+// writeBlocks writes the payload in blocks ended by an empty one.
+func writeBlocks(w *bytes.Buffer, payload []byte, hmacKey []byte) {
+	for index := uint64(0); ; index++ {
+		size := len(payload)
+		if size > blockSize {
+			size = blockSize
+		}
+
+		block := payload[:size]
+		payload = payload[size:]
+
+		w.Write(blockMAC(hmacKey, index, block))
+		_ = binary.Write(w, binary.LittleEndian, uint32(size))
+		w.Write(block)
+
+		if size == 0 {
+			return
+		}
+	}
+}
+
+// blockMAC returns the HMAC of the block at the index.
+func blockMAC(hmacKey []byte, index uint64, block []byte) []byte {
+	mac := hmac.New(sha256.New, blockKey(hmacKey, index))
+	mac.Write(binary.LittleEndian.AppendUint64(nil, index))
+	mac.Write(binary.LittleEndian.AppendUint32(nil, uint32(len(block))))
+	mac.Write(block)
+
+	return mac.Sum(nil)
+}
+
+// headerMAC returns the HMAC of the header, keyed as a block with the
+// last index would be.
+func headerMAC(hmacKey, raw []byte) []byte {
+	mac := hmac.New(sha256.New, blockKey(hmacKey, ^uint64(0)))
+	mac.Write(raw)
+
+	return mac.Sum(nil)
+}
+
+func blockKey(hmacKey []byte, index uint64) []byte {
+	key := sha512.Sum512(concat(binary.LittleEndian.AppendUint64(nil, index), hmacKey))
+	return key[:]
+}
+
+// crypt encrypts or decrypts the payload with the cipher, block ciphers
+// are used in CBC mode with PKCS #7 padding.
+func crypt(id string, key, iv, data []byte, encrypt bool) ([]byte, error) {
+	var block cipher.Block
+	var err error
+
+	switch id {
+	case cipherChaCha20:
+		stream, err := chacha20.NewUnauthenticatedCipher(key, iv)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrFormat, err)
+		}
+
+		out := make([]byte, len(data))
+		stream.XORKeyStream(out, data)
+
+		return out, nil
+	case cipherAES:
+		block, err = aes.NewCipher(key)
+	case cipherTwofish:
+		block, err = twofish.NewCipher(key)
+	default:
+		return nil, fmt.Errorf("%w: cipher %x", ErrUnsupported, id)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	size := block.BlockSize()
+	if len(iv) != size {
+		return nil, fmt.Errorf("%w: invalid IV", ErrFormat)
+	}
+
+	if encrypt {
+		padding := size - len(data)%size
+		out := append(append([]byte(nil), data...), bytes.Repeat([]byte{byte(padding)}, padding)...)
+		cipher.NewCBCEncrypter(block, iv).CryptBlocks(out, out)
+
+		return out, nil
+	}
+
+	if len(data) == 0 || len(data)%size != 0 {
+		return nil, fmt.Errorf("%w: truncated payload", ErrFormat)
+	}
+
+	out := make([]byte, len(data))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(out, data)
+
+	padding := int(out[len(out)-1])
+	if padding == 0 || padding > size || !bytes.Equal(out[len(out)-padding:], bytes.Repeat([]byte{byte(padding)}, padding)) {
+		return nil, fmt.Errorf("%w: invalid padding", ErrFormat)
+	}
+
+	return out[:len(out)-padding], nil
+}
+
+func concat(parts ...[]byte) []byte {
+	var b []byte
+	for _, p := range parts {
+		b = append(b, p...)
+	}
+
+	return b
+}
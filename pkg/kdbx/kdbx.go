@@ -0,0 +1,131 @@
+// Package kdbx reads and writes KeePass databases in the KDBX 4 format
+// protected by a password.
+//
+// Databases encrypted with AES-256, ChaCha20 or Twofish whose key is
+// derived with Argon2d, Argon2id or AES-KDF are read. Written databases
+// are KDBX 4.0 encrypted with AES-256 under an Argon2id key, compressed
+// with gzip, which KeePass 2.35 and KeePassXC 2.3 or newer open. Key files
+// and attachments aren't supported.
+package kdbx
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"time"
+)
+
+var (
+	// ErrFormat is returned for data that isn't a KeePass database or
+	// is damaged
+	ErrFormat = errors.New("not a KeePass database")
+	// ErrUnsupported is returned for databases of older versions or
+	// using features this package doesn't implement
+	ErrUnsupported = errors.New("unsupported KeePass database")
+	// ErrPassword is returned when the database can't be opened with the
+	// password, either because it's wrong or a key file is needed too
+	ErrPassword = errors.New("wrong password")
+)
+
+// Database is what the bot keeps of a KeePass database: its groups and
+// entries. Metadata, icons and auto-type settings aren't kept.
+type Database struct {
+	Name string
+	// Root is the group holding every other group and entry, the recycle
+	// bin of a read database is left out
+	Root Group
+}
+
+// Group is a folder of entries and groups.
+type Group struct {
+	Name    string
+	Groups  []Group
+	Entries []Entry
+}
+
+// Entry is a KeePass entry. Times are zero when the database doesn't
+// have them, written entries get the current time.
+type Entry struct {
+	Title    string
+	Username string
+	Password string
+	URL      string
+	Notes    string
+	// Fields are the other strings of the entry, such as the "otp"
+	// of KeePassXC. They are protected in memory by KeePass when written.
+	Fields map[string]string
+	Tags   []string
+	// CustomData are values of plugins and other applications, KeePass
+	// keeps them but doesn't show them
+	CustomData map[string]string
+	Created    time.Time
+	Modified   time.Time
+	Accessed   time.Time
+	// History are the previous versions of the entry, the oldest first
+	History []Entry
+}
+
+// IsKDBX reports whether data starts like a KeePass database of any version.
+func IsKDBX(data []byte) bool {
+	return len(data) >= 8 &&
+		binary.LittleEndian.Uint32(data) == signature1 &&
+		binary.LittleEndian.Uint32(data[4:]) == signature2
+}
+
+// Read decrypts a database with the password.
+func Read(data []byte, password string) (Database, error) {
+	r := bytes.NewReader(data)
+
+	h, err := readHeader(r)
+	if err != nil {
+		return Database{}, err
+	}
+
+	payload, err := h.open(r, password)
+	if err != nil {
+		return Database{}, err
+	}
+
+	return readPayload(payload)
+}
+
+// Cost is the Argon2 cost of deriving the key of a database.
+type Cost struct {
+	Iterations uint64
+	// Memory is in bytes
+	Memory      uint64
+	Parallelism uint32
+}
+
+// DefaultCost has the memory and parallelism KeePassXC defaults to, it
+// takes about two hundred milliseconds.
+var DefaultCost = Cost{Iterations: 2, Memory: 64 << 20, Parallelism: 2}
+
+// Write encrypts the database with the password at the default cost.
+func Write(db Database, password string) ([]byte, error) {
+	return WriteCost(db, password, DefaultCost)
+}
+
+// WriteCost encrypts the database with the password at the cost.
+func WriteCost(db Database, password string, cost Cost) ([]byte, error) {
+	kdf, err := argon2Params(kdfArgon2id, cost)
+	if err != nil {
+		return nil, err
+	}
+
+	return write(db, password, kdf)
+}
+
+func write(db Database, password string, kdf variants) ([]byte, error) {
+	payload, err := writePayload(db)
+	if err != nil {
+		return nil, err
+	}
+
+	h, err := newHeader(kdf)
+	if err != nil {
+		return nil, err
+	}
+
+	return h.seal(payload, password)
+}
@@ -0,0 +1,277 @@
+package kdbx
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// The fixtures are written by testdata/generate.py with Python and
+// OpenSSL, not by this package.
+const fixturePassword = "correct horse battery staple"
+
+// testCost keeps the tests fast
+var testCost = Cost{Iterations: 1, Memory: 64 << 10, Parallelism: 2}
+
+func date(year int, month time.Month, day int) time.Time {
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+func TestReadFixtures(t *testing.T) {
+	github := Entry{
+		Title:    "GitHub",
+		Username: "octocat",
+		Password: "new-secret",
+		URL:      "https://github.com",
+		Notes:    "2FA on",
+		Fields: map[string]string{
+			"otp": "otpauth://totp/GitHub:octocat?secret=JBSWY3DPEHPK3PXP&period=30&digits=6&issuer=GitHub",
+			"PIN": "1234",
+		},
+		Tags:       []string{"dev", "work"},
+		CustomData: map[string]string{"app.kind": "login"},
+		Created:    date(2022, 1, 1),
+		Modified:   date(2023, 3, 1),
+		Accessed:   date(2023, 3, 1),
+		History: []Entry{
+			{
+				Title: "GitHub", Username: "octocat", Password: "old-secret", URL: "https://github.com",
+				Created: date(2022, 1, 1), Modified: date(2022, 1, 1), Accessed: date(2022, 1, 1),
+			},
+			{
+				Title: "GitHub", Username: "octocat", Password: "old-secret", URL: "https://github.com", Notes: "2FA on",
+				Created: date(2022, 1, 1), Modified: date(2022, 6, 1), Accessed: date(2022, 6, 1),
+			},
+		},
+	}
+
+	want := Database{
+		Name: "Fixture",
+		Root: Group{
+			Name: "Root",
+			Entries: []Entry{{
+				Title: "Bank", Username: "me", Password: "p&ss<word>", URL: "https://bank.example", Notes: "line 1\nline 2",
+				Created: date(2022, 1, 1), Modified: date(2022, 1, 1), Accessed: date(2022, 1, 1),
+			}},
+			// The recycle bin is left out
+			Groups: []Group{{Name: "Work", Entries: []Entry{github}}},
+		},
+	}
+
+	for _, name := range []string{"aes.kdbx", "chacha20.kdbx"} {
+		t.Run(name, func(t *testing.T) {
+			data, err := os.ReadFile("testdata/" + name)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !IsKDBX(data) {
+				t.Fatal("expected the fixture to be recognized")
+			}
+
+			db, err := Read(data, fixturePassword)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(db, want) {
+				t.Fatalf("expected %+v, got %+v", want, db)
+			}
+
+			if _, err = Read(data, "wrong"); !errors.Is(err, ErrPassword) {
+				t.Fatalf("expected ErrPassword, got %v", err)
+			}
+		})
+	}
+}
+
+func TestWriteRead(t *testing.T) {
+	db := Database{
+		Name: "Passwords",
+		Root: Group{
+			Name: "Passwords",
+			Entries: []Entry{{
+				Title:    "Bank",
+				Username: "me",
+				Password: "p&ss<word>\n\x01",
+				Notes:    "multi\nline",
+				Created:  date(2021, 5, 1),
+				Modified: date(2022, 5, 1),
+				Accessed: date(2023, 5, 1),
+			}},
+			Groups: []Group{{
+				Name: "work",
+				Entries: []Entry{{
+					Title:      "GitHub",
+					Username:   "octocat",
+					Password:   "secret",
+					URL:        "https://github.com",
+					Fields:     map[string]string{"otp": "otpauth://totp/GitHub?secret=JBSWY3DPEHPK3PXP", "PIN": "1234"},
+					Tags:       []string{"work", "dev"},
+					CustomData: map[string]string{"app.kind": "card"},
+					Created:    date(2020, 1, 1),
+					Modified:   date(2022, 1, 1),
+					Accessed:   date(2022, 2, 1),
+					History: []Entry{{
+						Title: "GitHub", Username: "octocat", Password: "old",
+						Created: date(2020, 1, 1), Modified: date(2021, 1, 1), Accessed: date(2021, 1, 1),
+					}},
+				}},
+			}},
+		},
+	}
+
+	// The control character is replaced when written as XML
+	want := db
+	want.Root.Entries = []Entry{db.Root.Entries[0]}
+	want.Root.Entries[0].Password = "p&ss<word>\n�"
+
+	argon2d, err := argon2Params(kdfArgon2d, testCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	argon2id, err := argon2Params(kdfArgon2id, testCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, kdf := range map[string]variants{"argon2d": argon2d, "argon2id": argon2id} {
+		t.Run(name, func(t *testing.T) {
+			data, err := write(db, "password", kdf)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := Read(data, "password")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(got, want) {
+				t.Fatalf("expected %+v, got %+v", want, got)
+			}
+
+			if _, err = Read(data, "passw0rd"); !errors.Is(err, ErrPassword) {
+				t.Fatalf("expected ErrPassword, got %v", err)
+			}
+		})
+	}
+}
+
+func TestReadInvalid(t *testing.T) {
+	data, err := WriteCost(Database{Name: "empty"}, "password", testCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = Read(data, "password"); err != nil {
+		t.Fatal(err)
+	}
+
+	damaged := append([]byte(nil), data...)
+	damaged[len(damaged)-50] ^= 1
+
+	truncated := data[:len(data)-40]
+
+	kdbx3 := append([]byte(nil), data...)
+	kdbx3[10] = 3
+
+	tests := []struct {
+		name string
+		data []byte
+		err  error
+	}{
+		{name: "empty", data: nil, err: ErrFormat},
+		{name: "not kdbx", data: []byte("name,url,username,password\n"), err: ErrFormat},
+		{name: "damaged", data: damaged, err: ErrFormat},
+		{name: "truncated", data: truncated, err: ErrFormat},
+		{name: "kdbx 3", data: kdbx3, err: ErrUnsupported},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Read(tt.data, "password"); !errors.Is(err, tt.err) {
+				t.Fatalf("expected %v, got %v", tt.err, err)
+			}
+		})
+	}
+}
+
+func TestWriteCostLimits(t *testing.T) {
+	for _, cost := range []Cost{
+		{},
+		{Iterations: 1, Memory: maxArgon2Memory + 1, Parallelism: 1},
+		{Iterations: maxArgon2Iterations + 1, Memory: 64 << 10, Parallelism: 1},
+		{Iterations: maxArgon2Iterations, Memory: maxArgon2Memory, Parallelism: 1},
+	} {
+		if _, err := WriteCost(Database{}, "password", cost); err == nil {
+			t.Errorf("expected cost %+v to be rejected", cost)
+		}
+	}
+}
+
+// TestReadCostLimits checks that databases asking for too costly a key
+// derivation are rejected before deriving it.
+func TestReadCostLimits(t *testing.T) {
+	data, err := WriteCost(Database{Name: "costly"}, "password", testCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		params map[string]uint64
+	}{
+		{name: "memory", params: map[string]uint64{"M": 1 << 40}},
+		{name: "iterations", params: map[string]uint64{"I": 1 << 32}},
+		{name: "work", params: map[string]uint64{"M": maxArgon2Memory, "I": maxArgon2Iterations}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			costly := withKDFParams(t, data, tt.params)
+
+			if _, err := Read(costly, "password"); !errors.Is(err, ErrUnsupported) {
+				t.Fatalf("expected ErrUnsupported, got %v", err)
+			}
+		})
+	}
+}
+
+// withKDFParams returns a copy of data with the uint64 parameters of the
+// key derivation replaced and the header checksum updated to match.
+func withKDFParams(t *testing.T, data []byte, params map[string]uint64) []byte {
+	t.Helper()
+
+	h, err := readHeader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	patched := append([]byte(nil), data...)
+	raw := patched[:len(h.raw)]
+
+	for name, value := range params {
+		// A uint64 variant: its type, the name and the value, both length prefixed
+		entry := append([]byte{variantUint64}, binary.LittleEndian.AppendUint32(nil, uint32(len(name)))...)
+		entry = append(append(entry, name...), 8, 0, 0, 0)
+
+		i := bytes.Index(raw, entry)
+		if i < 0 {
+			t.Fatalf("no %s parameter in the header", name)
+		}
+
+		binary.LittleEndian.PutUint64(raw[i+len(entry):], value)
+	}
+
+	sum := sha256.Sum256(raw)
+	copy(patched[len(raw):], sum[:])
+
+	return patched
+}
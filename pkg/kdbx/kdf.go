@@ -0,0 +1,261 @@
+package kdbx
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"sort"
+)
+
+// KDF UUIDs.
+var (
+	kdfAES      = uuid("c9d9f39a628a4460bf740d08c18a4fea")
+	kdfArgon2d  = uuid("ef636ddf8c29444b91f7a9a403e30a0c")
+	kdfArgon2id = uuid("9e298b1956db4773b23dfc3ec6f0a1e6")
+)
+
+// Limits keep opening a crafted database from taking minutes or
+// gigabytes of memory, they are well above the defaults of KeePass.
+const (
+	maxAESRounds        = 1 << 28
+	maxArgon2Iterations = 20
+	maxArgon2Memory     = 256 << 20
+	// maxArgon2Work bounds memory times iterations, e.g. 256 MB can be
+	// passed over 8 times
+	maxArgon2Work   = 2 << 30
+	minArgon2Memory = 8 << 10
+	maxArgon2Lanes  = 255
+)
+
+// transformKey derives the key of the database from the composite key
+// of the password as the KDF parameters say.
+func transformKey(kdf variants, composite []byte) ([]byte, error) {
+	id, _ := kdf.getBytes("$UUID")
+
+	switch string(id) {
+	case kdfAES:
+		seed, ok := kdf.getBytes("S")
+		rounds, hasRounds := kdf.getUint64("R")
+		if !ok || !hasRounds || len(seed) != 32 {
+			return nil, fmt.Errorf("%w: invalid AES-KDF parameters", ErrFormat)
+		}
+
+		if rounds > maxAESRounds {
+			return nil, fmt.Errorf("%w: %d AES-KDF rounds, at most %d are supported", ErrUnsupported, rounds, maxAESRounds)
+		}
+
+		return aesKDF(composite, seed, rounds)
+	case kdfArgon2d, kdfArgon2id:
+		salt, ok := kdf.getBytes("S")
+		lanes, hasLanes := kdf.getUint32("P")
+		memory, hasMemory := kdf.getUint64("M")
+		iterations, hasIterations := kdf.getUint64("I")
+		version, hasVersion := kdf.getUint32("V")
+		if !ok || !hasLanes || !hasMemory || !hasIterations || !hasVersion {
+			return nil, fmt.Errorf("%w: invalid Argon2 parameters", ErrFormat)
+		}
+
+		if version != argon2Version {
+			return nil, fmt.Errorf("%w: Argon2 version %#x", ErrUnsupported, version)
+		}
+
+		if err := checkArgon2(iterations, memory, lanes); err != nil {
+			return nil, err
+		}
+
+		mode := argon2id
+		if string(id) == kdfArgon2d {
+			mode = argon2d
+		}
+
+		secret, _ := kdf.getBytes("K")
+		data, _ := kdf.getBytes("A")
+
+		return deriveKey(mode, composite, salt, secret, data, uint32(iterations), uint32(memory>>10), uint8(lanes), 32), nil
+	default:
+		return nil, fmt.Errorf("%w: key derivation %x", ErrUnsupported, id)
+	}
+}
+
+func checkArgon2(iterations, memory uint64, lanes uint32) error {
+	switch {
+	case iterations == 0 || lanes == 0 || memory < minArgon2Memory:
+		return fmt.Errorf("%w: invalid Argon2 parameters", ErrFormat)
+	case iterations > maxArgon2Iterations:
+		return fmt.Errorf("%w: %d Argon2 iterations, at most %d are supported", ErrUnsupported, iterations, maxArgon2Iterations)
+	case memory > maxArgon2Memory:
+		return fmt.Errorf("%w: %d MB of Argon2 memory, at most %d MB are supported", ErrUnsupported, memory>>20, maxArgon2Memory>>20)
+	case memory*iterations > maxArgon2Work:
+		return fmt.Errorf("%w: %d Argon2 iterations over %d MB, at most %d MB in all are supported", ErrUnsupported, iterations, memory>>20, maxArgon2Work>>20)
+	case lanes > maxArgon2Lanes:
+		return fmt.Errorf("%w: %d Argon2 lanes, at most %d are supported", ErrUnsupported, lanes, maxArgon2Lanes)
+	default:
+		return nil
+	}
+}
+
+// argon2Params returns the parameters of an Argon2 key derivation at
+// the cost with a new salt.
+func argon2Params(id string, cost Cost) (variants, error) {
+	if err := checkArgon2(cost.Iterations, cost.Memory, cost.Parallelism); err != nil {
+		return nil, fmt.Errorf("invalid Argon2 cost %+v: %w", cost, err)
+	}
+
+	salt := make([]byte, 32)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+
+	return variants{
+		"$UUID": {kind: variantBytes, value: []byte(id)},
+		"S":     {kind: variantBytes, value: salt},
+		"P":     {kind: variantUint32, value: binary.LittleEndian.AppendUint32(nil, cost.Parallelism)},
+		"M":     {kind: variantUint64, value: binary.LittleEndian.AppendUint64(nil, cost.Memory)},
+		"I":     {kind: variantUint64, value: binary.LittleEndian.AppendUint64(nil, cost.Iterations)},
+		"V":     {kind: variantUint32, value: binary.LittleEndian.AppendUint32(nil, argon2Version)},
+	}, nil
+}
+
+// aesKDF encrypts both halves of the key with AES-256 keyed by the seed
+// for the rounds and hashes the result.
+func aesKDF(composite, seed []byte, rounds uint64) ([]byte, error) {
+	block, err := aes.NewCipher(seed)
+	if err != nil {
+		return nil, err
+	}
+
+	key := append([]byte(nil), composite...)
+	for i := uint64(0); i < rounds; i++ {
+		block.Encrypt(key[:16], key[:16])
+		block.Encrypt(key[16:], key[16:])
+	}
+
+	sum := sha256.Sum256(key)
+
+	return sum[:], nil
+}
+
+// Types of variant dictionary values.
+const (
+	variantEnd    = 0x00
+	variantUint32 = 0x04
+	variantUint64 = 0x05
+	variantBool   = 0x08
+	variantInt32  = 0x0C
+	variantInt64  = 0x0D
+	variantString = 0x18
+	variantBytes  = 0x42
+)
+
+// variantsVersion is 1.0, readers only check the major version
+const variantsVersion = 0x0100
+
+type variant struct {
+	kind  uint8
+	value []byte
+}
+
+// variants is a KeePass variant dictionary, the typed parameters of the KDF.
+type variants map[string]variant
+
+func readVariants(data []byte) (variants, error) {
+	invalid := fmt.Errorf("%w: invalid KDF parameters", ErrFormat)
+
+	if len(data) < 2 || binary.LittleEndian.Uint16(data)>>8 != variantsVersion>>8 {
+		return nil, invalid
+	}
+	data = data[2:]
+
+	v := make(variants)
+	for len(data) > 0 {
+		kind := data[0]
+		data = data[1:]
+
+		if kind == variantEnd {
+			return v, nil
+		}
+
+		name, rest, ok := cutSized(data)
+		if !ok {
+			return nil, invalid
+		}
+
+		value, rest, ok := cutSized(rest)
+		if !ok {
+			return nil, invalid
+		}
+
+		v[string(name)] = variant{kind: kind, value: value}
+		data = rest
+	}
+
+	return nil, invalid
+}
+
+// cutSized cuts a value prefixed by its 32 bit size from data.
+func cutSized(data []byte) (value, rest []byte, ok bool) {
+	if len(data) < 4 {
+		return nil, nil, false
+	}
+
+	size := binary.LittleEndian.Uint32(data)
+	if int64(size) > int64(len(data)-4) {
+		return nil, nil, false
+	}
+
+	return data[4 : 4+size], data[4+size:], true
+}
+
+// bytes returns the dictionary written with its names sorted.
+func (v variants) bytes() []byte {
+	names := make([]string, 0, len(v))
+	for name := range v {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b bytes.Buffer
+	_ = binary.Write(&b, binary.LittleEndian, uint16(variantsVersion))
+
+	for _, name := range names {
+		b.WriteByte(v[name].kind)
+		_ = binary.Write(&b, binary.LittleEndian, uint32(len(name)))
+		b.WriteString(name)
+		_ = binary.Write(&b, binary.LittleEndian, uint32(len(v[name].value)))
+		b.Write(v[name].value)
+	}
+
+	b.WriteByte(variantEnd)
+
+	return b.Bytes()
+}
+
+func (v variants) getBytes(name string) ([]byte, bool) {
+	x, ok := v[name]
+	if !ok || x.kind != variantBytes {
+		return nil, false
+	}
+
+	return x.value, true
+}
+
+func (v variants) getUint32(name string) (uint32, bool) {
+	x, ok := v[name]
+	if !ok || x.kind != variantUint32 || len(x.value) != 4 {
+		return 0, false
+	}
+
+	return binary.LittleEndian.Uint32(x.value), true
+}
+
+func (v variants) getUint64(name string) (uint64, bool) {
+	x, ok := v[name]
+	if !ok || x.kind != variantUint64 || len(x.value) != 8 {
+		return 0, false
+	}
+
+	return binary.LittleEndian.Uint64(x.value), true
+}
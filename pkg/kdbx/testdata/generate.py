@@ -0,0 +1,199 @@
+#!/usr/bin/env python3
+"""Writes the KDBX 4 fixtures of the tests with Python's hashlib and the
+OpenSSL command line, independently of the Go package.
+
+The databases use AES-KDF, which OpenSSL can compute, instead of Argon2.
+Their XML is written like KeePassXC writes it: entries before groups,
+a recycle bin, history, tags, custom data and protected custom fields.
+
+    python3 generate.py
+"""
+
+import base64
+import gzip
+import hashlib
+import hmac
+import os
+import struct
+import subprocess
+
+PASSWORD = b"correct horse battery staple"
+
+AES = bytes.fromhex("31c1f2e6bf714350be5805216afc5aff")
+CHACHA20 = bytes.fromhex("d6038a2b8b6f4cb5a524339a31dbb59a")
+AES_KDF = bytes.fromhex("c9d9f39a628a4460bf740d08c18a4fea")
+
+ROUNDS = 10
+
+
+def openssl(args, data):
+    return subprocess.run(["openssl", "enc"] + args, input=data, capture_output=True, check=True).stdout
+
+
+def aes_kdf(key, seed, rounds):
+    for _ in range(rounds):
+        key = openssl(["-aes-256-ecb", "-nopad", "-K", seed.hex()], key)
+    return hashlib.sha256(key).digest()
+
+
+def variant(kind, name, value):
+    return bytes([kind]) + struct.pack("<I", len(name)) + name + struct.pack("<I", len(value)) + value
+
+
+def field(id, value):
+    return bytes([id]) + struct.pack("<I", len(value)) + value
+
+
+def ktime(year, month, day):
+    # Seconds since 0001-01-01
+    import datetime
+
+    delta = datetime.datetime(year, month, day) - datetime.datetime(1, 1, 1)
+    return base64.b64encode(struct.pack("<q", int(delta.total_seconds()))).decode()
+
+
+class Stream:
+    """The ChaCha20 inner stream, protected values are XORed in document order."""
+
+    def __init__(self, key):
+        h = hashlib.sha512(key).digest()
+        self.key, self.nonce = h[:32], h[32:44]
+        self.offset = 0
+
+    def xor(self, data):
+        start = self.offset
+        stream = openssl(
+            ["-chacha20", "-K", self.key.hex(), "-iv", (b"\0" * 4 + self.nonce).hex()],
+            b"\0" * (start + len(data)),
+        )
+        self.offset += len(data)
+        return bytes(a ^ b for a, b in zip(data, stream[start:]))
+
+
+def string(stream, key, value, protected=False):
+    if protected:
+        value = base64.b64encode(stream.xor(value.encode())).decode()
+        return f'<String><Key>{key}</Key><Value Protected="True">{value}</Value></String>'
+    return f"<String><Key>{key}</Key><Value>{value}</Value></String>"
+
+
+def times(created, modified):
+    return (
+        f"<Times><CreationTime>{created}</CreationTime><LastModificationTime>{modified}</LastModificationTime>"
+        f"<LastAccessTime>{modified}</LastAccessTime><ExpiryTime>{created}</ExpiryTime><Expires>False</Expires>"
+        f"<UsageCount>0</UsageCount><LocationChanged>{created}</LocationChanged></Times>"
+    )
+
+
+def entry(stream, uuid, title, username, password, url="", notes="", extra=lambda: "", tags="", created=None,
+          modified=None, history=lambda: ""):
+    created = created or ktime(2022, 1, 1)
+    modified = modified or created
+    return (
+        f"<Entry><UUID>{uuid}</UUID><IconID>0</IconID><Tags>{tags}</Tags>{times(created, modified)}"
+        + string(stream, "Title", title)
+        + string(stream, "UserName", username)
+        + string(stream, "Password", password, True)
+        + string(stream, "URL", url)
+        + string(stream, "Notes", notes)
+        + extra()
+        + f"<AutoType><Enabled>True</Enabled></AutoType>{history()}</Entry>"
+    )
+
+
+def xml(stream):
+    u = lambda n: base64.b64encode(bytes([n]) * 16).decode()
+    # Protected values are encrypted in document order, so entries are
+    # made in it and custom strings and history after the standard strings
+    github_history = lambda: (
+        "<History>"
+        + entry(stream, u(2), "GitHub", "octocat", "old-secret", "https://github.com",
+                created=ktime(2022, 1, 1), modified=ktime(2022, 1, 1))
+        + entry(stream, u(2), "GitHub", "octocat", "old-secret", "https://github.com", notes="2FA on",
+                created=ktime(2022, 1, 1), modified=ktime(2022, 6, 1))
+        + "</History>"
+    )
+    root_entry = entry(stream, u(1), "Bank", "me", "p&ss<word>", "https://bank.example", notes="line 1\nline 2")
+    github = entry(
+        stream, u(2), "GitHub", "octocat", "new-secret", "https://github.com", notes="2FA on",
+        extra=lambda: string(stream, "otp", "otpauth://totp/GitHub:octocat?secret=JBSWY3DPEHPK3PXP&period=30&digits=6&issuer=GitHub", True)
+        + string(stream, "PIN", "1234", True)
+        + "<CustomData><Item><Key>app.kind</Key><Value>login</Value></Item></CustomData>",
+        tags="dev;work", created=ktime(2022, 1, 1), modified=ktime(2023, 3, 1),
+        history=github_history,
+    )
+    deleted = entry(stream, u(4), "Old", "gone", "deleted")
+
+    return (
+        '<?xml version="1.0" encoding="UTF-8" standalone="yes"?>\n'
+        "<KeePassFile><Meta><Generator>KeePassXC</Generator><DatabaseName>Fixture</DatabaseName>"
+        "<MemoryProtection><ProtectTitle>False</ProtectTitle><ProtectUserName>False</ProtectUserName>"
+        "<ProtectPassword>True</ProtectPassword><ProtectURL>False</ProtectURL><ProtectNotes>False</ProtectNotes>"
+        f"</MemoryProtection><RecycleBinEnabled>True</RecycleBinEnabled><RecycleBinUUID>{u(9)}</RecycleBinUUID>"
+        "</Meta><Root>"
+        f"<Group><UUID>{u(7)}</UUID><Name>Root</Name>{times(ktime(2022, 1, 1), ktime(2022, 1, 1))}"
+        + root_entry
+        + f"<Group><UUID>{u(8)}</UUID><Name>Work</Name>{times(ktime(2022, 1, 1), ktime(2022, 1, 1))}"
+        + github
+        + "</Group>"
+        + f"<Group><UUID>{u(9)}</UUID><Name>Recycle Bin</Name>{times(ktime(2022, 1, 1), ktime(2022, 1, 1))}"
+        + deleted
+        + "</Group></Group><DeletedObjects/></Root></KeePassFile>"
+    ).encode()
+
+
+def write(path, cipher, compressed):
+    seed, kdf_seed = os.urandom(32), os.urandom(32)
+    iv = os.urandom(16 if cipher == AES else 12)
+
+    kdf = struct.pack("<H", 0x0100)
+    kdf += variant(0x42, b"$UUID", AES_KDF)
+    kdf += variant(0x05, b"R", struct.pack("<Q", ROUNDS))
+    kdf += variant(0x42, b"S", kdf_seed)
+    kdf += b"\0"
+
+    header = struct.pack("<III", 0x9AA2D903, 0xB54BFB67, 0x00040000)
+    header += field(2, cipher)
+    header += field(3, struct.pack("<I", 1 if compressed else 0))
+    header += field(4, seed)
+    header += field(7, iv)
+    header += field(11, kdf)
+    header += field(0, b"\r\n\r\n")
+
+    composite = hashlib.sha256(hashlib.sha256(PASSWORD).digest()).digest()
+    transformed = aes_kdf(composite, kdf_seed, ROUNDS)
+    key = hashlib.sha256(seed + transformed).digest()
+    hmac_key = hashlib.sha512(seed + transformed + b"\x01").digest()
+
+    def block_key(index):
+        return hashlib.sha512(struct.pack("<Q", index) + hmac_key).digest()
+
+    stream_key = os.urandom(64)
+    inner = field(1, struct.pack("<I", 3)) + field(2, stream_key) + field(0, b"")
+    payload = inner + xml(Stream(stream_key))
+    if compressed:
+        payload = gzip.compress(payload)
+
+    if cipher == AES:
+        ciphertext = openssl(["-aes-256-cbc", "-K", key.hex(), "-iv", iv.hex()], payload)
+    else:
+        ciphertext = openssl(["-chacha20", "-K", key.hex(), "-iv", (b"\0" * 4 + iv).hex()], payload)
+
+    out = header + hashlib.sha256(header).digest()
+    out += hmac.new(block_key(2**64 - 1), header, hashlib.sha256).digest()
+
+    # Two blocks and the empty one ending them
+    half = len(ciphertext) // 2
+    for index, block in enumerate([ciphertext[:half], ciphertext[half:], b""]):
+        size = struct.pack("<I", len(block))
+        mac = hmac.new(block_key(index), struct.pack("<Q", index) + size + block, hashlib.sha256).digest()
+        out += mac + size + block
+
+    with open(path, "wb") as f:
+        f.write(out)
+
+
+if __name__ == "__main__":
+    here = os.path.dirname(os.path.abspath(__file__))
+    write(os.path.join(here, "aes.kdbx"), AES, True)
+    write(os.path.join(here, "chacha20.kdbx"), CHACHA20, False)
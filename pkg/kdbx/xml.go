@@ -0,0 +1,572 @@
+package kdbx
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/chacha20"
+)
+
+// The decrypted payload is the inner header, then the database as XML.
+// Protected values of the XML are encrypted with the inner stream cipher
+// in document order, so they are never in memory as plaintext in KeePass.
+
+// Fields of the inner header.
+const (
+	innerEnd       = 0
+	innerStreamID  = 1
+	innerStreamKey = 2
+)
+
+// streamChaCha20 is the inner stream cipher of KDBX 4
+const streamChaCha20 = 3
+
+// generator names the application that wrote a database
+const generator = "telegram-bot"
+
+// Keys of the strings every entry has, other strings are its fields.
+const (
+	keyTitle    = "Title"
+	keyUsername = "UserName"
+	keyPassword = "Password"
+	keyURL      = "URL"
+	keyNotes    = "Notes"
+)
+
+// epoch is the Unix time of 0001-01-01, which KDBX 4 times count from
+const epoch = -62135596800
+
+func readPayload(data []byte) (Database, error) {
+	var streamID uint32
+	var streamKey []byte
+
+	for end := false; !end; {
+		if len(data) < 1 {
+			return Database{}, fmt.Errorf("%w: truncated inner header", ErrFormat)
+		}
+
+		id := data[0]
+		value, rest, ok := cutSized(data[1:])
+		if !ok {
+			return Database{}, fmt.Errorf("%w: truncated inner header", ErrFormat)
+		}
+		data = rest
+
+		switch id {
+		case innerEnd:
+			end = true
+		case innerStreamID:
+			if len(value) != 4 {
+				return Database{}, fmt.Errorf("%w: invalid inner stream", ErrFormat)
+			}
+			streamID = binary.LittleEndian.Uint32(value)
+		case innerStreamKey:
+			streamKey = value
+		}
+	}
+
+	if streamID != streamChaCha20 {
+		return Database{}, fmt.Errorf("%w: inner stream %d", ErrUnsupported, streamID)
+	}
+
+	stream, err := innerStream(streamKey)
+	if err != nil {
+		return Database{}, err
+	}
+
+	plain, err := transformProtected(data, stream, false)
+	if err != nil {
+		return Database{}, err
+	}
+
+	var f xmlFile
+	if err = xml.Unmarshal(plain, &f); err != nil {
+		return Database{}, fmt.Errorf("%w: %s", ErrFormat, err)
+	}
+
+	return f.database(), nil
+}
+
+func writePayload(db Database) ([]byte, error) {
+	streamKey := make([]byte, 64)
+	if _, err := rand.Read(streamKey); err != nil {
+		return nil, err
+	}
+
+	stream, err := innerStream(streamKey)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := xmlFileOf(db)
+	if err != nil {
+		return nil, err
+	}
+
+	plain, err := xml.Marshal(f)
+	if err != nil {
+		return nil, err
+	}
+
+	protected, err := transformProtected(plain, stream, true)
+	if err != nil {
+		return nil, err
+	}
+
+	var b bytes.Buffer
+	writeField := func(id uint8, value []byte) {
+		b.WriteByte(id)
+		_ = binary.Write(&b, binary.LittleEndian, uint32(len(value)))
+		b.Write(value)
+	}
+
+	writeField(innerStreamID, binary.LittleEndian.AppendUint32(nil, streamChaCha20))
+	writeField(innerStreamKey, streamKey)
+	writeField(innerEnd, nil)
+
+	b.WriteString(xml.Header)
+	b.Write(protected)
+
+	return b.Bytes(), nil
+}
+
+func innerStream(key []byte) (cipher.Stream, error) {
+	sum := sha512.Sum512(key)
+	return chacha20.NewUnauthenticatedCipher(sum[:32], sum[32:44])
+}
+
+// transformProtected returns the XML with its protected values decrypted
+// or encrypted with the stream, in document order. Decrypted values are
+// text, encrypted ones base64.
+func transformProtected(data []byte, stream cipher.Stream, encrypt bool) ([]byte, error) {
+	d := xml.NewDecoder(bytes.NewReader(data))
+
+	var b bytes.Buffer
+	e := xml.NewEncoder(&b)
+
+	var protected bool
+	var value []byte
+
+	for {
+		token, err := d.RawToken()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrFormat, err)
+		}
+
+		switch t := token.(type) {
+		case xml.ProcInst:
+			// The declaration is written again with the payload
+			continue
+		case xml.StartElement:
+			protected = t.Name.Local == "Value" && isProtected(t)
+			value = value[:0]
+		case xml.CharData:
+			if protected {
+				value = append(value, t...)
+				continue
+			}
+		case xml.EndElement:
+			if protected {
+				if value, err = cryptValue(stream, value, encrypt); err != nil {
+					return nil, err
+				}
+
+				if err = e.EncodeToken(xml.CharData(value)); err != nil {
+					return nil, err
+				}
+			}
+			protected = false
+		}
+
+		if err = e.EncodeToken(token); err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrFormat, err)
+		}
+	}
+
+	if err := e.Flush(); err != nil {
+		return nil, err
+	}
+
+	return b.Bytes(), nil
+}
+
+// cryptValue encrypts a protected value into base64 or decrypts it from base64.
+func cryptValue(stream cipher.Stream, value []byte, encrypt bool) ([]byte, error) {
+	if encrypt {
+		out := make([]byte, len(value))
+		stream.XORKeyStream(out, value)
+
+		return []byte(base64.StdEncoding.EncodeToString(out)), nil
+	}
+
+	out, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(value)))
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid protected value", ErrFormat)
+	}
+	stream.XORKeyStream(out, out)
+
+	return out, nil
+}
+
+func isProtected(t xml.StartElement) bool {
+	for _, a := range t.Attr {
+		if a.Name.Local == "Protected" && strings.EqualFold(a.Value, "true") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// XML of a database, only the elements kept are declared.
+
+type xmlFile struct {
+	XMLName xml.Name `xml:"KeePassFile"`
+	Meta    xmlMeta  `xml:"Meta"`
+	Root    struct {
+		Group xmlGroup `xml:"Group"`
+	} `xml:"Root"`
+}
+
+type xmlMeta struct {
+	Generator        string `xml:"Generator"`
+	DatabaseName     string `xml:"DatabaseName"`
+	MemoryProtection struct {
+		ProtectTitle    string `xml:"ProtectTitle"`
+		ProtectUserName string `xml:"ProtectUserName"`
+		ProtectPassword string `xml:"ProtectPassword"`
+		ProtectURL      string `xml:"ProtectURL"`
+		ProtectNotes    string `xml:"ProtectNotes"`
+	} `xml:"MemoryProtection"`
+	RecycleBinEnabled string `xml:"RecycleBinEnabled"`
+	RecycleBinUUID    string `xml:"RecycleBinUUID"`
+}
+
+type xmlGroup struct {
+	UUID    string     `xml:"UUID"`
+	Name    string     `xml:"Name"`
+	Times   xmlTimes   `xml:"Times"`
+	Entries []xmlEntry `xml:"Entry"`
+	Groups  []xmlGroup `xml:"Group"`
+}
+
+type xmlEntry struct {
+	UUID       string         `xml:"UUID"`
+	Tags       string         `xml:"Tags,omitempty"`
+	Times      xmlTimes       `xml:"Times"`
+	Strings    []xmlString    `xml:"String"`
+	CustomData *xmlCustomData `xml:"CustomData,omitempty"`
+	History    *xmlHistory    `xml:"History,omitempty"`
+}
+
+type xmlHistory struct {
+	Entries []xmlEntry `xml:"Entry"`
+}
+
+type xmlString struct {
+	Key   string `xml:"Key"`
+	Value struct {
+		Protected string `xml:"Protected,attr,omitempty"`
+		Text      string `xml:",chardata"`
+	} `xml:"Value"`
+}
+
+type xmlCustomData struct {
+	Items []xmlItem `xml:"Item"`
+}
+
+type xmlItem struct {
+	Key   string `xml:"Key"`
+	Value string `xml:"Value"`
+}
+
+type xmlTimes struct {
+	CreationTime         string `xml:"CreationTime"`
+	LastModificationTime string `xml:"LastModificationTime"`
+	LastAccessTime       string `xml:"LastAccessTime"`
+	ExpiryTime           string `xml:"ExpiryTime"`
+	Expires              string `xml:"Expires"`
+	UsageCount           int    `xml:"UsageCount"`
+	LocationChanged      string `xml:"LocationChanged"`
+}
+
+func (f xmlFile) database() Database {
+	var recycleBin string
+	if strings.EqualFold(f.Meta.RecycleBinEnabled, "true") {
+		recycleBin = f.Meta.RecycleBinUUID
+	}
+
+	return Database{Name: f.Meta.DatabaseName, Root: f.Root.Group.group(recycleBin)}
+}
+
+func (g xmlGroup) group(recycleBin string) Group {
+	group := Group{Name: g.Name}
+
+	for _, e := range g.Entries {
+		group.Entries = append(group.Entries, e.entry())
+	}
+
+	for _, sub := range g.Groups {
+		if recycleBin != "" && sub.UUID == recycleBin {
+			continue
+		}
+
+		group.Groups = append(group.Groups, sub.group(recycleBin))
+	}
+
+	return group
+}
+
+func (e xmlEntry) entry() Entry {
+	entry := Entry{
+		Tags:     splitTags(e.Tags),
+		Created:  parseTime(e.Times.CreationTime),
+		Modified: parseTime(e.Times.LastModificationTime),
+		Accessed: parseTime(e.Times.LastAccessTime),
+	}
+
+	for _, s := range e.Strings {
+		value := s.Value.Text
+
+		switch s.Key {
+		case keyTitle:
+			entry.Title = value
+		case keyUsername:
+			entry.Username = value
+		case keyPassword:
+			entry.Password = value
+		case keyURL:
+			entry.URL = value
+		case keyNotes:
+			entry.Notes = value
+		default:
+			if value == "" {
+				continue
+			}
+
+			if entry.Fields == nil {
+				entry.Fields = make(map[string]string)
+			}
+			entry.Fields[s.Key] = value
+		}
+	}
+
+	if e.CustomData != nil {
+		for _, item := range e.CustomData.Items {
+			if entry.CustomData == nil {
+				entry.CustomData = make(map[string]string)
+			}
+			entry.CustomData[item.Key] = item.Value
+		}
+	}
+
+	if e.History != nil {
+		for _, h := range e.History.Entries {
+			entry.History = append(entry.History, h.entry())
+		}
+	}
+
+	return entry
+}
+
+func xmlFileOf(db Database) (xmlFile, error) {
+	var f xmlFile
+
+	f.Meta.Generator = generator
+	f.Meta.DatabaseName = db.Name
+	f.Meta.MemoryProtection.ProtectTitle = "False"
+	f.Meta.MemoryProtection.ProtectUserName = "False"
+	f.Meta.MemoryProtection.ProtectPassword = "True"
+	f.Meta.MemoryProtection.ProtectURL = "False"
+	f.Meta.MemoryProtection.ProtectNotes = "False"
+	f.Meta.RecycleBinEnabled = "False"
+	f.Meta.RecycleBinUUID = base64.StdEncoding.EncodeToString(make([]byte, 16))
+
+	root := db.Root
+	if root.Name == "" {
+		root.Name = db.Name
+	}
+
+	if root.Name == "" {
+		root.Name = "Root"
+	}
+
+	var err error
+	f.Root.Group, err = xmlGroupOf(root, time.Now())
+
+	return f, err
+}
+
+func xmlGroupOf(g Group, now time.Time) (xmlGroup, error) {
+	id, err := newUUID()
+	if err != nil {
+		return xmlGroup{}, err
+	}
+
+	group := xmlGroup{UUID: id, Name: g.Name, Times: xmlTimesOf(now, now, now, now)}
+
+	for _, e := range g.Entries {
+		entry, err := xmlEntryOf(e, now)
+		if err != nil {
+			return xmlGroup{}, err
+		}
+
+		group.Entries = append(group.Entries, entry)
+	}
+
+	for _, sub := range g.Groups {
+		subgroup, err := xmlGroupOf(sub, now)
+		if err != nil {
+			return xmlGroup{}, err
+		}
+
+		group.Groups = append(group.Groups, subgroup)
+	}
+
+	return group, nil
+}
+
+func xmlEntryOf(e Entry, now time.Time) (xmlEntry, error) {
+	id, err := newUUID()
+	if err != nil {
+		return xmlEntry{}, err
+	}
+
+	entry := xmlEntry{
+		UUID:  id,
+		Tags:  strings.Join(e.Tags, ";"),
+		Times: xmlTimesOf(e.Created, e.Modified, e.Accessed, now),
+	}
+
+	addString := func(key, value string, protected bool) {
+		s := xmlString{Key: key}
+		s.Value.Text = value
+		if protected {
+			s.Value.Protected = "True"
+		}
+		entry.Strings = append(entry.Strings, s)
+	}
+
+	addString(keyTitle, e.Title, false)
+	addString(keyUsername, e.Username, false)
+	addString(keyPassword, e.Password, true)
+	addString(keyURL, e.URL, false)
+	addString(keyNotes, e.Notes, false)
+
+	for _, key := range sortedKeys(e.Fields) {
+		addString(key, e.Fields[key], true)
+	}
+
+	if len(e.CustomData) > 0 {
+		entry.CustomData = &xmlCustomData{}
+		for _, key := range sortedKeys(e.CustomData) {
+			entry.CustomData.Items = append(entry.CustomData.Items, xmlItem{Key: key, Value: e.CustomData[key]})
+		}
+	}
+
+	if len(e.History) > 0 {
+		entry.History = &xmlHistory{}
+
+		for _, h := range e.History {
+			// Versions share the UUID of the entry
+			h.History = nil
+			version, err := xmlEntryOf(h, now)
+			if err != nil {
+				return xmlEntry{}, err
+			}
+			version.UUID = id
+
+			entry.History.Entries = append(entry.History.Entries, version)
+		}
+	}
+
+	return entry, nil
+}
+
+// xmlTimesOf returns the times of an entry, now for the unknown ones.
+func xmlTimesOf(created, modified, accessed, now time.Time) xmlTimes {
+	orNow := func(t time.Time) time.Time {
+		if t.IsZero() {
+			return now
+		}
+
+		return t
+	}
+
+	created = orNow(created)
+
+	return xmlTimes{
+		CreationTime:         formatTime(created),
+		LastModificationTime: formatTime(orNow(modified)),
+		LastAccessTime:       formatTime(orNow(accessed)),
+		ExpiryTime:           formatTime(created),
+		Expires:              "False",
+		LocationChanged:      formatTime(created),
+	}
+}
+
+// parseTime reads a time of KDBX 4, base64 of the seconds since
+// 0001-01-01, or of KDBX 3 written in RFC 3339. Invalid times are zero.
+func parseTime(value string) time.Time {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t
+	}
+
+	b, err := base64.StdEncoding.DecodeString(value)
+	if err != nil || len(b) != 8 {
+		return time.Time{}
+	}
+
+	return time.Unix(int64(binary.LittleEndian.Uint64(b))+epoch, 0).UTC()
+}
+
+func formatTime(t time.Time) string {
+	return base64.StdEncoding.EncodeToString(binary.LittleEndian.AppendUint64(nil, uint64(t.Unix()-epoch)))
+}
+
+func newUUID() (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(id), nil
+}
+
+// splitTags splits the tags of an entry, KeePass separates them with
+// semicolons and KeePassXC with commas too.
+func splitTags(text string) []string {
+	var tags []string
+	for _, tag := range strings.FieldsFunc(text, func(r rune) bool { return r == ',' || r == ';' }) {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+
+	return tags
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
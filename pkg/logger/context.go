@@ -0,0 +1,30 @@
+package logger
+
+import (
+	"context"
+
+	"github.com/sirupsen/logrus"
+)
+
+type requestIDKey struct{}
+
+// WithRequestID returns a copy of ctx carrying the request ID.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the request ID carried by ctx or an empty string.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// WithContext returns an entry that logs the request ID carried by ctx.
+func (l *Logger) WithContext(ctx context.Context) *logrus.Entry {
+	id := RequestID(ctx)
+	if id == "" {
+		return logrus.NewEntry(l.Logrus)
+	}
+
+	return l.Logrus.WithField("request_id", id)
+}
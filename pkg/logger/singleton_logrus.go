@@ -248,6 +248,7 @@ func Middleware() echo.MiddlewareFunc {
 			if err != nil {
 				GetInstance().Logrus.WithFields(logrus.Fields{
 					"error":         err.Error(),
+					"request_id":    RequestID(req.Context()),
 					"remote_ip":     c.RealIP(),
 					"host":          req.Host,
 					"uri":           req.RequestURI,
@@ -265,6 +266,7 @@ func Middleware() echo.MiddlewareFunc {
 				return err
 			}
 			GetInstance().Logrus.WithFields(map[string]interface{}{
+				"request_id":    RequestID(req.Context()),
 				"remote_ip":     c.RealIP(),
 				"host":          req.Host,
 				"uri":           req.RequestURI,
@@ -0,0 +1,73 @@
+package metrics
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+const (
+	typeCounter = "counter"
+	typeGauge   = "gauge"
+)
+
+type metric struct {
+	name  string
+	help  string
+	kind  string
+	value func() float64
+}
+
+// Registry collects metrics read at scrape time and serves them in the
+// Prometheus text format.
+type Registry struct {
+	mu      sync.RWMutex
+	metrics map[string]metric
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		metrics: make(map[string]metric),
+	}
+}
+
+// CounterFunc registers a counter whose value is returned by fn.
+// Registering a name again replaces the metric.
+func (r *Registry) CounterFunc(name, help string, fn func() float64) {
+	r.register(metric{name: name, help: help, kind: typeCounter, value: fn})
+}
+
+// GaugeFunc registers a gauge whose value is returned by fn.
+// Registering a name again replaces the metric.
+func (r *Registry) GaugeFunc(name, help string, fn func() float64) {
+	r.register(metric{name: name, help: help, kind: typeGauge, value: fn})
+}
+
+func (r *Registry) register(m metric) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.metrics[m.name] = m
+}
+
+func (r *Registry) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	r.mu.RLock()
+	metrics := make([]metric, 0, len(r.metrics))
+	for _, m := range r.metrics {
+		metrics = append(metrics, m)
+	}
+	r.mu.RUnlock()
+
+	sort.Slice(metrics, func(i, j int) bool {
+		return metrics[i].name < metrics[j].name
+	})
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+
+	for _, m := range metrics {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n%s %s\n",
+			m.name, m.help, m.name, m.kind, m.name, strconv.FormatFloat(m.value(), 'g', -1, 64))
+	}
+}
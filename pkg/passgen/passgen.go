@@ -0,0 +1,442 @@
+// Package passgen generates passwords and passphrases with crypto/rand.
+package passgen
+
+import (
+	"crypto/rand"
+	_ "embed"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Modes of generation.
+const (
+	ModeRandom        = "random"
+	ModePronounceable = "pronounceable"
+	ModePassphrase    = "passphrase"
+)
+
+const (
+	MinLength = 8
+	MaxLength = 128
+	MinWords  = 3
+	MaxWords  = 20
+)
+
+const (
+	lowerChars = "abcdefghijklmnopqrstuvwxyz"
+	upperChars = "ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+	digitChars = "0123456789"
+	// symbolChars leave out quotes and backticks, which break code
+	// blocks of messages and are awkward to type on phones
+	symbolChars = "!#$%&*+-=?@^_~.,:;()[]{}<>/|"
+	// ambiguousChars look alike in many fonts
+	ambiguousChars = "Il1|O0o"
+
+	consonants = "bcdfghjklmnprstvwz"
+	vowels     = "aeiou"
+)
+
+var ErrInvalidPolicy = errors.New("invalid password policy")
+
+//go:embed wordlist.txt
+var wordlist string
+
+// words are short common English words for passphrases
+var words = strings.Fields(wordlist)
+
+// Policy describes what to generate.
+type Policy struct {
+	Mode string
+	// Length of random and pronounceable passwords
+	Length int
+	// Character classes. Random passwords have at least one character of
+	// every chosen class, pronounceable ones are lowercase letters with a
+	// capital, a digit and a symbol when chosen, and passphrases get
+	// capitalized words and a digit.
+	Lower, Upper, Digits, Symbols bool
+	// ExcludeAmbiguous leaves out characters that look alike, such as l, 1 and I
+	ExcludeAmbiguous bool
+	// Words and Separator of passphrases
+	Words     int
+	Separator string
+}
+
+// DefaultPolicy is used by users who haven't chosen their own.
+var DefaultPolicy = Policy{
+	Mode:      ModeRandom,
+	Length:    20,
+	Lower:     true,
+	Upper:     true,
+	Digits:    true,
+	Symbols:   true,
+	Words:     6,
+	Separator: "-",
+}
+
+// Parse applies space separated options to base and returns the result:
+// a mode (random, pronounceable or passphrase), a number setting the
+// length or the number of words, a class (lower, upper, digits, symbols)
+// to include or, prefixed with "no", to leave out, "noambiguous" or
+// "ambiguous" and "sep=" followed by the passphrase separator.
+func Parse(s string, base Policy) (Policy, error) {
+	p := base
+	options := strings.Fields(strings.ToLower(s))
+
+	// The mode decides what a number means, so it's applied first
+	for _, option := range options {
+		switch option {
+		case ModeRandom:
+			p.Mode = ModeRandom
+		case ModePronounceable, "pron":
+			p.Mode = ModePronounceable
+		case ModePassphrase, "phrase", "words":
+			p.Mode = ModePassphrase
+		}
+	}
+
+	for _, option := range options {
+		if n, err := strconv.Atoi(option); err == nil {
+			if p.Mode == ModePassphrase {
+				p.Words = n
+			} else {
+				p.Length = n
+			}
+
+			continue
+		}
+
+		if sep, ok := strings.CutPrefix(option, "sep="); ok {
+			p.Separator = sep
+			continue
+		}
+
+		switch option {
+		case ModeRandom, ModePronounceable, "pron", ModePassphrase, "phrase", "words":
+			continue
+		}
+
+		on := true
+		name := option
+		if rest, ok := strings.CutPrefix(option, "no"); ok {
+			on, name = false, strings.TrimPrefix(rest, "-")
+		}
+
+		switch name {
+		case "lower":
+			p.Lower = on
+		case "upper":
+			p.Upper = on
+		case "digits":
+			p.Digits = on
+		case "symbols":
+			p.Symbols = on
+		case "ambiguous":
+			p.ExcludeAmbiguous = !on
+		default:
+			return Policy{}, fmt.Errorf("%w: unknown option %q", ErrInvalidPolicy, option)
+		}
+	}
+
+	if err := p.Validate(); err != nil {
+		return Policy{}, err
+	}
+
+	return p, nil
+}
+
+// Validate checks the policy can be generated.
+func (p Policy) Validate() error {
+	switch p.Mode {
+	case ModeRandom:
+		if !p.Lower && !p.Upper && !p.Digits && !p.Symbols {
+			return fmt.Errorf("%w: choose at least one character class", ErrInvalidPolicy)
+		}
+	case ModePronounceable:
+	case ModePassphrase:
+		if p.Words < MinWords || p.Words > MaxWords {
+			return fmt.Errorf("%w: passphrases have %d to %d words", ErrInvalidPolicy, MinWords, MaxWords)
+		}
+
+		return nil
+	default:
+		return fmt.Errorf("%w: unknown mode %q", ErrInvalidPolicy, p.Mode)
+	}
+
+	if p.Length < MinLength || p.Length > MaxLength {
+		return fmt.Errorf("%w: length must be %d to %d", ErrInvalidPolicy, MinLength, MaxLength)
+	}
+
+	return nil
+}
+
+// String returns the policy as options that Parse applied to
+// DefaultPolicy reads back.
+func (p Policy) String() string {
+	var options []string
+
+	if p.Mode == ModePassphrase {
+		options = append(options, p.Mode, strconv.Itoa(p.Words))
+		if p.Separator != DefaultPolicy.Separator {
+			options = append(options, "sep="+p.Separator)
+		}
+	} else {
+		options = append(options, p.Mode, strconv.Itoa(p.Length))
+	}
+
+	for _, class := range []struct {
+		name string
+		on   bool
+	}{
+		{"lower", p.Lower},
+		{"upper", p.Upper},
+		{"digits", p.Digits},
+		{"symbols", p.Symbols},
+	} {
+		if !class.on {
+			options = append(options, "no"+class.name)
+		}
+	}
+
+	if p.ExcludeAmbiguous {
+		options = append(options, "noambiguous")
+	}
+
+	return strings.Join(options, " ")
+}
+
+// Generate returns a new password made by the policy.
+func Generate(p Policy) (string, error) {
+	if err := p.Validate(); err != nil {
+		return "", err
+	}
+
+	switch p.Mode {
+	case ModePronounceable:
+		return pronounceable(p)
+	case ModePassphrase:
+		return passphrase(p)
+	default:
+		return random(p)
+	}
+}
+
+// Entropy estimates the strength of passwords made by the policy in bits.
+func (p Policy) Entropy() float64 {
+	switch p.Mode {
+	case ModePronounceable:
+		letters := p.Length - p.extras()
+		c, v := len(p.filter(consonants)), len(p.filter(vowels))
+		bits := float64((letters+1)/2)*math.Log2(float64(c)) + float64(letters/2)*math.Log2(float64(v))
+		if p.Digits {
+			bits += math.Log2(float64(len(p.filter(digitChars))))
+		}
+		if p.Symbols {
+			bits += math.Log2(float64(len(p.filter(symbolChars))))
+		}
+
+		return bits
+	case ModePassphrase:
+		bits := float64(p.Words) * math.Log2(float64(len(words)))
+		if p.Digits {
+			bits += math.Log2(float64(10 * p.Words))
+		}
+
+		return bits
+	default:
+		return float64(p.Length) * math.Log2(float64(len(strings.Join(p.classes(), ""))))
+	}
+}
+
+// classes returns characters of the chosen classes.
+func (p Policy) classes() []string {
+	var classes []string
+
+	for _, class := range []struct {
+		chars string
+		on    bool
+	}{
+		{lowerChars, p.Lower},
+		{upperChars, p.Upper},
+		{digitChars, p.Digits},
+		{symbolChars, p.Symbols},
+	} {
+		if class.on {
+			classes = append(classes, p.filter(class.chars))
+		}
+	}
+
+	return classes
+}
+
+func (p Policy) filter(chars string) string {
+	if !p.ExcludeAmbiguous {
+		return chars
+	}
+
+	return strings.Map(func(r rune) rune {
+		if strings.ContainsRune(ambiguousChars, r) {
+			return -1
+		}
+
+		return r
+	}, chars)
+}
+
+// extras is the number of digits and symbols added to pronounceable passwords.
+func (p Policy) extras() int {
+	n := 0
+	if p.Digits {
+		n++
+	}
+	if p.Symbols {
+		n++
+	}
+
+	return n
+}
+
+func random(p Policy) (string, error) {
+	classes := p.classes()
+	all := strings.Join(classes, "")
+
+	password := make([]byte, 0, p.Length)
+
+	// One character of every class, the rest from all of them
+	for _, class := range classes {
+		c, err := pick(class)
+		if err != nil {
+			return "", err
+		}
+		password = append(password, c)
+	}
+
+	for len(password) < p.Length {
+		c, err := pick(all)
+		if err != nil {
+			return "", err
+		}
+		password = append(password, c)
+	}
+
+	if err := shuffle(password); err != nil {
+		return "", err
+	}
+
+	return string(password), nil
+}
+
+// pronounceable alternates consonants and vowels and ends with
+// a digit and a symbol when they are chosen.
+func pronounceable(p Policy) (string, error) {
+	cons, vows := p.filter(consonants), p.filter(vowels)
+
+	password := make([]byte, 0, p.Length)
+
+	for i := 0; i < p.Length-p.extras(); i++ {
+		chars := cons
+		if i%2 == 1 {
+			chars = vows
+		}
+
+		c, err := pick(chars)
+		if err != nil {
+			return "", err
+		}
+		password = append(password, c)
+	}
+
+	// Words start with a consonant, so the capital is never an I or O
+	if p.Upper {
+		password[0] = strings.ToUpper(string(password[0]))[0]
+	}
+
+	for _, extra := range []struct {
+		chars string
+		on    bool
+	}{
+		{p.filter(digitChars), p.Digits},
+		{p.filter(symbolChars), p.Symbols},
+	} {
+		if !extra.on {
+			continue
+		}
+
+		c, err := pick(extra.chars)
+		if err != nil {
+			return "", err
+		}
+		password = append(password, c)
+	}
+
+	return string(password), nil
+}
+
+// passphrase joins words picked from the embedded wordlist.
+func passphrase(p Policy) (string, error) {
+	phrase := make([]string, p.Words)
+
+	for i := range phrase {
+		n, err := randomInt(len(words))
+		if err != nil {
+			return "", err
+		}
+
+		phrase[i] = words[n]
+		if p.Upper {
+			phrase[i] = strings.ToUpper(phrase[i][:1]) + phrase[i][1:]
+		}
+	}
+
+	if p.Digits {
+		i, err := randomInt(len(phrase))
+		if err != nil {
+			return "", err
+		}
+
+		digit, err := pick(digitChars)
+		if err != nil {
+			return "", err
+		}
+
+		phrase[i] += string(digit)
+	}
+
+	return strings.Join(phrase, p.Separator), nil
+}
+
+func pick(chars string) (byte, error) {
+	n, err := randomInt(len(chars))
+	if err != nil {
+		return 0, err
+	}
+
+	return chars[n], nil
+}
+
+// shuffle is a Fisher-Yates shuffle.
+func shuffle(b []byte) error {
+	for i := len(b) - 1; i > 0; i-- {
+		j, err := randomInt(i + 1)
+		if err != nil {
+			return err
+		}
+
+		b[i], b[j] = b[j], b[i]
+	}
+
+	return nil
+}
+
+// randomInt returns a uniform random number in [0, n).
+func randomInt(n int) (int, error) {
+	v, err := rand.Int(rand.Reader, big.NewInt(int64(n)))
+	if err != nil {
+		return 0, err
+	}
+
+	return int(v.Int64()), nil
+}
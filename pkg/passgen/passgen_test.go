@@ -0,0 +1,148 @@
+package passgen
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestGenerateRandom(t *testing.T) {
+	p := DefaultPolicy
+	p.Length = 12
+	p.ExcludeAmbiguous = true
+
+	for i := 0; i < 100; i++ {
+		password, err := Generate(p)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		if len(password) != 12 {
+			t.Fatalf("expected 12 characters, got %q", password)
+		}
+
+		for _, class := range []string{lowerChars, upperChars, digitChars, symbolChars} {
+			if !strings.ContainsAny(password, class) {
+				t.Fatalf("%q has no characters of %q", password, class)
+			}
+		}
+
+		if strings.ContainsAny(password, ambiguousChars) {
+			t.Fatalf("%q has ambiguous characters", password)
+		}
+	}
+}
+
+func TestGenerateClasses(t *testing.T) {
+	p, err := Parse("random 16 noupper nosymbols", DefaultPolicy)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	password, err := Generate(p)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if len(password) != 16 || strings.ContainsAny(password, upperChars+symbolChars) {
+		t.Fatalf("unexpected password %q", password)
+	}
+}
+
+func TestGeneratePronounceable(t *testing.T) {
+	p, err := Parse("pronounceable 10", DefaultPolicy)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	password, err := Generate(p)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if len(password) != 10 {
+		t.Fatalf("expected 10 characters, got %q", password)
+	}
+
+	if !strings.ContainsAny(password[:1], upperChars) || !strings.ContainsAny(password[1:2], vowels) ||
+		!strings.ContainsAny(password[8:9], digitChars) || !strings.ContainsAny(password[9:], symbolChars) {
+		t.Fatalf("unexpected password %q", password)
+	}
+}
+
+func TestGeneratePassphrase(t *testing.T) {
+	p, err := Parse("phrase 5 sep=. noupper nodigits", DefaultPolicy)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	phrase, err := Generate(p)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	parts := strings.Split(phrase, ".")
+	if len(parts) != 5 {
+		t.Fatalf("expected 5 words, got %q", phrase)
+	}
+
+	known := make(map[string]bool, len(words))
+	for _, w := range words {
+		known[w] = true
+	}
+
+	for _, part := range parts {
+		if !known[part] {
+			t.Fatalf("%q is not in the wordlist", part)
+		}
+	}
+}
+
+func TestWordlist(t *testing.T) {
+	seen := make(map[string]bool, len(words))
+
+	for _, w := range words {
+		if seen[w] {
+			t.Fatalf("%q is listed twice", w)
+		}
+		seen[w] = true
+	}
+
+	// At least 10 bits per word
+	if len(words) < 1024 {
+		t.Fatalf("expected at least 1024 words, got %d", len(words))
+	}
+}
+
+func TestParseString(t *testing.T) {
+	for _, options := range []string{
+		"random 20",
+		"random 32 nosymbols noambiguous",
+		"pronounceable 14 nodigits",
+		"passphrase 7 sep=_ noupper",
+	} {
+		p, err := Parse(options, DefaultPolicy)
+		if err != nil {
+			t.Fatalf("%q: unexpected error: %s", options, err)
+		}
+
+		if p.String() != options {
+			t.Errorf("expected %q, got %q", options, p.String())
+		}
+	}
+
+	for _, invalid := range []string{"4", "random 500", "phrase 2", "nolower noupper nodigits nosymbols", "purple"} {
+		if _, err := Parse(invalid, DefaultPolicy); !errors.Is(err, ErrInvalidPolicy) {
+			t.Errorf("%q: expected ErrInvalidPolicy, got %v", invalid, err)
+		}
+	}
+}
+
+func TestEntropy(t *testing.T) {
+	// 6 words of at least 10 bits and 20 characters of at least 6 bits
+	for _, p := range []Policy{DefaultPolicy, {Mode: ModePassphrase, Words: 6}} {
+		if bits := p.Entropy(); bits < 60 {
+			t.Errorf("%s: expected at least 60 bits, got %.1f", p, bits)
+		}
+	}
+}
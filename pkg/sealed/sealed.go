@@ -0,0 +1,160 @@
+// Package sealed encrypts data with a passphrase in a small authenticated
+// format, so files leaving the bot can only be read and trusted by whoever
+// knows the passphrase.
+//
+// A sealed file starts with a header: the magic "PWSEALED", a version
+// byte, the scrypt cost as log2 N, r and p bytes, a 16 byte salt and a
+// 12 byte nonce. The rest is the data encrypted with AES-256-GCM under
+// the scrypt key of the passphrase, the header is authenticated with it.
+//
+// Streams too large to hold in memory are sealed by NewWriter with the
+// same header, version 2, followed by chunks encrypted one by one (see
+// stream.go).
+package sealed
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	magic   = "PWSEALED"
+	version = 1
+
+	saltSize  = 16
+	nonceSize = 12
+	keySize   = 32
+
+	headerSize = len(magic) + 4 + saltSize + nonceSize
+)
+
+var (
+	// ErrFormat is returned for data that isn't sealed by this package
+	ErrFormat = errors.New("not a sealed file")
+	// ErrPassphrase is returned when the data can't be opened with the
+	// passphrase, either because it's wrong or the data was changed
+	ErrPassphrase = errors.New("wrong passphrase or damaged file")
+)
+
+// Cost is the scrypt cost of deriving the key.
+type Cost struct {
+	LogN uint8
+	R, P uint8
+}
+
+// DefaultCost takes about a hundred milliseconds and 32 MB.
+var DefaultCost = Cost{LogN: 15, R: 8, P: 1}
+
+// Limits of the scrypt cost keep opening a crafted file from taking more
+// than 1 GB of memory, which is 128·r·N bytes, and a few seconds: p
+// multiplies the work.
+const (
+	maxLogN = 20
+	maxR    = 8
+	maxP    = 4
+)
+
+func (c Cost) valid() bool {
+	return c.LogN != 0 && c.LogN <= maxLogN && c.R != 0 && c.R <= maxR && c.P != 0 && c.P <= maxP
+}
+
+// Seal encrypts data with the passphrase at the default cost.
+func Seal(data []byte, passphrase string) ([]byte, error) {
+	return SealCost(data, passphrase, DefaultCost)
+}
+
+// SealCost encrypts data with the passphrase at the cost.
+func SealCost(data []byte, passphrase string, cost Cost) ([]byte, error) {
+	header, err := newHeader(version, cost)
+	if err != nil {
+		return nil, err
+	}
+
+	gcm, err := newGCM(passphrase, header)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := header[headerSize-nonceSize:]
+
+	return gcm.Seal(header, nonce, data, header), nil
+}
+
+// Open decrypts data sealed with the passphrase.
+func Open(sealed []byte, passphrase string) ([]byte, error) {
+	if !IsSealed(sealed) {
+		return nil, ErrFormat
+	}
+
+	if sealed[len(magic)] != version {
+		return nil, fmt.Errorf("%w: version %d", ErrFormat, sealed[len(magic)])
+	}
+
+	header := sealed[:headerSize]
+
+	gcm, err := newGCM(passphrase, header)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := gcm.Open(nil, header[headerSize-nonceSize:], sealed[headerSize:], header)
+	if err != nil {
+		return nil, ErrPassphrase
+	}
+
+	return data, nil
+}
+
+// IsSealed reports whether data starts with a sealed header.
+func IsSealed(data []byte) bool {
+	return len(data) >= headerSize && bytes.HasPrefix(data, []byte(magic))
+}
+
+// newHeader returns a header of the version with the cost, a random salt
+// and a random nonce.
+func newHeader(v byte, cost Cost) ([]byte, error) {
+	if !cost.valid() {
+		return nil, fmt.Errorf("invalid scrypt cost %+v", cost)
+	}
+
+	header := make([]byte, 0, headerSize)
+	header = append(header, magic...)
+	header = append(header, v, cost.LogN, cost.R, cost.P)
+
+	random := make([]byte, saltSize+nonceSize)
+	if _, err := rand.Read(random); err != nil {
+		return nil, err
+	}
+
+	return append(header, random...), nil
+}
+
+// newGCM derives the key of the passphrase with the cost and salt of the header.
+func newGCM(passphrase string, header []byte) (cipher.AEAD, error) {
+	params := header[len(magic)+1:]
+	cost := Cost{LogN: params[0], R: params[1], P: params[2]}
+
+	if !cost.valid() {
+		return nil, fmt.Errorf("%w: scrypt cost %+v", ErrFormat, cost)
+	}
+
+	salt := header[len(magic)+4 : len(magic)+4+saltSize]
+
+	key, err := scrypt.Key([]byte(passphrase), salt, 1<<cost.LogN, int(cost.R), int(cost.P), keySize)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,136 @@
+package sealed
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+// testCost keeps the tests fast
+var testCost = Cost{LogN: 10, R: 8, P: 1}
+
+func TestSealOpen(t *testing.T) {
+	data := []byte(`{"items":[{"name":"github","password":"secret"}]}`)
+
+	sealed, err := SealCost(data, "correct horse battery staple", testCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if bytes.Contains(sealed, []byte("secret")) {
+		t.Fatal("sealed data contains the plaintext")
+	}
+
+	if !IsSealed(sealed) {
+		t.Fatal("sealed data isn't recognized")
+	}
+
+	opened, err := Open(sealed, "correct horse battery staple")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(opened, data) {
+		t.Fatalf("expected %q, got %q", data, opened)
+	}
+}
+
+func TestSealRandomized(t *testing.T) {
+	first, err := SealCost([]byte("data"), "passphrase", testCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	second, err := SealCost([]byte("data"), "passphrase", testCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if bytes.Equal(first, second) {
+		t.Fatal("sealing twice gave the same output")
+	}
+}
+
+func TestOpenWrongPassphrase(t *testing.T) {
+	sealed, err := SealCost([]byte("data"), "passphrase", testCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = Open(sealed, "Passphrase"); !errors.Is(err, ErrPassphrase) {
+		t.Fatalf("expected ErrPassphrase, got %v", err)
+	}
+}
+
+func TestOpenTampered(t *testing.T) {
+	sealed, err := SealCost([]byte("data"), "passphrase", testCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Changing the salt in the header or the ciphertext is detected
+	for _, i := range []int{headerSize - nonceSize - 1, len(sealed) - 1} {
+		tampered := append([]byte(nil), sealed...)
+		tampered[i] ^= 1
+
+		if _, err = Open(tampered, "passphrase"); !errors.Is(err, ErrPassphrase) {
+			t.Fatalf("byte %d: expected ErrPassphrase, got %v", i, err)
+		}
+	}
+}
+
+func TestOpenInvalid(t *testing.T) {
+	sealed, err := SealCost([]byte("data"), "passphrase", testCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expensive := append([]byte(nil), sealed...)
+	expensive[len(magic)+1] = 40
+
+	// Each of r and p over its limit
+	largeR := append([]byte(nil), sealed...)
+	largeR[len(magic)+2] = maxR + 1
+
+	largeP := append([]byte(nil), sealed...)
+	largeP[len(magic)+3] = 255
+
+	newer := append([]byte(nil), sealed...)
+	newer[len(magic)] = version + 1
+
+	tests := map[string][]byte{
+		"empty":     nil,
+		"plaintext": []byte(`{"items":[]}`),
+		"truncated": sealed[:headerSize-1],
+		"expensive": expensive,
+		"large r":   largeR,
+		"large p":   largeP,
+		"newer":     newer,
+	}
+
+	for name, data := range tests {
+		if _, err = Open(data, "passphrase"); !errors.Is(err, ErrFormat) {
+			t.Errorf("%s: expected ErrFormat, got %v", name, err)
+		}
+	}
+}
+
+func TestSealCostLimits(t *testing.T) {
+	for _, cost := range []Cost{
+		{LogN: 0, R: 8, P: 1},
+		{LogN: maxLogN + 1, R: 8, P: 1},
+		{LogN: 10, R: 0, P: 1},
+		{LogN: 10, R: maxR + 1, P: 1},
+		{LogN: 10, R: 8, P: 0},
+		{LogN: 10, R: 8, P: maxP + 1},
+	} {
+		if _, err := SealCost([]byte("data"), "passphrase", cost); err == nil {
+			t.Errorf("%+v: expected an error", cost)
+		}
+
+		if _, err := NewWriter(io.Discard, "passphrase", cost); err == nil {
+			t.Errorf("%+v: expected an error from NewWriter", cost)
+		}
+	}
+}
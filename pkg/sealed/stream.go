@@ -0,0 +1,236 @@
+package sealed
+
+import (
+	"bufio"
+	"crypto/cipher"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// A sealed stream is a header of streamVersion followed by chunks. A chunk
+// is a 4 byte big-endian length of its plaintext, with the top bit set on
+// the last chunk, and the plaintext encrypted with the nonce of the header
+// XORed with the index of the chunk. The header and the length are
+// authenticated with each chunk, so chunks can't be reordered, dropped or
+// cut off after the last one.
+const (
+	streamVersion = 2
+
+	chunkSize = 64 << 10
+	lastChunk = 1 << 31
+)
+
+// Writer seals what is written to it in chunks, Close seals the last one.
+type Writer struct {
+	w      io.Writer
+	gcm    cipher.AEAD
+	header []byte
+	buf    []byte
+	index  uint32
+	err    error
+}
+
+// NewWriter writes the header of a sealed stream to w and returns a writer
+// sealing the data written to it with the passphrase at the cost.
+func NewWriter(w io.Writer, passphrase string, cost Cost) (*Writer, error) {
+	header, err := newHeader(streamVersion, cost)
+	if err != nil {
+		return nil, err
+	}
+
+	gcm, err := newGCM(passphrase, header)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err = w.Write(header); err != nil {
+		return nil, err
+	}
+
+	return &Writer{
+		w:      w,
+		gcm:    gcm,
+		header: header,
+		buf:    make([]byte, 0, chunkSize),
+	}, nil
+}
+
+func (s *Writer) Write(p []byte) (int, error) {
+	if s.err != nil {
+		return 0, s.err
+	}
+
+	written := 0
+	for len(p) > 0 {
+		// A full chunk is kept until more data comes, so the last one is
+		// never empty unless the stream is
+		if len(s.buf) == chunkSize {
+			if s.err = s.seal(false); s.err != nil {
+				return written, s.err
+			}
+		}
+
+		n := copy(s.buf[len(s.buf):chunkSize], p)
+		s.buf = s.buf[:len(s.buf)+n]
+		p = p[n:]
+		written += n
+	}
+
+	return written, nil
+}
+
+// Close seals the last chunk, it doesn't close the underlying writer.
+func (s *Writer) Close() error {
+	if s.err != nil {
+		return s.err
+	}
+
+	if s.err = s.seal(true); s.err != nil {
+		return s.err
+	}
+
+	s.err = errors.New("sealed: write to a closed writer")
+
+	return nil
+}
+
+func (s *Writer) seal(last bool) error {
+	if s.index == math.MaxUint32 {
+		return errors.New("sealed: stream too long")
+	}
+
+	length := uint32(len(s.buf))
+	if last {
+		length |= lastChunk
+	}
+
+	prefix := binary.BigEndian.AppendUint32(nil, length)
+	chunk := s.gcm.Seal(prefix, chunkNonce(s.header, s.index), s.buf, chunkData(s.header, prefix))
+
+	if _, err := s.w.Write(chunk); err != nil {
+		return err
+	}
+
+	s.buf = s.buf[:0]
+	s.index++
+
+	return nil
+}
+
+// Reader opens a sealed stream.
+type Reader struct {
+	r      *bufio.Reader
+	gcm    cipher.AEAD
+	header []byte
+	buf    []byte
+	index  uint32
+	last   bool
+}
+
+// NewReader reads the header of a sealed stream from r and opens its first
+// chunk, so a wrong passphrase is reported here rather than by Read.
+func NewReader(r io.Reader, passphrase string) (*Reader, error) {
+	br := bufio.NewReader(r)
+
+	header := make([]byte, headerSize)
+	if _, err := io.ReadFull(br, header); err != nil || !IsSealed(header) {
+		return nil, ErrFormat
+	}
+
+	if header[len(magic)] != streamVersion {
+		return nil, fmt.Errorf("%w: version %d isn't a stream", ErrFormat, header[len(magic)])
+	}
+
+	gcm, err := newGCM(passphrase, header)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Reader{r: br, gcm: gcm, header: header}
+	if err = s.open(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (s *Reader) Read(p []byte) (int, error) {
+	for len(s.buf) == 0 {
+		if s.last {
+			// Data after the last chunk wasn't sealed with the stream
+			_, err := s.r.ReadByte()
+			switch {
+			case err == nil:
+				return 0, fmt.Errorf("%w: data after the end of the stream", ErrFormat)
+			case err != io.EOF:
+				return 0, err
+			}
+
+			return 0, io.EOF
+		}
+
+		if err := s.open(); err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, s.buf)
+	s.buf = s.buf[n:]
+
+	return n, nil
+}
+
+// open reads and decrypts the next chunk. A stream cut off before its last
+// chunk is as damaged as a changed one.
+func (s *Reader) open() error {
+	prefix := make([]byte, 4)
+	if _, err := io.ReadFull(s.r, prefix); err != nil {
+		return readError(err)
+	}
+
+	length := binary.BigEndian.Uint32(prefix)
+	if length&^lastChunk > chunkSize {
+		return ErrPassphrase
+	}
+
+	chunk := make([]byte, int(length&^lastChunk)+s.gcm.Overhead())
+	if _, err := io.ReadFull(s.r, chunk); err != nil {
+		return readError(err)
+	}
+
+	plaintext, err := s.gcm.Open(chunk[:0], chunkNonce(s.header, s.index), chunk, chunkData(s.header, prefix))
+	if err != nil {
+		return ErrPassphrase
+	}
+
+	s.buf = plaintext
+	s.last = length&lastChunk != 0
+	s.index++
+
+	return nil
+}
+
+func readError(err error) error {
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return ErrPassphrase
+	}
+
+	return err
+}
+
+// chunkNonce returns the nonce of the header XORed with the chunk index.
+func chunkNonce(header []byte, index uint32) []byte {
+	nonce := append([]byte(nil), header[headerSize-nonceSize:]...)
+
+	tail := nonce[nonceSize-4:]
+	binary.BigEndian.PutUint32(tail, binary.BigEndian.Uint32(tail)^index)
+
+	return nonce
+}
+
+func chunkData(header, prefix []byte) []byte {
+	return append(append(make([]byte, 0, len(header)+len(prefix)), header...), prefix...)
+}
@@ -0,0 +1,122 @@
+package sealed
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+func sealStream(t *testing.T, data []byte, passphrase string) []byte {
+	t.Helper()
+
+	var out bytes.Buffer
+
+	w, err := NewWriter(&out, passphrase, testCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Uneven writes cross chunk boundaries
+	for len(data) > 0 {
+		n := 10000
+		if n > len(data) {
+			n = len(data)
+		}
+
+		if _, err = w.Write(data[:n]); err != nil {
+			t.Fatal(err)
+		}
+		data = data[n:]
+	}
+
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return out.Bytes()
+}
+
+func openStream(sealed []byte, passphrase string) ([]byte, error) {
+	r, err := NewReader(bytes.NewReader(sealed), passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	return io.ReadAll(r)
+}
+
+func TestStream(t *testing.T) {
+	sizes := []int{0, 1, chunkSize - 1, chunkSize, chunkSize + 1, 3*chunkSize + 12345}
+
+	for _, size := range sizes {
+		data := bytes.Repeat([]byte("secret!"), size/7+1)[:size]
+
+		sealed := sealStream(t, data, "passphrase")
+		if size > 0 && bytes.Contains(sealed, []byte("secret!")) {
+			t.Fatalf("%d bytes: sealed stream contains the plaintext", size)
+		}
+
+		opened, err := openStream(sealed, "passphrase")
+		if err != nil {
+			t.Fatalf("%d bytes: %v", size, err)
+		}
+
+		if !bytes.Equal(opened, data) {
+			t.Fatalf("%d bytes: opened %d different bytes", size, len(opened))
+		}
+	}
+}
+
+func TestStreamDamaged(t *testing.T) {
+	data := bytes.Repeat([]byte{42}, 2*chunkSize+100)
+	sealed := sealStream(t, data, "passphrase")
+
+	// Each chunk takes its length, the data and the GCM tag
+	chunk := 4 + chunkSize + 16
+
+	flipped := append([]byte(nil), sealed...)
+	flipped[headerSize+chunk+100] ^= 1
+
+	// The second chunk swapped with the first
+	swapped := append([]byte(nil), sealed[:headerSize]...)
+	swapped = append(swapped, sealed[headerSize+chunk:headerSize+2*chunk]...)
+	swapped = append(swapped, sealed[headerSize:headerSize+chunk]...)
+	swapped = append(swapped, sealed[headerSize+2*chunk:]...)
+
+	tests := map[string]struct {
+		data []byte
+		err  error
+	}{
+		"wrong passphrase": {sealed, ErrPassphrase},
+		"flipped bit":      {flipped, ErrPassphrase},
+		"swapped chunks":   {swapped, ErrPassphrase},
+		"cut at a chunk":   {sealed[:headerSize+2*chunk], ErrPassphrase},
+		"cut in a chunk":   {sealed[:len(sealed)-1], ErrPassphrase},
+		"trailing data":    {append(append([]byte(nil), sealed...), 0), ErrFormat},
+		"not a stream":     {mustSeal(t, data), ErrFormat},
+		"empty":            {nil, ErrFormat},
+	}
+
+	for name, tt := range tests {
+		passphrase := "passphrase"
+		if name == "wrong passphrase" {
+			passphrase = "Passphrase"
+		}
+
+		if _, err := openStream(tt.data, passphrase); !errors.Is(err, tt.err) {
+			t.Errorf("%s: expected %v, got %v", name, tt.err, err)
+		}
+	}
+}
+
+func mustSeal(t *testing.T, data []byte) []byte {
+	t.Helper()
+
+	sealed, err := SealCost(data, "passphrase", testCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return sealed
+}
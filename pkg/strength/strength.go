@@ -0,0 +1,395 @@
+// Package strength estimates how hard a password is to guess, offline.
+//
+// A password is split into the cheapest sequence of parts an attacker
+// would try: common passwords and words, names taken from the account,
+// keyboard walks, sequences, repeats and years, with the rest guessed
+// character by character. The estimate is the entropy of that sequence.
+package strength
+
+import (
+	_ "embed"
+	"fmt"
+	"math"
+	"strings"
+	"unicode"
+)
+
+// Score rates a password. The zero value means it wasn't estimated.
+type Score int
+
+const (
+	Unknown Score = iota
+	VeryWeak
+	Weak
+	Fair
+	Strong
+	VeryStrong
+)
+
+var scoreNames = map[Score]string{
+	Unknown:    "unknown",
+	VeryWeak:   "very weak",
+	Weak:       "weak",
+	Fair:       "fair",
+	Strong:     "strong",
+	VeryStrong: "very strong",
+}
+
+func (s Score) String() string {
+	return scoreNames[s]
+}
+
+// MinLength is the length below which a password is weak whatever it contains.
+const MinLength = 8
+
+// Result is the estimate of a password.
+type Result struct {
+	Score Score
+	// Entropy is the estimated number of guesses as bits
+	Entropy float64
+	// Warnings explain what makes the password easier to guess
+	Warnings []string
+}
+
+// Weak reports whether the password should be replaced.
+func (r Result) Weak() bool {
+	return r.Score <= Weak
+}
+
+//go:embed common.txt
+var common string
+
+// ranks are positions of common passwords and words, most used first
+var ranks = func() map[string]int {
+	words := strings.Fields(common)
+	ranks := make(map[string]int, len(words))
+	for i, w := range words {
+		ranks[w] = i + 1
+	}
+
+	return ranks
+}()
+
+// keyboardRows are rows of a US keyboard, unshifted and shifted.
+var keyboardRows = []string{
+	"`1234567890-=", "qwertyuiop[]\\", "asdfghjkl;'", "zxcvbnm,./",
+	"~!@#$%^&*()_+", "QWERTYUIOP{}|", "ASDFGHJKL:\"", "ZXCVBNM<>?",
+}
+
+// leet are common substitutions of letters.
+var leet = map[rune]rune{
+	'4': 'a', '@': 'a', '8': 'b', '3': 'e', '6': 'g', '1': 'i', '!': 'i',
+	'0': 'o', '$': 's', '5': 's', '7': 't', '+': 't', '2': 'z',
+}
+
+// part is a guessable part [start, end) of the password.
+type part struct {
+	start, end int
+	bits       float64
+	warning    string
+}
+
+// Estimate rates password. Inputs are things an attacker knows about the
+// account, such as its username and service name.
+func Estimate(password string, inputs ...string) Result {
+	runes := []rune(password)
+	if len(runes) == 0 {
+		return Result{Score: VeryWeak, Warnings: []string{"The password is empty"}}
+	}
+
+	var parts []part
+	parts = append(parts, dictionaryParts(runes, inputs)...)
+	parts = append(parts, keyboardParts(runes)...)
+	parts = append(parts, sequenceParts(runes)...)
+	parts = append(parts, repeatParts(runes)...)
+	parts = append(parts, yearParts(runes)...)
+
+	bruteForce := math.Log2(float64(cardinality(runes)))
+
+	// best[i] is the cheapest way to guess the first i runes
+	best := make([]float64, len(runes)+1)
+	via := make([]*part, len(runes)+1)
+
+	for i := 1; i <= len(runes); i++ {
+		best[i] = best[i-1] + bruteForce
+
+		for j := range parts {
+			p := &parts[j]
+			if p.end == i && best[p.start]+p.bits < best[i] {
+				best[i] = best[p.start] + p.bits
+				via[i] = p
+			}
+		}
+	}
+
+	result := Result{Entropy: best[len(runes)]}
+
+	seen := make(map[string]bool)
+	for i := len(runes); i > 0; {
+		p := via[i]
+		if p == nil {
+			i--
+			continue
+		}
+
+		if !seen[p.warning] {
+			seen[p.warning] = true
+			result.Warnings = append([]string{p.warning}, result.Warnings...)
+		}
+		i = p.start
+	}
+
+	result.Score = scoreOf(result.Entropy)
+
+	if len(runes) < MinLength {
+		result.Warnings = append(result.Warnings, fmt.Sprintf("It's shorter than %d characters", MinLength))
+		if result.Score > Weak {
+			result.Score = Weak
+		}
+	}
+
+	return result
+}
+
+func scoreOf(bits float64) Score {
+	switch {
+	case bits < 28:
+		return VeryWeak
+	case bits < 40:
+		return Weak
+	case bits < 60:
+		return Fair
+	case bits < 80:
+		return Strong
+	default:
+		return VeryStrong
+	}
+}
+
+// cardinality is the number of characters of the classes used in the password.
+func cardinality(runes []rune) int {
+	var lower, upper, digits, symbols, other bool
+
+	for _, r := range runes {
+		switch {
+		case r >= 'a' && r <= 'z':
+			lower = true
+		case r >= 'A' && r <= 'Z':
+			upper = true
+		case r >= '0' && r <= '9':
+			digits = true
+		case r < unicode.MaxASCII:
+			symbols = true
+		default:
+			other = true
+		}
+	}
+
+	n := 0
+	for _, class := range []struct {
+		used bool
+		size int
+	}{{lower, 26}, {upper, 26}, {digits, 10}, {symbols, 33}, {other, 100}} {
+		if class.used {
+			n += class.size
+		}
+	}
+
+	return n
+}
+
+// dictionaryParts finds common passwords, words and inputs, also
+// capitalized and with letters substituted by look-alike digits.
+func dictionaryParts(runes []rune, inputs []string) []part {
+	names := make(map[string]bool)
+	for _, input := range inputs {
+		input = strings.ToLower(input)
+		names[input] = true
+
+		// john.doe@example.com is guessed as john, doe and example too
+		for _, word := range strings.FieldsFunc(input, func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		}) {
+			names[word] = true
+		}
+	}
+
+	var parts []part
+
+	for i := range runes {
+		for j := i + 3; j <= len(runes); j++ {
+			raw := string(runes[i:j])
+			lower := strings.ToLower(raw)
+			unleet := strings.Map(func(r rune) rune {
+				if l, ok := leet[r]; ok {
+					return l
+				}
+
+				return r
+			}, lower)
+
+			bits := caseBits(runes[i:j])
+			if unleet != lower {
+				bits++
+			}
+
+			whole := i == 0 && j == len(runes)
+
+			switch {
+			case names[lower] || names[unleet]:
+				parts = append(parts, part{i, j, 1 + bits, fmt.Sprintf("It contains %q, which is part of the account", raw)})
+			case ranks[lower] > 0:
+				parts = append(parts, wordPart(i, j, ranks[lower], bits, raw, whole))
+			case ranks[unleet] > 0:
+				parts = append(parts, wordPart(i, j, ranks[unleet], bits, raw, whole))
+			}
+		}
+	}
+
+	return parts
+}
+
+func wordPart(start, end, rank int, bits float64, raw string, whole bool) part {
+	warning := fmt.Sprintf("It contains the common word %q", raw)
+	if whole {
+		warning = "It's one of the most common passwords"
+	}
+
+	return part{start, end, math.Log2(float64(rank)+1) + bits, warning}
+}
+
+// caseBits are the guesses added by capitalization: none for lowercase,
+// one bit for a capital first letter or all capitals, a bit per letter
+// otherwise.
+func caseBits(runes []rune) float64 {
+	var upper, letters int
+	for _, r := range runes {
+		if unicode.IsLetter(r) {
+			letters++
+			if unicode.IsUpper(r) {
+				upper++
+			}
+		}
+	}
+
+	switch {
+	case upper == 0:
+		return 0
+	case upper == letters || (upper == 1 && unicode.IsUpper(runes[0])):
+		return 1
+	default:
+		return float64(letters)
+	}
+}
+
+// keyboardParts finds walks of 4 or more adjacent keys of a row, like qwer or 7890.
+func keyboardParts(runes []rune) []part {
+	var parts []part
+
+	for i := 0; i < len(runes); {
+		j := i + 1
+		for j < len(runes) && adjacentKeys(runes[j-1], runes[j]) {
+			j++
+		}
+
+		if j-i >= 4 {
+			// A starting key, then a direction per key
+			bits := math.Log2(47) + float64(j-i-1)
+			parts = append(parts, part{i, j, bits, fmt.Sprintf("Keyboard patterns like %q are easy to guess", string(runes[i:j]))})
+		}
+
+		i = j
+	}
+
+	return parts
+}
+
+func adjacentKeys(a, b rune) bool {
+	for _, row := range keyboardRows {
+		i, j := strings.IndexRune(row, a), strings.IndexRune(row, b)
+		if i >= 0 && j >= 0 && (i-j == 1 || j-i == 1) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// sequenceParts finds runs of 3 or more characters with the same step, like abc or 9753.
+func sequenceParts(runes []rune) []part {
+	var parts []part
+
+	for i := 0; i+2 < len(runes); {
+		step := runes[i+1] - runes[i]
+		if step == 0 || step > 2 || step < -2 {
+			i++
+			continue
+		}
+
+		j := i + 2
+		for j < len(runes) && runes[j]-runes[j-1] == step {
+			j++
+		}
+
+		if j-i >= 3 {
+			bits := math.Log2(26) + 1 + math.Log2(float64(j-i))
+			parts = append(parts, part{i, j, bits, fmt.Sprintf("Sequences like %q are easy to guess", string(runes[i:j]))})
+			i = j - 1
+			continue
+		}
+
+		i++
+	}
+
+	return parts
+}
+
+// repeatParts finds a character or a group of characters repeated, like aaa or abcabc.
+func repeatParts(runes []rune) []part {
+	var parts []part
+
+	for size := 1; size <= len(runes)/2; size++ {
+		for i := 0; i+2*size <= len(runes); i++ {
+			count := 1
+			for i+(count+1)*size <= len(runes) &&
+				string(runes[i+count*size:i+(count+1)*size]) == string(runes[i:i+size]) {
+				count++
+			}
+
+			// Single characters count as repeated from three on
+			if count < 2 || (size == 1 && count < 3) {
+				continue
+			}
+
+			end := i + count*size
+			bits := float64(size)*math.Log2(float64(cardinality(runes[i:i+size]))) + math.Log2(float64(count))
+			parts = append(parts, part{i, end, bits, fmt.Sprintf("Repeats like %q are easy to guess", string(runes[i:end]))})
+		}
+	}
+
+	return parts
+}
+
+// yearParts finds years from 1900 to 2099.
+func yearParts(runes []rune) []part {
+	var parts []part
+
+	for i := 0; i+4 <= len(runes); i++ {
+		s := string(runes[i : i+4])
+		if (strings.HasPrefix(s, "19") || strings.HasPrefix(s, "20")) && isDigits(s) {
+			parts = append(parts, part{i, i + 4, math.Log2(200), "Years are easy to guess"})
+		}
+	}
+
+	return parts
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,68 @@
+package strength
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEstimateScore(t *testing.T) {
+	tests := []struct {
+		password string
+		inputs   []string
+		max      Score
+		min      Score
+	}{
+		{"123", nil, VeryWeak, VeryWeak},
+		{"password", nil, VeryWeak, VeryWeak},
+		{"P@ssw0rd", nil, VeryWeak, VeryWeak},
+		{"qwertyuiop", nil, VeryWeak, VeryWeak},
+		{"abcdefgh", nil, VeryWeak, VeryWeak},
+		{"aaaaaaaaaaaa", nil, VeryWeak, VeryWeak},
+		{"Octocat1987", []string{"octocat", "github"}, Weak, VeryWeak},
+		{"summer2024!", nil, Weak, VeryWeak},
+		{"correct-horse-battery-staple", nil, Fair, Weak},
+		{"k8#Vq2!mZx7@Lp4$", nil, VeryStrong, VeryStrong},
+		{"vivid-otter-lunar-gravy-brisk-oasis", nil, VeryStrong, Strong},
+	}
+
+	for _, tt := range tests {
+		r := Estimate(tt.password, tt.inputs...)
+		if r.Score < tt.min || r.Score > tt.max {
+			t.Errorf("%q: expected %s to %s, got %s (%.1f bits, %v)", tt.password, tt.min, tt.max, r.Score, r.Entropy, r.Warnings)
+		}
+	}
+}
+
+func TestEstimateWarnings(t *testing.T) {
+	tests := []struct {
+		password string
+		inputs   []string
+		warning  string
+	}{
+		{"123456", nil, "most common passwords"},
+		{"Dragonfly#42xq", nil, "common word \"Dragon\""},
+		{"asdf-Tq9!-Kx2z", nil, "Keyboard patterns like \"asdf\""},
+		{"xK!9mabcdeQ", nil, "Sequences like \"abcde\""},
+		{"xK!9mQ1990zp", nil, "Years"},
+		{"xK!9mQzzzzp", nil, "Repeats like \"zzzz\""},
+		{"JohnDoe!x9Qw", []string{"john.doe@example.com"}, "part of the account"},
+		{"xK!9", nil, "shorter than 8"},
+	}
+
+	for _, tt := range tests {
+		r := Estimate(tt.password, tt.inputs...)
+		if !strings.Contains(strings.Join(r.Warnings, "\n"), tt.warning) {
+			t.Errorf("%q: expected a warning about %q, got %v", tt.password, tt.warning, r.Warnings)
+		}
+	}
+}
+
+func TestWeak(t *testing.T) {
+	if !Estimate("letmein").Weak() {
+		t.Error("expected letmein to be weak")
+	}
+
+	if Estimate("Gq7$mW2!xR9#vL4&").Weak() {
+		t.Error("expected a random password not to be weak")
+	}
+}
@@ -0,0 +1,187 @@
+// Package totp generates RFC 6238 time-based one-time passwords.
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultDigits = 6
+	defaultPeriod = 30 * time.Second
+)
+
+var ErrInvalidKey = errors.New("invalid TOTP secret")
+
+// Key is a shared TOTP secret with its parameters.
+type Key struct {
+	Secret []byte
+	// Digits of a code, 6 to 8
+	Digits int
+	Period time.Duration
+	// Algorithm is SHA1, SHA256 or SHA512
+	Algorithm string
+	Issuer    string
+	Account   string
+}
+
+// Parse reads a base32 secret, as shown by sites next to their QR codes,
+// or an otpauth://totp/ URI.
+func Parse(s string) (Key, error) {
+	s = strings.TrimSpace(s)
+
+	if strings.HasPrefix(strings.ToLower(s), "otpauth://") {
+		return parseURI(s)
+	}
+
+	secret, err := decodeSecret(s)
+	if err != nil {
+		return Key{}, err
+	}
+
+	return Key{
+		Secret:    secret,
+		Digits:    defaultDigits,
+		Period:    defaultPeriod,
+		Algorithm: "SHA1",
+	}, nil
+}
+
+func parseURI(s string) (Key, error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return Key{}, fmt.Errorf("%w: %s", ErrInvalidKey, err)
+	}
+
+	if !strings.EqualFold(u.Host, "totp") {
+		return Key{}, fmt.Errorf("%w: only totp URIs are supported", ErrInvalidKey)
+	}
+
+	query := u.Query()
+
+	key, err := Parse(query.Get("secret"))
+	if err != nil {
+		return Key{}, err
+	}
+
+	label := strings.TrimPrefix(u.Path, "/")
+	if issuer, account, ok := strings.Cut(label, ":"); ok {
+		key.Issuer, key.Account = strings.TrimSpace(issuer), strings.TrimSpace(account)
+	} else {
+		key.Account = label
+	}
+
+	if issuer := query.Get("issuer"); issuer != "" {
+		key.Issuer = issuer
+	}
+
+	if v := query.Get("digits"); v != "" {
+		if key.Digits, err = strconv.Atoi(v); err != nil || key.Digits < 6 || key.Digits > 8 {
+			return Key{}, fmt.Errorf("%w: digits must be 6 to 8", ErrInvalidKey)
+		}
+	}
+
+	if v := query.Get("period"); v != "" {
+		seconds, err := strconv.Atoi(v)
+		if err != nil || seconds <= 0 {
+			return Key{}, fmt.Errorf("%w: period must be a positive number of seconds", ErrInvalidKey)
+		}
+		key.Period = time.Duration(seconds) * time.Second
+	}
+
+	if v := query.Get("algorithm"); v != "" {
+		key.Algorithm = strings.ToUpper(v)
+		if newHash(key.Algorithm) == nil {
+			return Key{}, fmt.Errorf("%w: unsupported algorithm %s", ErrInvalidKey, v)
+		}
+	}
+
+	return key, nil
+}
+
+// decodeSecret accepts base32 in any case, with spaces and without padding.
+func decodeSecret(s string) ([]byte, error) {
+	s = strings.ToUpper(strings.NewReplacer(" ", "", "-", "").Replace(s))
+	s = strings.TrimRight(s, "=")
+
+	secret, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(s)
+	if err != nil || len(secret) == 0 {
+		return nil, fmt.Errorf("%w: expected base32", ErrInvalidKey)
+	}
+
+	return secret, nil
+}
+
+// URI returns the key as an otpauth URI that Parse reads back.
+func (k Key) URI() string {
+	label := k.Account
+	if k.Issuer != "" {
+		label = k.Issuer + ":" + k.Account
+	}
+
+	query := url.Values{}
+	query.Set("secret", base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(k.Secret))
+	query.Set("digits", strconv.Itoa(k.Digits))
+	query.Set("period", strconv.Itoa(int(k.Period/time.Second)))
+	query.Set("algorithm", k.Algorithm)
+	if k.Issuer != "" {
+		query.Set("issuer", k.Issuer)
+	}
+
+	u := url.URL{Scheme: "otpauth", Host: "totp", Path: "/" + label, RawQuery: query.Encode()}
+
+	return u.String()
+}
+
+// Code returns the code valid at t.
+func (k Key) Code(t time.Time) string {
+	counter := uint64(t.Unix()) / uint64(k.Period/time.Second)
+
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], counter)
+
+	mac := hmac.New(func() hash.Hash { return newHash(k.Algorithm) }, k.Secret)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:]) & 0x7fffffff
+
+	mod := uint32(1)
+	for i := 0; i < k.Digits; i++ {
+		mod *= 10
+	}
+
+	return fmt.Sprintf("%0*d", k.Digits, value%mod)
+}
+
+// Remaining returns how long the code valid at t stays valid.
+func (k Key) Remaining(t time.Time) time.Duration {
+	period := int64(k.Period / time.Second)
+
+	return time.Duration(period-t.Unix()%period) * time.Second
+}
+
+func newHash(algorithm string) hash.Hash {
+	switch algorithm {
+	case "SHA1":
+		return sha1.New()
+	case "SHA256":
+		return sha256.New()
+	case "SHA512":
+		return sha512.New()
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,96 @@
+package totp
+
+import (
+	"encoding/base32"
+	"errors"
+	"testing"
+	"time"
+)
+
+// Test vectors from RFC 6238, appendix B.
+func TestCodeRFC6238(t *testing.T) {
+	secrets := map[string]string{
+		"SHA1":   "12345678901234567890",
+		"SHA256": "12345678901234567890123456789012",
+		"SHA512": "1234567890123456789012345678901234567890123456789012345678901234",
+	}
+
+	tests := []struct {
+		time      int64
+		algorithm string
+		code      string
+	}{
+		{59, "SHA1", "94287082"},
+		{59, "SHA256", "46119246"},
+		{59, "SHA512", "90693936"},
+		{1111111109, "SHA1", "07081804"},
+		{1111111109, "SHA256", "68084774"},
+		{1111111109, "SHA512", "25091201"},
+		{1234567890, "SHA1", "89005924"},
+		{2000000000, "SHA256", "90698825"},
+		{20000000000, "SHA512", "47863826"},
+	}
+
+	for _, tt := range tests {
+		key := Key{
+			Secret:    []byte(secrets[tt.algorithm]),
+			Digits:    8,
+			Period:    30 * time.Second,
+			Algorithm: tt.algorithm,
+		}
+
+		if code := key.Code(time.Unix(tt.time, 0)); code != tt.code {
+			t.Errorf("%s at %d: expected %s, got %s", tt.algorithm, tt.time, tt.code, code)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	secret := base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+
+	key, err := Parse("gezd gnbv gy3t qojq gezd gnbv gy3t qojq")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if string(key.Secret) != "12345678901234567890" || key.Digits != 6 || key.Period != 30*time.Second {
+		t.Fatalf("unexpected key: %+v", key)
+	}
+
+	key, err = Parse("otpauth://totp/GitHub:octocat?secret=" + secret + "&digits=8&period=60&algorithm=sha256")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if key.Issuer != "GitHub" || key.Account != "octocat" || key.Digits != 8 ||
+		key.Period != time.Minute || key.Algorithm != "SHA256" {
+		t.Fatalf("unexpected key: %+v", key)
+	}
+
+	again, err := Parse(key.URI())
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if again.URI() != key.URI() {
+		t.Fatalf("expected %s, got %s", key.URI(), again.URI())
+	}
+
+	for _, invalid := range []string{"", "not base32!", "otpauth://hotp/x?secret=" + secret, "otpauth://totp/x?secret=" + secret + "&digits=4"} {
+		if _, err = Parse(invalid); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("%q: expected ErrInvalidKey, got %v", invalid, err)
+		}
+	}
+}
+
+func TestRemaining(t *testing.T) {
+	key := Key{Period: 30 * time.Second}
+
+	if r := key.Remaining(time.Unix(59, 0)); r != time.Second {
+		t.Fatalf("expected 1s, got %s", r)
+	}
+
+	if r := key.Remaining(time.Unix(60, 0)); r != 30*time.Second {
+		t.Fatalf("expected 30s, got %s", r)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/rand"
+	"errors"
 )
 
 func Encrypt(password, key string) (string, error) {
@@ -38,6 +39,10 @@ func Decrypt(passwordCrypt, key string) (string, error) {
 		return "", err
 	}
 
+	if len(passwordCrypt) < gcm.NonceSize() {
+		return "", errors.New("ciphertext too short")
+	}
+
 	nonce, ciphertext := passwordCrypt[:gcm.NonceSize()], passwordCrypt[gcm.NonceSize():]
 
 	plaintext, err := gcm.Open(nil, []byte(nonce), []byte(ciphertext), nil)